@@ -0,0 +1,245 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// LevelSetter is implemented by loggers whose level can be changed, such as
+// a logrus Logger or a kvlog Logger.
+type LevelSetter interface {
+	GetLevel() log.Level
+	SetLevel(level log.Level)
+}
+
+// AdminConfig represents a configuration function to be passed to
+// NewAdminHandler.
+type AdminConfig func(h *AdminHandler)
+
+// AdminLevel allows the level of l to be viewed and changed.
+func AdminLevel(l LevelSetter) AdminConfig {
+	return func(h *AdminHandler) {
+		h.logger = l
+	}
+}
+
+// AdminFormatter allows the package and component levels of cf, set by
+// WithPackageLevels and WithComponentLevels, to be viewed and changed.
+func AdminFormatter(cf *Formatter) AdminConfig {
+	return func(h *AdminHandler) {
+		h.cf = cf
+	}
+}
+
+// AdminSampler allows the sampling rates of s to be viewed and changed.
+func AdminSampler(s *Sampler) AdminConfig {
+	return func(h *AdminHandler) {
+		h.sampler = s
+	}
+}
+
+// AdminHandler is an http.Handler that shows the current logging
+// configuration and allows it to be changed without restarting the
+// program.
+//
+// eg.
+//
+//	http.Handle("/debug/kvlog", kvlog.NewAdminHandler(
+//	    kvlog.AdminLevel(logrus.StandardLogger()),
+//	    kvlog.AdminFormatter(formatter),
+//	    kvlog.AdminSampler(sampler)))
+//
+// A GET request returns the configuration as a JSON object:
+//
+//	{"level":"info","packages":{"github.com/example/app/cache":"warning"},
+//	 "components":{"db":"error"},"sample_rates":{"debug":100}}
+//
+// A POST request with an object of the same form changes the settings it
+// includes and returns the new configuration.  Package and component
+// entries are merged with those already set, and an empty level removes
+// an entry.  For example, to log debug entries for everything except the
+// cache package:
+//
+//	curl -H 'Content-Type: application/json' \
+//	    -d '{"level":"debug","packages":{"github.com/example/app/cache":"info"}}' \
+//	    http://localhost:6060/debug/kvlog
+//
+// A POST request must have a Content-Type of application/json, and one
+// with an Origin header must come from the handler's own host, so that a
+// web page can't change the settings through a user's browser.
+//
+// The handler performs no authentication.  It must not be exposed without
+// it: serve it only on an internal port, or wrap it in a handler that
+// checks the caller's credentials.
+type AdminHandler struct {
+	logger  LevelSetter
+	cf      *Formatter
+	sampler *Sampler
+	mu      sync.Mutex // serializes changes
+}
+
+// NewAdminHandler creates an AdminHandler for the loggers, formatters and
+// samplers given by cfgs.
+func NewAdminHandler(cfgs ...AdminConfig) *AdminHandler {
+	h := new(AdminHandler)
+	for _, cfg := range cfgs {
+		cfg(h)
+	}
+	return h
+}
+
+// adminConfig is the JSON form of the settings managed by an AdminHandler.
+type adminConfig struct {
+	Level       string            `json:"level,omitempty"`
+	Packages    map[string]string `json:"packages,omitempty"`
+	Components  map[string]string `json:"components,omitempty"`
+	SampleRates map[string]int    `json:"sample_rates,omitempty"`
+}
+
+// ServeHTTP implements http.Handler.
+func (h *AdminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET", "HEAD":
+	case "POST":
+		if mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || mt != "application/json" {
+			http.Error(w, "Content-Type must be application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if u, err := url.Parse(origin); err != nil || u.Host != r.Host {
+				http.Error(w, "cross-origin request not allowed", http.StatusForbidden)
+				return
+			}
+		}
+		var req adminConfig
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := h.update(req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.config())
+}
+
+// config returns the current settings.
+func (h *AdminHandler) config() adminConfig {
+	var c adminConfig
+	if h.logger != nil {
+		c.Level = levelName(h.logger.GetLevel())
+	}
+	if h.cf != nil {
+		c.Packages = levelNames(h.cf.PackageLevels())
+		c.Components = levelNames(h.cf.ComponentLevels())
+	}
+	if h.sampler != nil {
+		c.SampleRates = make(map[string]int)
+		for _, level := range log.AllLevels {
+			if n := h.sampler.Rate(level); n > 1 {
+				c.SampleRates[levelName(level)] = n
+			}
+		}
+	}
+	return c
+}
+
+// update applies the settings in req, after checking that they're all
+// valid.
+func (h *AdminHandler) update(req adminConfig) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var level log.Level
+	if req.Level != "" {
+		if h.logger == nil {
+			return fmt.Errorf("level can't be changed")
+		}
+		var err error
+		if level, err = log.ParseLevel(req.Level); err != nil {
+			return err
+		}
+	}
+	if (req.Packages != nil || req.Components != nil) && h.cf == nil {
+		return fmt.Errorf("package and component levels can't be changed")
+	}
+	var packages, components map[string]log.Level
+	var err error
+	if h.cf != nil {
+		if packages, err = mergeLevels(h.cf.PackageLevels(), req.Packages); err != nil {
+			return err
+		}
+		if components, err = mergeLevels(h.cf.ComponentLevels(), req.Components); err != nil {
+			return err
+		}
+	}
+	rates := make(map[log.Level]int)
+	if req.SampleRates != nil && h.sampler == nil {
+		return fmt.Errorf("sample rates can't be changed")
+	}
+	for name, n := range req.SampleRates {
+		level, err := log.ParseLevel(name)
+		if err != nil {
+			return err
+		}
+		if level <= log.WarnLevel || n < 0 {
+			return fmt.Errorf("invalid sample rate %d for %s", n, name)
+		}
+		rates[level] = n
+	}
+
+	if req.Level != "" {
+		h.logger.SetLevel(level)
+	}
+	if req.Packages != nil {
+		h.cf.SetPackageLevels(packages)
+	}
+	if req.Components != nil {
+		h.cf.SetComponentLevels(components)
+	}
+	for level, n := range rates {
+		h.sampler.SetRate(level, n)
+	}
+	return nil
+}
+
+// mergeLevels returns levels updated with the named levels in changes,
+// removing those set to an empty string.
+func mergeLevels(levels map[string]log.Level, changes map[string]string) (map[string]log.Level, error) {
+	for k, name := range changes {
+		if name == "" {
+			delete(levels, k)
+			continue
+		}
+		level, err := log.ParseLevel(name)
+		if err != nil {
+			return nil, err
+		}
+		levels[k] = level
+	}
+	return levels, nil
+}
+
+func levelNames(levels map[string]log.Level) map[string]string {
+	names := make(map[string]string, len(levels))
+	for k, level := range levels {
+		names[k] = levelName(level)
+	}
+	return names
+}
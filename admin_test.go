@@ -0,0 +1,123 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func adminRequest(t *testing.T, h http.Handler, method, body string) (int, string) {
+	req := httptest.NewRequest(method, "/debug/kvlog", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return serveAdmin(t, h, req)
+}
+
+func serveAdmin(t *testing.T, h http.Handler, req *http.Request) (int, string) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, req)
+	b, err := ioutil.ReadAll(w.Result().Body)
+	require.Nil(t, err)
+	return w.Code, strings.TrimSpace(string(b))
+}
+
+func TestAdminHandler(t *testing.T) {
+	logger := NewLogger(ioutil.Discard, nil)
+	cf := New(WithPackageLevels(map[string]log.Level{"github.com/example/cache": log.WarnLevel}))
+	sampler := NewSampler(ioutil.Discard, SampleRate(log.DebugLevel, 100))
+	h := NewAdminHandler(AdminLevel(logger), AdminFormatter(cf), AdminSampler(sampler))
+
+	code, body := adminRequest(t, h, "GET", "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"level":"info","packages":{"github.com/example/cache":"warning"},"sample_rates":{"debug":100}}`, body)
+
+	code, body = adminRequest(t, h, "POST", `{
+		"level": "debug",
+		"packages": {"github.com/example/cache": "", "github.com/example/db": "error"},
+		"components": {"auth": "warn"},
+		"sample_rates": {"debug": 10, "info": 2}
+	}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, `{"level":"debug","packages":{"github.com/example/db":"error"},"components":{"auth":"warning"},"sample_rates":{"debug":10,"info":2}}`, body)
+
+	assert.Equal(t, log.DebugLevel, logger.GetLevel())
+	assert.Equal(t, map[string]log.Level{"github.com/example/db": log.ErrorLevel}, cf.PackageLevels())
+	assert.Equal(t, map[string]log.Level{"auth": log.WarnLevel}, cf.ComponentLevels())
+	assert.Equal(t, 2, sampler.Rate(log.InfoLevel))
+}
+
+func TestAdminHandlerErrors(t *testing.T) {
+	logger := log.New()
+	h := NewAdminHandler(AdminLevel(logger))
+	tests := []struct {
+		name   string
+		method string
+		body   string
+		code   int
+	}{
+		{"bad-json", "POST", `{`, http.StatusBadRequest},
+		{"bad-level", "POST", `{"level":"loud"}`, http.StatusBadRequest},
+		{"no-formatter", "POST", `{"level":"debug","packages":{"x":"warn"}}`, http.StatusBadRequest},
+		{"no-sampler", "POST", `{"sample_rates":{"info":2}}`, http.StatusBadRequest},
+		{"method", "DELETE", ``, http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, _ := adminRequest(t, h, test.method, test.body)
+			assert.Equal(t, test.code, code)
+		})
+	}
+	// nothing is changed by a request that's partly invalid
+	assert.Equal(t, log.InfoLevel, logger.GetLevel())
+}
+
+func TestAdminHandlerCrossOrigin(t *testing.T) {
+	logger := log.New()
+	h := NewAdminHandler(AdminLevel(logger))
+	body := `{"level":"debug"}`
+	tests := []struct {
+		name        string
+		contentType string
+		origin      string
+		code        int
+	}{
+		{"form", "application/x-www-form-urlencoded", "", http.StatusUnsupportedMediaType},
+		{"text", "text/plain", "", http.StatusUnsupportedMediaType},
+		{"no-type", "", "", http.StatusUnsupportedMediaType},
+		{"other-origin", "application/json", "http://evil.example.com", http.StatusForbidden},
+		{"bad-origin", "application/json", "://", http.StatusForbidden},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/debug/kvlog", strings.NewReader(body))
+			if test.contentType != "" {
+				req.Header.Set("Content-Type", test.contentType)
+			}
+			if test.origin != "" {
+				req.Header.Set("Origin", test.origin)
+			}
+			code, _ := serveAdmin(t, h, req)
+			assert.Equal(t, test.code, code)
+		})
+	}
+	assert.Equal(t, log.InfoLevel, logger.GetLevel())
+
+	// a request from the handler's own host, with parameters on the type
+	req := httptest.NewRequest("POST", "http://localhost:6060/debug/kvlog", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Origin", "http://localhost:6060")
+	code, _ := serveAdmin(t, h, req)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, log.DebugLevel, logger.GetLevel())
+}
@@ -0,0 +1,181 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// Syncer is implemented by writers that can commit the data written to
+// them to stable storage, such as *os.File and RotatingFile.
+type Syncer interface {
+	io.Writer
+	Sync() error
+}
+
+// AuditConfig represents a configuration function to be passed to
+// NewAuditWriter.
+type AuditConfig func(a *AuditWriter)
+
+// AuditSyncDelay causes entries to be synced in batches rather than
+// individually, with each entry synced at most d after it was written.
+// Write then returns without waiting for the sync, so an entry may be lost
+// if power fails within d of it being written, in exchange for far fewer
+// syncs when many entries are written.
+func AuditSyncDelay(d time.Duration) AuditConfig {
+	return func(a *AuditWriter) {
+		a.delay = d
+	}
+}
+
+// AuditErrorHandler sets a function to be called when a sync fails.
+func AuditErrorHandler(f func(error)) AuditConfig {
+	return func(a *AuditWriter) {
+		a.onError = f
+	}
+}
+
+// AuditWriter is an io.Writer for audit and security logs that syncs each
+// entry to stable storage, so that entries survive a crash or power loss as
+// soon as they have been logged.
+//
+// eg.
+//
+//	f, err := os.OpenFile("audit.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+//	...
+//	defer f.Close()
+//	w := kvlog.NewAuditWriter(f, kvlog.AuditErrorHandler(alert))
+//	defer w.Close()
+//	auditLog := kvlog.NewLogger(w, kvlog.New())
+//
+// By default Write syncs before returning and returns any error from the
+// sync, so that a logging call doesn't return until the entry is durable.
+// AuditSyncDelay instead syncs in the background, bounding the time an
+// entry may remain unsynced.
+type AuditWriter struct {
+	out     Syncer
+	delay   time.Duration
+	onError func(error)
+
+	mu      sync.Mutex
+	dirty   bool // written since the last sync
+	closed  bool
+	kick    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewAuditWriter creates an AuditWriter that writes entries to out.
+func NewAuditWriter(out Syncer, cfgs ...AuditConfig) *AuditWriter {
+	a := &AuditWriter{
+		out:     out,
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	for _, cfg := range cfgs {
+		cfg(a)
+	}
+	if a.delay > 0 {
+		go a.run()
+	} else {
+		close(a.stopped)
+	}
+	RegisterShutdown(a)
+	return a
+}
+
+// Write implements io.Writer.
+func (a *AuditWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return 0, errWriterClosed
+	}
+	n, err := a.out.Write(p)
+	if err != nil {
+		return n, err
+	}
+	if a.delay > 0 {
+		if !a.dirty {
+			a.dirty = true
+			select {
+			case a.kick <- struct{}{}:
+			default:
+			}
+		}
+		return n, nil
+	}
+	return n, a.sync()
+}
+
+// Flush syncs any entries written since the last sync.
+func (a *AuditWriter) Flush() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.closed {
+		return nil
+	}
+	return a.sync()
+}
+
+// Close syncs any entries written since the last sync.  The underlying
+// writer is left open.
+func (a *AuditWriter) Close() error {
+	UnregisterShutdown(a)
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
+	a.closed = true
+	close(a.done)
+	err := a.sync()
+	a.mu.Unlock()
+	<-a.stopped
+	return err
+}
+
+func (a *AuditWriter) sync() error {
+	a.dirty = false
+	err := a.out.Sync()
+	if err != nil {
+		observeDeliveryError("audit", err)
+		sinkError(a.onError, err)
+	}
+	return err
+}
+
+// run syncs entries written with AuditSyncDelay, waiting the delay after
+// the first entry written since the last sync.
+func (a *AuditWriter) run() {
+	defer close(a.stopped)
+	timer := time.NewTimer(a.delay)
+	timer.Stop()
+	for {
+		select {
+		case <-a.kick:
+			timer.Reset(a.delay)
+			select {
+			case <-timer.C:
+			case <-a.done:
+				timer.Stop()
+				return
+			}
+			a.mu.Lock()
+			if !a.closed && a.dirty {
+				a.sync()
+			}
+			a.mu.Unlock()
+		case <-a.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,135 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+type syncRecorder struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	synced int // bytes written at the last sync
+	syncs  int
+	err    error
+	closed bool
+}
+
+func (s *syncRecorder) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *syncRecorder) Sync() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.syncs++
+	if s.err != nil {
+		return s.err
+	}
+	s.synced = s.buf.Len()
+	return nil
+}
+
+func (s *syncRecorder) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *syncRecorder) state() (syncs, synced int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.syncs, s.synced
+}
+
+func TestAuditWriter(t *testing.T) {
+	out := new(syncRecorder)
+	w := NewAuditWriter(out)
+
+	for i := 1; i <= 3; i++ {
+		_, err := w.Write([]byte("ll=\"info\" _msg=\"login\"\n"))
+		require.Nil(t, err)
+		syncs, synced := out.state()
+		assert.Equal(t, i, syncs)
+		assert.Equal(t, out.buf.Len(), synced)
+	}
+
+	require.Nil(t, w.Close())
+	assert.False(t, out.closed)
+	_, err := w.Write([]byte("x\n"))
+	assert.NotNil(t, err)
+}
+
+func TestAuditWriterError(t *testing.T) {
+	syncErr := errors.New("disk gone")
+	out := &syncRecorder{err: syncErr}
+	var handled []error
+	w := NewAuditWriter(out, AuditErrorHandler(func(err error) {
+		handled = append(handled, err)
+	}))
+	defer w.Close()
+
+	_, err := w.Write([]byte("x\n"))
+	assert.Equal(t, syncErr, err)
+	assert.Equal(t, []error{syncErr}, handled)
+}
+
+func TestAuditWriterSyncDelay(t *testing.T) {
+	out := new(syncRecorder)
+	w := NewAuditWriter(out, AuditSyncDelay(50*time.Millisecond))
+
+	for i := 0; i < 10; i++ {
+		_, err := w.Write([]byte("x\n"))
+		require.Nil(t, err)
+	}
+	syncs, _ := out.state()
+	assert.Equal(t, 0, syncs, "synced before delay")
+
+	assert.Eventually(t, func() bool {
+		syncs, synced := out.state()
+		return syncs == 1 && synced == 20
+	}, time.Second, 5*time.Millisecond)
+
+	// a later write starts a new batch, synced by Close
+	w.Write([]byte("y\n"))
+	require.Nil(t, w.Close())
+	syncs, synced := out.state()
+	assert.Equal(t, 2, syncs)
+	assert.Equal(t, 22, synced)
+}
+
+func TestAuditWriterRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	f, err := NewRotatingFile(path)
+	require.Nil(t, err)
+	w := NewAuditWriter(f)
+	_, err = w.Write([]byte("x=1\n"))
+	require.Nil(t, err)
+	require.Nil(t, w.Close())
+	require.Nil(t, f.Close())
+
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, "x=1\n", string(data))
+}
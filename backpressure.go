@@ -0,0 +1,135 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Overflow selects what an asynchronous sink does with a new entry when its
+// queue is full.
+type Overflow int
+
+const (
+	// DropOldest discards the oldest queued entry to make room for the new
+	// one.
+	DropOldest Overflow = iota
+
+	// DropNewest discards the new entry, keeping those already queued.
+	DropNewest
+
+	// Block causes the caller to wait until there's room in the queue,
+	// slowing the program down to the rate the destination accepts entries
+	// rather than losing any.
+	Block
+)
+
+// Reasons reported in the reason field of dropped entry reports.
+const (
+	dropQueueFull   = "queue_full"
+	dropSendFailed  = "send_failed"
+	dropCircuitOpen = "circuit_open"
+)
+
+// QueuePolicy controls how many entries the asynchronous sinks, NetWriter,
+// OTLPExporter, HECForwarder, LokiWriter and FluentForwarder, hold in
+// memory while waiting to send them, and what happens when that limit is
+// reached.
+//
+// Entries the sink discards are counted, and every ReportInterval in which
+// any were discarded the sink sends a warning entry of its own through the
+// same destination, eg.
+//
+//	2017-02-13T12:13:45.000Z ll="warning" dropped=142 reason="queue_full" _msg="kvlog: dropped log entries"
+//
+// reason is "queue_full" for entries discarded by the Overflow policy,
+// "send_failed" for those in a batch the destination didn't accept after
+// any retries and "circuit_open" for those discarded while the RetryPolicy
+// circuit breaker was open.
+type QueuePolicy struct {
+	Size           int // maximum entries held; 0 for no limit
+	Overflow       Overflow
+	ReportInterval time.Duration // 0 disables dropped entry reports
+}
+
+// DefaultQueuePolicy is the policy used by the asynchronous sinks unless
+// configured otherwise.
+var DefaultQueuePolicy = QueuePolicy{
+	Size:           10000,
+	Overflow:       DropOldest,
+	ReportInterval: time.Minute,
+}
+
+// reportFormatter formats dropped entry reports for sinks that write
+// preformatted lines.
+var reportFormatter = New()
+
+// dropCounter counts discarded entries by reason.
+type dropCounter struct {
+	mu      sync.Mutex
+	total   int64
+	pending map[string]int64 // since the last report
+}
+
+func (d *dropCounter) add(reason string, n int) {
+	if n == 0 {
+		return
+	}
+	d.mu.Lock()
+	if d.pending == nil {
+		d.pending = make(map[string]int64)
+	}
+	d.total += int64(n)
+	d.pending[reason] += int64(n)
+	d.mu.Unlock()
+	observeDrops(reason, n)
+}
+
+func (d *dropCounter) dropped() int64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.total
+}
+
+// report passes an entry to emit for each reason entries have been dropped
+// since the last report.
+func (d *dropCounter) report(emit func(*log.Entry)) {
+	d.mu.Lock()
+	pending := d.pending
+	d.pending = nil
+	d.mu.Unlock()
+
+	reasons := make([]string, 0, len(pending))
+	for reason := range pending {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		emit(&log.Entry{
+			Time:    time.Now(),
+			Level:   log.WarnLevel,
+			Message: "kvlog: dropped log entries",
+			Data:    log.Fields{"dropped": pending[reason], "reason": reason},
+		})
+	}
+}
+
+// run calls report every interval until done is closed.
+func (d *dropCounter) run(interval time.Duration, done <-chan struct{}, emit func(*log.Entry)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			d.report(emit)
+		case <-done:
+			return
+		}
+	}
+}
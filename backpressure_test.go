@@ -0,0 +1,205 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+// lokiLines collects the lines pushed to a test Loki server.
+type lokiLines struct {
+	mu     sync.Mutex
+	lines  []string
+	status []int // responses for successive requests; 204 once exhausted
+}
+
+func (l *lokiLines) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	var push lokiPush
+	json.Unmarshal(body, &push)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.status) > 0 {
+		status := l.status[0]
+		l.status = l.status[1:]
+		w.WriteHeader(status)
+		return
+	}
+	for _, s := range push.Streams {
+		for _, v := range s.Values {
+			l.lines = append(l.lines, v[1])
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (l *lokiLines) get() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func TestQueuePolicyOverflow(t *testing.T) {
+	tests := []struct {
+		name     string
+		overflow Overflow
+		expected []string
+		dropped  int64
+	}{
+		{"drop-oldest", DropOldest, []string{"line2", "line3", "line4"}, 2},
+		{"drop-newest", DropNewest, []string{"line0", "line1", "line2"}, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			recv := new(lokiLines)
+			srv := httptest.NewServer(recv)
+			defer srv.Close()
+
+			w := NewLokiWriter(srv.URL,
+				LokiBatch(100, time.Hour),
+				LokiQueuePolicy(QueuePolicy{Size: 3, Overflow: test.overflow}))
+			for i := 0; i < 5; i++ {
+				fmt.Fprintf(w, "line%d\n", i)
+			}
+			require.Nil(t, w.Close())
+			assert.Equal(t, test.expected, recv.get())
+			assert.Equal(t, test.dropped, w.Dropped())
+		})
+	}
+}
+
+func TestQueuePolicyBlock(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	lines, _ := readLines(l)
+
+	w := NewNetWriter("tcp", l.Addr().String(), NetQueuePolicy(QueuePolicy{Size: 1, Overflow: Block}))
+	go func() {
+		for i := 0; i < 200; i++ {
+			fmt.Fprintf(w, "entry%d\n", i)
+		}
+	}()
+	for i := 0; i < 200; i++ {
+		assert.Equal(t, fmt.Sprintf("entry%d", i), recvLine(t, lines))
+	}
+	assert.Equal(t, int64(0), w.Dropped())
+	assert.Nil(t, w.Close())
+}
+
+func TestQueuePolicyBlockClose(t *testing.T) {
+	// reserve an address with nothing listening on it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	w := NewNetWriter("tcp", addr,
+		NetQueuePolicy(QueuePolicy{Size: 1, Overflow: Block}),
+		NetBackoff(time.Hour, time.Hour))
+	errs := make(chan error, 5)
+	go func() {
+		for i := 0; i < 5; i++ {
+			_, err := w.Write([]byte("entry\n"))
+			errs <- err
+		}
+	}()
+	assert.Nil(t, <-errs)
+	time.Sleep(20 * time.Millisecond)
+	w.Close()
+
+	// blocked writers are released when the writer is closed
+	var failed int
+	for i := 1; i < 5; i++ {
+		select {
+		case err := <-errs:
+			if err != nil {
+				failed++
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("write remained blocked after close")
+		}
+	}
+	assert.True(t, failed > 0)
+}
+
+func TestDroppedReport(t *testing.T) {
+	recv := &lokiLines{status: []int{400}}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	w := NewLokiWriter(srv.URL,
+		LokiBatch(100, time.Hour),
+		LokiRetryPolicy(RetryPolicy{}),
+		LokiQueuePolicy(QueuePolicy{Size: 1, Overflow: DropNewest, ReportInterval: time.Hour}))
+
+	// the first batch is rejected by the server
+	w.Write([]byte("rejected\n"))
+	assert.NotNil(t, w.Flush())
+
+	w.Write([]byte("kept\n"))
+	w.Write([]byte("dropped\n"))
+	w.Write([]byte("dropped\n"))
+	require.Nil(t, w.Close())
+	assert.Equal(t, int64(3), w.Dropped())
+
+	lines := recv.get()
+	require.Len(t, lines, 3)
+	assert.Equal(t, "kept", lines[0])
+	for i, reason := range []string{"queue_full", "send_failed"} {
+		entry, err := Parse([]byte(lines[i+1]))
+		require.Nil(t, err)
+		assert.Equal(t, "warning", entry.Level.String())
+		assert.Equal(t, "kvlog: dropped log entries", entry.Message)
+		assert.Equal(t, reason, entry.Fields["reason"])
+	}
+}
+
+func TestDroppedReportInterval(t *testing.T) {
+	// reserve an address with nothing listening on it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	w := NewNetWriter("tcp", addr,
+		NetQueuePolicy(QueuePolicy{Size: 2, Overflow: DropNewest, ReportInterval: 10 * time.Millisecond}),
+		NetBackoff(10*time.Millisecond, 10*time.Millisecond))
+	defer w.Close()
+	for i := 0; i < 5; i++ {
+		w.Write([]byte("entry\n"))
+	}
+	dropped := w.Dropped()
+	assert.True(t, dropped > 0)
+
+	// start listening so the queued entries and the report are delivered
+	l, err = net.Listen("tcp", addr)
+	require.Nil(t, err)
+	defer l.Close()
+	lines, _ := readLines(l)
+	for {
+		line := recvLine(t, lines)
+		if strings.Contains(line, "kvlog: dropped log entries") {
+			assert.Contains(t, line, `reason="queue_full"`)
+			break
+		}
+	}
+}
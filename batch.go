@@ -0,0 +1,195 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// batcher accumulates encoded items and hands them to a send function once
+// a batch is full or the flush interval has elapsed.  Sends are serialized
+// and run on a background goroutine so that logging calls never wait for
+// the network, unless the queue policy is Block.
+type batcher struct {
+	sink     string // identifies the sink to observers, eg. "loki"
+	size     int
+	queue    QueuePolicy
+	send     func(batch [][]byte) error
+	encode   func(entry *log.Entry) []byte // encodes dropped entry reports
+	onError  func(error)
+	drops    dropCounter
+	mu       sync.Mutex
+	space    *sync.Cond // signalled when pending is emptied
+	pending  [][]byte
+	closed   bool
+	sendMu   sync.Mutex
+	kick     chan struct{}
+	done     chan struct{}
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+func newBatcher(sink string, size int, interval time.Duration, queue QueuePolicy, send func([][]byte) error, encode func(*log.Entry) []byte, onError func(error)) *batcher {
+	if size < 1 {
+		size = 1
+	}
+	b := &batcher{
+		sink:    sink,
+		size:    size,
+		queue:   queue,
+		send:    send,
+		encode:  encode,
+		onError: onError,
+		kick:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	b.space = sync.NewCond(&b.mu)
+	go b.run(interval)
+	return b
+}
+
+func (b *batcher) run(interval time.Duration) {
+	defer close(b.stopped)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	var report <-chan time.Time
+	if b.queue.ReportInterval > 0 {
+		reportTicker := time.NewTicker(b.queue.ReportInterval)
+		defer reportTicker.Stop()
+		report = reportTicker.C
+	}
+	for {
+		select {
+		case <-b.kick:
+		case <-ticker.C:
+		case <-report:
+			b.drops.report(b.addReport)
+			continue
+		case <-b.done:
+			return
+		}
+		if err := b.flush(); err != nil {
+			sinkError(b.onError, err)
+		}
+	}
+}
+
+func (b *batcher) trigger() {
+	select {
+	case b.kick <- struct{}{}:
+	default:
+	}
+}
+
+// add queues an item, triggering a background send if the batch is full.
+// If the queue is full the item is dropped or add blocks, according to the
+// queue policy.  An error is returned if the batcher has been closed.
+func (b *batcher) add(item []byte) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return errWriterClosed
+	}
+	if max := b.queue.Size; max > 0 {
+		for b.queue.Overflow == Block && len(b.pending) >= max && !b.closed {
+			b.trigger()
+			b.space.Wait()
+		}
+		if b.closed {
+			b.mu.Unlock()
+			return errWriterClosed
+		}
+		if len(b.pending) >= max {
+			b.drops.add(dropQueueFull, 1)
+			if b.queue.Overflow != DropOldest {
+				b.mu.Unlock()
+				return nil
+			}
+			b.pending = b.pending[1:]
+		}
+	}
+	b.pending = append(b.pending, item)
+	full := len(b.pending) >= b.size
+	b.mu.Unlock()
+	if full {
+		b.trigger()
+	}
+	return nil
+}
+
+// addReport queues a dropped entry report, regardless of the queue limit.
+func (b *batcher) addReport(entry *log.Entry) {
+	item := b.encode(entry)
+	b.mu.Lock()
+	b.pending = append(b.pending, item)
+	b.mu.Unlock()
+}
+
+// backlog returns the number of items queued.
+func (b *batcher) backlog() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+// dropped returns the number of items discarded.
+func (b *batcher) dropped() int64 {
+	return b.drops.dropped()
+}
+
+// flush synchronously sends all queued items in batches of at most size
+// items, returning the first error encountered.
+func (b *batcher) flush() error {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+
+	b.mu.Lock()
+	items := b.pending
+	b.pending = nil
+	b.space.Broadcast()
+	b.mu.Unlock()
+
+	var firstErr error
+	for len(items) > 0 {
+		n := b.size
+		if n > len(items) {
+			n = len(items)
+		}
+		if err := b.send(items[:n]); err != nil {
+			if err == ErrCircuitOpen {
+				b.drops.add(dropCircuitOpen, n)
+			} else {
+				b.drops.add(dropSendFailed, n)
+				observeDeliveryError(b.sink, err)
+			}
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+		items = items[n:]
+	}
+	return firstErr
+}
+
+// close stops the background goroutine and sends any queued items,
+// preceded by a report of any items dropped since the last.
+func (b *batcher) close() error {
+	b.stopOnce.Do(func() {
+		close(b.done)
+		b.mu.Lock()
+		b.closed = true
+		b.space.Broadcast()
+		b.mu.Unlock()
+	})
+	<-b.stopped
+	if b.queue.ReportInterval > 0 {
+		b.drops.report(b.addReport)
+	}
+	return b.flush()
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// WithBuildInfoFields adds constant fields identifying the build of the
+// running program, as recorded by the Go toolchain:
+//
+//	vcs_revision  the version control revision the binary was built from
+//	vcs_dirty     true if the working tree had uncommitted changes
+//	go_version    the Go version used to build the binary
+//	version       the version of the main module, if built from a tagged module
+//
+// Values that weren't recorded, such as the revision of a binary built
+// outside of a repository or with -buildvcs=false, are omitted.
+func WithBuildInfoFields() Config {
+	return func(kvf *Formatter) {
+		fc := kvf.fields()
+		for _, f := range buildInfoFields() {
+			fc.constants = appendField(fc.constants, f.key, f.value)
+		}
+	}
+}
+
+func buildInfoFields() []field {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return []field{{"go_version", runtime.Version()}}
+	}
+
+	var fields []field
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			fields = append(fields, field{"vcs_revision", s.Value})
+		case "vcs.modified":
+			fields = append(fields, field{"vcs_dirty", s.Value == "true"})
+		}
+	}
+	fields = append(fields, field{"go_version", info.GoVersion})
+	if v := info.Main.Version; v != "" && v != "(devel)" {
+		fields = append(fields, field{"version", v})
+	}
+	return fields
+}
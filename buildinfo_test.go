@@ -0,0 +1,35 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"runtime"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestBuildInfoFields(t *testing.T) {
+	cf := New(WithBuildInfoFields())
+	result, err := cf.Format(&log.Entry{
+		Time:  testTime,
+		Level: log.InfoLevel,
+		Data:  log.Fields{"action": "start"},
+	})
+	require.Nil(t, err)
+
+	entry, err := Parse(result)
+	require.Nil(t, err)
+	assert.Equal(t, runtime.Version(), entry.Fields["go_version"])
+	assert.Equal(t, "action", entry.Keys[len(entry.Keys)-1], "build fields should precede entry fields")
+	if rev, ok := entry.Fields["vcs_revision"]; ok {
+		assert.NotEmpty(t, rev)
+		assert.IsType(t, true, entry.Fields["vcs_dirty"])
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"fmt"
+	"sync"
+)
+
+// KeyLimit selects what WithKeyLimit does with new keys once the limit on
+// the number of distinct keys has been reached.
+type KeyLimit int
+
+const (
+	// WarnNewKeys reports that the limit has been exceeded, once, but
+	// continues to emit fields with new keys.
+	WarnNewKeys KeyLimit = iota
+
+	// DropNewKeys reports that the limit has been exceeded, once, and drops
+	// fields whose keys haven't been seen before.  Dropped fields are
+	// counted by SuppressedFields.
+	DropNewKeys
+)
+
+// KeyLimitError is reported when an entry has a key that would take the
+// number of distinct keys logged beyond the limit set by WithKeyLimit.
+type KeyLimitError struct {
+	Limit int    // the configured limit
+	Key   string // the first key beyond the limit
+}
+
+func (e *KeyLimitError) Error() string {
+	return fmt.Sprintf("kvlog: more than %d distinct field keys logged, starting with %q", e.Limit, e.Key)
+}
+
+// WithKeyLimit tracks the distinct field keys logged and, once more than n
+// have been seen, reports a KeyLimitError to the handler set by
+// WithErrorHandler and either continues or drops fields with new keys,
+// according to policy.  This guards log indexers against entries that use
+// generated values, such as user IDs, as keys.
+//
+// Constant fields aren't counted.  Formatters created by Child share the
+// keys seen by their parent.
+func WithKeyLimit(n int, policy KeyLimit) Config {
+	return func(kvf *Formatter) {
+		kvf.keys = &keyTracker{limit: n, drop: policy == DropNewKeys}
+	}
+}
+
+// WithErrorHandler sets a function to be called with problems encountered
+// by the Formatter, such as a KeyLimitError.  By default they're passed to
+// the handler set by SetErrorHandler, or written to os.Stderr if there's
+// none.
+func WithErrorHandler(f func(error)) Config {
+	return func(kvf *Formatter) {
+		kvf.onError = f
+	}
+}
+
+// reportError passes err to the configured error handler.
+func (cf *Formatter) reportError(err error) {
+	if cf.onError != nil {
+		cf.onError(err)
+		return
+	}
+	internalError(err)
+}
+
+// keyTracker records the distinct keys seen, up to a limit.
+type keyTracker struct {
+	limit    int
+	drop     bool
+	mu       sync.RWMutex
+	seen     map[string]struct{}
+	exceeded bool
+}
+
+// admit records k and reports whether a field with key k should be emitted.
+func (t *keyTracker) admit(cf *Formatter, k string) bool {
+	t.mu.RLock()
+	_, ok := t.seen[k]
+	exceeded := t.exceeded
+	t.mu.RUnlock()
+	if ok {
+		return true
+	}
+	if exceeded {
+		return !t.drop
+	}
+
+	t.mu.Lock()
+	if _, ok := t.seen[k]; ok {
+		t.mu.Unlock()
+		return true
+	}
+	if len(t.seen) < t.limit {
+		if t.seen == nil {
+			t.seen = make(map[string]struct{})
+		}
+		t.seen[k] = struct{}{}
+		t.mu.Unlock()
+		return true
+	}
+	report := !t.exceeded
+	t.exceeded = true
+	t.mu.Unlock()
+	if report {
+		cf.reportError(&KeyLimitError{Limit: t.limit, Key: k})
+	}
+	return !t.drop
+}
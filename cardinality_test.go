@@ -0,0 +1,77 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestKeyLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		policy     KeyLimit
+		expected   []string
+		suppressed int64
+	}{
+		{"warn", WarnNewKeys, []string{
+			`a=1 b=2`,
+			`a=1 c=3`,
+			`a=1 user_42=4`,
+			`b=2 user_43=5`,
+		}, 0},
+		{"drop", DropNewKeys, []string{
+			`a=1 b=2`,
+			`a=1 c=3`,
+			`a=1`,
+			`b=2`,
+		}, 2},
+	}
+
+	entries := []log.Fields{
+		{"a": 1, "b": 2},
+		{"a": 1, "c": 3},
+		{"a": 1, "user_42": 4},
+		{"b": 2, "user_43": 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var errs []error
+			cf := New(
+				WithKeyLimit(3, test.policy),
+				WithErrorHandler(func(err error) { errs = append(errs, err) }),
+				WithConstantField("app", "x"))
+			for i, data := range entries {
+				result, err := cf.Format(&log.Entry{Time: testTime, Level: log.InfoLevel, Data: data})
+				require.Nil(t, err)
+				assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" app="x" `+test.expected[i], strings.TrimSuffix(string(result), "\n"))
+			}
+			require.Len(t, errs, 1)
+			assert.Equal(t, &KeyLimitError{Limit: 3, Key: "user_42"}, errs[0])
+			assert.Equal(t, `kvlog: more than 3 distinct field keys logged, starting with "user_42"`, errs[0].Error())
+			assert.Equal(t, test.suppressed, cf.SuppressedFields())
+		})
+	}
+}
+
+func TestKeyLimitChild(t *testing.T) {
+	var errs []error
+	cf := New(WithKeyLimit(1, DropNewKeys), WithErrorHandler(func(err error) { errs = append(errs, err) }))
+	var buf bytes.Buffer
+	NewLogger(&buf, cf).Log(log.InfoLevel, "first", Int("a", 1))
+	NewLogger(&buf, cf.Child()).Log(log.InfoLevel, "second", Int("a", 1), Int("b", 2))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.Regexp(t, ` a=1 _msg="first"$`, lines[0])
+	assert.Regexp(t, ` a=1 _msg="second"$`, lines[1])
+	assert.Len(t, errs, 1)
+}
@@ -0,0 +1,78 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"errors"
+	"hash/crc32"
+	"strconv"
+)
+
+// ErrChecksum is returned by Parse for a line whose _cksum field doesn't
+// match the rest of the line.
+var ErrChecksum = errors.New("kvlog: line checksum mismatch")
+
+const (
+	checksumKey = " _cksum="
+	checksumLen = len(checksumKey) + 8
+)
+
+// WithChecksum appends a _cksum field to each line holding the CRC-32 (IEEE)
+// of the rest of the line as 8 hex digits, so that lines truncated or
+// corrupted in transit can be detected.  It's always the last field.
+//
+// Parse verifies the checksum of lines that have one, returning ErrChecksum
+// if it doesn't match, and Decoder.RequireChecksum additionally rejects
+// lines without one, such as those cut short.
+//
+// Only the default k=v format includes the checksum.
+func WithChecksum() Config {
+	return func(kvf *Formatter) {
+		kvf.checksum = true
+	}
+}
+
+// appendChecksum appends the _cksum field for line to it.
+func appendChecksum(line []byte) []byte {
+	var sum [8]byte
+	hex := strconv.AppendUint(sum[:0], uint64(crc32.ChecksumIEEE(line)), 16)
+	line = append(line[:len(line):len(line)], checksumKey...)
+	for i := len(hex); i < 8; i++ {
+		line = append(line, '0')
+	}
+	return append(line, hex...)
+}
+
+// addChecksums appends a _cksum field to each line written to b from
+// offset start.
+func addChecksums(b *bytes.Buffer, start int) {
+	lines := bytes.SplitAfter(append([]byte(nil), b.Bytes()[start:]...), []byte("\n"))
+	b.Truncate(start)
+	for _, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		body := bytes.TrimRight(line, "\n")
+		b.Write(appendChecksum(body))
+		b.Write(line[len(body):])
+	}
+}
+
+// splitChecksum returns line without its trailing _cksum field and whether
+// the field was present.  valid reports whether it matched the rest of the
+// line.
+func splitChecksum(line []byte) (body []byte, present, valid bool) {
+	n := len(line) - checksumLen
+	if n < 0 || !bytes.Equal(line[n:n+len(checksumKey)], []byte(checksumKey)) {
+		return line, false, false
+	}
+	sum, err := strconv.ParseUint(string(line[n+len(checksumKey):]), 16, 32)
+	if err != nil {
+		return line, false, false
+	}
+	body = line[:n]
+	return body, true, uint32(sum) == crc32.ChecksumIEEE(body)
+}
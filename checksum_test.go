@@ -0,0 +1,119 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func checksumEntry() *log.Entry {
+	return &log.Entry{
+		Time:    testTime,
+		Level:   log.InfoLevel,
+		Message: "login",
+		Data:    log.Fields{"user": "joe", "attempts": 3},
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	out, err := New(WithChecksum()).Format(checksumEntry())
+	require.Nil(t, err)
+	line := strings.TrimSuffix(string(out), "\n")
+	plain, _ := New().Format(checksumEntry())
+	assert.Equal(t, strings.TrimSuffix(string(plain), "\n"), line[:len(line)-len(" _cksum=00000000")])
+	assert.Regexp(t, ` _cksum=[0-9a-f]{8}$`, line)
+
+	entry, err := Parse(out)
+	require.Nil(t, err)
+	assert.True(t, entry.Checksummed)
+	assert.Equal(t, "login", entry.Message)
+	assert.NotContains(t, entry.Fields, "_cksum")
+	assert.Equal(t, []string{"attempts", "user"}, entry.Keys)
+
+	corrupt := strings.Replace(line, "joe", "jon", 1)
+	_, err = Parse([]byte(corrupt))
+	assert.Equal(t, ErrChecksum, err)
+
+	entry, err = Parse(plain)
+	require.Nil(t, err)
+	assert.False(t, entry.Checksummed)
+}
+
+func TestChecksumLogger(t *testing.T) {
+	var buf bytes.Buffer
+	NewLogger(&buf, New(WithChecksum())).Log(log.InfoLevel, "hello", String("user", "joe"))
+	entry, err := Parse(buf.Bytes())
+	require.Nil(t, err)
+	assert.True(t, entry.Checksummed)
+}
+
+func TestChecksumAddedFields(t *testing.T) {
+	cf := New(WithChecksum())
+	var buf bytes.Buffer
+	r := NewRingBuffer(&buf, 3)
+	e := checksumEntry()
+	e.Level = log.DebugLevel
+	line, _ := cf.Format(e)
+	r.Write(line)
+	e.Level = log.ErrorLevel
+	line, _ = cf.Format(e)
+	r.Write(line)
+
+	d := NewDecoder(&buf)
+	d.RequireChecksum()
+	var entries []Entry
+	for d.Next() {
+		entries = append(entries, d.Entry())
+	}
+	require.Len(t, entries, 2)
+	assert.Equal(t, true, entries[0].Fields["replayed"])
+	assert.Equal(t, 0, d.Malformed())
+}
+
+func TestChecksumLineLimit(t *testing.T) {
+	cf := New(WithChecksum(), WithMaxLineLength(100, SplitLine))
+	e := checksumEntry()
+	e.Data["body"] = strings.Repeat("x", 200)
+	out, err := cf.Format(e)
+	require.Nil(t, err)
+
+	d := NewDecoder(bytes.NewReader(out))
+	d.RequireChecksum()
+	n := 0
+	for d.Next() {
+		assert.True(t, len(d.Line())+1 <= 100, "line too long: %d", len(d.Line())+1)
+		n++
+	}
+	assert.True(t, n > 1)
+	assert.Equal(t, 0, d.Malformed())
+}
+
+func TestDecoderRequireChecksum(t *testing.T) {
+	good, _ := New(WithChecksum()).Format(checksumEntry())
+	plain, _ := New().Format(checksumEntry())
+	truncated := append(append([]byte(nil), good[:len(good)/2]...), '"', '\n')
+	input := bytes.Join([][]byte{good, plain, truncated, good}, nil)
+
+	d := NewDecoder(bytes.NewReader(input))
+	d.RequireChecksum()
+	var skipped []int
+	d.OnMalformed(func(lineNum int, line []byte, err error) {
+		skipped = append(skipped, lineNum)
+	})
+	n := 0
+	for d.Next() {
+		n++
+	}
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []int{2, 3}, skipped)
+}
@@ -0,0 +1,61 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// WithClock sets a function returning the time to be logged for each
+// entry, in place of the time recorded by logrus or a Logger, so that tests
+// and examples produce the same output on every run.
+//
+// eg.
+//
+//	kvlog.New(kvlog.WithClock(func() time.Time {
+//	    return time.Date(2017, 1, 2, 12, 0, 0, 0, time.UTC)
+//	}))
+func WithClock(now func() time.Time) Config {
+	return func(kvf *Formatter) {
+		kvf.clock = now
+	}
+}
+
+// WithCallerFunc sets a function that adjusts the calling function name and
+// line number included by IncludeCaller, such as to fix the line number so
+// that output doesn't change whenever the calling file is edited.  f is
+// passed the caller that would otherwise be logged, with an empty name if
+// it couldn't be determined.  Minimum levels set by WithPackageLevels still
+// use the actual caller.
+//
+// eg.
+//
+//	kvlog.WithCallerFunc(func(name string, line int) (string, int) {
+//	    return name, 100
+//	})
+func WithCallerFunc(f func(name string, line int) (string, int)) Config {
+	return func(kvf *Formatter) {
+		kvf.callerFunc = f
+	}
+}
+
+// now returns the time to be logged for a new entry.
+func (cf *Formatter) now() time.Time {
+	if cf.clock != nil {
+		return cf.clock()
+	}
+	return time.Now()
+}
+
+// record adapts a logrus entry, replacing its time if WithClock was used.
+func (cf *Formatter) record(entry *log.Entry) *Record {
+	r := newRecord(entry)
+	if cf.clock != nil {
+		r.Time = cf.clock()
+	}
+	return r
+}
@@ -0,0 +1,50 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestWithClock(t *testing.T) {
+	clock := func() time.Time { return testTime }
+	tests := []struct {
+		name     string
+		cfgs     []Config
+		expected string
+	}{
+		{"kv", nil, `2017-02-13T12:13:45.000Z ll="info" _msg="hi"` + "\n"},
+		{"json", []Config{WithJSON()}, `{"time":"2017-02-13T12:13:45.000Z","ll":"info","_msg":"hi"}` + "\n"},
+		{"caller", []Config{IncludeCaller(), WithCallerFunc(func(name string, line int) (string, int) {
+			assert.Contains(t, name, "TestWithClock")
+			assert.True(t, line > 0)
+			return "handler", 7
+		})}, `2017-02-13T12:13:45.000Z ll="info" srcfnc="handler" srcline=7 _msg="hi"` + "\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cf := New(append([]Config{WithClock(clock)}, test.cfgs...)...)
+
+			var buf bytes.Buffer
+			logger := log.New()
+			logger.Out = &buf
+			logger.Formatter = cf
+			logger.Info("hi")
+			assert.Equal(t, test.expected, buf.String())
+
+			buf.Reset()
+			NewLogger(&buf, cf.Child()).Info("hi")
+			assert.Equal(t, test.expected, buf.String())
+		})
+	}
+}
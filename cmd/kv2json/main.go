@@ -0,0 +1,72 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Command kv2json converts kvlog lines to newline delimited JSON, suitable for
+loading into tools such as jq, DuckDB or BigQuery.
+
+Usage:
+
+	kv2json [flags] [file ...]
+
+Each line becomes a JSON object holding the same keys in the same order,
+starting with "time" and "ll" and ending with "_msg".  Quoted values become
+JSON strings while unquoted numbers, booleans and <nil> values become JSON
+numbers, booleans and null.
+
+Lines that can't be parsed are reported to stderr and skipped.
+
+Flags:
+
+	-q	don't report lines that can't be parsed
+*/
+package main
+
+import (
+	"bufio"
+	"flag"
+	"io"
+	"os"
+
+	"github.com/gwatts/kvlog"
+	"github.com/gwatts/kvlog/internal/cli"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], cli.Env{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}))
+}
+
+func run(args []string, env cli.Env) int {
+	fs := flag.NewFlagSet("kv2json", flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	quiet := fs.Bool("q", false, "don't report lines that can't be parsed")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	out := bufio.NewWriter(env.Stdout)
+	ok := env.EachInput("kv2json", fs.Args(), func(name string, in io.Reader) error {
+		d := kvlog.NewDecoder(in)
+		if !*quiet {
+			d.OnMalformed(func(lineNum int, _ []byte, err error) {
+				env.Errorf("kv2json", "%s:%d: %v", name, lineNum, err)
+			})
+		}
+		for d.Next() {
+			e := d.Entry()
+			order := append([]string{"srcfnc", "srcline"}, e.Keys...)
+			b, _ := kvlog.New(kvlog.WithPrimaryFields(order...), kvlog.WithJSON()).Format(e.LogEntry())
+			out.Write(b)
+		}
+		return d.Err()
+	})
+	if err := out.Flush(); err != nil {
+		env.Errorf("kv2json", "%v", err)
+		return 1
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,28 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gwatts/kvlog/internal/cli"
+)
+
+func TestKV2JSON(t *testing.T) {
+	assert := assert.New(t)
+
+	input := `2017-02-13T12:13:45.000Z ll="info" srcfnc="main" srcline=10 status="ok" count=3 ratio=0.5 ok=true id="42" v=<nil> _msg="first"
+garbage
+`
+	var stdout, stderr bytes.Buffer
+	status := run(nil, cli.Env{Stdin: strings.NewReader(input), Stdout: &stdout, Stderr: &stderr})
+	assert.Equal(0, status)
+	assert.Equal(`{"time":"2017-02-13T12:13:45.000Z","ll":"info","srcfnc":"main","srcline":10,"status":"ok","count":3,"ratio":0.5,"ok":true,"id":"42","v":null,"_msg":"first"}`+"\n", stdout.String())
+	assert.Equal("kv2json: -:2: kvlog: invalid timestamp at offset 0\n", stderr.String())
+}
@@ -0,0 +1,122 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Command kvcat reads kvlog output from files or stdin and renders it for
+humans, with optional color, multi-line pretty printing and key filtering.
+
+Usage:
+
+	kvcat [flags] [file ...]
+
+Lines that can't be parsed are passed through unchanged.
+
+With -f kvcat follows a single file as it's appended to, like tail -f,
+starting from its current end and reopening it if it's rotated.
+
+Flags:
+
+	-color string
+	      colorize output: auto, always or never (default "auto")
+	-f	follow a file as it's appended to, like tail -f
+	-hide string
+	      comma separated list of keys to omit
+	-pretty
+	      print each field on its own line
+	-show string
+	      comma separated list of keys to include; all others are omitted
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gwatts/kvlog"
+	"github.com/gwatts/kvlog/internal/cli"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], cli.Env{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}))
+}
+
+func run(args []string, env cli.Env) int {
+	fs := flag.NewFlagSet("kvcat", flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	color := fs.String("color", "auto", "colorize output: auto, always or never")
+	pretty := fs.Bool("pretty", false, "print each field on its own line")
+	show := fs.String("show", "", "comma separated list of keys to include; all others are omitted")
+	hide := fs.String("hide", "", "comma separated list of keys to omit")
+	follow := fs.Bool("f", false, "follow a file as it's appended to, like tail -f")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	r := &renderer{
+		show:   cli.KeySet(*show),
+		hide:   cli.KeySet(*hide),
+		pretty: *pretty,
+	}
+	var err error
+	if r.color, err = cli.UseColor(*color, env.Stdout); err != nil {
+		env.Errorf("kvcat", "%v", err)
+		return 2
+	}
+
+	cat := func(name string, in io.Reader) error {
+		d := kvlog.NewDecoder(in)
+		d.OnMalformed(func(_ int, line []byte, _ error) {
+			fmt.Fprintf(env.Stdout, "%s\n", line)
+		})
+		for d.Next() {
+			env.Stdout.Write(r.render(d.Entry()))
+		}
+		return d.Err()
+	}
+
+	var ok bool
+	if *follow {
+		if fs.NArg() != 1 {
+			env.Errorf("kvcat", "-f requires a single file")
+			return 2
+		}
+		ok = env.FollowInput("kvcat", fs.Arg(0), cat)
+	} else {
+		ok = env.EachInput("kvcat", fs.Args(), cat)
+	}
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+type renderer struct {
+	show   map[string]bool
+	hide   map[string]bool
+	color  bool
+	pretty bool
+}
+
+// render formats an entry, preserving the order of its keys.
+func (r *renderer) render(e kvlog.Entry) []byte {
+	entry := e.LogEntry()
+	order := append([]string{"srcfnc", "srcline"}, e.Keys...)
+	for k := range entry.Data {
+		if (r.show != nil && !r.show[k]) || r.hide[k] {
+			delete(entry.Data, k)
+		}
+	}
+
+	cfgs := []kvlog.Config{kvlog.WithPrimaryFields(order...)}
+	if r.color {
+		cfgs = append(cfgs, kvlog.WithColor())
+	}
+	if r.pretty {
+		cfgs = append(cfgs, kvlog.WithPretty())
+	}
+	out, _ := kvlog.New(cfgs...).Format(entry)
+	return out
+}
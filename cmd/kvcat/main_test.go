@@ -0,0 +1,69 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gwatts/kvlog/internal/cli"
+)
+
+const testInput = `2017-02-13T12:13:45.000Z ll="info" srcfnc="main" srcline=10 status="ok" count=3 _msg="first"
+not a log line
+2017-02-13T12:13:45.000Z ll="error" status="failed" _msg="second"
+`
+
+var kvcatTests = []struct {
+	name     string
+	args     []string
+	expected string
+}{
+	{"plain", []string{"-color", "never"}, testInput},
+	{"hide", []string{"-hide", "status,srcline"},
+		`2017-02-13T12:13:45.000Z ll="info" srcfnc="main" count=3 _msg="first"
+not a log line
+2017-02-13T12:13:45.000Z ll="error" _msg="second"
+`},
+	{"show", []string{"-show", "count"},
+		`2017-02-13T12:13:45.000Z ll="info" count=3 _msg="first"
+not a log line
+2017-02-13T12:13:45.000Z ll="error" _msg="second"
+`},
+	{"pretty", []string{"-pretty", "-show", "status"},
+		`2017-02-13T12:13:45.000Z INFO  first
+    status: "ok"
+not a log line
+2017-02-13T12:13:45.000Z ERROR second
+    status: "failed"
+`},
+}
+
+func TestKVCat(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, test := range kvcatTests {
+		var stdout, stderr bytes.Buffer
+		status := run(test.args, cli.Env{Stdin: strings.NewReader(testInput), Stdout: &stdout, Stderr: &stderr})
+		assert.Equal(0, status, test.name+" should succeed")
+		assert.Equal(test.expected, stdout.String(), test.name+" output should match")
+	}
+}
+
+func TestKVCatColor(t *testing.T) {
+	var stdout bytes.Buffer
+	run([]string{"-color", "always"}, cli.Env{Stdin: strings.NewReader(testInput), Stdout: &stdout, Stderr: &stdout})
+	assert.Contains(t, stdout.String(), "\x1b[")
+}
+
+func TestKVCatMissingFile(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"/nonexistent"}, cli.Env{Stdout: &stdout, Stderr: &stderr})
+	assert.Equal(t, 1, status)
+	assert.Contains(t, stderr.String(), "kvcat: open /nonexistent")
+}
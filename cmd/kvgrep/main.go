@@ -0,0 +1,122 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Command kvgrep prints kvlog lines whose fields match an expression.
+
+Usage:
+
+	kvgrep [flags] expression [file ...]
+
+eg.
+
+	kvgrep 'status!=ok && duration_ms>500' app.log
+
+Expressions compare field values using ==, !=, <, <=, >, >= and the regular
+expression operators =~ and !~, combined with &&, || and ! and grouped with
+parentheses.  A key on its own tests whether the field is present.  Values
+are compared numerically where both sides are numbers, so unlike grep it can
+filter on ranges; quoted literals are always compared as strings.  The ll
+key is compared by severity, so ll>=warning matches warnings and errors.
+
+Lines that can't be parsed never match.  The exit status is 0 if any line
+matched, 1 if none did and 2 if an error occurred.
+
+With -f kvgrep follows a single file as it's appended to, like tail -f,
+starting from its current end and reopening it if it's rotated.  When
+writing to a terminal matching warning lines are highlighted in yellow and
+error lines in red.
+
+Flags:
+
+	-c	print only a count of matching lines
+	-color string
+	      highlight warning and error lines: auto, always or never (default "auto")
+	-f	follow a file as it's appended to, like tail -f
+	-v	print lines that don't match
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gwatts/kvlog"
+	"github.com/gwatts/kvlog/internal/cli"
+	"github.com/gwatts/kvlog/internal/expr"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], cli.Env{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}))
+}
+
+func run(args []string, env cli.Env) int {
+	fs := flag.NewFlagSet("kvgrep", flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	count := fs.Bool("c", false, "print only a count of matching lines")
+	invert := fs.Bool("v", false, "print lines that don't match")
+	follow := fs.Bool("f", false, "follow a file as it's appended to, like tail -f")
+	color := fs.String("color", "auto", "highlight warning and error lines: auto, always or never")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	highlight, err := cli.UseColor(*color, env.Stdout)
+	if err != nil {
+		env.Errorf("kvgrep", "%v", err)
+		return 2
+	}
+	if fs.NArg() < 1 {
+		env.Errorf("kvgrep", "usage: kvgrep [flags] expression [file ...]")
+		return 2
+	}
+	x, err := expr.Parse(fs.Arg(0))
+	if err != nil {
+		env.Errorf("kvgrep", "%v", err)
+		return 2
+	}
+
+	matches := 0
+	grep := func(name string, in io.Reader) error {
+		d := kvlog.NewDecoder(in)
+		for d.Next() {
+			if x.Match(d.Entry()) == *invert {
+				continue
+			}
+			matches++
+			if *count {
+				continue
+			}
+			if hl := cli.Highlight(d.Entry().Level); highlight && hl != "" {
+				fmt.Fprintf(env.Stdout, "%s%s%s\n", hl, d.Line(), cli.HighlightReset)
+			} else {
+				fmt.Fprintf(env.Stdout, "%s\n", d.Line())
+			}
+		}
+		return d.Err()
+	}
+
+	var ok bool
+	if *follow {
+		if fs.NArg() != 2 {
+			env.Errorf("kvgrep", "-f requires a single file")
+			return 2
+		}
+		ok = env.FollowInput("kvgrep", fs.Arg(1), grep)
+	} else {
+		ok = env.EachInput("kvgrep", fs.Args()[1:], grep)
+	}
+	if *count {
+		fmt.Fprintln(env.Stdout, matches)
+	}
+
+	switch {
+	case !ok:
+		return 2
+	case matches == 0:
+		return 1
+	}
+	return 0
+}
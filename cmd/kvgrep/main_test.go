@@ -0,0 +1,50 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gwatts/kvlog/internal/cli"
+)
+
+const testInput = `2017-02-13T12:13:45.000Z ll="info" status="ok" duration_ms=120
+2017-02-13T12:13:46.000Z ll="error" status="failed" duration_ms=900
+2017-02-13T12:13:47.000Z ll="info" status="ok" duration_ms=650
+`
+
+var kvgrepTests = []struct {
+	name     string
+	args     []string
+	status   int
+	expected string
+}{
+	{"match", []string{"duration_ms>500"}, 0,
+		"2017-02-13T12:13:46.000Z ll=\"error\" status=\"failed\" duration_ms=900\n" +
+			"2017-02-13T12:13:47.000Z ll=\"info\" status=\"ok\" duration_ms=650\n"},
+	{"invert", []string{"-v", "status==ok"}, 0,
+		"2017-02-13T12:13:46.000Z ll=\"error\" status=\"failed\" duration_ms=900\n"},
+	{"count", []string{"-c", "status==ok"}, 0, "2\n"},
+	{"none", []string{"status==missing"}, 1, ""},
+	{"bad-expr", []string{"status=="}, 2, ""},
+	{"highlight", []string{"-color", "always", "duration_ms>500"}, 0,
+		"\x1b[1;31m2017-02-13T12:13:46.000Z ll=\"error\" status=\"failed\" duration_ms=900\x1b[0m\n" +
+			"2017-02-13T12:13:47.000Z ll=\"info\" status=\"ok\" duration_ms=650\n"},
+}
+
+func TestKVGrep(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, test := range kvgrepTests {
+		var stdout, stderr bytes.Buffer
+		status := run(test.args, cli.Env{Stdin: strings.NewReader(testInput), Stdout: &stdout, Stderr: &stderr})
+		assert.Equal(test.status, status, test.name+" status should match")
+		assert.Equal(test.expected, stdout.String(), test.name+" output should match")
+	}
+}
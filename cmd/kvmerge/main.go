@@ -0,0 +1,154 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Command kvmerge interleaves kvlog files from different hosts or services into
+a single stream ordered by timestamp, adding a field to each line naming the
+file it came from.
+
+Usage:
+
+	kvmerge [flags] [label=]file ...
+
+eg.
+
+	kvmerge web=web1/app.log api=api1/app.log
+
+The source field is inserted before the message of each line and is set to
+the label given for the file, or to the file's base name if no label is
+given.  Lines are otherwise copied verbatim, except that a _cksum field is
+recalculated and a _sig field, which would no longer match, is removed.  Each input is expected to already be
+in time order, as log files normally are; lines with equal timestamps are
+emitted in the order the files were given.
+
+Lines that can't be parsed are reported to stderr and skipped.
+
+Flags:
+
+	-key string
+	      name of the field added to each line (default "source")
+*/
+package main
+
+import (
+	"bufio"
+	"container/heap"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gwatts/kvlog"
+	"github.com/gwatts/kvlog/internal/cli"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], cli.Env{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}))
+}
+
+func run(args []string, env cli.Env) int {
+	fs := flag.NewFlagSet("kvmerge", flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	key := fs.String("key", "source", "name of the field added to each line")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() == 0 {
+		env.Errorf("kvmerge", "usage: kvmerge [flags] [label=]file ...")
+		return 2
+	}
+
+	status := 0
+	var h sourceHeap
+	for i, arg := range fs.Args() {
+		label, name := filepath.Base(arg), arg
+		if eq := strings.IndexByte(arg, '='); eq > 0 {
+			label, name = arg[:eq], arg[eq+1:]
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			env.Errorf("kvmerge", "%v", err)
+			status = 1
+			continue
+		}
+		defer f.Close()
+
+		s := &source{
+			order: i,
+			field: kvlog.String(*key, label),
+			d:     kvlog.NewDecoder(f),
+		}
+		s.d.OnMalformed(func(lineNum int, _ []byte, err error) {
+			env.Errorf("kvmerge", "%s:%d: %v", name, lineNum, err)
+		})
+		if s.next() {
+			h = append(h, s)
+		}
+		if err := s.d.Err(); err != nil {
+			env.Errorf("kvmerge", "%s: %v", name, err)
+			status = 1
+		}
+	}
+	heap.Init(&h)
+
+	out := bufio.NewWriter(env.Stdout)
+	for h.Len() > 0 {
+		s := h[0]
+		out.Write(kvlog.AddFields(s.line, s.field))
+		out.WriteByte('\n')
+		if s.next() {
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+			if err := s.d.Err(); err != nil {
+				env.Errorf("kvmerge", "%v", err)
+				status = 1
+			}
+		}
+	}
+	if err := out.Flush(); err != nil {
+		env.Errorf("kvmerge", "%v", err)
+		return 1
+	}
+	return status
+}
+
+type source struct {
+	order int
+	field kvlog.Field
+	d     *kvlog.Decoder
+	entry kvlog.Entry
+	line  []byte
+}
+
+// next advances to the source's next entry.  The line is copied as the
+// decoder reuses its buffer.
+func (s *source) next() bool {
+	if !s.d.Next() {
+		return false
+	}
+	s.entry = s.d.Entry()
+	s.line = append(s.line[:0], s.d.Line()...)
+	return true
+}
+
+// sourceHeap orders sources by the timestamp of their current entry.
+type sourceHeap []*source
+
+func (h sourceHeap) Len() int { return len(h) }
+func (h sourceHeap) Less(i, j int) bool {
+	ti, tj := h[i].entry.Time, h[j].entry.Time
+	if ti.Equal(tj) {
+		return h[i].order < h[j].order
+	}
+	return ti.Before(tj)
+}
+func (h sourceHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *sourceHeap) Push(x interface{}) { *h = append(*h, x.(*source)) }
+func (h *sourceHeap) Pop() interface{} {
+	old := *h
+	s := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return s
+}
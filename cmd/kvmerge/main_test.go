@@ -0,0 +1,81 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gwatts/kvlog"
+	"github.com/gwatts/kvlog/internal/cli"
+)
+
+func TestKVMerge(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	dir, err := ioutil.TempDir("", "kvmerge")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	web := filepath.Join(dir, "web.log")
+	api := filepath.Join(dir, "api.log")
+	require.Nil(ioutil.WriteFile(web, []byte(
+		`2017-02-13T12:13:45.000Z ll="info" req="a" _msg="web start"
+2017-02-13T12:13:47.000Z ll="info" req="a" _msg="web end"
+`), 0644))
+	require.Nil(ioutil.WriteFile(api, []byte(
+		`2017-02-13T12:13:45.000Z ll="info" req="a" _msg="api start"
+bad line
+2017-02-13T12:13:46.500Z ll="error" req="a" _msg="api failed"
+`), 0644))
+
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"-key", "svc", web, "backend=" + api}, cli.Env{Stdout: &stdout, Stderr: &stderr})
+	assert.Equal(0, status)
+	assert.Equal(`2017-02-13T12:13:45.000Z ll="info" req="a" svc="web.log" _msg="web start"
+2017-02-13T12:13:45.000Z ll="info" req="a" svc="backend" _msg="api start"
+2017-02-13T12:13:46.500Z ll="error" req="a" svc="backend" _msg="api failed"
+2017-02-13T12:13:47.000Z ll="info" req="a" svc="web.log" _msg="web end"
+`, stdout.String())
+	assert.Contains(stderr.String(), "api.log:2:")
+}
+
+func TestKVMergeRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvmerge")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// checksummed and signed lines must still parse once the source is added
+	var buf bytes.Buffer
+	logger := kvlog.NewLogger(kvlog.NewSigningWriter(&buf, []byte("secret")), kvlog.New(kvlog.WithChecksum()))
+	logger.Log(log.InfoLevel, "first", kvlog.String("req", "a"))
+	logger.Log(log.WarnLevel, "second", kvlog.Int("n", 2))
+	path := filepath.Join(dir, "web.log")
+	require.Nil(t, ioutil.WriteFile(path, buf.Bytes(), 0644))
+
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"web=" + path}, cli.Env{Stdout: &stdout, Stderr: &stderr})
+	require.Equal(t, 0, status, stderr.String())
+	assert.NotContains(t, stdout.String(), "_sig=")
+
+	d := kvlog.NewDecoder(&stdout)
+	d.RequireChecksum()
+	var msgs []string
+	for d.Next() {
+		entry := d.Entry()
+		assert.Equal(t, "web", entry.Fields["source"])
+		msgs = append(msgs, entry.Message)
+	}
+	require.Nil(t, d.Err())
+	assert.Equal(t, []string{"first", "second"}, msgs)
+}
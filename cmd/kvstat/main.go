@@ -0,0 +1,209 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Command kvstat summarizes kvlog output, producing counts and statistics for
+numeric fields grouped by chosen keys, for quick triage without shipping
+logs anywhere.
+
+Usage:
+
+	kvstat [flags] [file ...]
+
+eg. to count entries by status and report the 95th percentile of
+duration_ms for each action:
+
+	kvstat -by status app.log
+	kvstat -by action -value duration_ms -p 95 app.log
+
+Groups are printed in order of decreasing count.  Entries missing a group
+key are grouped under "-".  Values that aren't numbers are ignored.
+
+Flags:
+
+	-by string
+	      comma separated list of keys to group by
+	-p string
+	      comma separated list of percentiles to report for each value (default "50,95,99")
+	-value string
+	      comma separated list of numeric keys to summarize
+	-where string
+	      only include entries matching an expression, as used by kvgrep
+*/
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/gwatts/kvlog"
+	"github.com/gwatts/kvlog/internal/cli"
+	"github.com/gwatts/kvlog/internal/expr"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], cli.Env{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}))
+}
+
+func run(args []string, env cli.Env) int {
+	fs := flag.NewFlagSet("kvstat", flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	by := fs.String("by", "", "comma separated list of keys to group by")
+	value := fs.String("value", "", "comma separated list of numeric keys to summarize")
+	pcts := fs.String("p", "50,95,99", "comma separated list of percentiles to report for each value")
+	where := fs.String("where", "", "only include entries matching an expression, as used by kvgrep")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	s := &stats{
+		by:     cli.List(*by),
+		values: cli.List(*value),
+		groups: make(map[string]*group),
+	}
+	for _, p := range cli.List(*pcts) {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil || f <= 0 || f > 100 {
+			env.Errorf("kvstat", "invalid percentile %q", p)
+			return 2
+		}
+		s.pcts = append(s.pcts, f)
+	}
+	if *where != "" {
+		x, err := expr.Parse(*where)
+		if err != nil {
+			env.Errorf("kvstat", "%v", err)
+			return 2
+		}
+		s.where = x
+	}
+
+	ok := env.EachInput("kvstat", fs.Args(), func(name string, in io.Reader) error {
+		d := kvlog.NewDecoder(in)
+		for d.Next() {
+			s.add(d.Entry())
+		}
+		return d.Err()
+	})
+	s.print(env.Stdout)
+	if !ok {
+		return 1
+	}
+	return 0
+}
+
+type group struct {
+	keys   []string
+	count  int
+	values [][]float64
+}
+
+type stats struct {
+	by     []string
+	values []string
+	pcts   []float64
+	where  *expr.Expr
+	groups map[string]*group
+}
+
+func (s *stats) add(e kvlog.Entry) {
+	if s.where != nil && !s.where.Match(e) {
+		return
+	}
+
+	keys := make([]string, len(s.by))
+	for i, k := range s.by {
+		keys[i] = "-"
+		if v, ok := expr.Lookup(e, k); ok {
+			keys[i] = fmt.Sprint(v)
+		}
+	}
+	id := strings.Join(keys, "\x00")
+	g := s.groups[id]
+	if g == nil {
+		g = &group{keys: keys, values: make([][]float64, len(s.values))}
+		s.groups[id] = g
+	}
+	g.count++
+
+	for i, k := range s.values {
+		v, _ := expr.Lookup(e, k)
+		switch v := v.(type) {
+		case int64:
+			g.values[i] = append(g.values[i], float64(v))
+		case float64:
+			g.values[i] = append(g.values[i], v)
+		}
+	}
+}
+
+func (s *stats) print(w io.Writer) {
+	groups := make([]*group, 0, len(s.groups))
+	for _, g := range s.groups {
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].count != groups[j].count {
+			return groups[i].count > groups[j].count
+		}
+		return strings.Join(groups[i].keys, "\x00") < strings.Join(groups[j].keys, "\x00")
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	header := append(append([]string{}, s.by...), "count")
+	for _, v := range s.values {
+		header = append(header, v+".sum", v+".min", v+".max", v+".avg")
+		for _, p := range s.pcts {
+			header = append(header, v+".p"+formatNum(p))
+		}
+	}
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+	for _, g := range groups {
+		row := append(append([]string{}, g.keys...), strconv.Itoa(g.count))
+		for _, vals := range g.values {
+			if len(vals) == 0 {
+				for i := 0; i < 4+len(s.pcts); i++ {
+					row = append(row, "-")
+				}
+				continue
+			}
+			sort.Float64s(vals)
+			sum := 0.0
+			for _, v := range vals {
+				sum += v
+			}
+			row = append(row, formatNum(sum), formatNum(vals[0]), formatNum(vals[len(vals)-1]), formatNum(sum/float64(len(vals))))
+			for _, p := range s.pcts {
+				row = append(row, formatNum(percentile(vals, p)))
+			}
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	tw.Flush()
+}
+
+// percentile returns the p'th percentile of sorted using the nearest rank
+// method.
+func percentile(sorted []float64, p float64) float64 {
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func formatNum(f float64) string {
+	if f == math.Trunc(f) && math.Abs(f) < 1e15 {
+		return strconv.FormatFloat(f, 'f', 0, 64)
+	}
+	return strconv.FormatFloat(f, 'f', 3, 64)
+}
@@ -0,0 +1,59 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gwatts/kvlog/internal/cli"
+)
+
+const testInput = `2017-02-13T12:13:45.000Z ll="info" status="ok" action="get" duration_ms=100
+2017-02-13T12:13:45.000Z ll="info" status="ok" action="get" duration_ms=200
+2017-02-13T12:13:45.000Z ll="info" status="ok" action="put" duration_ms=300.5
+2017-02-13T12:13:45.000Z ll="error" status="failed" action="get" duration_ms=900
+2017-02-13T12:13:45.000Z ll="error" action="get"
+`
+
+var kvstatTests = []struct {
+	name     string
+	args     []string
+	expected string
+}{
+	{"count", []string{"-by", "status"}, `status  count
+ok      3
+-       1
+failed  1
+`},
+	{"values", []string{"-by", "action", "-value", "duration_ms", "-p", "50,100"}, `action  count  duration_ms.sum  duration_ms.min  duration_ms.max  duration_ms.avg  duration_ms.p50  duration_ms.p100
+get     4      1200             100              900              400              200              900
+put     1      300.500          300.500          300.500          300.500          300.500          300.500
+`},
+	{"where", []string{"-where", "ll>=error", "-by", "action"}, `action  count
+get     2
+`},
+}
+
+func TestKVStat(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, test := range kvstatTests {
+		var stdout, stderr bytes.Buffer
+		status := run(test.args, cli.Env{Stdin: strings.NewReader(testInput), Stdout: &stdout, Stderr: &stderr})
+		assert.Equal(0, status, test.name+" should succeed")
+		assert.Equal(test.expected, stdout.String(), test.name+" output should match")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	vals := []float64{15, 20, 35, 40, 50}
+	assert.Equal(t, 20.0, percentile(vals, 30))
+	assert.Equal(t, 35.0, percentile(vals, 50))
+	assert.Equal(t, 50.0, percentile(vals, 100))
+}
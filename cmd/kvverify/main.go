@@ -0,0 +1,99 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Command kvverify checks the signatures of kvlog lines written by a
+kvlog.SigningWriter, to show that a log hasn't been altered.
+
+Usage:
+
+	kvverify -key file [flags] [file ...]
+
+eg.
+
+	kvverify -key /etc/app/log.key -chain audit.log
+
+Each line that fails verification is reported to stdout with its line
+number and the reason, followed by a count of the lines checked.  With
+-chain, the line after any that were removed or reordered is also
+reported; each file is verified as a separate chain.  The first line
+written after the program was restarted starts a new chain and so is
+reported as a broken chain.
+
+The key file's content, less any trailing newline, is used as the key.  The
+exit status is 0 if every line verified, 1 if any didn't and 2 if an error
+occurred.
+
+Flags:
+
+	-chain
+	      verify lines were signed with kvlog.SignChained
+	-key string
+	      file holding the signing key
+*/
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/gwatts/kvlog"
+	"github.com/gwatts/kvlog/internal/cli"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], cli.Env{Stdin: os.Stdin, Stdout: os.Stdout, Stderr: os.Stderr}))
+}
+
+func run(args []string, env cli.Env) int {
+	fs := flag.NewFlagSet("kvverify", flag.ContinueOnError)
+	fs.SetOutput(env.Stderr)
+	keyFile := fs.String("key", "", "file holding the signing key")
+	chain := fs.Bool("chain", false, "verify lines were signed with kvlog.SignChained")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *keyFile == "" {
+		env.Errorf("kvverify", "-key is required")
+		return 2
+	}
+	key, err := ioutil.ReadFile(*keyFile)
+	if err != nil {
+		env.Errorf("kvverify", "%v", err)
+		return 2
+	}
+	key = bytes.TrimRight(key, "\r\n")
+
+	var cfgs []kvlog.SignConfig
+	if *chain {
+		cfgs = append(cfgs, kvlog.SignChained())
+	}
+
+	var checked, failed int
+	ok := env.EachInput("kvverify", fs.Args(), func(name string, in io.Reader) error {
+		d := kvlog.NewDecoder(in)
+		d.VerifySignatures(kvlog.NewVerifier(key, cfgs...))
+		d.OnMalformed(func(lineNum int, _ []byte, err error) {
+			fmt.Fprintf(env.Stdout, "%s:%d: %v\n", name, lineNum, err)
+		})
+		for d.Next() {
+			checked++
+		}
+		checked += d.Malformed()
+		failed += d.Malformed()
+		return d.Err()
+	})
+	fmt.Fprintf(env.Stdout, "%d lines checked, %d failed\n", checked, failed)
+	switch {
+	case !ok:
+		return 2
+	case failed > 0:
+		return 1
+	}
+	return 0
+}
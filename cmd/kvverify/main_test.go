@@ -0,0 +1,74 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gwatts/kvlog"
+	"github.com/gwatts/kvlog/internal/cli"
+)
+
+func signedInput(t *testing.T) string {
+	var buf bytes.Buffer
+	w := kvlog.NewSigningWriter(&buf, []byte("secret"), kvlog.SignChained())
+	for _, msg := range []string{"one", "two", "three", "four"} {
+		_, err := w.Write([]byte(`2017-02-13T12:13:45.000Z ll="info" _msg="` + msg + "\"\n"))
+		require.Nil(t, err)
+	}
+	return buf.String()
+}
+
+func TestKVVerify(t *testing.T) {
+	f, err := ioutil.TempFile("", "kvverify")
+	require.Nil(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("secret\n")
+	f.Close()
+
+	lines := strings.SplitAfter(signedInput(t), "\n")
+	tampered := strings.Replace(lines[1], "two", "TWO", 1)
+
+	tests := []struct {
+		name     string
+		input    string
+		status   int
+		expected string
+	}{
+		{"valid", strings.Join(lines, ""), 0, "4 lines checked, 0 failed\n"},
+		{"tampered", lines[0] + tampered + lines[2] + lines[3], 1,
+			"-:2: kvlog: line signature mismatch\n4 lines checked, 1 failed\n"},
+		{"removed", lines[0] + lines[2] + lines[3], 1,
+			"-:2: kvlog: line signature mismatch\n3 lines checked, 1 failed\n"},
+		{"restarted", lines[0] + lines[1] + lines[0] + lines[1], 1,
+			"-:3: kvlog: signature chain broken\n4 lines checked, 1 failed\n"},
+		{"unsigned", lines[0] + "2017-02-13T12:13:45.000Z ll=\"info\"\n", 1,
+			"-:2: kvlog: line not signed\n2 lines checked, 1 failed\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			status := run([]string{"-key", f.Name(), "-chain"}, cli.Env{Stdin: strings.NewReader(test.input), Stdout: &stdout, Stderr: &stderr})
+			assert.Equal(t, test.status, status)
+			assert.Equal(t, test.expected, stdout.String())
+			assert.Equal(t, "", stderr.String())
+		})
+	}
+}
+
+func TestKVVerifyNoKey(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	status := run(nil, cli.Env{Stdin: strings.NewReader(""), Stdout: &stdout, Stderr: &stderr})
+	assert.Equal(t, 2, status)
+	assert.Equal(t, "kvverify: -key is required\n", stderr.String())
+}
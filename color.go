@@ -0,0 +1,78 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ANSI escape sequences used by WithColor
+const (
+	colorReset   = "\x1b[0m"
+	colorBold    = "\x1b[1m"
+	colorFaint   = "\x1b[2m"
+	colorRed     = "\x1b[31m"
+	colorGreen   = "\x1b[32m"
+	colorYellow  = "\x1b[33m"
+	colorBlue    = "\x1b[34m"
+	colorMagenta = "\x1b[35m"
+	colorCyan    = "\x1b[36m"
+	colorGray    = "\x1b[90m"
+)
+
+// WithColor causes the Formatter to colorize k=v output using ANSI escape
+// codes for easier reading on a terminal during development.
+//
+// The timestamp is dimmed, the level is colored by severity, keys are cyan,
+// quoted values are green and all other values magenta.  Field ordering is
+// unchanged.  Color should not be enabled for output that is to be consumed
+// by other tools.
+func WithColor() Config {
+	return func(kvf *Formatter) {
+		kvf.color = true
+	}
+}
+
+// levelColor returns the color used to display level.
+func levelColor(level log.Level) string {
+	switch level {
+	case log.PanicLevel, log.FatalLevel, log.ErrorLevel:
+		return colorRed
+	case log.WarnLevel:
+		return colorYellow
+	case log.InfoLevel:
+		return colorBlue
+	default:
+		return colorGray
+	}
+}
+
+func (cf *Formatter) emitColorLevel(b *bytes.Buffer, level log.Level) {
+	fmt.Fprintf(b, " %sll%s=%s%s%q%s", colorCyan, colorReset, colorBold, levelColor(level), level, colorReset)
+}
+
+// emitColor writes a k=v pair with ANSI colors applied to the key and value.
+func (cf *Formatter) emitColor(b *bytes.Buffer, k string, v interface{}) {
+	b.WriteString(colorCyan)
+	b.WriteString(sanitizeKey(k))
+	b.WriteString(colorReset)
+	b.WriteByte('=')
+
+	start := b.Len()
+	cf.emitValue(b, v)
+	val := append([]byte(nil), b.Bytes()[start:]...)
+	b.Truncate(start)
+
+	if len(val) > 0 && val[0] == '"' {
+		b.WriteString(colorGreen)
+	} else {
+		b.WriteString(colorMagenta)
+	}
+	b.Write(val)
+	b.WriteString(colorReset)
+}
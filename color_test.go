@@ -0,0 +1,43 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+var ansiRE = regexp.MustCompile("\x1b\\[[0-9;]*m")
+
+func TestColor(t *testing.T) {
+	assert := assert.New(t)
+
+	entry := &log.Entry{
+		Time:    testTime,
+		Level:   log.ErrorLevel,
+		Message: "test message",
+		Data: log.Fields{
+			"field1": "value1",
+			"field2": 123,
+			"status": "failed",
+		},
+	}
+	cfgs := []Config{WithConstantField("commit", "abcd"), WithPrimaryFields("status")}
+
+	plain, _ := New(cfgs...).Format(entry)
+	colored, _ := New(append(cfgs, WithColor())...).Format(entry)
+
+	assert.NotEqual(string(plain), string(colored))
+	assert.Equal(string(plain), ansiRE.ReplaceAllString(string(colored), ""), "stripped output should match")
+	assert.True(strings.Contains(string(colored), "\x1b[31m\"error\""), "level should be red")
+	assert.True(strings.Contains(string(colored), "\x1b[36mfield2\x1b[0m=\x1b[35m123"), "number should be magenta")
+	assert.True(strings.Contains(string(colored), "\x1b[36mfield1\x1b[0m=\x1b[32m\"value1\""), "string should be green")
+}
@@ -0,0 +1,54 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"context"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+type contextKey int
+
+const fieldsKey contextKey = 0
+
+// ContextWithFields returns a copy of ctx carrying fields in addition to any
+// fields already attached to ctx.  Where keys clash, the values in fields
+// take precedence.
+//
+// Fields attached to a context are included in entries logged through the
+// entry returned by FromContext, so that values such as a request or tenant
+// ID need only be supplied once per request.
+func ContextWithFields(ctx context.Context, fields log.Fields) context.Context {
+	existing := ContextFields(ctx)
+	merged := make(log.Fields, len(existing)+len(fields))
+	for k, v := range existing {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, fieldsKey, merged)
+}
+
+// ContextFields returns the fields attached to ctx by ContextWithFields, or
+// nil if there are none.  The returned map should not be modified.
+func ContextFields(ctx context.Context) log.Fields {
+	fields, _ := ctx.Value(fieldsKey).(log.Fields)
+	return fields
+}
+
+// FromContext returns an entry for logger that includes the fields
+// attached to ctx.  The entry also carries ctx itself, so that hooks can
+// extract other values from it such as an active trace span.
+//
+// eg.
+//
+//	ctx = kvlog.ContextWithFields(ctx, log.Fields{"request_id": id})
+//	...
+//	kvlog.FromContext(ctx, log.StandardLogger()).Info("order placed")
+func FromContext(ctx context.Context, logger log.FieldLogger) *log.Entry {
+	return logger.WithFields(ContextFields(ctx)).WithContext(ctx)
+}
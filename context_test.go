@@ -0,0 +1,50 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestContextFields(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	assert.Nil(ContextFields(ctx))
+
+	parent := ContextWithFields(ctx, log.Fields{"request_id": "abc", "tenant_id": 1})
+	child := ContextWithFields(parent, log.Fields{"tenant_id": 2, "user": "joe"})
+
+	assert.Equal(log.Fields{"request_id": "abc", "tenant_id": 1}, ContextFields(parent))
+	assert.Equal(log.Fields{"request_id": "abc", "tenant_id": 2, "user": "joe"}, ContextFields(child))
+}
+
+func TestFromContext(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger := &log.Logger{
+		Out:       &buf,
+		Formatter: New(WithPrimaryFields("request_id")),
+		Level:     log.InfoLevel,
+	}
+
+	ctx := ContextWithFields(context.Background(), log.Fields{"request_id": "abc", "tenant_id": 1})
+	FromContext(ctx, logger).WithField("action", "order").Info("order placed")
+	FromContext(context.Background(), logger).Info("no fields")
+
+	expected := `ll="info" request_id="abc" action="order" tenant_id=1 _msg="order placed"
+ll="info" _msg="no fields"
+`
+	assert.Equal(expected, regexp.MustCompile(`(?m)^\S+ `).ReplaceAllString(buf.String(), ""))
+}
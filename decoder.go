@@ -0,0 +1,175 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const maxLineSize = 1 << 20
+
+// Decoder reads and parses k=v log lines from an input stream one at a time,
+// so that arbitrarily large log files can be processed without loading them
+// into memory.
+//
+// Lines that cannot be parsed, or that are longer than 1MB, are skipped and
+// reported to the function passed to OnMalformed, if any.  Blank lines are
+// ignored.
+//
+// eg.
+//
+//	d := kvlog.NewDecoder(f)
+//	for d.Next() {
+//	    e := d.Entry()
+//	    ...
+//	}
+//	if err := d.Err(); err != nil {
+//	    ...
+//	}
+type Decoder struct {
+	r           *bufio.Reader
+	entry       Entry
+	line        []byte
+	lineNum     int
+	malformed   int
+	onMalformed func(lineNum int, line []byte, err error)
+	checksum    bool
+	verifier    *Verifier
+	err         error
+}
+
+// NewDecoder creates a Decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// OnMalformed sets a function to be called with the line number, content
+// and parse error of each line that's skipped.  The line slice is only valid
+// until the function returns.
+func (d *Decoder) OnMalformed(f func(lineNum int, line []byte, err error)) {
+	d.onMalformed = f
+}
+
+// RequireChecksum causes lines without a _cksum field, as added by
+// WithChecksum, to be skipped as malformed along with those whose checksum
+// doesn't match, so that lines cut short are detected.
+func (d *Decoder) RequireChecksum() {
+	d.checksum = true
+}
+
+// VerifySignatures causes each line to be checked with v, as it's read,
+// and skipped as malformed if its signature is missing or invalid.  Every
+// line of the input is passed to v, in order, so that chained signatures
+// can be verified.
+func (d *Decoder) VerifySignatures(v *Verifier) {
+	d.verifier = v
+}
+
+// Next advances to the next successfully parsed entry, returning false at
+// the end of the input or if a read error occurs.
+func (d *Decoder) Next() bool {
+	for d.err == nil {
+		line, err := d.readLine()
+		if err != nil {
+			if err != io.EOF {
+				d.err = err
+			}
+			return false
+		}
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if d.verifier != nil {
+			if err := d.verifier.Verify(line); err != nil {
+				d.skip(line, err)
+				continue
+			}
+		}
+		entry, err := Parse(line)
+		if err == nil && d.checksum && !entry.Checksummed {
+			err = &SyntaxError{"missing checksum", len(line)}
+		}
+		if err != nil {
+			d.skip(line, err)
+			continue
+		}
+		d.entry = entry
+		d.line = line
+		return true
+	}
+	return false
+}
+
+// Entry returns the entry parsed by the most recent call to Next.
+func (d *Decoder) Entry() Entry {
+	return d.entry
+}
+
+// Line returns the raw text of the entry returned by Entry, without its
+// trailing newline.  The slice is only valid until the next call to Next.
+func (d *Decoder) Line() []byte {
+	return d.line
+}
+
+// LineNum returns the line number of the entry returned by Entry, counting
+// from 1.
+func (d *Decoder) LineNum() int {
+	return d.lineNum
+}
+
+// Malformed returns the number of lines skipped so far.
+func (d *Decoder) Malformed() int {
+	return d.malformed
+}
+
+// Err returns the first non-EOF read error encountered.
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+func (d *Decoder) skip(line []byte, err error) {
+	d.malformed++
+	if d.onMalformed != nil {
+		d.onMalformed(d.lineNum, line, err)
+	}
+}
+
+// readLine returns the next line without its line ending.  Lines longer
+// than maxLineSize are discarded and reported as malformed.
+func (d *Decoder) readLine() ([]byte, error) {
+	for {
+		line, err := d.r.ReadSlice('\n')
+		if err == nil || (err == io.EOF && len(line) > 0) {
+			d.lineNum++
+			return bytes.TrimRight(line, "\r\n"), nil
+		}
+		if err != bufio.ErrBufferFull {
+			return nil, err
+		}
+
+		// accumulate a long line up to the limit
+		buf := append([]byte(nil), line...)
+		for err == bufio.ErrBufferFull {
+			line, err = d.r.ReadSlice('\n')
+			if len(buf) <= maxLineSize {
+				buf = append(buf, line...)
+			}
+		}
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		d.lineNum++
+		if len(buf) <= maxLineSize {
+			return bytes.TrimRight(buf, "\r\n"), nil
+		}
+		d.skip(buf[:maxLineSize], fmt.Errorf("kvlog: line exceeds %d bytes", maxLineSize))
+		if err == io.EOF {
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestDecoder(t *testing.T) {
+	assert := assert.New(t)
+
+	input := strings.Join([]string{
+		`2017-02-13T12:13:45.000Z ll="info" a=1 _msg="first"`,
+		`garbage line`,
+		``,
+		`2017-02-13T12:13:45.000Z ll="warning" a=2 _msg="second"`,
+		`2017-02-13T12:13:45.000Z ll="error" a="` + strings.Repeat("x", 2<<20) + `"`,
+		`2017-02-13T12:13:45.000Z ll="error" a=3 _msg="third"`,
+	}, "\n")
+
+	var badLines []int
+	d := NewDecoder(strings.NewReader(input))
+	d.OnMalformed(func(lineNum int, line []byte, err error) {
+		badLines = append(badLines, lineNum)
+	})
+
+	var msgs []string
+	var lineNums []int
+	for d.Next() {
+		msgs = append(msgs, d.Entry().Message)
+		lineNums = append(lineNums, d.LineNum())
+		assert.True(strings.HasPrefix(string(d.Line()), "2017-02-13"))
+	}
+	assert.Nil(d.Err())
+	assert.Equal([]string{"first", "second", "third"}, msgs)
+	assert.Equal([]int{1, 4, 6}, lineNums)
+	assert.Equal([]int{2, 5}, badLines)
+	assert.Equal(2, d.Malformed())
+}
@@ -0,0 +1,181 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// DedupConfig represents a configuration function to be passed to
+// NewDeduper.
+type DedupConfig func(d *Deduper)
+
+// DedupTimeout sets the maximum time an entry is held waiting for
+// repeats before being written.  The default is one second.
+func DedupTimeout(timeout time.Duration) DedupConfig {
+	return func(d *Deduper) {
+		d.timeout = timeout
+	}
+}
+
+// Deduper is a LevelWriter that collapses runs of identical entries into a
+// single entry with a repeat_count field, so that a message logged in a
+// tight loop occupies one line rather than thousands.
+//
+// eg.
+//
+//	d := kvlog.NewDeduper(os.Stderr)
+//	defer d.Close()
+//	logrus.SetOutput(d)
+//
+// Entries are identical if they differ only in their timestamp; the level,
+// message, caller and every field must match.  Each entry is held until a
+// different entry is written or the timeout set by DedupTimeout passes, and
+// then written with the timestamp of its first occurrence.  If it was
+// repeated, a repeat_count field holding the total number of occurrences is
+// added, eg.
+//
+//	2017-02-13T12:13:45.000Z ll="error" error="connection refused" repeat_count=1042 _msg="query failed"
+//
+// As an entry is only written once the next is received, an error writing
+// it is returned from the following call to Write, or reported to the
+// handler set by SetErrorHandler if it's written once the timeout passes.
+// Close should be called before the program exits to write the last entry.
+type Deduper struct {
+	out     io.Writer
+	timeout time.Duration
+
+	mu     sync.Mutex
+	held   []byte
+	level  log.Level
+	key    string
+	count  int
+	gen    int // incremented each time a new entry is held
+	timer  *time.Timer
+	closed bool
+}
+
+// NewDeduper creates a Deduper that writes to out.
+func NewDeduper(out io.Writer, cfgs ...DedupConfig) *Deduper {
+	d := &Deduper{out: out, timeout: time.Second}
+	for _, cfg := range cfgs {
+		cfg(d)
+	}
+	RegisterShutdown(d)
+	return d
+}
+
+// Write implements io.Writer, reading the entry's level from the line.
+func (d *Deduper) Write(p []byte) (int, error) {
+	return d.WriteLevel(lineLevel(p), p)
+}
+
+// WriteLevel implements LevelWriter.
+func (d *Deduper) WriteLevel(level log.Level, p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	key := dedupKey(p)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return 0, errWriterClosed
+	}
+	if d.held != nil && key == d.key {
+		d.count++
+		return len(p), nil
+	}
+
+	err := d.flush()
+	d.held = append([]byte(nil), p...)
+	d.level, d.key, d.count = level, key, 1
+	d.gen++
+	gen := d.gen
+	d.timer = time.AfterFunc(d.timeout, func() { d.expire(gen) })
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// expire writes the held entry if it's still the one held as generation
+// gen.
+func (d *Deduper) expire(gen int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.gen == gen {
+		if err := d.flush(); err != nil {
+			internalError(fmt.Errorf("kvlog: failed to write deduplicated entry: %w", err))
+		}
+	}
+}
+
+// flush writes the held entry; d.mu must be held.
+func (d *Deduper) flush() error {
+	if d.held == nil {
+		return nil
+	}
+	line := d.held
+	if d.count > 1 {
+		line = addLineFields(line, field{"repeat_count", d.count})
+	}
+	d.held = nil
+	d.timer.Stop()
+	_, err := writeLevel(d.out, d.level, line)
+	return err
+}
+
+// Flush writes the held entry immediately.
+func (d *Deduper) Flush() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.flush()
+}
+
+// Close writes the held entry.  The underlying writer is left open.
+func (d *Deduper) Close() error {
+	UnregisterShutdown(d)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return nil
+	}
+	d.closed = true
+	return d.flush()
+}
+
+// jsonTimeKeys holds the keys used for the timestamp by the JSON formats.
+var jsonTimeKeys = []string{"time", "timestamp", "@timestamp"}
+
+// dedupKey returns a formatted line without its timestamp.
+func dedupKey(line []byte) string {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) > 0 && line[0] == '{' {
+		var obj map[string]interface{}
+		if json.Unmarshal(line, &obj) == nil {
+			for _, k := range jsonTimeKeys {
+				delete(obj, k)
+			}
+			if b, err := json.Marshal(obj); err == nil {
+				return string(b)
+			}
+		}
+		return string(line)
+	}
+	line, _, _ = splitChecksum(line)
+	if sp := bytes.IndexByte(line, ' '); sp != -1 {
+		if _, err := time.Parse(timestampFormat, string(line[:sp])); err == nil {
+			return string(line[sp:])
+		}
+	}
+	return string(line)
+}
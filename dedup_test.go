@@ -0,0 +1,88 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestDeduper(t *testing.T) {
+	out := new(syncBuffer)
+	d := NewDeduper(out, DedupTimeout(time.Hour))
+	lines := []string{
+		`2017-02-13T12:13:45.000Z ll="error" error="refused" _msg="query failed"`,
+		`2017-02-13T12:13:45.001Z ll="error" error="refused" _msg="query failed"`,
+		`2017-02-13T12:13:45.002Z ll="error" error="refused" _msg="query failed"`,
+		`2017-02-13T12:13:45.003Z ll="error" error="timeout" _msg="query failed"`,
+		`2017-02-13T12:13:45.004Z ll="info" _msg="query failed"`,
+		`2017-02-13T12:13:45.005Z ll="info" _msg="query failed"`,
+	}
+	for _, line := range lines {
+		n, err := d.Write([]byte(line + "\n"))
+		require.Nil(t, err)
+		assert.Equal(t, len(line)+1, n)
+	}
+	require.Nil(t, d.Close())
+	assert.False(t, out.closed)
+
+	expected := []string{
+		`2017-02-13T12:13:45.000Z ll="error" error="refused" repeat_count=3 _msg="query failed"`,
+		`2017-02-13T12:13:45.003Z ll="error" error="timeout" _msg="query failed"`,
+		`2017-02-13T12:13:45.004Z ll="info" repeat_count=2 _msg="query failed"`,
+	}
+	assert.Equal(t, strings.Join(expected, "\n")+"\n", string(out.Bytes()))
+
+	_, err := d.Write([]byte(lines[0]))
+	assert.NotNil(t, err)
+}
+
+func TestDeduperJSON(t *testing.T) {
+	var buf bytes.Buffer
+	d := NewDeduper(&buf, DedupTimeout(time.Hour))
+	d.Write([]byte(`{"time":"2017-02-13T12:13:45.000Z","ll":"info","_msg":"hi"}` + "\n"))
+	d.Write([]byte(`{"time":"2017-02-13T12:13:46.000Z","ll":"info","_msg":"hi"}` + "\n"))
+	require.Nil(t, d.Flush())
+	assert.Equal(t, `{"time":"2017-02-13T12:13:45.000Z","ll":"info","_msg":"hi","repeat_count":2}`+"\n", buf.String())
+}
+
+func TestDeduperTimeout(t *testing.T) {
+	out := new(syncBuffer)
+	d := NewDeduper(out, DedupTimeout(10*time.Millisecond))
+	defer d.Close()
+	line := []byte(`2017-02-13T12:13:45.000Z ll="info" _msg="tick"` + "\n")
+	d.Write(line)
+	d.Write(line)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(out.Bytes()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" repeat_count=2 _msg="tick"`+"\n", string(out.Bytes()))
+}
+
+func TestDeduperTimeoutError(t *testing.T) {
+	errs := make(chan error, 1)
+	SetErrorHandler(func(err error) { errs <- err })
+	defer SetErrorHandler(nil)
+
+	d := NewDeduper(errWriter{}, DedupTimeout(10*time.Millisecond))
+	defer d.Close()
+	d.Write([]byte(`2017-02-13T12:13:45.000Z ll="info" _msg="tick"` + "\n"))
+
+	select {
+	case err := <-errs:
+		assert.Contains(t, err.Error(), "failed to write deduplicated entry")
+	case <-time.After(5 * time.Second):
+		t.Fatal("error not reported")
+	}
+}
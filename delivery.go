@@ -0,0 +1,155 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is reported by the HTTP based sinks when a batch is
+// discarded without being sent because recent requests have failed.
+var ErrCircuitOpen = errors.New("kvlog: circuit open; endpoint unavailable")
+
+// RetryPolicy controls how the HTTP based sinks, OTLPExporter,
+// HECForwarder and LokiWriter, retry failed requests and stop sending to
+// an endpoint that's down.
+//
+// A request is retried if it fails to connect or the endpoint responds
+// with a 429 or 5xx status.  The delay before each retry starts at
+// MinBackoff and doubles on each attempt up to MaxBackoff, with random
+// jitter so that many clients don't retry in step.  A Retry-After header
+// on the response is respected, up to MaxBackoff.
+//
+// Once BreakerThreshold consecutive batches have failed, the circuit
+// breaker opens and batches are discarded, reporting ErrCircuitOpen, until
+// BreakerCooldown has passed.  The next batch is then sent as a trial; if
+// it succeeds the circuit closes again.  This prevents a dead endpoint from
+// holding entries, and the goroutines sending them, indefinitely.
+type RetryPolicy struct {
+	Retries          int
+	MinBackoff       time.Duration
+	MaxBackoff       time.Duration
+	BreakerThreshold int // 0 disables the circuit breaker
+	BreakerCooldown  time.Duration
+}
+
+// DefaultRetryPolicy is the policy used by the HTTP based sinks unless
+// configured otherwise.
+var DefaultRetryPolicy = RetryPolicy{
+	Retries:          3,
+	MinBackoff:       500 * time.Millisecond,
+	MaxBackoff:       30 * time.Second,
+	BreakerThreshold: 5,
+	BreakerCooldown:  30 * time.Second,
+}
+
+// deliverer sends HTTP requests according to a RetryPolicy.
+type deliverer struct {
+	policy RetryPolicy
+	client *http.Client
+	desc   string // used in error messages, eg. "Loki push"
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+
+	closing   chan struct{} // closed to abandon retries
+	closeOnce sync.Once
+}
+
+func newDeliverer(policy RetryPolicy, client *http.Client, desc string) *deliverer {
+	return &deliverer{
+		policy:  policy,
+		client:  client,
+		desc:    desc,
+		closing: make(chan struct{}),
+	}
+}
+
+// close causes requests to be attempted once, without waiting to retry,
+// and interrupts any wait in progress, so that a sink being closed doesn't
+// wait through the backoff schedule.
+func (d *deliverer) close() {
+	d.closeOnce.Do(func() { close(d.closing) })
+}
+
+// do sends the request returned by newReq, which is called for each
+// attempt, returning an error if it ultimately fails.
+func (d *deliverer) do(newReq func() (*http.Request, error)) error {
+	d.mu.Lock()
+	open := time.Now().Before(d.openUntil)
+	d.mu.Unlock()
+	if open {
+		return ErrCircuitOpen
+	}
+
+	err := d.attempt(newReq)
+
+	d.mu.Lock()
+	if err == nil {
+		d.failures = 0
+	} else if d.failures++; d.policy.BreakerThreshold > 0 && d.failures >= d.policy.BreakerThreshold {
+		d.openUntil = time.Now().Add(d.policy.BreakerCooldown)
+	}
+	d.mu.Unlock()
+	return err
+}
+
+func (d *deliverer) attempt(newReq func() (*http.Request, error)) error {
+	backoff := d.policy.MinBackoff
+	for attempt := 0; ; attempt++ {
+		req, err := newReq()
+		if err != nil {
+			return err
+		}
+		var wait time.Duration
+		resp, err := d.client.Do(req)
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode/100 == 2 {
+				return nil
+			}
+			err = fmt.Errorf("kvlog: %s failed: %s", d.desc, resp.Status)
+			if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode/100 != 5 {
+				return err
+			}
+			if secs, perr := strconv.Atoi(resp.Header.Get("Retry-After")); perr == nil {
+				wait = time.Duration(secs) * time.Second
+			}
+		}
+		if attempt >= d.policy.Retries {
+			return err
+		}
+		select {
+		case <-d.closing:
+			return err
+		default:
+		}
+
+		if wait == 0 && backoff > 0 {
+			// equal jitter: wait between half and all of the backoff
+			wait = backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		}
+		if d.policy.MaxBackoff > 0 && wait > d.policy.MaxBackoff {
+			wait = d.policy.MaxBackoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-d.closing:
+			timer.Stop()
+			return err
+		}
+		if backoff *= 2; d.policy.MaxBackoff > 0 && backoff > d.policy.MaxBackoff {
+			backoff = d.policy.MaxBackoff
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+// statusServer responds to each request with the next of statuses, and
+// 200 once they're exhausted.
+func statusServer(statuses ...int) (*httptest.Server, *int32) {
+	var count int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&count, 1)
+		if int(n) <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+		}
+	}))
+	return srv, &count
+}
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		retries  int
+		ok       bool
+		requests int32
+	}{
+		{"success", nil, 3, true, 1},
+		{"recovers", []int{503, 429}, 3, true, 3},
+		{"exhausted", []int{503, 503, 503}, 2, false, 3},
+		{"not-retryable", []int{400}, 3, false, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			srv, count := statusServer(test.statuses...)
+			defer srv.Close()
+
+			w := NewLokiWriter(srv.URL, LokiRetryPolicy(RetryPolicy{
+				Retries:    test.retries,
+				MinBackoff: time.Millisecond,
+			}))
+			defer w.Close()
+			w.Write([]byte("line\n"))
+			err := w.Flush()
+			assert.Equal(t, test.ok, err == nil, "err=%v", err)
+			assert.Equal(t, test.requests, atomic.LoadInt32(count))
+		})
+	}
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	srv, count := statusServer(503, 503, 503)
+	defer srv.Close()
+
+	exp := NewOTLPExporter(New(), srv.URL, OTLPRetryPolicy(RetryPolicy{
+		BreakerThreshold: 2,
+		BreakerCooldown:  50 * time.Millisecond,
+	}))
+	defer exp.Close()
+	fire := func() error {
+		exp.Fire(&log.Entry{Time: testTime, Level: log.InfoLevel, Message: "msg"})
+		return exp.Flush()
+	}
+
+	assert.NotNil(t, fire())
+	assert.NotNil(t, fire())
+	// the circuit is now open, so the endpoint isn't contacted
+	assert.Equal(t, ErrCircuitOpen, fire())
+	assert.Equal(t, int32(2), atomic.LoadInt32(count))
+
+	// after the cooldown a trial request is made; it fails, reopening the
+	// circuit
+	time.Sleep(60 * time.Millisecond)
+	assert.NotNil(t, fire())
+	assert.Equal(t, ErrCircuitOpen, fire())
+	assert.Equal(t, int32(3), atomic.LoadInt32(count))
+
+	// the next trial succeeds and closes the circuit
+	time.Sleep(60 * time.Millisecond)
+	assert.Nil(t, fire())
+	assert.Nil(t, fire())
+	assert.Equal(t, int32(5), atomic.LoadInt32(count))
+}
+
+func TestCloseInterruptsRetry(t *testing.T) {
+	srv, count := statusServer(503, 503, 503, 503)
+	defer srv.Close()
+
+	// without a report of the dropped line, which Close would otherwise send
+	policy := DefaultQueuePolicy
+	policy.ReportInterval = 0
+	w := NewLokiWriter(srv.URL, LokiQueuePolicy(policy), LokiRetryPolicy(RetryPolicy{
+		Retries:    3,
+		MinBackoff: time.Hour,
+		MaxBackoff: time.Hour,
+	}))
+	w.Write([]byte("line\n"))
+	flushed := make(chan error, 1)
+	go func() { flushed <- w.Flush() }()
+	for atomic.LoadInt32(count) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	closed := make(chan error, 1)
+	go func() { closed <- w.Close() }()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close waited for the retry backoff")
+	}
+	assert.NotNil(t, <-flushed)
+	assert.Equal(t, int32(1), atomic.LoadInt32(count))
+}
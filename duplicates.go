@@ -0,0 +1,131 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DuplicateKeyPolicy selects how WithDuplicateKeys resolves a key that
+// would be emitted more than once in a single entry.
+type DuplicateKeyPolicy int
+
+const (
+	// KeepFirstKey keeps the first field with the key, in the order
+	// constant fields, primary fields and then other fields, and drops the
+	// rest.
+	KeepFirstKey DuplicateKeyPolicy = iota
+
+	// KeepLastKey keeps the value of the last field with the key, so that
+	// an entry field replaces a constant field with the same key.
+	KeepLastKey
+
+	// SuffixDuplicateKeys keeps every field, renaming the second and
+	// subsequent fields with the key by adding _2, _3 and so on.
+	SuffixDuplicateKeys
+)
+
+// DuplicateKeyError is reported the first time a key is found to be
+// repeated within an entry by a Formatter using WithDuplicateKeys.
+type DuplicateKeyError struct {
+	Key string
+}
+
+func (e *DuplicateKeyError) Error() string {
+	return fmt.Sprintf("kvlog: field key %q emitted more than once in an entry", e.Key)
+}
+
+type duplicateKeys struct {
+	policy   DuplicateKeyPolicy
+	reported sync.Map // keys already reported
+}
+
+// WithDuplicateKeys resolves keys that would otherwise appear more than
+// once on a line according to policy, such as a constant field "env" and an
+// entry field of the same name, or a key produced by a Loggable value that
+// matches another field's key.  Without it both fields are emitted, leaving
+// the value extracted by an indexer such as Splunk undefined.
+//
+// Each repeated key is reported to the handler set by WithErrorHandler, as
+// a DuplicateKeyError, the first time it's seen.  Formatters created by
+// Child share the keys reported by their parent.
+func WithDuplicateKeys(policy DuplicateKeyPolicy) Config {
+	return func(kvf *Formatter) {
+		kvf.dupKeys = &duplicateKeys{policy: policy}
+	}
+}
+
+// resolveDuplicates applies the policy set by WithDuplicateKeys to the
+// entry fields, which may repeat each other's keys or those of the constant
+// fields of fc.  Under KeepLastKey, a field repeating an earlier entry
+// field's key replaces its value in place, while one repeating a constant's
+// key is kept and the constant omitted by constantReplaced.
+func (cf *Formatter) resolveDuplicates(fc *fieldConfig, fields []field) []field {
+	if cf.dupKeys == nil || len(fields) == 0 {
+		return fields
+	}
+	seen := make(map[string]int, len(fc.constants)+len(fields)) // index in result, or -1 for constants
+	for _, f := range fc.constants {
+		seen[f.key] = -1
+	}
+	result := fields[:0]
+	for _, f := range fields {
+		i, dup := seen[f.key]
+		if !dup {
+			seen[f.key] = len(result)
+			result = append(result, f)
+			continue
+		}
+		cf.dupKeys.report(cf, f.key)
+		switch cf.dupKeys.policy {
+		case KeepFirstKey:
+			continue
+		case KeepLastKey:
+			if i >= 0 {
+				result[i].value = f.value
+				continue
+			}
+		case SuffixDuplicateKeys:
+			for n := 2; ; n++ {
+				k := fmt.Sprintf("%s_%d", f.key, n)
+				if _, ok := seen[k]; !ok {
+					f.key = k
+					break
+				}
+			}
+		}
+		seen[f.key] = len(result)
+		result = append(result, f)
+	}
+	return result
+}
+
+// constantReplaced reports whether the constant field with key k is
+// replaced by one of the entry fields under KeepLastKey.
+func (cf *Formatter) constantReplaced(k string, fields []field) bool {
+	return cf.dupKeys != nil && cf.dupKeys.policy == KeepLastKey && hasField(fields, k)
+}
+
+// entryConstants returns the constant fields of fc to be emitted along with
+// fields, omitting any replaced by an entry field.
+func (cf *Formatter) entryConstants(fc *fieldConfig, fields []field) []field {
+	if cf.dupKeys == nil || cf.dupKeys.policy != KeepLastKey {
+		return fc.constants
+	}
+	constants := make([]field, 0, len(fc.constants))
+	for _, f := range fc.constants {
+		if !hasField(fields, f.key) {
+			constants = append(constants, f)
+		}
+	}
+	return constants
+}
+
+func (d *duplicateKeys) report(cf *Formatter, k string) {
+	if _, loaded := d.reported.LoadOrStore(k, struct{}{}); !loaded {
+		cf.reportError(&DuplicateKeyError{Key: k})
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestDuplicateKeys(t *testing.T) {
+	data := log.Fields{
+		"env":  "dev",
+		"user": Ordered(".id", 1),
+		"":     Ordered("user.id", 2, "env_2", "x"),
+	}
+	tests := []struct {
+		name     string
+		cfgs     []Config
+		expected string
+	}{
+		{"none", nil,
+			`env="prod" user.id=2 env_2="x" env="dev" user.id=1`},
+		{"first", []Config{WithDuplicateKeys(KeepFirstKey)},
+			`env="prod" user.id=2 env_2="x"`},
+		{"last", []Config{WithDuplicateKeys(KeepLastKey)},
+			`user.id=1 env_2="x" env="dev"`},
+		{"suffix", []Config{WithDuplicateKeys(SuffixDuplicateKeys)},
+			`env="prod" user.id=2 env_2="x" env_3="dev" user.id_2=1`},
+		{"json-last", []Config{WithDuplicateKeys(KeepLastKey), WithJSON()},
+			`{"time":"2017-02-13T12:13:45.000Z","ll":"info","user.id":1,"env_2":"x","env":"dev"}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfgs := append([]Config{WithConstantField("env", "prod"), WithErrorHandler(func(error) {})}, test.cfgs...)
+			result, err := New(cfgs...).Format(&log.Entry{Time: testTime, Level: log.InfoLevel, Data: data})
+			require.Nil(t, err)
+			if strings.HasPrefix(test.expected, "{") {
+				assert.JSONEq(t, test.expected, string(result))
+				return
+			}
+			assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" `+test.expected, strings.TrimSuffix(string(result), "\n"))
+		})
+	}
+}
+
+func TestDuplicateKeysReported(t *testing.T) {
+	var errs []error
+	cf := New(WithConstantField("env", "prod"), WithDuplicateKeys(KeepFirstKey), WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+	child := cf.Child()
+	for i := 0; i < 3; i++ {
+		child.Format(&log.Entry{Time: testTime, Level: log.InfoLevel, Data: log.Fields{"env": "dev"}})
+	}
+	require.Len(t, errs, 1)
+	assert.Equal(t, &DuplicateKeyError{Key: "env"}, errs[0])
+	assert.Equal(t, `kvlog: field key "env" emitted more than once in an entry`, errs[0].Error())
+}
@@ -0,0 +1,131 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// reserved keys used by the Embedded Metric Format output
+var emfKeys = map[string]struct{}{
+	"_aws":    {},
+	"level":   {},
+	"message": {},
+}
+
+// Metric marks a numeric field value as a CloudWatch metric with the given
+// unit.  Unit should be one of the units supported by CloudWatch, such as
+// "Milliseconds", "Bytes" or "Count"; if empty "None" is used.
+//
+// In k=v output a Metric is formatted as a plain number.  If the Formatter
+// is configured WithEMF the field is also declared as a metric in the entry's
+// Embedded Metric Format metadata.
+type Metric struct {
+	Value float64
+	Unit  string
+}
+
+// MarshalLogValue implements the Marshaler interface.
+func (m Metric) MarshalLogValue() string {
+	return strconv.FormatFloat(m.Value, 'g', -1, 64)
+}
+
+var _ Marshaler = Metric{} // assert that Metric implements the Marshaler interface.
+
+// WithEMF causes the Formatter to emit each entry as a CloudWatch Embedded
+// Metric Format JSON object.  Any field with a Metric value is published as
+// a metric in the given namespace, using the named fields as its dimensions.
+//
+// Dimension fields that aren't set for an entry are omitted from that
+// entry's dimension set.  Entries without any Metric fields are emitted as
+// plain JSON objects that CloudWatch Logs ingests without creating metrics.
+//
+// eg.
+//
+//	log.WithFields(log.Fields{
+//	    "service": "checkout",
+//	    "latency": kvlog.Metric{Value: 12.5, Unit: "Milliseconds"},
+//	}).Info("order placed")
+func WithEMF(namespace string, dimensions ...string) Config {
+	dims := append([]string{}, dimensions...)
+	return func(kvf *Formatter) {
+		kvf.encode = func(cf *Formatter, b *bytes.Buffer, entry *Record) {
+			encodeEMF(cf, b, entry, namespace, dims)
+		}
+	}
+}
+
+func encodeEMF(cf *Formatter, b *bytes.Buffer, entry *Record, namespace string, dimensions []string) {
+	fc := cf.fields()
+	entryFields := cf.entryFields(fc, entry)
+	fields := append(append([]field{}, cf.entryConstants(fc, entryFields)...), entryFields...)
+
+	var metrics []field
+	present := make(map[string]struct{}, len(fields))
+	for _, f := range fields {
+		present[f.key] = struct{}{}
+		if _, ok := f.value.(Metric); ok {
+			metrics = append(metrics, f)
+		}
+	}
+
+	obj := newJSONObject(b)
+	if len(metrics) > 0 {
+		obj.key("_aws")
+		aws := newJSONObject(b)
+		aws.field("Timestamp", entry.Time.UnixNano()/1e6)
+		aws.key("CloudWatchMetrics")
+		b.WriteByte('[')
+		directive := newJSONObject(b)
+		directive.str("Namespace", namespace)
+		directive.key("Dimensions")
+		b.WriteString("[[")
+		n := 0
+		for _, d := range dimensions {
+			if _, ok := present[d]; !ok {
+				continue
+			}
+			if n > 0 {
+				b.WriteByte(',')
+			}
+			writeJSONString(b, d)
+			n++
+		}
+		b.WriteString("]]")
+		directive.key("Metrics")
+		b.WriteByte('[')
+		for i, f := range metrics {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			unit := f.value.(Metric).Unit
+			if unit == "" {
+				unit = "None"
+			}
+			m := newJSONObject(b)
+			m.str("Name", fieldKey(emfKeys, f.key))
+			m.str("Unit", unit)
+			m.close()
+		}
+		b.WriteByte(']')
+		directive.close()
+		b.WriteByte(']')
+		aws.close()
+	}
+
+	obj.str("level", entry.level().String())
+	if entry.Message != "" {
+		obj.str("message", entry.Message)
+	}
+	if cf.includeCaller {
+		cf.writeJSONCaller(obj, entry)
+	}
+	for _, f := range fields {
+		obj.field(fieldKey(emfKeys, f.key), f.value)
+	}
+	obj.close()
+	b.WriteByte('\n')
+}
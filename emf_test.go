@@ -0,0 +1,80 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+var emfTests = []struct {
+	name     string
+	entry    *log.Entry
+	expected string
+}{
+	{"metrics", &log.Entry{
+		Time:    testTime,
+		Level:   log.InfoLevel,
+		Message: "order placed",
+		Data: log.Fields{
+			"latency": Metric{Value: 12.5, Unit: "Milliseconds"},
+			"items":   Metric{Value: 3},
+			"op":      "checkout",
+		},
+	}, `{"_aws":{"Timestamp":1486988025000,"CloudWatchMetrics":[{"Namespace":"shop","Dimensions":[["service","op"]],` +
+		`"Metrics":[{"Name":"items","Unit":"None"},{"Name":"latency","Unit":"Milliseconds"}]}]},` +
+		`"level":"info","message":"order placed","service":"cart","items":3,"latency":12.5,"op":"checkout"}`},
+	{"missing-dimension", &log.Entry{
+		Time:  testTime,
+		Level: log.InfoLevel,
+		Data: log.Fields{
+			"latency": Metric{Value: 1, Unit: "Seconds"},
+		},
+	}, `{"_aws":{"Timestamp":1486988025000,"CloudWatchMetrics":[{"Namespace":"shop","Dimensions":[["service"]],` +
+		`"Metrics":[{"Name":"latency","Unit":"Seconds"}]}]},"level":"info","service":"cart","latency":1}`},
+	{"no-metrics", &log.Entry{
+		Time:  testTime,
+		Level: log.InfoLevel,
+		Data: log.Fields{
+			"op": "checkout",
+		},
+	}, `{"level":"info","service":"cart","op":"checkout"}`},
+}
+
+func TestEMF(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for _, test := range emfTests {
+		cf := New(
+			WithConstantField("service", "cart"),
+			WithEMF("shop", "service", "op"))
+		result, err := cf.Format(test.entry)
+		require.Nil(err, test.name+" should not error")
+		assert.Equal(test.expected, strings.TrimSpace(string(result)), test.name+" should match")
+		assert.True(json.Valid(result), test.name+" should be valid JSON")
+	}
+}
+
+func TestMetricKV(t *testing.T) {
+	assert := assert.New(t)
+
+	cf := New()
+	result, _ := cf.Format(&log.Entry{
+		Time:  testTime,
+		Level: log.InfoLevel,
+		Data: log.Fields{
+			"latency": Metric{Value: 12.5, Unit: "Milliseconds"},
+		},
+	})
+	assert.Equal(`2017-02-13T12:13:45.000Z ll="info" latency=12.5`, strings.TrimSpace(string(result)))
+}
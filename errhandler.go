@@ -0,0 +1,85 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+)
+
+var errorHandler atomic.Value // func(error)
+
+// SetErrorHandler sets a function to be called with failures within kvlog
+// that would otherwise be lost or only written to os.Stderr, so that an
+// application can surface problems with its log pipeline, eg. by counting
+// them or alerting.  These include
+//
+//   - errors writing to the output of a Logger
+//   - a MarshalLogValue method that panics
+//   - background delivery failures of sinks without their own error handler,
+//     such as LokiWriter and NetWriter
+//   - errors compressing or reopening a RotatingFile
+//   - problems found by a Formatter without a handler set by
+//     WithErrorHandler, such as a KeyLimitError
+//
+// f may be called concurrently and must not log through kvlog itself.
+// Passing nil restores the default, where sink failures are ignored and
+// other errors written to os.Stderr.
+func SetErrorHandler(f func(error)) {
+	errorHandler.Store(f)
+}
+
+// handleError passes err to the handler set by SetErrorHandler, returning
+// false if none is set.
+func handleError(err error) bool {
+	f, _ := errorHandler.Load().(func(error))
+	if f == nil {
+		return false
+	}
+	f(err)
+	return true
+}
+
+// internalError reports err to the handler set by SetErrorHandler, or to
+// os.Stderr if none is set.
+func internalError(err error) {
+	if !handleError(err) {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+	}
+}
+
+// sinkError reports a background failure of a sink to onError, the sink's
+// own handler, if set, or else to the handler set by SetErrorHandler.
+func sinkError(onError func(error), err error) {
+	if onError != nil {
+		onError(err)
+		return
+	}
+	handleError(err)
+}
+
+// MarshalPanicError is reported when a MarshalLogValue method panics.  The
+// value is logged as the string fmt uses for a panicking String method.
+type MarshalPanicError struct {
+	Type  string      // the type of the value, as formatted by %T
+	Panic interface{} // the value passed to panic
+}
+
+func (e *MarshalPanicError) Error() string {
+	return fmt.Sprintf("kvlog: MarshalLogValue method of %s panicked: %v", e.Type, e.Panic)
+}
+
+// marshalValue returns the result of m.MarshalLogValue, recovering from
+// and reporting a panic, eg. on a nil receiver.
+func marshalValue(m Marshaler) (s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			internalError(&MarshalPanicError{Type: fmt.Sprintf("%T", m), Panic: r})
+			s = fmt.Sprintf("%%!v(PANIC=MarshalLogValue method: %v)", r)
+		}
+	}()
+	return m.MarshalLogValue()
+}
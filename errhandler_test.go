@@ -0,0 +1,81 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+type panicMarshaler struct {
+	name string
+}
+
+func (m *panicMarshaler) MarshalLogValue() string {
+	return m.name
+}
+
+type errWriter struct{}
+
+func (errWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestSetErrorHandler(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	SetErrorHandler(func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	})
+	defer SetErrorHandler(nil)
+
+	NewLogger(errWriter{}, nil).Info("lost")
+
+	var nilMarshaler *panicMarshaler
+	result, err := New().Format(&log.Entry{Time: testTime, Level: log.InfoLevel, Data: log.Fields{"v": nilMarshaler}})
+	require.Nil(t, err)
+	assert.Contains(t, string(result), ` v=%!v(PANIC=MarshalLogValue method: runtime error: invalid memory address or nil pointer dereference)`+"\n")
+
+	cf := New(WithKeyLimit(1, WarnNewKeys))
+	cf.Format(&log.Entry{Level: log.InfoLevel, Data: log.Fields{"a": 1, "b": 2}})
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Len(t, errs, 3)
+	assert.Equal(t, "kvlog: failed to write log entry: disk full", errs[0].Error())
+	require.IsType(t, &MarshalPanicError{}, errs[1])
+	assert.Equal(t, "*kvlog_test.panicMarshaler", errs[1].(*MarshalPanicError).Type)
+	assert.True(t, strings.HasPrefix(errs[1].Error(), "kvlog: MarshalLogValue method of *kvlog_test.panicMarshaler panicked: "))
+	assert.IsType(t, &KeyLimitError{}, errs[2])
+}
+
+func TestSetErrorHandlerSinks(t *testing.T) {
+	errs := make(chan error, 10)
+	SetErrorHandler(func(err error) {
+		errs <- err
+	})
+	defer SetErrorHandler(nil)
+
+	w := NewNetWriter("tcp", "127.0.0.1:1", NetBackoff(time.Hour, time.Hour))
+	w.Write([]byte("x\n"))
+	select {
+	case err := <-errs:
+		assert.Contains(t, err.Error(), "connect")
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for error")
+	}
+	w.Close()
+}
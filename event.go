@@ -0,0 +1,126 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Event is an entry being built by a Logger.  Fields are added by chaining
+// calls and the entry is written by Msg or Msgf; nothing is formatted until
+// then.
+//
+// eg.
+//
+//	logger.At(log.InfoLevel).Str("action", "login").Int("attempts", 3).Msg("ok")
+//
+// At returns nil if the level isn't enabled.  All Event methods are no-ops
+// on a nil Event, so the arguments to a disabled event are never formatted.
+// An Event must not be used after Msg or Msgf has been called.
+type Event struct {
+	logger *Logger
+	level  log.Level
+	fields []Field
+	buf    [8]Field
+}
+
+var eventPool = sync.Pool{
+	New: func() interface{} { return new(Event) },
+}
+
+// At starts a new Event at level, or returns nil if entries at level
+// wouldn't be written.
+func (l *Logger) At(level log.Level) *Event {
+	if !l.IsLevelEnabled(level) {
+		return nil
+	}
+	e := eventPool.Get().(*Event)
+	e.logger = l
+	e.level = level
+	e.fields = e.buf[:0]
+	return e
+}
+
+// Field adds a typed field created by a constructor such as String.
+func (e *Event) Field(f Field) *Event {
+	if e != nil {
+		e.fields = append(e.fields, f)
+	}
+	return e
+}
+
+// Str adds a string field.
+func (e *Event) Str(key, value string) *Event {
+	return e.Field(String(key, value))
+}
+
+// Int adds an int field.
+func (e *Event) Int(key string, value int) *Event {
+	return e.Field(Int(key, value))
+}
+
+// Int64 adds an int64 field.
+func (e *Event) Int64(key string, value int64) *Event {
+	return e.Field(Int64(key, value))
+}
+
+// Float64 adds a float64 field.
+func (e *Event) Float64(key string, value float64) *Event {
+	return e.Field(Float64(key, value))
+}
+
+// Bool adds a bool field.
+func (e *Event) Bool(key string, value bool) *Event {
+	return e.Field(Bool(key, value))
+}
+
+// Dur adds a duration field.
+func (e *Event) Dur(key string, value time.Duration) *Event {
+	return e.Field(Dur(key, value))
+}
+
+// Err adds err as an error field.
+func (e *Event) Err(err error) *Event {
+	return e.Field(Err(err))
+}
+
+// Interface adds a field holding an arbitrary value, formatted as it would
+// be if passed to WithFields.
+func (e *Event) Interface(key string, value interface{}) *Event {
+	return e.Field(Any(key, value))
+}
+
+// Msg writes the event with the given message.
+func (e *Event) Msg(msg string) {
+	if e == nil {
+		return
+	}
+	e.logger.Log(e.level, msg, e.fields...)
+	e.release()
+}
+
+// Msgf writes the event with a formatted message.  The message is only
+// formatted if the event's level is enabled.
+func (e *Event) Msgf(format string, args ...interface{}) {
+	if e == nil {
+		return
+	}
+	e.logger.Log(e.level, fmt.Sprintf(format, args...), e.fields...)
+	e.release()
+}
+
+func (e *Event) release() {
+	e.logger = nil
+	for i := range e.fields {
+		e.fields[i] = Field{}
+	}
+	if cap(e.fields) == len(e.buf) {
+		eventPool.Put(e)
+	}
+}
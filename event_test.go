@@ -0,0 +1,67 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"regexp"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestEvent(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, New(WithPrimaryFields("action")))
+	logger.At(log.InfoLevel).Str("action", "login").Int("attempts", 3).Bool("ok", true).Msg("ok")
+	logger.At(log.WarnLevel).Dur("elapsed", 2*time.Second).Float64("ratio", 0.5).Int64("id", 7).Msgf("slow %s", "login")
+	logger.At(log.ErrorLevel).Err(errors.New("boom")).Interface("ids", []int{1, 2}).Field(String("k", "v")).Msg("")
+	logger.At(log.DebugLevel).Str("action", "dropped").Msg("not logged")
+
+	expected := `ll="info" action="login" attempts=3 ok=true _msg="ok"
+ll="warning" elapsed="2s" id=7 ratio=0.5 _msg="slow login"
+ll="error" error="boom" ids=[1 2] k="v"
+`
+	assert.Equal(expected, regexp.MustCompile(`(?m)^\S+ `).ReplaceAllString(buf.String(), ""))
+}
+
+func TestEventManyFields(t *testing.T) {
+	var buf bytes.Buffer
+	e := NewLogger(&buf, nil).At(log.InfoLevel)
+	for _, k := range []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"} {
+		e = e.Str(k, k)
+	}
+	e.Msg("many")
+	assert.Regexp(t, `a="a" b="b" c="c" d="d" e="e" f="f" g="g" h="h" i="i" j="j" _msg="many"\n$`, buf.String())
+}
+
+func TestEventCaller(t *testing.T) {
+	var buf bytes.Buffer
+	NewLogger(&buf, New(IncludeCaller())).At(log.InfoLevel).Msg("hello")
+	assert.Regexp(t, `^\S+ ll="info" srcfnc="TestEventCaller" srcline=\d+ _msg="hello"\n$`, buf.String())
+}
+
+func TestEventDisabled(t *testing.T) {
+	logger := NewLogger(ioutil.Discard, nil)
+	e := logger.At(log.DebugLevel)
+	assert.Nil(t, e)
+	e.Str("k", "v").Int("n", 1).Msgf("%s", "unused")
+}
+
+func BenchmarkEvent(b *testing.B) {
+	logger := NewLogger(ioutil.Discard, New(WithPrimaryFields("action")))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.At(log.InfoLevel).Str("action", "get").Int("status", 200).Dur("elapsed", time.Millisecond).Msg("request complete")
+	}
+}
@@ -1,22 +1,27 @@
 package kvlog_test
 
 import (
-	"bytes"
-	"fmt"
-	"regexp"
+	"os"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/gwatts/kvlog"
 )
 
 func Example() {
-	var buf bytes.Buffer
-
-	log.SetOutput(&buf)
+	log.SetOutput(os.Stdout)
 	log.SetFormatter(
 		kvlog.New(
 			kvlog.IncludeCaller(),
-			kvlog.WithPrimaryFields("action", "status")))
+			kvlog.WithPrimaryFields("action", "status"),
+
+			// fix the timestamp and srcline so the output is consistent
+			kvlog.WithClock(func() time.Time {
+				return time.Date(2017, 1, 2, 12, 0, 0, 0, time.UTC)
+			}),
+			kvlog.WithCallerFunc(func(name string, line int) (string, int) {
+				return name, 100
+			})))
 
 	log.WithFields(log.Fields{
 		"action":          "user_login",
@@ -26,12 +31,5 @@ func Example() {
 		"active_sessions": 4,
 	}).Info("User logged in")
 
-	// replace the timestamp so the output is consistent
-	output := "2017-01-02T12:00:00.000Z " + buf.String()[25:]
-
-	// replace srcline so tests aren't sensitive to exact line number
-	output = regexp.MustCompile(`srcline=\d+`).ReplaceAllLiteralString(output, `srcline=100`)
-
-	fmt.Println(output)
 	// Output: 2017-01-02T12:00:00.000Z ll="info" srcfnc="Example" srcline=100 action="user_login" status="ok" active_sessions=4 email="joe@example.com" username="joe_user" _msg="User logged in"
 }
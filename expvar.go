@@ -0,0 +1,79 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"expvar"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ExpvarObserver is an Observer that keeps counts of logging activity in an
+// expvar.Map, so that they're shown by the standard /debug/vars endpoint.
+// It's created by PublishExpvar.
+type ExpvarObserver struct {
+	m            *expvar.Map
+	lines        *expvar.Map
+	bytes        *expvar.Int
+	formatErrors *expvar.Int
+	dropped      *expvar.Map
+	failures     *expvar.Map
+}
+
+// PublishExpvar publishes counts of logging activity as an expvar named
+// name, such as "kvlog", and registers the observer that maintains them, for
+// services that don't use Prometheus.  The variable holds
+//
+//	{"lines": {"info": 12, ...}, "bytes": 1440, "format_errors": 0,
+//	 "dropped": {"queue_full": 3}, "delivery_failures": {"loki": 1}}
+//
+// with lines counted by level, dropped entries by reason and delivery
+// failures by sink, as described by Observer.
+//
+// As with expvar.Publish, PublishExpvar panics if name is already in use.
+func PublishExpvar(name string) *ExpvarObserver {
+	o := &ExpvarObserver{
+		m:            new(expvar.Map),
+		lines:        new(expvar.Map),
+		bytes:        new(expvar.Int),
+		formatErrors: new(expvar.Int),
+		dropped:      new(expvar.Map),
+		failures:     new(expvar.Map),
+	}
+	o.m.Set("lines", o.lines)
+	o.m.Set("bytes", o.bytes)
+	o.m.Set("format_errors", o.formatErrors)
+	o.m.Set("dropped", o.dropped)
+	o.m.Set("delivery_failures", o.failures)
+	expvar.Publish(name, o.m)
+	RegisterObserver(o)
+	return o
+}
+
+// Map returns the published variable.
+func (o *ExpvarObserver) Map() *expvar.Map {
+	return o.m
+}
+
+// LineWritten implements Observer.
+func (o *ExpvarObserver) LineWritten(level log.Level, n int) {
+	o.lines.Add(level.String(), 1)
+	o.bytes.Add(int64(n))
+}
+
+// FormatFailed implements Observer.
+func (o *ExpvarObserver) FormatFailed(err error) {
+	o.formatErrors.Add(1)
+}
+
+// EntriesDropped implements Observer.
+func (o *ExpvarObserver) EntriesDropped(reason string, n int) {
+	o.dropped.Add(reason, int64(n))
+}
+
+// DeliveryFailed implements Observer.
+func (o *ExpvarObserver) DeliveryFailed(sink string, err error) {
+	o.failures.Add(sink, 1)
+}
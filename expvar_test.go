@@ -0,0 +1,53 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	name := fmt.Sprintf("kvlog_test_%d", time.Now().UnixNano()) // unique with -count
+	o := PublishExpvar(name)
+	defer UnregisterObserver(o)
+
+	var buf bytes.Buffer
+	logger := log.New()
+	logger.Out = &buf
+	logger.Formatter = New()
+	logger.Info("one")
+	logger.Info("two")
+	logger.Warn("three")
+
+	s := NewSampler(ioutil.Discard, SampleByField("id"), SampleRate(log.InfoLevel, 1000000))
+	s.WriteLevel(log.InfoLevel, []byte(`ll="info" id="b" _msg="x"`+"\n"))
+
+	var vars struct {
+		Lines            map[string]int64 `json:"lines"`
+		Bytes            int64            `json:"bytes"`
+		FormatErrors     int64            `json:"format_errors"`
+		Dropped          map[string]int64 `json:"dropped"`
+		DeliveryFailures map[string]int64 `json:"delivery_failures"`
+	}
+	require.Nil(t, json.Unmarshal([]byte(expvar.Get(name).String()), &vars))
+	assert.Equal(t, int64(2), vars.Lines["info"])
+	assert.Equal(t, int64(1), vars.Lines["warning"])
+	assert.Equal(t, int64(buf.Len()), vars.Bytes)
+	assert.Equal(t, int64(0), vars.FormatErrors)
+	assert.Equal(t, int64(1), vars.Dropped["sampled"])
+	assert.Equal(t, o.Map(), expvar.Get(name))
+}
@@ -0,0 +1,255 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type fieldKind uint8
+
+const (
+	anyKind fieldKind = iota
+	stringKind
+	intKind
+	floatKind
+	boolKind
+	durationKind
+	errorKind
+)
+
+// Field is a typed key/value pair to be passed to Logger.Log.
+//
+// Fields created by the typed constructors, such as String and Int, are
+// formatted without boxing their values in an interface or building a
+// Fields map, while producing output identical to the equivalent value
+// logged through WithFields.
+type Field struct {
+	key  string
+	kind fieldKind
+	num  int64
+	str  string
+	val  interface{}
+}
+
+// String returns a Field holding a string value.
+func String(key, value string) Field {
+	return Field{key: key, kind: stringKind, str: value}
+}
+
+// Int returns a Field holding an int value.
+func Int(key string, value int) Field {
+	return Field{key: key, kind: intKind, num: int64(value)}
+}
+
+// Int64 returns a Field holding an int64 value.
+func Int64(key string, value int64) Field {
+	return Field{key: key, kind: intKind, num: value}
+}
+
+// Float64 returns a Field holding a float64 value.
+func Float64(key string, value float64) Field {
+	return Field{key: key, kind: floatKind, num: int64(math.Float64bits(value))}
+}
+
+// Bool returns a Field holding a bool value.
+func Bool(key string, value bool) Field {
+	f := Field{key: key, kind: boolKind}
+	if value {
+		f.num = 1
+	}
+	return f
+}
+
+// Dur returns a Field holding a duration, formatted as a quoted string
+// such as "1.5s".
+func Dur(key string, value time.Duration) Field {
+	return Field{key: key, kind: durationKind, num: int64(value)}
+}
+
+// Err returns a Field holding err with the key "error".
+func Err(err error) Field {
+	return Field{key: "error", kind: errorKind, val: err}
+}
+
+// Any returns a Field holding an arbitrary value, formatted as it would be
+// if passed to WithFields.
+func Any(key string, value interface{}) Field {
+	return Field{key: key, kind: anyKind, val: value}
+}
+
+// value returns the field's value in the form that would be passed to
+// WithFields.
+func (f Field) value() interface{} {
+	switch f.kind {
+	case stringKind:
+		return f.str
+	case intKind:
+		return f.num
+	case floatKind:
+		return math.Float64frombits(uint64(f.num))
+	case boolKind:
+		return f.num == 1
+	case durationKind:
+		return time.Duration(f.num)
+	default:
+		return f.val
+	}
+}
+
+// appendValue appends the field's formatted value to buf.  Fields created
+// by Any are formatted by the Formatter instead.
+func (f Field) appendValue(cf *Formatter, buf []byte) []byte {
+	switch f.kind {
+	case stringKind:
+		return cf.appendString(buf, f.str)
+	case intKind:
+		return strconv.AppendInt(buf, f.num, 10)
+	case floatKind:
+		return strconv.AppendFloat(buf, math.Float64frombits(uint64(f.num)), 'g', -1, 64)
+	case boolKind:
+		return strconv.AppendBool(buf, f.num == 1)
+	case durationKind:
+		if cf.quoter != nil {
+			return cf.appendString(buf, time.Duration(f.num).String())
+		}
+		return appendQuoted(buf, time.Duration(f.num).String())
+	case errorKind:
+		if f.val == nil {
+			return append(buf, "<nil>"...)
+		}
+		return cf.appendString(buf, f.val.(error).Error())
+	}
+	return buf
+}
+
+var bufPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// canFormatFields reports whether fields can be rendered by formatFields.
+// Other formatting modes, scrubbing, schema and key policy validation,
+// duplicate key resolution, entries that may exceed the field limit,
+// Loggable and OrderedFields values, which expand into several keys, and
+// LazyValues, which may return one, fall back to the general entry formatter.
+func (cf *Formatter) canFormatFields(fields []Field) bool {
+	if cf.encode != nil || cf.color || cf.maxLine > 0 || cf.checksum || cf.scrub != nil ||
+		cf.schema != nil || cf.keyPolicy != nil || cf.dupKeys != nil || cf.omitEmpty != 0 ||
+		cf.placeholder != nil {
+		return false
+	}
+	if cf.maxFields > 0 && len(fields) > cf.maxFields {
+		return false
+	}
+	for _, f := range fields {
+		if f.kind == anyKind {
+			switch f.val.(type) {
+			case Loggable, OrderedFields, LazyValue:
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// formatFields renders entry with the given typed fields in place of its
+// Data in the default k=v format, producing the same output as Format would
+// for an entry with equivalent data.  Where keys are repeated the last value is used.
+func (cf *Formatter) formatFields(b *bytes.Buffer, entry *Record, fields []Field) {
+	if !cf.levelEnabled(entry, fields) {
+		return
+	}
+	cf.emitTimestamp(b, entry.Time)
+	cf.emitLogLevel(b, entry.level())
+	if cf.includeCaller {
+		cf.emitCaller(b, entry)
+	}
+	fc := cf.fields()
+	for _, f := range fc.constantFields {
+		b.Write(f)
+	}
+
+	var scratch [64]byte
+	emit := func(f Field) {
+		if cf.levelFields != nil && cf.hiddenAt(f.key, entry.level()) {
+			return
+		}
+		if (cf.allow != nil || cf.deny != nil || cf.keys != nil) && cf.suppress(f.key, f.key) {
+			return
+		}
+		b.WriteByte(' ')
+		b.WriteString(sanitizeKey(f.key))
+		b.WriteByte('=')
+		if cf.redact != nil && cf.redact.match(f.key) {
+			cf.writeString(b, Redacted)
+		} else if h := cf.hasher(f.key); h != nil {
+			cf.writeString(b, HashedValue(h.key, f.value()))
+		} else if f.kind == anyKind {
+			cf.emitValue(b, f.val)
+		} else {
+			b.Write(f.appendValue(cf, scratch[:0]))
+		}
+	}
+
+	// order is the index of each field to be emitted, with primary fields
+	// first and the remainder in key order.
+	var orderBuf [32]int
+	order := orderBuf[:0]
+	for _, pk := range fc.primaryFields {
+		if i := lastField(fields, pk); i != -1 {
+			order = append(order, i)
+		}
+	}
+	nprimary := len(order)
+	for i, f := range fields {
+		if lastField(fields, f.key) != i || isPrimary(fc.primaryFields, f.key) {
+			continue
+		}
+		if cf.unsorted {
+			order = append(order, i)
+			continue
+		}
+		// insertion sort; entries rarely have more than a handful of fields
+		j := len(order)
+		order = append(order, i)
+		for j > nprimary && fields[order[j-1]].key > f.key {
+			order[j] = order[j-1]
+			j--
+		}
+		order[j] = i
+	}
+	for _, i := range order {
+		emit(fields[i])
+	}
+
+	if entry.Message != "" {
+		b.WriteString(" _msg=")
+		cf.writeString(b, entry.Message)
+	}
+	b.WriteByte('\n')
+}
+
+// lastField returns the index of the last field with the given key, or -1.
+func lastField(fields []Field, key string) int {
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i].key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+func isPrimary(primary []string, key string) bool {
+	for _, k := range primary {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,146 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"math"
+	"regexp"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestTypedFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		cfgs   []Config
+		fields []Field
+		data   log.Fields
+	}{
+		{
+			name: "all-types",
+			fields: []Field{
+				String("str", "quote\" and é"),
+				Int("int", -42),
+				Int64("int64", 1<<40),
+				Float64("float", 1.5),
+				Float64("big", 1234567),
+				Float64("inf", math.Inf(1)),
+				Bool("yes", true),
+				Bool("no", false),
+				Dur("elapsed", 1500*time.Millisecond),
+				Err(errors.New("boom")),
+				Any("raw", RawLogString("verbatim")),
+				Any("slice", []int{1, 2}),
+			},
+			data: log.Fields{
+				"str":     "quote\" and é",
+				"int":     -42,
+				"int64":   int64(1 << 40),
+				"float":   1.5,
+				"big":     1234567.0,
+				"inf":     math.Inf(1),
+				"yes":     true,
+				"no":      false,
+				"elapsed": 1500 * time.Millisecond,
+				"error":   errors.New("boom"),
+				"raw":     RawLogString("verbatim"),
+				"slice":   []int{1, 2},
+			},
+		}, {
+			name:   "nil-error",
+			fields: []Field{Err(nil)},
+			data:   log.Fields{"error": nil},
+		}, {
+			name: "primary-and-constant",
+			cfgs: []Config{WithPrimaryFields("status", "action"), WithConstantField("app", "test"), IncludeCaller()},
+			fields: []Field{
+				String("zzz", "last"),
+				Int("status", 200),
+				String("action", "login"),
+				String("aaa", "first"),
+			},
+			data: log.Fields{"zzz": "last", "status": 200, "action": "login", "aaa": "first"},
+		}, {
+			name:   "duplicate-keys",
+			fields: []Field{String("k", "first"), Int("n", 1), String("k", "second")},
+			data:   log.Fields{"k": "second", "n": 1},
+		}, {
+			name:   "loggable",
+			fields: []Field{Any("nested", testLoggable{"a": 1, "b": "x"}), Int("n", 1)},
+			data:   log.Fields{"nested": testLoggable{"a": 1, "b": "x"}, "n": 1},
+		}, {
+			name:   "json",
+			cfgs:   []Config{WithJSON()},
+			fields: []Field{String("s", "v"), Dur("d", time.Second)},
+			data:   log.Fields{"s": "v", "d": time.Second},
+		},
+	}
+
+	ts := regexp.MustCompile(`\d{4}-\d\d-\d\dT[\d:.]+Z`)
+	srcline := regexp.MustCompile(`srcline=\d+`)
+	clean := func(s string) string {
+		return srcline.ReplaceAllString(ts.ReplaceAllString(s, "TS"), "srcline=100")
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cf := New(test.cfgs...)
+			var typed, lr bytes.Buffer
+			NewLogger(&typed, cf).Log(log.InfoLevel, "message", test.fields...)
+			(&log.Logger{Out: &lr, Formatter: cf, Level: log.InfoLevel}).WithFields(test.data).Info("message")
+			if test.name == "json" {
+				assert.JSONEq(t, ts.ReplaceAllString(lr.String(), "TS"), ts.ReplaceAllString(typed.String(), "TS"))
+				return
+			}
+			assert.Equal(t, clean(lr.String()), clean(typed.String()))
+		})
+	}
+}
+
+func TestTypedFieldsWithLoggerFields(t *testing.T) {
+	var buf bytes.Buffer
+	NewLogger(&buf, nil).WithField("component", "cache").Log(log.WarnLevel, "evicted", Int("count", 3))
+	assert.Regexp(t, `^\S+ ll="warning" component="cache" count=3 _msg="evicted"\n$`, buf.String())
+}
+
+func TestTypedFieldsLevel(t *testing.T) {
+	var buf bytes.Buffer
+	NewLogger(&buf, nil).Log(log.DebugLevel, "dropped", Int("count", 3))
+	assert.Equal(t, "", buf.String())
+}
+
+func TestTypedFieldsAllocs(t *testing.T) {
+	logger := NewLogger(ioutil.Discard, New(WithPrimaryFields("action")))
+	allocs := allocsPerRun(func() {
+		logger.Log(log.InfoLevel, "request complete",
+			String("action", "get"), Int("status", 200), Float64("ratio", 0.5),
+			Bool("cached", true), Dur("elapsed", time.Millisecond))
+	})
+	assert.Equal(t, 0.0, allocs)
+}
+
+func BenchmarkTypedFields(b *testing.B) {
+	logger := NewLogger(ioutil.Discard, New(WithPrimaryFields("action")))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.Log(log.InfoLevel, "request complete",
+			String("action", "get"), Int("status", 200), Dur("elapsed", time.Millisecond))
+	}
+}
+
+func BenchmarkMapFields(b *testing.B) {
+	logger := NewLogger(ioutil.Discard, New(WithPrimaryFields("action")))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.WithFields(log.Fields{"action": "get", "status": 200, "elapsed": time.Millisecond}).Info("request complete")
+	}
+}
@@ -0,0 +1,53 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"sync/atomic"
+)
+
+// WithAllowedKeys causes only fields whose keys match any of keys to be
+// emitted; all others are dropped.  Keys may be exact names or glob
+// patterns, as for WithRedactedKeys.  The keys produced by a Loggable value
+// are allowed if they, or the key of the value itself, match.  Constant
+// fields are always emitted.
+//
+// Repeated use adds to the allowed keys.
+func WithAllowedKeys(keys ...string) Config {
+	return func(kvf *Formatter) {
+		kvf.allow = kvf.allow.with(keys, false)
+	}
+}
+
+// WithDeniedKeys causes fields whose keys match any of keys to be dropped,
+// so that a library that logs internal state can't leak it into production
+// logs.  Keys may be exact names or glob patterns, as for WithRedactedKeys.
+// Denied keys are dropped even if they're also allowed by WithAllowedKeys.
+// Constant fields are always emitted.
+func WithDeniedKeys(keys ...string) Config {
+	return func(kvf *Formatter) {
+		kvf.deny = kvf.deny.with(keys, false)
+	}
+}
+
+// SuppressedFields returns the number of fields dropped by cf because of
+// WithAllowedKeys, WithDeniedKeys or WithKeyLimit.  Formatters created by Child keep
+// their own count.
+func (cf *Formatter) SuppressedFields() int64 {
+	return atomic.LoadInt64(&cf.suppressed)
+}
+
+// suppress reports whether a field with key k should be dropped, and counts
+// it if so.  parent is the key of the Loggable value the field was produced
+// by, or k itself.
+func (cf *Formatter) suppress(k, parent string) bool {
+	if (cf.deny != nil && cf.deny.match(k)) ||
+		(cf.allow != nil && !cf.allow.match(k) && !cf.allow.match(parent)) ||
+		(cf.keys != nil && !cf.keys.admit(cf, k)) {
+		atomic.AddInt64(&cf.suppressed, 1)
+		return true
+	}
+	return false
+}
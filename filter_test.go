@@ -0,0 +1,67 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestKeyFilters(t *testing.T) {
+	data := log.Fields{
+		"action":      "login",
+		"status":      "ok",
+		"user":        Ordered(".name", "joe", ".internal", 1),
+		"cache_state": "dirty",
+		"cache_size":  12,
+	}
+	tests := []struct {
+		name       string
+		cfgs       []Config
+		expected   string
+		suppressed int64
+	}{
+		{"allow", []Config{WithAllowedKeys("action", "status")},
+			`action="login" status="ok"`, 4},
+		{"allow-glob", []Config{WithAllowedKeys("cache_*", "user.name")},
+			`cache_size=12 cache_state="dirty" user.name="joe"`, 3},
+		{"allow-parent", []Config{WithAllowedKeys("user")},
+			`user.name="joe" user.internal=1`, 4},
+		{"deny", []Config{WithDeniedKeys("cache_*", "user.internal")},
+			`action="login" status="ok" user.name="joe"`, 3},
+		{"deny-parent", []Config{WithDeniedKeys("user")},
+			`action="login" cache_size=12 cache_state="dirty" status="ok"`, 1},
+		{"allow-and-deny", []Config{WithAllowedKeys("action", "cache_*"), WithDeniedKeys("cache_state")},
+			`action="login" cache_size=12`, 4},
+		{"with-redaction", []Config{WithAllowedKeys("user*"), WithRedactedKeys("user.internal")},
+			`user.name="joe" user.internal="[REDACTED]"`, 4},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cf := New(append(test.cfgs, WithConstantField("app", "auth"))...)
+			result, err := cf.Format(&log.Entry{Time: testTime, Level: log.InfoLevel, Data: data})
+			require.Nil(t, err)
+			assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" app="auth" `+test.expected, strings.TrimSuffix(string(result), "\n"))
+			assert.Equal(t, test.suppressed, cf.SuppressedFields())
+		})
+	}
+}
+
+func TestKeyFiltersTypedFields(t *testing.T) {
+	var buf bytes.Buffer
+	cf := New(WithDeniedKeys("debug_*"))
+	NewLogger(&buf, cf).Log(log.InfoLevel, "done",
+		String("status", "ok"), Int("debug_depth", 3), Bool("debug_hit", true))
+	assert.Regexp(t, ` ll="info" status="ok" _msg="done"\n$`, buf.String())
+	assert.Equal(t, int64(2), cf.SuppressedFields())
+}
@@ -0,0 +1,275 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// FluentConfig represents a configuration function to be passed to
+// NewFluentForwarder.
+type FluentConfig func(f *FluentForwarder)
+
+// FluentAck causes the forwarder to request an acknowledgement of each
+// batch from the server, waiting up to timeout for it to arrive.  Batches
+// that aren't acknowledged are resent over a new connection once.
+func FluentAck(timeout time.Duration) FluentConfig {
+	return func(f *FluentForwarder) {
+		f.ackTimeout = timeout
+	}
+}
+
+// FluentBatch sets the maximum number of entries sent in a single message
+// and the maximum time an entry is held before being sent.  The defaults
+// are 100 entries and one second.
+func FluentBatch(size int, interval time.Duration) FluentConfig {
+	return func(f *FluentForwarder) {
+		f.batchSize = size
+		f.interval = interval
+	}
+}
+
+// FluentTLS causes connections to the server to be made using TLS with the
+// given configuration, such as one returned by NewTLSConfig.
+func FluentTLS(cfg *tls.Config) FluentConfig {
+	return func(f *FluentForwarder) {
+		f.tlsConfig = cfg
+	}
+}
+
+// FluentQueuePolicy sets how many entries are held in memory awaiting
+// sending and what happens when that limit is reached.  The default is
+// DefaultQueuePolicy.
+func FluentQueuePolicy(policy QueuePolicy) FluentConfig {
+	return func(f *FluentForwarder) {
+		f.queuePolicy = policy
+	}
+}
+
+// FluentErrorHandler sets a function to be called if a background send
+// fails.
+func FluentErrorHandler(fn func(error)) FluentConfig {
+	return func(f *FluentForwarder) {
+		f.onError = fn
+	}
+}
+
+// FluentForwarder is a logrus hook that sends entries to Fluentd or Fluent
+// Bit using the forward protocol, so that they arrive as structured records
+// rather than lines of text to be parsed.
+//
+// eg.
+//
+//	fwd := kvlog.NewFluentForwarder(kvlog.New(), "localhost:24224", "app.billing",
+//	    kvlog.FluentAck(5*time.Second))
+//	defer fwd.Close()
+//	logrus.AddHook(fwd)
+//
+// Each record holds the same keys as the k=v output, including ll and _msg,
+// with numeric and boolean values retaining their types.  Record fields are
+// taken from the given Formatter, so constant fields and Loggable values are
+// handled identically to the formatted output.  The entry's time is sent
+// with nanosecond precision.
+//
+// Close should be called before the program exits to send any queued
+// entries.
+type FluentForwarder struct {
+	cf          *Formatter
+	addr        string
+	tag         string
+	ackTimeout  time.Duration
+	tlsConfig   *tls.Config
+	queuePolicy QueuePolicy
+	batchSize   int
+	interval    time.Duration
+	onError     func(error)
+	batch       *batcher
+	conn        net.Conn // owned by send, which the batcher serializes
+}
+
+// NewFluentForwarder creates a forwarder that sends entries with the given
+// tag to the server listening on the TCP address addr.
+func NewFluentForwarder(cf *Formatter, addr, tag string, cfgs ...FluentConfig) *FluentForwarder {
+	f := &FluentForwarder{
+		cf:          cf,
+		addr:        addr,
+		tag:         tag,
+		batchSize:   100,
+		interval:    time.Second,
+		queuePolicy: DefaultQueuePolicy,
+	}
+	for _, cfg := range cfgs {
+		cfg(f)
+	}
+	f.batch = newBatcher("fluent", f.batchSize, f.interval, f.queuePolicy, f.send, f.encode, f.onError)
+	RegisterShutdown(f)
+	return f
+}
+
+// Levels implements the logrus.Hook interface.
+func (f *FluentForwarder) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements the logrus.Hook interface, queuing the entry to be sent.
+func (f *FluentForwarder) Fire(entry *log.Entry) error {
+	return f.batch.add(f.encode(entry))
+}
+
+func (f *FluentForwarder) encode(entry *log.Entry) []byte {
+	var b bytes.Buffer
+	f.writeEntry(&b, f.cf.record(entry))
+	return b.Bytes()
+}
+
+// Dropped returns the number of entries discarded, either because the
+// queue was full or because they couldn't be sent.
+func (f *FluentForwarder) Dropped() int64 {
+	return f.batch.dropped()
+}
+
+// Backlog returns the number of entries queued awaiting sending.
+func (f *FluentForwarder) Backlog() int {
+	return f.batch.backlog()
+}
+
+// Flush synchronously sends all queued entries.
+func (f *FluentForwarder) Flush() error {
+	return f.batch.flush()
+}
+
+// Close stops the forwarder after sending any queued entries.
+func (f *FluentForwarder) Close() error {
+	UnregisterShutdown(f)
+	err := f.batch.close()
+	if f.conn != nil {
+		f.conn.Close()
+		f.conn = nil
+	}
+	return err
+}
+
+// writeEntry writes entry as a forward protocol [time, record] pair.
+func (f *FluentForwarder) writeEntry(b *bytes.Buffer, entry *Record) {
+	cf := f.cf
+	var fields []field
+	fields = append(fields, field{"ll", entry.level().String()})
+	if cf.includeCaller {
+		if name, line := cf.caller(entry); name == "" {
+			fields = append(fields, field{"srcfnc", "unknown"})
+		} else {
+			fields = append(fields, field{"srcfnc", name}, field{"srcline", line})
+		}
+	}
+	fc := cf.fields()
+	entryFields := cf.entryFields(fc, entry)
+	fields = append(fields, cf.entryConstants(fc, entryFields)...)
+	fields = append(fields, entryFields...)
+	if entry.Message != "" {
+		fields = append(fields, field{"_msg", entry.Message})
+	}
+
+	msgpackArray(b, 2)
+	msgpackEventTime(b, entry.Time)
+	msgpackMap(b, len(fields))
+	for _, fld := range fields {
+		msgpackString(b, fld.key)
+		msgpackValue(b, fld.value)
+	}
+}
+
+func (f *FluentForwarder) send(entries [][]byte) error {
+	var b bytes.Buffer
+	var chunk string
+	msgpackArray(&b, 3)
+	msgpackString(&b, f.tag)
+	msgpackArray(&b, len(entries))
+	for _, e := range entries {
+		b.Write(e)
+	}
+	if f.ackTimeout > 0 {
+		var id [16]byte
+		rand.Read(id[:])
+		chunk = base64.StdEncoding.EncodeToString(id[:])
+		msgpackMap(&b, 2)
+		msgpackString(&b, "size")
+		msgpackInt(&b, int64(len(entries)))
+		msgpackString(&b, "chunk")
+		msgpackString(&b, chunk)
+	} else {
+		msgpackMap(&b, 1)
+		msgpackString(&b, "size")
+		msgpackInt(&b, int64(len(entries)))
+	}
+
+	err := f.write(b.Bytes(), chunk)
+	if err != nil {
+		// the server may have closed an idle connection; retry once
+		err = f.write(b.Bytes(), chunk)
+	}
+	return err
+}
+
+// write sends msg over the connection, dialing if needed, and waits for
+// the server to acknowledge chunk if it's set.
+func (f *FluentForwarder) write(msg []byte, chunk string) error {
+	if f.conn == nil {
+		dialer := &net.Dialer{Timeout: 10 * time.Second}
+		var conn net.Conn
+		var err error
+		if f.tlsConfig != nil {
+			conn, err = tls.DialWithDialer(dialer, "tcp", f.addr, f.tlsConfig)
+		} else {
+			conn, err = dialer.Dial("tcp", f.addr)
+		}
+		if err != nil {
+			return err
+		}
+		f.conn = conn
+	}
+	err := f.writeConn(msg, chunk)
+	if err != nil {
+		f.conn.Close()
+		f.conn = nil
+	}
+	return err
+}
+
+func (f *FluentForwarder) writeConn(msg []byte, chunk string) error {
+	if _, err := f.conn.Write(msg); err != nil {
+		return err
+	}
+	if chunk == "" {
+		return nil
+	}
+
+	// The response is a map of the form {"ack": chunk}; rather than decode
+	// it, check that it holds the expected chunk ID.
+	f.conn.SetReadDeadline(time.Now().Add(f.ackTimeout))
+	defer f.conn.SetReadDeadline(time.Time{})
+	var resp []byte
+	buf := make([]byte, 128)
+	for {
+		n, err := f.conn.Read(buf)
+		resp = append(resp, buf[:n]...)
+		if bytes.Contains(resp, []byte(chunk)) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(resp) > 1024 {
+			return errors.New("kvlog: invalid fluentd ack response")
+		}
+	}
+}
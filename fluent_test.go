@@ -0,0 +1,222 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+// decodeMsgpack decodes the subset of MessagePack produced by
+// FluentForwarder.
+func decodeMsgpack(r *bufio.Reader) (interface{}, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	readN := func(n int) []byte {
+		buf := make([]byte, n)
+		if _, e := io.ReadFull(r, buf); e != nil {
+			err = e
+		}
+		return buf
+	}
+	readLen := func(size int) int {
+		buf := readN(size)
+		if size == 1 {
+			return int(buf[0])
+		} else if size == 2 {
+			return int(binary.BigEndian.Uint16(buf))
+		}
+		return int(binary.BigEndian.Uint32(buf))
+	}
+
+	var arrayLen, mapLen, strLen = -1, -1, -1
+	switch {
+	case c < 0x80:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x90:
+		arrayLen = int(c & 0x0f)
+	case c&0xf0 == 0x80:
+		mapLen = int(c & 0x0f)
+	case c&0xe0 == 0xa0:
+		strLen = int(c & 0x1f)
+	case c == 0xc0:
+		return nil, nil
+	case c == 0xc2, c == 0xc3:
+		return c == 0xc3, nil
+	case c == 0xd3:
+		return int64(binary.BigEndian.Uint64(readN(8))), err
+	case c == 0xcf:
+		return binary.BigEndian.Uint64(readN(8)), err
+	case c == 0xcb:
+		return math.Float64frombits(binary.BigEndian.Uint64(readN(8))), err
+	case c == 0xd7:
+		buf := readN(9)
+		return time.Unix(int64(binary.BigEndian.Uint32(buf[1:])), int64(binary.BigEndian.Uint32(buf[5:]))).UTC(), err
+	case c == 0xd9, c == 0xda, c == 0xdb:
+		strLen = readLen(1 << (c - 0xd9))
+	case c == 0xdc, c == 0xdd:
+		arrayLen = readLen(2 << (c - 0xdc))
+	case c == 0xde, c == 0xdf:
+		mapLen = readLen(2 << (c - 0xde))
+	default:
+		return nil, fmt.Errorf("unsupported type %#x", c)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strLen >= 0:
+		return string(readN(strLen)), err
+	case arrayLen >= 0:
+		a := make([]interface{}, arrayLen)
+		for i := range a {
+			if a[i], err = decodeMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	default:
+		m := make(map[string]interface{}, mapLen)
+		for i := 0; i < mapLen; i++ {
+			k, err := decodeMsgpack(r)
+			if err != nil {
+				return nil, err
+			}
+			ks, ok := k.(string)
+			if !ok {
+				return nil, errors.New("non-string map key")
+			}
+			if m[ks], err = decodeMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+}
+
+// fluentServer accepts forward protocol messages, acknowledging chunks if
+// ack is true, and returns them on a channel.
+func fluentServer(t *testing.T, ack bool) (net.Listener, <-chan []interface{}) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	msgs := make(chan []interface{}, 10)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					v, err := decodeMsgpack(r)
+					if err != nil {
+						return
+					}
+					msg := v.([]interface{})
+					if ack {
+						opts := msg[2].(map[string]interface{})
+						chunk := opts["chunk"].(string)
+						resp := append([]byte{0x81, 0xa3, 'a', 'c', 'k', 0xa0 | byte(len(chunk))}, chunk...)
+						conn.Write(resp)
+					}
+					msgs <- msg
+				}
+			}()
+		}
+	}()
+	return l, msgs
+}
+
+func TestFluentForwarder(t *testing.T) {
+	for _, ack := range []bool{false, true} {
+		t.Run(fmt.Sprintf("ack=%t", ack), func(t *testing.T) {
+			l, msgs := fluentServer(t, ack)
+			defer l.Close()
+
+			cfgs := []FluentConfig{FluentBatch(10, time.Hour)}
+			if ack {
+				cfgs = append(cfgs, FluentAck(5*time.Second))
+			}
+			fwd := NewFluentForwarder(New(WithConstantField("app", "billing")), l.Addr().String(), "app.billing", cfgs...)
+			ts := testTime.Add(123456789 * time.Nanosecond)
+			fwd.Fire(&log.Entry{Time: ts, Level: log.WarnLevel, Message: "disk low",
+				Data: log.Fields{"free_pct": 4.5, "disk": "/dev/sda", "count": 3, "ok": false}})
+			fwd.Fire(&log.Entry{Time: testTime, Level: log.InfoLevel,
+				Data: log.Fields{"big": int64(1 << 40), "neg": -1000}})
+			require.Nil(t, fwd.Close())
+
+			var msg []interface{}
+			select {
+			case msg = <-msgs:
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for message")
+			}
+			require.Len(t, msg, 3)
+			assert.Equal(t, "app.billing", msg[0])
+			assert.Equal(t, int64(2), msg[2].(map[string]interface{})["size"])
+
+			entries := msg[1].([]interface{})
+			require.Len(t, entries, 2)
+			e0 := entries[0].([]interface{})
+			assert.Equal(t, ts, e0[0])
+			assert.Equal(t, map[string]interface{}{
+				"ll":       "warning",
+				"app":      "billing",
+				"count":    int64(3),
+				"disk":     "/dev/sda",
+				"free_pct": 4.5,
+				"ok":       false,
+				"_msg":     "disk low",
+			}, e0[1])
+			assert.Equal(t, map[string]interface{}{
+				"ll":  "info",
+				"app": "billing",
+				"big": int64(1 << 40),
+				"neg": int64(-1000),
+			}, entries[1].([]interface{})[1])
+		})
+	}
+}
+
+func TestFluentForwarderAckTimeout(t *testing.T) {
+	// a server that accepts messages but never acknowledges them
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go io.Copy(ioutil.Discard, conn)
+		}
+	}()
+
+	fwd := NewFluentForwarder(New(), l.Addr().String(), "app", FluentAck(50*time.Millisecond))
+	fwd.Fire(&log.Entry{Time: testTime, Level: log.InfoLevel, Message: "msg"})
+	assert.NotNil(t, fwd.Close())
+}
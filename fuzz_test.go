@@ -0,0 +1,90 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+// roundTrip checks that line is parsed and that formatting the parsed entry
+// with cf reproduces it exactly.
+func roundTrip(t *testing.T, cf *Formatter, line []byte) Entry {
+	entry, err := Parse(line)
+	require.Nil(t, err, "%q", line)
+	again, err := cf.Format(entry.LogEntry())
+	require.Nil(t, err)
+	require.Equal(t, string(line), string(again))
+	return entry
+}
+
+func FuzzFormatParse(f *testing.F) {
+	f.Add("key", "value", "message")
+	f.Add("", "", "")
+	f.Add("a b=c", "quote\"d\nnew line", "tab\tdel\x7f")
+	f.Add("_msg", "x", "")
+	f.Add("srcline", "42", "msg")
+	f.Add("ll", "debug", "é \xff")
+
+	cf := New()
+	f.Fuzz(func(t *testing.T, key, value, msg string) {
+		line, err := cf.Format(&log.Entry{
+			Time:    testTime,
+			Level:   log.InfoLevel,
+			Message: msg,
+			Data:    log.Fields{key: value},
+		})
+		require.Nil(t, err)
+		entry := roundTrip(t, cf, line)
+		if msg != "" {
+			// without a message, a trailing _msg field is indistinguishable
+			require.Equal(t, msg, entry.Message)
+		}
+	})
+}
+
+func FuzzFormatParseRaw(f *testing.F) {
+	f.Add("value", "next")
+	f.Add("007", "x=1")
+	f.Add(`"quoted"`, `"A"`)
+	f.Add("1e5", "+Inf")
+	f.Add("a b=c", `"`)
+	f.Add("18446744073709551615", "<nil>")
+
+	cf := New(WithStrictValues())
+	f.Fuzz(func(t *testing.T, raw, next string) {
+		line, err := cf.Format(&log.Entry{
+			Time:    testTime,
+			Level:   log.InfoLevel,
+			Message: "msg",
+			Data:    log.Fields{"a": RawLogString(raw), "b": RawLogString(next), "c": next},
+		})
+		require.Nil(t, err)
+		entry := roundTrip(t, cf, line)
+		require.Equal(t, next, entry.Fields["c"])
+	})
+}
+
+func FuzzParse(f *testing.F) {
+	f.Add([]byte(`2017-02-13T12:13:45.000Z ll="info" srcfnc="main" srcline=42 a=1 b="x y" c=raw value _msg="m"`))
+	f.Add([]byte(`2017-02-13T12:13:45.000Z ll="info" a="\x41" b=007`))
+	f.Add([]byte(`2017-02-13T12:13:45.000Z ll="info" _msg="m" a=1`))
+
+	cf := New()
+	f.Fuzz(func(t *testing.T, line []byte) {
+		entry, err := Parse(line)
+		if err != nil {
+			return
+		}
+		// a parsed entry must format to a line that parses to the same entry
+		again, err := cf.Format(entry.LogEntry())
+		require.Nil(t, err)
+		roundTrip(t, cf, again)
+	})
+}
@@ -0,0 +1,105 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"os"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// WithGELF causes the Formatter to emit each entry as a Graylog Extended Log
+// Format (GELF) 1.1 message, for delivery to a Graylog GELF input using
+// NewGraylogWriter.
+//
+// The entry's message is sent as short_message, or "-" if it has none, and
+// its level as the syslog severity.  Constant, primary and remaining fields
+// follow as additional fields, prefixed with an underscore as GELF requires,
+// with characters other than letters, digits, underscores, dots and dashes
+// replaced by underscores.  If host is empty, the machine's hostname is
+// used.
+//
+// eg.
+//
+//	{"version":"1.1","host":"web1","short_message":"User logged in","timestamp":1483358400.000,"level":6,"_action":"user_login"}
+func WithGELF(host string) Config {
+	if host == "" {
+		host, _ = os.Hostname()
+	}
+	return func(kvf *Formatter) {
+		kvf.encode = func(cf *Formatter, b *bytes.Buffer, entry *Record) {
+			encodeGELF(cf, b, entry, host)
+		}
+	}
+}
+
+func encodeGELF(cf *Formatter, b *bytes.Buffer, entry *Record, host string) {
+	obj := newJSONObject(b)
+	obj.str("version", "1.1")
+	obj.str("host", host)
+	msg := entry.Message
+	if msg == "" {
+		msg = "-"
+	}
+	obj.str("short_message", msg)
+	obj.key("timestamp")
+	ms := entry.Time.UnixNano() / 1e6
+	b.WriteString(strconv.FormatInt(ms/1000, 10))
+	b.WriteByte('.')
+	b.Write(itoa(nil, int(ms%1000), 3))
+	obj.field("level", syslogSeverity(entry.level()))
+
+	if cf.includeCaller {
+		if name, line := cf.caller(entry); name != "" {
+			obj.str("_srcfnc", name)
+			obj.field("_srcline", line)
+		}
+	}
+	fc := cf.fields()
+	fields := cf.entryFields(fc, entry)
+	for _, f := range cf.entryConstants(fc, fields) {
+		obj.field(gelfKey(f.key), f.value)
+	}
+	for _, f := range fields {
+		obj.field(gelfKey(f.key), f.value)
+	}
+	obj.close()
+	b.WriteByte('\n')
+}
+
+// gelfKey returns the additional field name for key.  GELF reserves the
+// _id field, so an id key is renamed to _fields.id.
+func gelfKey(key string) string {
+	if key == "id" {
+		return "_fields.id"
+	}
+	k := []byte("_" + key)
+	for i, c := range k {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '.' || c == '-') {
+			k[i] = '_'
+		}
+	}
+	return string(k)
+}
+
+// syslogSeverity returns the syslog severity corresponding to level.
+func syslogSeverity(level log.Level) int {
+	switch level {
+	case log.PanicLevel:
+		return 0 // emerg
+	case log.FatalLevel:
+		return 2 // crit
+	case log.ErrorLevel:
+		return 3 // err
+	case log.WarnLevel:
+		return 4 // warning
+	case log.InfoLevel:
+		return 6 // info
+	default:
+		return 7 // debug
+	}
+}
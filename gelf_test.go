@@ -0,0 +1,52 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+var gelfTests = []struct {
+	name     string
+	entry    *log.Entry
+	expected string
+}{
+	{"full", &log.Entry{
+		Time:    testTime.Add(250 * time.Millisecond),
+		Level:   log.WarnLevel,
+		Message: "disk low",
+		Data: log.Fields{
+			"free_pct":  4.5,
+			"disk name": "sda",
+			"id":        17,
+		},
+	}, `{"version":"1.1","host":"web1","short_message":"disk low","timestamp":1486988025.250,"level":4,` +
+		`"_app":"billing","_disk_name":"sda","_free_pct":4.5,"_fields.id":17}`},
+	{"no-message", &log.Entry{
+		Time:  testTime,
+		Level: log.ErrorLevel,
+	}, `{"version":"1.1","host":"web1","short_message":"-","timestamp":1486988025.000,"level":3,"_app":"billing"}`},
+}
+
+func TestGELF(t *testing.T) {
+	cf := New(
+		WithConstantField("app", "billing"),
+		WithGELF("web1"))
+	for _, test := range gelfTests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := cf.Format(test.entry)
+			require.Nil(t, err)
+			assert.Equal(t, test.expected, strings.TrimSpace(string(result)))
+		})
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// KitLogger implements the go-kit log.Logger interface, rendering each call
+// to Log as a k=v line using a Formatter, so that go-kit services share the
+// same format, primary fields and Marshaler behaviour as logrus users.
+//
+// eg.
+//
+//	var logger kitlog.Logger = kvlog.NewKitLogger(kvlog.New(), os.Stderr)
+//	logger = level.Info(logger)
+//	logger.Log("msg", "user logged in", "username", "joe_user")
+//
+// The "level" key (as set by the go-kit level package) sets the entry's level,
+// which defaults to info.  The "msg" key sets its message and a "ts" key
+// holding a time.Time sets its timestamp, which otherwise defaults to the
+// current time.  All other keys become fields.
+type KitLogger struct {
+	cf  *Formatter
+	out io.Writer
+	mu  sync.Mutex
+}
+
+// NewKitLogger creates a KitLogger that formats entries using cf and writes
+// them to out.
+func NewKitLogger(cf *Formatter, out io.Writer) *KitLogger {
+	return &KitLogger{cf: cf, out: out}
+}
+
+// Log implements the go-kit log.Logger interface.  An odd number of keyvals
+// is padded with a "(MISSING)" value, as go-kit does.
+func (l *KitLogger) Log(keyvals ...interface{}) error {
+	if len(keyvals)%2 != 0 {
+		keyvals = append(keyvals, "(MISSING)")
+	}
+
+	entry := &log.Entry{
+		Level: log.InfoLevel,
+		Data:  make(log.Fields, len(keyvals)/2),
+	}
+	for i := 0; i < len(keyvals); i += 2 {
+		k := fmt.Sprint(keyvals[i])
+		v := keyvals[i+1]
+		switch k {
+		case "level":
+			if level, ok := kitLevel(v); ok {
+				entry.Level = level
+				continue
+			}
+		case "msg":
+			if entry.Message == "" {
+				entry.Message = valueString(v)
+				continue
+			}
+		case "ts":
+			if t, ok := v.(time.Time); ok {
+				entry.Time = t
+				continue
+			}
+		}
+		entry.Data[k] = v
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+
+	b, err := l.cf.Format(entry)
+	if err != nil {
+		return err
+	}
+	if len(b) == 0 {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.out.Write(b)
+	return err
+}
+
+// kitLevel converts a go-kit level value, which formats as "debug", "info",
+// "warn" or "error", to a logrus level.
+func kitLevel(v interface{}) (log.Level, bool) {
+	switch strings.ToLower(valueString(v)) {
+	case "debug":
+		return log.DebugLevel, true
+	case "info":
+		return log.InfoLevel, true
+	case "warn", "warning":
+		return log.WarnLevel, true
+	case "error":
+		return log.ErrorLevel, true
+	}
+	return 0, false
+}
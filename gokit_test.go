@@ -0,0 +1,46 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+// kitLevel mimics the level values used by the go-kit level package
+type kitLevel string
+
+func (l kitLevel) String() string { return string(l) }
+
+var kitTests = []struct {
+	name     string
+	keyvals  []interface{}
+	expected string
+}{
+	{"simple",
+		[]interface{}{"ts", testTime, "level", kitLevel("warn"), "msg", "test message", "count", 3, "status", "ok"},
+		`2017-02-13T12:13:45.000Z ll="warning" status="ok" count=3 _msg="test message"`},
+	{"odd",
+		[]interface{}{"ts", testTime, "key"},
+		`2017-02-13T12:13:45.000Z ll="info" key="(MISSING)"`},
+	{"non-string-key",
+		[]interface{}{"ts", testTime, 1, "one", "err", RawLogString("raw")},
+		`2017-02-13T12:13:45.000Z ll="info" 1="one" err=raw`},
+}
+
+func TestKitLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, test := range kitTests {
+		var buf bytes.Buffer
+		l := NewKitLogger(New(WithPrimaryFields("status")), &buf)
+		assert.Nil(l.Log(test.keyvals...))
+		assert.Equal(test.expected+"\n", buf.String(), test.name+" should match")
+	}
+}
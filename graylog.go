@@ -0,0 +1,27 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+// NewGraylogWriter creates a NetWriter that sends entries to a Graylog TCP
+// input at addr, terminating each with the NUL byte that Graylog uses to
+// delimit messages in place of the trailing newline.
+//
+// eg.
+//
+//	w := kvlog.NewGraylogWriter("graylog:12201", kvlog.NetTLS(&tls.Config{}))
+//	defer w.Close()
+//	logrus.SetFormatter(kvlog.New(kvlog.WithGELF("")))
+//	logrus.SetOutput(w)
+//
+// A GELF TCP input expects entries formatted using WithGELF; a raw TCP input
+// configured with the NUL delimiter accepts the usual k=v output.  As with
+// NewNetWriter, the connection is re-established automatically after a
+// failure and may use TLS.
+func NewGraylogWriter(addr string, cfgs ...NetConfig) *NetWriter {
+	w := newNetWriter("tcp", addr, cfgs)
+	w.nulFraming = true
+	w.start()
+	return w
+}
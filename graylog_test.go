@@ -0,0 +1,55 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestGraylogWriter(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+
+	msgs := make(chan string, 10)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		r := bufio.NewReader(conn)
+		for {
+			msg, err := r.ReadString(0)
+			if err != nil {
+				return
+			}
+			msgs <- msg
+		}
+	}()
+
+	w := NewGraylogWriter(l.Addr().String())
+	w.Write([]byte(`{"version":"1.1","short_message":"one"}` + "\n"))
+	w.Write([]byte(`{"version":"1.1","short_message":"two"}`))
+	for _, expected := range []string{
+		`{"version":"1.1","short_message":"one"}` + "\x00",
+		`{"version":"1.1","short_message":"two"}` + "\x00",
+	} {
+		select {
+		case msg := <-msgs:
+			assert.Equal(t, expected, msg)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for message")
+		}
+	}
+	assert.Nil(t, w.Close())
+}
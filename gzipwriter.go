@@ -0,0 +1,166 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"compress/gzip"
+	"io"
+	"sync"
+	"time"
+)
+
+// GzipConfig represents a configuration function to be passed to
+// NewGzipWriter.
+type GzipConfig func(g *GzipWriter)
+
+// GzipLevel sets the compression level, as defined by compress/gzip.  The
+// default is gzip.DefaultCompression.
+func GzipLevel(level int) GzipConfig {
+	return func(g *GzipWriter) {
+		g.level = level
+	}
+}
+
+// GzipFlushInterval sets the maximum time written entries are buffered
+// before being flushed to the underlying writer.  The default is one
+// second.
+func GzipFlushInterval(d time.Duration) GzipConfig {
+	return func(g *GzipWriter) {
+		g.interval = d
+	}
+}
+
+// GzipFlushSize sets the number of uncompressed bytes written after which
+// the compressed data is flushed to the underlying writer.  The default is
+// 256KB.
+func GzipFlushSize(n int) GzipConfig {
+	return func(g *GzipWriter) {
+		g.flushSize = n
+	}
+}
+
+// GzipWriter is an io.Writer that gzip compresses entries before writing
+// them to another writer, for archiving very verbose output.
+//
+// eg.
+//
+//	f, err := os.Create("batch.log.gz")
+//	...
+//	defer f.Close()
+//	w := kvlog.NewGzipWriter(f)
+//	defer w.Close()
+//	logrus.SetOutput(w)
+//
+// Compressed data is flushed to the underlying writer periodically and
+// once enough has been written, as set by GzipFlushInterval and
+// GzipFlushSize, so that the output can be read, eg. with zcat, while the
+// program is running and at most a short period of entries is lost if it
+// crashes.  Close must be called to complete the gzip stream.
+type GzipWriter struct {
+	out       io.Writer
+	level     int
+	interval  time.Duration
+	flushSize int
+
+	mu      sync.Mutex
+	zw      *gzip.Writer
+	pending int // uncompressed bytes written since the last flush
+	closed  bool
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// NewGzipWriter creates a GzipWriter that writes compressed entries to out.
+func NewGzipWriter(out io.Writer, cfgs ...GzipConfig) *GzipWriter {
+	g := &GzipWriter{
+		out:       out,
+		level:     gzip.DefaultCompression,
+		interval:  time.Second,
+		flushSize: 256 << 10,
+		done:      make(chan struct{}),
+		stopped:   make(chan struct{}),
+	}
+	for _, cfg := range cfgs {
+		cfg(g)
+	}
+	zw, err := gzip.NewWriterLevel(out, g.level)
+	if err != nil {
+		zw = gzip.NewWriter(out)
+	}
+	g.zw = zw
+	go g.run()
+	RegisterShutdown(g)
+	return g
+}
+
+// Write implements io.Writer.
+func (g *GzipWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return 0, errWriterClosed
+	}
+	n, err := g.zw.Write(p)
+	if err != nil {
+		return n, err
+	}
+	g.pending += n
+	if g.pending >= g.flushSize {
+		return n, g.flush()
+	}
+	return n, nil
+}
+
+// Flush writes any buffered compressed data to the underlying writer.
+func (g *GzipWriter) Flush() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return nil
+	}
+	return g.flush()
+}
+
+func (g *GzipWriter) flush() error {
+	g.pending = 0
+	return g.zw.Flush()
+}
+
+// Close completes the gzip stream.  The underlying writer is left open.
+func (g *GzipWriter) Close() error {
+	UnregisterShutdown(g)
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return nil
+	}
+	g.closed = true
+	close(g.done)
+	err := g.zw.Close()
+	g.mu.Unlock()
+	<-g.stopped
+	return err
+}
+
+func (g *GzipWriter) run() {
+	defer close(g.stopped)
+	ticker := time.NewTicker(g.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			g.mu.Lock()
+			if !g.closed && g.pending > 0 {
+				g.flush()
+			}
+			g.mu.Unlock()
+		case <-g.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+// syncBuffer is a bytes.Buffer that's safe for concurrent use.
+type syncBuffer struct {
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.closed = true
+	return nil
+}
+
+func (b *syncBuffer) Bytes() []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]byte(nil), b.buf.Bytes()...)
+}
+
+// gunzip decompresses as much of data as is available.
+func gunzip(t *testing.T, data []byte) string {
+	zr, err := gzip.NewReader(bytes.NewReader(data))
+	require.Nil(t, err)
+	out, _ := ioutil.ReadAll(zr)
+	return string(out)
+}
+
+func TestGzipWriter(t *testing.T) {
+	out := new(syncBuffer)
+	w := NewGzipWriter(out, GzipFlushInterval(time.Hour))
+	line := `2017-02-13T12:13:45.000Z ll="info" _msg="repeated message"` + "\n"
+	for i := 0; i < 1000; i++ {
+		w.Write([]byte(line))
+	}
+	require.Nil(t, w.Close())
+	assert.False(t, out.closed)
+
+	data := out.Bytes()
+	assert.True(t, len(data) < len(line)*10, "compressed size %d", len(data))
+	assert.Equal(t, strings.Repeat(line, 1000), gunzip(t, data))
+
+	_, err := w.Write([]byte(line))
+	assert.NotNil(t, err)
+}
+
+func TestGzipWriterFlush(t *testing.T) {
+	line := `2017-02-13T12:13:45.000Z ll="info" _msg="test"` + "\n"
+
+	t.Run("size", func(t *testing.T) {
+		out := new(syncBuffer)
+		w := NewGzipWriter(out, GzipFlushInterval(time.Hour), GzipFlushSize(len(line)*2))
+		defer w.Close()
+		w.Write([]byte(line))
+		w.Write([]byte(line))
+		assert.Equal(t, line+line, gunzip(t, out.Bytes()))
+	})
+
+	t.Run("interval", func(t *testing.T) {
+		out := new(syncBuffer)
+		w := NewGzipWriter(out, GzipFlushInterval(10*time.Millisecond))
+		defer w.Close()
+		w.Write([]byte(line))
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) && gunzip(t, out.Bytes()) == "" {
+			time.Sleep(5 * time.Millisecond)
+		}
+		assert.Equal(t, line, gunzip(t, out.Bytes()))
+	})
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// hashedLen is the number of bytes of the HMAC kept in a hashed value.
+const hashedLen = 16
+
+// WithHashedKeys causes the values of fields whose keys match any of keys
+// to be replaced with a keyed hash of the value, as returned by
+// HashedValue.  The same value always produces the same hash, so entries
+// can still be correlated by, for example, user ID without the ID itself
+// being stored with the logs.
+//
+// Keys may be exact names or glob patterns, as for WithRedactedKeys, and
+// redaction takes precedence over hashing.  key should be a secret of at
+// least 32 random bytes; without it, hashes of guessable values such as
+// email addresses could be reversed by trying candidates.
+//
+// eg.
+//
+//	kvlog.New(kvlog.WithHashedKeys(secret, "user_id", "email"))
+func WithHashedKeys(key []byte, keys ...string) Config {
+	return func(kvf *Formatter) {
+		kvf.hashers = append(kvf.hashers[:len(kvf.hashers):len(kvf.hashers)], valueHasher{
+			key:  append([]byte(nil), key...),
+			keys: (*keyMatcher)(nil).with(keys, false),
+		})
+	}
+}
+
+// HashedValue returns the hash logged in place of v by a Formatter
+// configured with WithHashedKeys(key, ...), allowing the entries for a
+// known value to be found.  The hash is the first 16 bytes of the
+// HMAC-SHA256 of v's string form, hex encoded.
+func HashedValue(key []byte, v interface{}) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(valueString(v)))
+	return hex.EncodeToString(mac.Sum(nil)[:hashedLen])
+}
+
+// valueHasher hashes the values of fields with matching keys.
+type valueHasher struct {
+	key  []byte
+	keys *keyMatcher
+}
+
+// hasher returns the hasher for fields with key k, or nil if k isn't one
+// of the keys configured by WithHashedKeys.
+func (cf *Formatter) hasher(k string) *valueHasher {
+	for i := range cf.hashers {
+		if cf.hashers[i].keys.match(k) {
+			return &cf.hashers[i]
+		}
+	}
+	return nil
+}
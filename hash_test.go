@@ -0,0 +1,56 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestHashedValue(t *testing.T) {
+	key := []byte("secret")
+	h := HashedValue(key, "joe@example.com")
+	assert.Regexp(t, `^[0-9a-f]{32}$`, h)
+	assert.Equal(t, h, HashedValue(key, "joe@example.com"))
+	assert.Equal(t, HashedValue(key, "42"), HashedValue(key, 42))
+	assert.NotEqual(t, h, HashedValue(key, "bob@example.com"))
+	assert.NotEqual(t, h, HashedValue([]byte("other"), "joe@example.com"))
+}
+
+func TestHashedKeys(t *testing.T) {
+	key := []byte("secret")
+	cf := New(
+		WithHashedKeys(key, "email", "*_id"),
+		WithRedactedKeys("session_id"))
+	result, err := cf.Format(&log.Entry{
+		Time:  testTime,
+		Level: log.InfoLevel,
+		Data: log.Fields{
+			"email":      "joe@example.com",
+			"user_id":    42,
+			"session_id": "abc",
+			"status":     "ok",
+		},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info"`+
+		` email="`+HashedValue(key, "joe@example.com")+`"`+
+		` session_id="[REDACTED]" status="ok"`+
+		` user_id="`+HashedValue(key, 42)+`"`+"\n", string(result))
+}
+
+func TestHashedKeysTypedFields(t *testing.T) {
+	key := []byte("secret")
+	var buf bytes.Buffer
+	NewLogger(&buf, New(WithHashedKeys(key, "user_id"))).Log(log.InfoLevel, "login",
+		Int("user_id", 42), String("status", "ok"))
+	assert.Regexp(t, ` status="ok" user_id="`+HashedValue(key, 42)+`" _msg="login"\n$`, buf.String())
+}
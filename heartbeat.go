@@ -0,0 +1,179 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Backlogger is implemented by sinks that queue entries before sending
+// them, such as LokiWriter and NetWriter.
+type Backlogger interface {
+	// Backlog returns the number of entries queued awaiting sending.
+	Backlog() int
+}
+
+// HeartbeatConfig represents a configuration function to be passed to
+// NewHeartbeat.
+type HeartbeatConfig func(h *Heartbeat)
+
+// HeartbeatSampler includes the sampling rates of s in each heartbeat, as
+// sample_rate.<level> fields for each level being sampled.
+func HeartbeatSampler(s *Sampler) HeartbeatConfig {
+	return func(h *Heartbeat) {
+		h.samplers = append(h.samplers, s)
+	}
+}
+
+// HeartbeatBacklog includes the number of entries queued by sink in each
+// heartbeat, as a backlog.<name> field.
+func HeartbeatBacklog(name string, sink Backlogger) HeartbeatConfig {
+	return func(h *Heartbeat) {
+		h.backlogs = append(h.backlogs, namedBacklog{name, sink})
+	}
+}
+
+type namedBacklog struct {
+	name string
+	sink Backlogger
+}
+
+// Heartbeat periodically logs an entry summarizing logging activity since
+// the last, so that a forwarder or sink that has stopped delivering entries
+// shows up as a gap, or as a growing backlog, in the entries that do arrive.
+//
+// eg.
+//
+//	hb := kvlog.NewHeartbeat(logrus.StandardLogger(), 5*time.Minute,
+//	    kvlog.HeartbeatBacklog("loki", lokiWriter))
+//	defer hb.Close()
+//
+// logs
+//
+//	2017-02-13T12:13:45.000Z ll="info" backlog.loki=0 bytes=48213 delivery_failures=0 dropped=0 heartbeat=true interval="5m0s" lines=402 _msg="kvlog: heartbeat"
+//
+// lines, bytes and dropped count the lines formatted, and entries
+// discarded by sinks and samplers, since the previous heartbeat, as
+// reported to an Observer; dropped entries are also broken down by reason
+// in dropped.<reason> fields.  Heartbeats are logged at InfoLevel.
+type Heartbeat struct {
+	lines    int64 // accessed atomically
+	bytes    int64 // accessed atomically
+	failures int64 // accessed atomically
+	logger   log.FieldLogger
+	interval time.Duration
+	samplers []*Sampler
+	backlogs []namedBacklog
+
+	mu      sync.Mutex
+	dropped map[string]int64
+
+	closing chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewHeartbeat starts logging heartbeats to logger every interval.  Close
+// should be called to stop it.
+func NewHeartbeat(logger log.FieldLogger, interval time.Duration, cfgs ...HeartbeatConfig) *Heartbeat {
+	h := &Heartbeat{
+		logger:   logger,
+		interval: interval,
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, cfg := range cfgs {
+		cfg(h)
+	}
+	RegisterObserver(h)
+	RegisterShutdown(h)
+	go h.run()
+	return h
+}
+
+func (h *Heartbeat) run() {
+	defer close(h.done)
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			h.Beat()
+		case <-h.closing:
+			return
+		}
+	}
+}
+
+// Beat logs a heartbeat immediately, resetting the counts.
+func (h *Heartbeat) Beat() {
+	fields := log.Fields{
+		"heartbeat":         true,
+		"interval":          h.interval,
+		"lines":             atomic.SwapInt64(&h.lines, 0),
+		"bytes":             atomic.SwapInt64(&h.bytes, 0),
+		"delivery_failures": atomic.SwapInt64(&h.failures, 0),
+	}
+	h.mu.Lock()
+	var dropped int64
+	for reason, n := range h.dropped {
+		fields["dropped."+reason] = n
+		dropped += n
+	}
+	h.dropped = nil
+	h.mu.Unlock()
+	fields["dropped"] = dropped
+
+	for _, s := range h.samplers {
+		for _, level := range log.AllLevels {
+			if n := s.Rate(level); n > 1 {
+				fields["sample_rate."+level.String()] = n
+			}
+		}
+	}
+	for _, b := range h.backlogs {
+		fields["backlog."+b.name] = b.sink.Backlog()
+	}
+	h.logger.WithFields(fields).Info("kvlog: heartbeat")
+}
+
+// Close stops the heartbeat.  It doesn't log a final heartbeat.
+func (h *Heartbeat) Close() error {
+	h.once.Do(func() {
+		UnregisterShutdown(h)
+		UnregisterObserver(h)
+		close(h.closing)
+	})
+	<-h.done
+	return nil
+}
+
+// LineWritten implements Observer.
+func (h *Heartbeat) LineWritten(level log.Level, n int) {
+	atomic.AddInt64(&h.lines, 1)
+	atomic.AddInt64(&h.bytes, int64(n))
+}
+
+// FormatFailed implements Observer.
+func (h *Heartbeat) FormatFailed(err error) {}
+
+// EntriesDropped implements Observer.
+func (h *Heartbeat) EntriesDropped(reason string, n int) {
+	h.mu.Lock()
+	if h.dropped == nil {
+		h.dropped = make(map[string]int64)
+	}
+	h.dropped[reason] += int64(n)
+	h.mu.Unlock()
+}
+
+// DeliveryFailed implements Observer.
+func (h *Heartbeat) DeliveryFailed(sink string, err error) {
+	atomic.AddInt64(&h.failures, 1)
+}
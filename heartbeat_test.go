@@ -0,0 +1,84 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+type testBacklog int
+
+func (b testBacklog) Backlog() int {
+	return int(b)
+}
+
+func TestHeartbeat(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New()
+	logger.Out = &buf
+	logger.Formatter = New()
+
+	s := NewSampler(ioutil.Discard, SampleByField("id"), SampleRate(log.DebugLevel, 1000000))
+	hb := NewHeartbeat(logger, time.Hour, HeartbeatSampler(s), HeartbeatBacklog("loki", testBacklog(7)))
+	defer hb.Close()
+
+	logger.Info("one")
+	logger.Warn("two")
+	size := buf.Len()
+	s.WriteLevel(log.DebugLevel, []byte(`ll="debug" id="b" _msg="x"`+"\n"))
+
+	lastEntry := func() Entry {
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		entry, err := Parse([]byte(lines[len(lines)-1]))
+		require.Nil(t, err)
+		return entry
+	}
+
+	hb.Beat()
+	entry := lastEntry()
+	assert.Equal(t, "kvlog: heartbeat", entry.Message)
+	assert.Equal(t, log.InfoLevel, entry.Level)
+	assert.Equal(t, map[string]interface{}{
+		"heartbeat":         true,
+		"interval":          "1h0m0s",
+		"lines":             int64(2),
+		"bytes":             int64(size),
+		"delivery_failures": int64(0),
+		"dropped":           int64(1),
+		"dropped.sampled":   int64(1),
+		"sample_rate.debug": int64(1000000),
+		"backlog.loki":      int64(7),
+	}, entry.Fields)
+
+	hb.Beat()
+	entry = lastEntry()
+	assert.Equal(t, int64(1), entry.Fields["lines"]) // the previous heartbeat
+	assert.Equal(t, int64(0), entry.Fields["dropped"])
+}
+
+func TestHeartbeatInterval(t *testing.T) {
+	buf := new(syncBuffer)
+	logger := log.New()
+	logger.Out = buf
+	logger.Formatter = New()
+
+	hb := NewHeartbeat(logger, 10*time.Millisecond)
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(string(buf.Bytes()), "kvlog: heartbeat") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	require.Nil(t, hb.Close())
+	assert.Contains(t, string(buf.Bytes()), "heartbeat=true")
+}
@@ -0,0 +1,63 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// HECEvent holds the metadata included in each Splunk HTTP Event Collector
+// envelope.  Empty values are omitted so that the collector's defaults
+// apply.
+type HECEvent struct {
+	Host       string
+	Source     string
+	SourceType string
+	Index      string
+}
+
+// WithHECEvent causes the Formatter to wrap each entry in a Splunk HTTP Event
+// Collector envelope so that output can be POSTed to the collector's
+// /services/collector/event endpoint verbatim.
+//
+// The event itself is a JSON object holding the same keys as the k=v output,
+// in the same order.
+//
+// eg.
+//
+//	{"time":1483358400.000,"host":"web1","sourcetype":"kvlog","event":{"time":"2017-01-02T12:00:00.000Z","ll":"info","action":"user_login","_msg":"User logged in"}}
+func WithHECEvent(meta HECEvent) Config {
+	return func(kvf *Formatter) {
+		kvf.encode = func(cf *Formatter, b *bytes.Buffer, entry *Record) {
+			encodeHEC(cf, b, entry, meta)
+		}
+	}
+}
+
+func encodeHEC(cf *Formatter, b *bytes.Buffer, entry *Record, meta HECEvent) {
+	obj := newJSONObject(b)
+	obj.key("time")
+	ms := entry.Time.UnixNano() / 1e6
+	b.WriteString(strconv.FormatInt(ms/1000, 10))
+	b.WriteByte('.')
+	b.Write(itoa(nil, int(ms%1000), 3))
+	if meta.Host != "" {
+		obj.str("host", meta.Host)
+	}
+	if meta.Source != "" {
+		obj.str("source", meta.Source)
+	}
+	if meta.SourceType != "" {
+		obj.str("sourcetype", meta.SourceType)
+	}
+	if meta.Index != "" {
+		obj.str("index", meta.Index)
+	}
+	obj.key("event")
+	cf.writeJSONEntry(b, entry)
+	obj.close()
+	b.WriteByte('\n')
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+var hecTests = []struct {
+	name     string
+	meta     HECEvent
+	entry    *log.Entry
+	expected string
+}{
+	{"full", HECEvent{Host: "web1", Source: "app", SourceType: "kvlog", Index: "main"}, &log.Entry{
+		Time:    testTime.Add(250 * time.Millisecond),
+		Level:   log.InfoLevel,
+		Message: "test message",
+		Data: log.Fields{
+			"field1": "value1",
+			"field2": 123,
+		},
+	}, `{"time":1486988025.250,"host":"web1","source":"app","sourcetype":"kvlog","index":"main",` +
+		`"event":{"time":"2017-02-13T12:13:45.250Z","ll":"info","commit":"abcd","field1":"value1","field2":123,"_msg":"test message"}}`},
+	{"empty-meta", HECEvent{}, &log.Entry{
+		Time:  testTime,
+		Level: log.ErrorLevel,
+	}, `{"time":1486988025.000,"event":{"time":"2017-02-13T12:13:45.000Z","ll":"error","commit":"abcd"}}`},
+}
+
+func TestHECEvent(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for _, test := range hecTests {
+		cf := New(
+			WithConstantField("commit", "abcd"),
+			WithHECEvent(test.meta))
+		result, err := cf.Format(test.entry)
+		require.Nil(err, test.name+" should not error")
+		assert.Equal(test.expected, strings.TrimSpace(string(result)), test.name+" should match")
+		assert.True(json.Valid(result), test.name+" should be valid JSON")
+	}
+}
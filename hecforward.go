@@ -0,0 +1,221 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// HECConfig represents a configuration function to be passed to
+// NewHECForwarder.
+type HECConfig func(h *HECForwarder)
+
+// HECMeta sets the host, source, sourcetype and index included with each
+// event.  Empty values are omitted so that the token's defaults apply.
+func HECMeta(meta HECEvent) HECConfig {
+	return func(h *HECForwarder) {
+		h.meta = meta
+	}
+}
+
+// HECBatch sets the maximum number of events sent in a single request and
+// the maximum time an event is held before being sent.  The defaults are
+// 100 events and 5 seconds.
+func HECBatch(size int, interval time.Duration) HECConfig {
+	return func(h *HECForwarder) {
+		h.batchSize = size
+		h.interval = interval
+	}
+}
+
+// HECGzip causes request bodies to be gzip compressed.
+func HECGzip() HECConfig {
+	return func(h *HECForwarder) {
+		h.gzip = true
+	}
+}
+
+// HECRetry sets the number of times a failed request is retried and the
+// delay before the first retry, which doubles on each subsequent attempt.
+// Requests are retried if they fail to connect or the collector responds
+// with a 429 or 5xx status.  The default is 3 retries starting at 1 second.
+func HECRetry(retries int, backoff time.Duration) HECConfig {
+	return func(h *HECForwarder) {
+		h.retry.Retries = retries
+		h.retry.MinBackoff = backoff
+	}
+}
+
+// HECRetryPolicy sets how failed requests are retried, including the
+// circuit breaker.  The default is DefaultRetryPolicy, with retries
+// starting at 1 second.
+func HECRetryPolicy(policy RetryPolicy) HECConfig {
+	return func(h *HECForwarder) {
+		h.retry = policy
+	}
+}
+
+// HECHTTPClient sets the client used to make requests.
+func HECHTTPClient(client *http.Client) HECConfig {
+	return func(h *HECForwarder) {
+		h.client = client
+	}
+}
+
+// HECTLS sets the TLS configuration used to make requests, such as one
+// returned by NewTLSConfig.  It replaces any client set by HECHTTPClient.
+func HECTLS(cfg *tls.Config) HECConfig {
+	return func(h *HECForwarder) {
+		h.client = tlsHTTPClient(cfg)
+	}
+}
+
+// HECQueuePolicy sets how many events are held in memory awaiting
+// sending and what happens when that limit is reached.  The default is
+// DefaultQueuePolicy.
+func HECQueuePolicy(policy QueuePolicy) HECConfig {
+	return func(h *HECForwarder) {
+		h.queuePolicy = policy
+	}
+}
+
+// HECErrorHandler sets a function to be called if a background send fails
+// after all retries.
+func HECErrorHandler(f func(error)) HECConfig {
+	return func(h *HECForwarder) {
+		h.onError = f
+	}
+}
+
+// HECForwarder is a logrus hook that POSTs batches of entries directly to a
+// Splunk HTTP Event Collector, without needing a universal forwarder.
+//
+// eg.
+//
+//	hec := kvlog.NewHECForwarder(kvlog.New(), "https://splunk:8088/services/collector/event", token,
+//	    kvlog.HECMeta(kvlog.HECEvent{Index: "main", SourceType: "kvlog"}),
+//	    kvlog.HECGzip())
+//	defer hec.Close()
+//	logrus.AddHook(hec)
+//
+// Events are encoded as for WithHECEvent using the given Formatter, so
+// constant fields, primary field ordering and Loggable values are handled
+// identically to the formatted output.
+//
+// Close should be called before the program exits to send any queued
+// events.
+type HECForwarder struct {
+	cf          *Formatter
+	endpoint    string
+	token       string
+	meta        HECEvent
+	client      *http.Client
+	gzip        bool
+	retry       RetryPolicy
+	queuePolicy QueuePolicy
+	batchSize   int
+	interval    time.Duration
+	onError     func(error)
+	batch       *batcher
+	deliver     *deliverer
+}
+
+// NewHECForwarder creates a forwarder that sends events to endpoint, which
+// should be the collector's full event URL, authenticating with token.
+func NewHECForwarder(cf *Formatter, endpoint, token string, cfgs ...HECConfig) *HECForwarder {
+	h := &HECForwarder{
+		cf:          cf,
+		endpoint:    endpoint,
+		token:       token,
+		client:      http.DefaultClient,
+		retry:       DefaultRetryPolicy,
+		queuePolicy: DefaultQueuePolicy,
+		batchSize:   100,
+		interval:    5 * time.Second,
+	}
+	h.retry.MinBackoff = time.Second
+	for _, cfg := range cfgs {
+		cfg(h)
+	}
+	h.deliver = newDeliverer(h.retry, h.client, "HEC request")
+	h.batch = newBatcher("hec", h.batchSize, h.interval, h.queuePolicy, h.send, h.encode, h.onError)
+	RegisterShutdown(h)
+	return h
+}
+
+// Levels implements the logrus.Hook interface.
+func (h *HECForwarder) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements the logrus.Hook interface, queuing the entry to be sent.
+func (h *HECForwarder) Fire(entry *log.Entry) error {
+	return h.batch.add(h.encode(entry))
+}
+
+func (h *HECForwarder) encode(entry *log.Entry) []byte {
+	var b bytes.Buffer
+	encodeHEC(h.cf, &b, h.cf.record(entry), h.meta)
+	return b.Bytes()
+}
+
+// Dropped returns the number of events discarded, either because the queue
+// was full or because they couldn't be sent.
+func (h *HECForwarder) Dropped() int64 {
+	return h.batch.dropped()
+}
+
+// Backlog returns the number of events queued awaiting sending.
+func (h *HECForwarder) Backlog() int {
+	return h.batch.backlog()
+}
+
+// Flush synchronously sends all queued events.
+func (h *HECForwarder) Flush() error {
+	return h.batch.flush()
+}
+
+// Close stops the forwarder after sending any queued events.  Requests are
+// attempted once, without waiting to retry, and a retry in progress is
+// abandoned, so that Close isn't held up by an unavailable endpoint.
+func (h *HECForwarder) Close() error {
+	UnregisterShutdown(h)
+	h.deliver.close()
+	return h.batch.close()
+}
+
+func (h *HECForwarder) send(events [][]byte) error {
+	var body bytes.Buffer
+	if h.gzip {
+		zw := gzip.NewWriter(&body)
+		for _, ev := range events {
+			zw.Write(ev)
+		}
+		zw.Close()
+	} else {
+		for _, ev := range events {
+			body.Write(ev)
+		}
+	}
+
+	return h.deliver.do(func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", h.endpoint, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", "Splunk "+h.token)
+		req.Header.Set("Content-Type", "application/json")
+		if h.gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		return req, nil
+	})
+}
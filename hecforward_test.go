@@ -0,0 +1,100 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestHECForwarder(t *testing.T) {
+	for _, useGzip := range []bool{false, true} {
+		name := "plain"
+		var cfgs []HECConfig
+		if useGzip {
+			name = "gzip"
+			cfgs = append(cfgs, HECGzip())
+		}
+		t.Run(name, func(t *testing.T) {
+			var mu sync.Mutex
+			var bodies []string
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				assert.Equal(t, "Splunk secret", r.Header.Get("Authorization"))
+				var body io.Reader = r.Body
+				if r.Header.Get("Content-Encoding") == "gzip" {
+					zr, err := gzip.NewReader(r.Body)
+					if !assert.Nil(t, err) {
+						return
+					}
+					body = zr
+				}
+				b, _ := ioutil.ReadAll(body)
+				mu.Lock()
+				bodies = append(bodies, string(b))
+				mu.Unlock()
+			}))
+			defer srv.Close()
+
+			cfgs = append(cfgs,
+				HECMeta(HECEvent{Index: "main", SourceType: "kvlog"}),
+				HECBatch(10, time.Hour))
+			hec := NewHECForwarder(New(), srv.URL, "secret", cfgs...)
+			hec.Fire(&log.Entry{Time: testTime, Level: log.InfoLevel, Message: "one"})
+			hec.Fire(&log.Entry{Time: testTime, Level: log.WarnLevel, Data: log.Fields{"n": 2}})
+			require.Nil(t, hec.Close())
+
+			require.Len(t, bodies, 1)
+			assert.Equal(t, strings.Join([]string{
+				`{"time":1486988025.000,"sourcetype":"kvlog","index":"main","event":{"time":"2017-02-13T12:13:45.000Z","ll":"info","_msg":"one"}}`,
+				`{"time":1486988025.000,"sourcetype":"kvlog","index":"main","event":{"time":"2017-02-13T12:13:45.000Z","ll":"warning","n":2}}`,
+				``}, "\n"), bodies[0])
+		})
+	}
+}
+
+func TestHECForwarderRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		attempts int
+	}{
+		{"unavailable", http.StatusServiceUnavailable, 3},
+		{"throttled", http.StatusTooManyRequests, 3},
+		{"forbidden", http.StatusForbidden, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var mu sync.Mutex
+			attempts := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				attempts++
+				mu.Unlock()
+				w.WriteHeader(test.status)
+			}))
+			defer srv.Close()
+
+			hec := NewHECForwarder(New(), srv.URL, "secret", HECRetry(2, time.Millisecond))
+			hec.Fire(&log.Entry{Time: testTime, Level: log.InfoLevel, Message: "msg"})
+			assert.NotNil(t, hec.Flush())
+			assert.Equal(t, test.attempts, attempts)
+			hec.Close()
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+// Package cli holds helpers shared by the kvlog command line tools.
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Env holds the standard streams for a command, allowing them to be
+// replaced in tests.
+type Env struct {
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// Errorf writes a message prefixed with the command name to Stderr.
+func (env Env) Errorf(cmd, format string, args ...interface{}) {
+	fmt.Fprintf(env.Stderr, cmd+": "+format+"\n", args...)
+}
+
+// EachInput calls fn with a reader for each named file, or for Stdin if
+// names is empty or a name is "-".  Files that can't be opened are reported
+// to Stderr and skipped.  It returns false if any input failed.
+func (env Env) EachInput(cmd string, names []string, fn func(name string, r io.Reader) error) bool {
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+	ok := true
+	for _, name := range names {
+		if name == "-" {
+			if err := fn("-", env.Stdin); err != nil {
+				env.Errorf(cmd, "%v", err)
+				ok = false
+			}
+			continue
+		}
+		f, err := os.Open(name)
+		if err != nil {
+			env.Errorf(cmd, "%v", err)
+			ok = false
+			continue
+		}
+		err = fn(name, f)
+		f.Close()
+		if err != nil {
+			env.Errorf(cmd, "%s: %v", name, err)
+			ok = false
+		}
+	}
+	return ok
+}
+
+// FollowInput calls fn with a Follower for the named file, which blocks
+// waiting for new lines to be written, so fn normally runs until the
+// program is interrupted.  If name is "-" Stdin is read instead.
+func (env Env) FollowInput(cmd, name string, fn func(name string, r io.Reader) error) bool {
+	if name == "-" {
+		return env.EachInput(cmd, nil, fn)
+	}
+	fl, err := Follow(name)
+	if err != nil {
+		env.Errorf(cmd, "%v", err)
+		return false
+	}
+	defer fl.Close()
+	if err := fn(name, fl); err != nil {
+		env.Errorf(cmd, "%s: %v", name, err)
+		return false
+	}
+	return true
+}
+
+// List splits a comma separated flag value, ignoring empty items.
+func List(list string) []string {
+	var out []string
+	for _, v := range strings.Split(list, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// KeySet parses a comma separated list of keys as used by the -show and
+// -hide flags.  A nil set is returned for an empty list.
+func KeySet(list string) map[string]bool {
+	keys := List(list)
+	if len(keys) == 0 {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, k := range keys {
+		set[k] = true
+	}
+	return set
+}
@@ -0,0 +1,48 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package cli
+
+import (
+	"fmt"
+	"io"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/gwatts/kvlog"
+)
+
+// ANSI escape sequences used to highlight whole lines
+const (
+	HighlightReset = "\x1b[0m"
+	highlightWarn  = "\x1b[33m"
+	highlightError = "\x1b[1;31m"
+)
+
+// UseColor interprets the value of a -color flag, which may be "auto",
+// "always" or "never".  Auto enables color if w is a terminal.
+func UseColor(value string, w io.Writer) (bool, error) {
+	switch value {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		return kvlog.IsTerminal(w), nil
+	}
+	return false, fmt.Errorf("invalid -color value %q", value)
+}
+
+// Highlight returns the escape sequence used to highlight a line at the
+// given level, or an empty string if lines at that level aren't
+// highlighted.
+func Highlight(level log.Level) string {
+	switch {
+	case level <= log.ErrorLevel:
+		return highlightError
+	case level == log.WarnLevel:
+		return highlightWarn
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package cli
+
+import (
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// FollowPoll is the interval at which a followed file is checked for new
+// data.
+var FollowPoll = 250 * time.Millisecond
+
+// Follower reads a file that's being appended to, like tail -f.  Reads
+// block until more data is written rather than returning io.EOF.
+//
+// If the file is renamed or removed and a new file created in its place, as
+// happens when logs are rotated, the Follower switches to the new file once
+// the old one has been read to the end.  If the file is truncated, reading
+// restarts at its beginning.
+type Follower struct {
+	name string
+	f    *os.File
+	off  int64
+	stop chan struct{}
+	once sync.Once
+}
+
+// Follow opens the named file for following.  Reading starts at the current
+// end of the file.
+func Follow(name string) (*Follower, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	off, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &Follower{name: name, f: f, off: off, stop: make(chan struct{})}, nil
+}
+
+// Read implements io.Reader.  It returns io.EOF only after Close is called.
+func (fl *Follower) Read(p []byte) (int, error) {
+	for {
+		select {
+		case <-fl.stop:
+			fl.f.Close()
+			return 0, io.EOF
+		default:
+		}
+
+		n, err := fl.f.Read(p)
+		fl.off += int64(n)
+		if n > 0 {
+			return n, nil
+		}
+		if err != nil && err != io.EOF {
+			return 0, err
+		}
+
+		if fl.reopen() {
+			continue
+		}
+		select {
+		case <-fl.stop:
+		case <-time.After(FollowPoll):
+		}
+	}
+}
+
+// reopen checks whether the file has been rotated or truncated, returning
+// true if there may be more data to read.
+func (fl *Follower) reopen() bool {
+	cur, err := fl.f.Stat()
+	if err != nil {
+		return false
+	}
+	fi, err := os.Stat(fl.name)
+	if err != nil {
+		return false // removed, but not yet replaced
+	}
+
+	if !os.SameFile(cur, fi) {
+		f, err := os.Open(fl.name)
+		if err != nil {
+			return false
+		}
+		fl.f.Close()
+		fl.f = f
+		fl.off = 0
+		return true
+	}
+
+	if fi.Size() < fl.off {
+		if _, err := fl.f.Seek(0, io.SeekStart); err == nil {
+			fl.off = 0
+			return true
+		}
+	}
+	return false
+}
+
+// Close stops following the file; any blocked or subsequent Read returns
+// io.EOF.  It's safe to call Close concurrently with Read.
+func (fl *Follower) Close() error {
+	fl.once.Do(func() { close(fl.stop) })
+	return nil
+}
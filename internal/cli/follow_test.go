@@ -0,0 +1,73 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package cli
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFollow(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	FollowPoll = 10 * time.Millisecond
+	dir, err := ioutil.TempDir("", "kvlog-follow")
+	require.Nil(err)
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "app.log")
+	require.Nil(ioutil.WriteFile(name, []byte("existing\n"), 0644))
+
+	fl, err := Follow(name)
+	require.Nil(err)
+	lines := make(chan string)
+	go func() {
+		s := bufio.NewScanner(fl)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+		close(lines)
+	}()
+
+	appendLine := func(line string) {
+		f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		require.Nil(err)
+		f.WriteString(line + "\n")
+		f.Close()
+	}
+	next := func() string {
+		select {
+		case line := <-lines:
+			return line
+		case <-time.After(5 * time.Second):
+			return "timeout"
+		}
+	}
+
+	appendLine("one")
+	assert.Equal("one", next())
+
+	// rotate
+	require.Nil(os.Rename(name, name+".1"))
+	appendLine("two")
+	assert.Equal("two", next())
+
+	// truncate
+	require.Nil(os.Truncate(name, 0))
+	appendLine("3")
+	assert.Equal("3", next())
+
+	fl.Close()
+	_, open := <-lines
+	assert.False(open)
+}
@@ -0,0 +1,386 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Package expr implements the field expressions used by the kvlog command line
+tools to select entries.
+
+An expression compares field values against literals:
+
+	status!=ok && duration_ms>500
+	ll>=warning || (action=="login" && user=~"^adm")
+
+The supported operators are == (or =), !=, <, <=, >, >=, =~ and !~ (regular
+expression match), combined with &&, || and ! and grouped with parentheses.
+A key on its own tests whether the field is present.
+
+If both the field value and the literal are numbers they're compared
+numerically, otherwise they're compared as strings.  Quoted literals are
+always treated as strings.  The ll key is compared by severity, so that
+ll>=warning matches warning, error, fatal and panic entries.  The _msg,
+srcfnc and srcline keys refer to the entry's message and caller.
+
+A comparison against a field that's not present is false, except for != and
+!~ which are true.
+*/
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+
+	"github.com/gwatts/kvlog"
+)
+
+// Expr is a compiled expression.
+type Expr struct {
+	root node
+}
+
+// Parse compiles an expression.
+func Parse(s string) (*Expr, error) {
+	p := &parser{s: s}
+	p.next()
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokEOF {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	return &Expr{root: root}, nil
+}
+
+// Match reports whether the entry satisfies the expression.
+func (x *Expr) Match(e kvlog.Entry) bool {
+	return x.root.eval(e)
+}
+
+// Lookup returns the value of key for an entry, including the special ll,
+// _msg, srcfnc and srcline keys.
+func Lookup(e kvlog.Entry, key string) (interface{}, bool) {
+	switch key {
+	case "ll":
+		return e.Level, true
+	case "_msg":
+		return e.Message, e.Message != ""
+	case "srcfnc":
+		return e.Caller, e.Caller != ""
+	case "srcline":
+		return int64(e.Line), e.Line > 0
+	}
+	v, ok := e.Fields[key]
+	return v, ok
+}
+
+type node interface {
+	eval(e kvlog.Entry) bool
+}
+
+type andNode struct{ l, r node }
+type orNode struct{ l, r node }
+type notNode struct{ n node }
+type existsNode struct{ key string }
+
+func (n andNode) eval(e kvlog.Entry) bool    { return n.l.eval(e) && n.r.eval(e) }
+func (n orNode) eval(e kvlog.Entry) bool     { return n.l.eval(e) || n.r.eval(e) }
+func (n notNode) eval(e kvlog.Entry) bool    { return !n.n.eval(e) }
+func (n existsNode) eval(e kvlog.Entry) bool { _, ok := Lookup(e, n.key); return ok }
+
+type compareNode struct {
+	key    string
+	op     string
+	lit    string
+	num    float64
+	isNum  bool
+	re     *regexp.Regexp
+	level  log.Level
+	isLvl  bool
+	quoted bool
+}
+
+func (n *compareNode) eval(e kvlog.Entry) bool {
+	v, ok := Lookup(e, n.key)
+	if !ok {
+		return n.op == "!=" || n.op == "!~"
+	}
+
+	switch n.op {
+	case "=~":
+		return n.re.MatchString(toString(v))
+	case "!~":
+		return !n.re.MatchString(toString(v))
+	}
+
+	var c int
+	switch v := v.(type) {
+	case log.Level:
+		if !n.isLvl {
+			c = strings.Compare(v.String(), n.lit)
+			break
+		}
+		// lower logrus levels are more severe
+		c = compareFloat(float64(n.level), float64(v))
+	default:
+		if f, ok := toFloat(v); ok && n.isNum && !n.quoted {
+			c = compareFloat(f, n.num)
+		} else {
+			c = strings.Compare(toString(v), n.lit)
+		}
+	}
+
+	switch n.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default: // >=
+		return c >= 0
+	}
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+func toString(v interface{}) string {
+	if v == nil {
+		return "<nil>"
+	}
+	return fmt.Sprint(v)
+}
+
+// parser
+
+type tokKind int
+
+const (
+	tokEOF tokKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokAnd
+	tokOr
+	tokNot
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind tokKind
+	text string
+	pos  int
+}
+
+type parser struct {
+	s   string
+	pos int
+	tok token
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("expr: "+format+" at offset %d", append(args, p.tok.pos)...)
+}
+
+const opChars = "=!<>~"
+
+func (p *parser) next() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t') {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.s) {
+		p.tok = token{tokEOF, "", start}
+		return
+	}
+	rest := p.s[p.pos:]
+	switch {
+	case strings.HasPrefix(rest, "&&"):
+		p.pos += 2
+		p.tok = token{tokAnd, "&&", start}
+	case strings.HasPrefix(rest, "||"):
+		p.pos += 2
+		p.tok = token{tokOr, "||", start}
+	case rest[0] == '(':
+		p.pos++
+		p.tok = token{tokLParen, "(", start}
+	case rest[0] == ')':
+		p.pos++
+		p.tok = token{tokRParen, ")", start}
+	case rest[0] == '"':
+		end := 1
+		for end < len(rest) && rest[end] != '"' {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rest) {
+			p.tok = token{tokString, rest, start}
+			p.pos = len(p.s)
+			return
+		}
+		p.pos += end + 1
+		p.tok = token{tokString, rest[:end+1], start}
+	case strings.IndexByte(opChars, rest[0]) != -1:
+		end := 0
+		for end < len(rest) && strings.IndexByte(opChars, rest[end]) != -1 {
+			end++
+		}
+		if rest[:end] == "!" {
+			p.pos++
+			p.tok = token{tokNot, "!", start}
+			return
+		}
+		p.pos += end
+		p.tok = token{tokOp, rest[:end], start}
+	default:
+		end := 0
+		for end < len(rest) && strings.IndexByte(" \t()&|"+opChars, rest[end]) == -1 {
+			end++
+		}
+		p.pos += end
+		p.tok = token{tokWord, rest[:end], start}
+	}
+}
+
+func (p *parser) parseOr() (node, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokOr {
+		p.next()
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = orNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	l, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.tok.kind == tokAnd {
+		p.next()
+		r, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		l = andNode{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	switch p.tok.kind {
+	case tokNot:
+		p.next()
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n}, nil
+
+	case tokLParen:
+		p.next()
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.tok.kind != tokRParen {
+			return nil, p.errorf("missing )")
+		}
+		p.next()
+		return n, nil
+
+	case tokWord:
+		return p.parseComparison()
+	}
+	if p.tok.kind == tokEOF {
+		return nil, p.errorf("unexpected end of expression")
+	}
+	return nil, p.errorf("unexpected %q", p.tok.text)
+}
+
+func (p *parser) parseComparison() (node, error) {
+	key := p.tok.text
+	p.next()
+	if p.tok.kind != tokOp {
+		return existsNode{key}, nil
+	}
+
+	op := p.tok.text
+	switch op {
+	case "=":
+		op = "=="
+	case "==", "!=", "<", "<=", ">", ">=", "=~", "!~":
+	default:
+		return nil, p.errorf("unknown operator %q", op)
+	}
+	p.next()
+
+	n := &compareNode{key: key, op: op}
+	switch p.tok.kind {
+	case tokWord:
+		n.lit = p.tok.text
+	case tokString:
+		s, err := strconv.Unquote(p.tok.text)
+		if err != nil {
+			return nil, p.errorf("invalid string %s", p.tok.text)
+		}
+		n.lit = s
+		n.quoted = true
+	default:
+		return nil, p.errorf("missing value for %s", key)
+	}
+	p.next()
+
+	if op == "=~" || op == "!~" {
+		re, err := regexp.Compile(n.lit)
+		if err != nil {
+			return nil, fmt.Errorf("expr: invalid regular expression %q: %v", n.lit, err)
+		}
+		n.re = re
+	}
+	if f, err := strconv.ParseFloat(n.lit, 64); err == nil {
+		n.num, n.isNum = f, true
+	}
+	if key == "ll" {
+		if level, err := log.ParseLevel(n.lit); err == nil {
+			n.level, n.isLvl = level, true
+		}
+	}
+	return n, nil
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package expr
+
+import (
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gwatts/kvlog"
+)
+
+var testEntry = kvlog.Entry{
+	Level:   log.WarnLevel,
+	Message: "request failed",
+	Caller:  "handle",
+	Line:    12,
+	Fields: map[string]interface{}{
+		"status":      "failed",
+		"duration_ms": int64(750),
+		"ratio":       0.25,
+		"code":        "500",
+		"ok":          false,
+	},
+}
+
+var exprTests = []struct {
+	expr     string
+	expected bool
+}{
+	{`status!=ok && duration_ms>500`, true},
+	{`status==failed`, true},
+	{`status=failed`, true},
+	{`status="failed"`, true},
+	{`duration_ms>=750 && duration_ms<=750`, true},
+	{`duration_ms<1000.5`, true},
+	{`duration_ms>"9"`, false}, // quoted literal forces string comparison
+	{`ratio<0.5`, true},
+	{`code==500`, true},
+	{`ok==false`, true},
+	{`status=~"^fail" && !(status=~ok)`, true},
+	{`status!~fail`, false},
+	{`missing==1`, false},
+	{`missing!=1`, true},
+	{`missing`, false},
+	{`status`, true},
+	{`!missing`, true},
+	{`status==ok || duration_ms>500`, true},
+	{`status==ok || duration_ms<500`, false},
+	{`ll>=warning`, true},
+	{`ll>=error`, false},
+	{`ll<info`, false},
+	{`ll==warn`, true},
+	{`_msg=~failed && srcfnc==handle && srcline==12`, true},
+}
+
+func TestExpr(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, test := range exprTests {
+		x, err := Parse(test.expr)
+		if !assert.Nil(err, test.expr+" should parse") {
+			continue
+		}
+		assert.Equal(test.expected, x.Match(testEntry), test.expr)
+	}
+}
+
+var exprErrorTests = []string{
+	``,
+	`status==`,
+	`(status==ok`,
+	`status==ok)`,
+	`status<>ok`,
+	`status=~"("`,
+	`&& status`,
+	`status=="unterminated`,
+}
+
+func TestExprErrors(t *testing.T) {
+	for _, test := range exprErrorTests {
+		_, err := Parse(test)
+		assert.NotNil(t, err, test+" should fail")
+	}
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+//go:build !windows && !plan9
+
+package kvlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const journalSocket = "/run/systemd/journal/socket"
+
+// JournalWriter is a LevelWriter that sends entries to systemd-journald
+// using its native protocol, so that each field of a k=v line is stored as
+// a separate journal field rather than as part of a flat message.
+//
+// eg.
+//
+//	w, err := kvlog.NewJournalWriter("", "myapp")
+//	...
+//	logrus.SetOutput(w)
+//
+// The entry's message is sent as MESSAGE, or the whole line if it has none,
+// its level as PRIORITY and the caller, if IncludeCaller was used, as
+// CODE_FUNC and CODE_LINE.  Other keys are converted to upper case with
+// characters other than letters, digits and underscores replaced by
+// underscores, eg. user-id becomes USER_ID.  Lines that can't be parsed,
+// such as JSON output, are sent unaltered as MESSAGE.
+//
+// Each entry is sent as a single datagram, so entries larger than the
+// socket's maximum datagram size, typically a little over 200KB, can't be
+// delivered.
+type JournalWriter struct {
+	tag  string
+	mu   sync.Mutex
+	conn net.Conn
+	buf  bytes.Buffer
+}
+
+// NewJournalWriter connects to the journald socket at path, or the default
+// system socket if path is empty.  Entries are sent with tag as their
+// SYSLOG_IDENTIFIER, unless tag is empty.
+func NewJournalWriter(path, tag string) (*JournalWriter, error) {
+	if path == "" {
+		path = journalSocket
+	}
+	conn, err := net.Dial("unixgram", path)
+	if err != nil {
+		return nil, err
+	}
+	return &JournalWriter{tag: tag, conn: conn}, nil
+}
+
+// Write implements io.Writer.
+func (j *JournalWriter) Write(p []byte) (int, error) {
+	return j.WriteLevel(lineLevel(p), p)
+}
+
+// WriteLevel implements LevelWriter, sending p with the journal priority
+// corresponding to level.
+func (j *JournalWriter) WriteLevel(level log.Level, p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	b := &j.buf
+	b.Reset()
+	writeJournalField(b, "PRIORITY", strconv.Itoa(syslogSeverity(level)))
+	if j.tag != "" {
+		writeJournalField(b, "SYSLOG_IDENTIFIER", j.tag)
+	}
+
+	entry, err := Parse(p)
+	if err != nil {
+		writeJournalField(b, "MESSAGE", string(bytes.TrimRight(p, "\n")))
+	} else {
+		msg := entry.Message
+		if msg == "" {
+			msg = string(bytes.TrimRight(p, "\n"))
+		}
+		writeJournalField(b, "MESSAGE", msg)
+		if entry.Caller != "" {
+			writeJournalField(b, "CODE_FUNC", entry.Caller)
+			if entry.Line > 0 {
+				writeJournalField(b, "CODE_LINE", strconv.Itoa(entry.Line))
+			}
+		}
+		for _, k := range entry.Keys {
+			v := entry.Fields[k]
+			s, ok := v.(string)
+			if !ok {
+				s = fmt.Sprint(v)
+			}
+			writeJournalField(b, journalKey(k), s)
+		}
+	}
+
+	if _, err := j.conn.Write(b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection to journald.
+func (j *JournalWriter) Close() error {
+	return j.conn.Close()
+}
+
+// writeJournalField appends a field in journald's native format.  Values
+// containing a newline are written with an explicit length.
+func writeJournalField(b *bytes.Buffer, key, value string) {
+	b.WriteString(key)
+	if strings.IndexByte(value, '\n') == -1 {
+		b.WriteByte('=')
+		b.WriteString(value)
+	} else {
+		var n [8]byte
+		binary.LittleEndian.PutUint64(n[:], uint64(len(value)))
+		b.WriteByte('\n')
+		b.Write(n[:])
+		b.WriteString(value)
+	}
+	b.WriteByte('\n')
+}
+
+// journalKey converts key into a valid journal field name.  Journal fields
+// may only contain upper case letters, digits and underscores, must not
+// start with a digit or an underscore and are limited to 64 characters.
+func journalKey(key string) string {
+	k := []byte(strings.ToUpper(key))
+	for i, c := range k {
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			k[i] = '_'
+		}
+	}
+	s := strings.TrimLeft(string(k), "_")
+	if s == "" || s[0] >= '0' && s[0] <= '9' {
+		s = "F_" + s
+	}
+	if len(s) > 64 {
+		s = s[:64]
+	}
+	return s
+}
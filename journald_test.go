@@ -0,0 +1,77 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+//go:build !windows && !plan9
+
+package kvlog_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestJournalWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "journal.sock")
+
+	pc, err := net.ListenPacket("unixgram", path)
+	require.Nil(t, err)
+	defer pc.Close()
+
+	w, err := NewJournalWriter(path, "kvtest")
+	require.Nil(t, err)
+	defer w.Close()
+
+	tests := []struct {
+		name     string
+		line     string
+		expected string
+	}{
+		{
+			name: "fields",
+			line: `2017-02-13T12:13:45.000Z ll="warning" srcfnc="main.run" srcline=12 user-id=42 _msg="disk low"` + "\n",
+			expected: "PRIORITY=4\nSYSLOG_IDENTIFIER=kvtest\nMESSAGE=disk low\n" +
+				"CODE_FUNC=main.run\nCODE_LINE=12\nUSER_ID=42\n",
+		}, {
+			name: "no-message",
+			line: `2017-02-13T12:13:45.000Z ll="info" status="ok"` + "\n",
+			expected: "PRIORITY=6\nSYSLOG_IDENTIFIER=kvtest\n" +
+				`MESSAGE=2017-02-13T12:13:45.000Z ll="info" status="ok"` + "\nSTATUS=ok\n",
+		}, {
+			name: "multiline",
+			line: `2017-02-13T12:13:45.000Z ll="error" _msg="a\nb"` + "\n",
+			expected: "PRIORITY=3\nSYSLOG_IDENTIFIER=kvtest\n" +
+				"MESSAGE\n\x03\x00\x00\x00\x00\x00\x00\x00a\nb\n",
+		}, {
+			name:     "unparsed",
+			line:     `{"ll":"info","_msg":"json"}` + "\n",
+			expected: "PRIORITY=6\nSYSLOG_IDENTIFIER=kvtest\n" + `MESSAGE={"ll":"info","_msg":"json"}` + "\n",
+		},
+	}
+
+	buf := make([]byte, 4096)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n, err := w.Write([]byte(test.line))
+			require.Nil(t, err)
+			assert.Equal(t, len(test.line), n)
+
+			pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+			n, _, err = pc.ReadFrom(buf)
+			require.Nil(t, err)
+			assert.Equal(t, test.expected, string(buf[:n]))
+		})
+	}
+}
@@ -0,0 +1,257 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// jsonObject writes the members of a single JSON object, taking care of
+// separating commas.
+type jsonObject struct {
+	b     *bytes.Buffer
+	count int
+}
+
+func newJSONObject(b *bytes.Buffer) *jsonObject {
+	b.WriteByte('{')
+	return &jsonObject{b: b}
+}
+
+// key writes the key for the next member of the object; the caller must
+// then write its value.
+func (o *jsonObject) key(k string) {
+	if o.count > 0 {
+		o.b.WriteByte(',')
+	}
+	o.count++
+	writeJSONString(o.b, k)
+	o.b.WriteByte(':')
+}
+
+// field writes a key and its value using the same type rules as the
+// k=v output.
+func (o *jsonObject) field(k string, v interface{}) {
+	o.key(k)
+	writeJSONValue(o.b, v)
+}
+
+func (o *jsonObject) str(k, v string) {
+	o.key(k)
+	writeJSONString(o.b, v)
+}
+
+func (o *jsonObject) close() {
+	o.b.WriteByte('}')
+}
+
+// fieldKey returns the key to use for a field in a JSON output mode, adding a
+// "fields." prefix if the key clashes with one that's reserved by the mode.
+func fieldKey(reserved map[string]struct{}, k string) string {
+	if _, ok := reserved[k]; ok {
+		return "fields." + k
+	}
+	return k
+}
+
+// writeJSONTimestamp writes t as a quoted RFC3339 timestamp with millisecond
+// precision, matching the timestamp used in k=v output.
+func (cf *Formatter) writeJSONTimestamp(b *bytes.Buffer, t time.Time) {
+	b.WriteByte('"')
+	cf.emitTimestamp(b, t)
+	b.WriteByte('"')
+}
+
+// WithJSON causes the Formatter to emit each entry as a JSON object rather
+// than as k=v pairs.  The object holds the same keys as the k=v output in the
+// same order, starting with "time" and "ll" and ending with "_msg".
+//
+// eg.
+//
+//	{"time":"2017-01-02T12:00:00.000Z","ll":"info","action":"user_login","active_sessions":4,"_msg":"User logged in"}
+func WithJSON() Config {
+	return func(kvf *Formatter) {
+		kvf.encode = func(cf *Formatter, b *bytes.Buffer, entry *Record) {
+			cf.writeJSONEntry(b, entry)
+			b.WriteByte('\n')
+		}
+	}
+}
+
+// writeJSONEntry writes entry as a JSON object using the same keys and
+// ordering as the k=v output.
+func (cf *Formatter) writeJSONEntry(b *bytes.Buffer, entry *Record) {
+	obj := newJSONObject(b)
+	obj.key("time")
+	cf.writeJSONTimestamp(b, entry.Time)
+	obj.str("ll", levelName(entry.level()))
+	if cf.includeCaller {
+		cf.writeJSONCaller(obj, entry)
+	}
+	fc := cf.fields()
+	fields := cf.entryFields(fc, entry)
+	for _, f := range cf.entryConstants(fc, fields) {
+		obj.field(f.key, f.value)
+	}
+	for _, f := range fields {
+		obj.field(f.key, f.value)
+	}
+	if entry.Message != "" {
+		obj.str("_msg", entry.Message)
+	}
+	obj.close()
+}
+
+// writeJSONCaller writes the srcfnc and srcline members using the same
+// values as the k=v output.
+func (cf *Formatter) writeJSONCaller(obj *jsonObject, entry *Record) {
+	name, line := cf.caller(entry)
+	if name == "" {
+		obj.str("srcfnc", "unknown")
+		return
+	}
+	obj.str("srcfnc", name)
+	obj.field("srcline", line)
+}
+
+// writeJSONValue encodes v as JSON.  Types are checked in the same order
+// as the k=v output so that values are rendered consistently between modes.
+// Marshaler values are included verbatim if they are valid JSON, otherwise
+// they are encoded as a string.
+func writeJSONValue(b *bytes.Buffer, v interface{}) {
+	switch data := v.(type) {
+	case nil:
+		b.WriteString("null")
+
+	case fmt.Stringer:
+		// fmt recovers from String methods that panic, eg. on a nil receiver
+		writeJSONString(b, fmt.Sprint(data))
+
+	case string:
+		writeJSONString(b, data)
+
+	case *string:
+		if data == nil {
+			b.WriteString("null")
+		} else {
+			writeJSONString(b, *data)
+		}
+
+	case error:
+		writeJSONString(b, data.Error())
+
+	case []byte:
+		writeJSONString(b, string(data))
+
+	case Marshaler:
+		s := marshalValue(data)
+		if json.Valid([]byte(s)) {
+			b.WriteString(s)
+		} else {
+			writeJSONString(b, s)
+		}
+
+	case bool:
+		b.WriteString(strconv.FormatBool(data))
+
+	case int:
+		b.WriteString(strconv.FormatInt(int64(data), 10))
+	case int8:
+		b.WriteString(strconv.FormatInt(int64(data), 10))
+	case int16:
+		b.WriteString(strconv.FormatInt(int64(data), 10))
+	case int32:
+		b.WriteString(strconv.FormatInt(int64(data), 10))
+	case int64:
+		b.WriteString(strconv.FormatInt(data, 10))
+	case uint:
+		b.WriteString(strconv.FormatUint(uint64(data), 10))
+	case uint8:
+		b.WriteString(strconv.FormatUint(uint64(data), 10))
+	case uint16:
+		b.WriteString(strconv.FormatUint(uint64(data), 10))
+	case uint32:
+		b.WriteString(strconv.FormatUint(uint64(data), 10))
+	case uint64:
+		b.WriteString(strconv.FormatUint(data, 10))
+
+	case float32:
+		writeJSONFloat(b, float64(data), 32)
+	case float64:
+		writeJSONFloat(b, data, 64)
+
+	default:
+		enc, err := json.Marshal(data)
+		if err != nil {
+			writeJSONString(b, fmt.Sprintf("%v", data))
+			return
+		}
+		b.Write(enc)
+	}
+}
+
+// writeJSONFloat writes f as a JSON number; NaN and infinities have no JSON
+// representation so are written as strings.
+func writeJSONFloat(b *bytes.Buffer, f float64, bits int) {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		writeJSONString(b, strconv.FormatFloat(f, 'g', -1, bits))
+		return
+	}
+	b.WriteString(strconv.FormatFloat(f, 'g', -1, bits))
+}
+
+// writeJSONString writes s as a quoted JSON string.  Unlike encoding/json
+// HTML characters are not escaped.
+func writeJSONString(b *bytes.Buffer, s string) {
+	b.WriteByte('"')
+	start := 0
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b.WriteString(s[start:i])
+			switch c {
+			case '"', '\\':
+				b.WriteByte('\\')
+				b.WriteByte(c)
+			case '\n':
+				b.WriteString(`\n`)
+			case '\r':
+				b.WriteString(`\r`)
+			case '\t':
+				b.WriteString(`\t`)
+			default:
+				b.WriteString(`\u00`)
+				b.WriteByte(hexDigits[c>>4])
+				b.WriteByte(hexDigits[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b.WriteString(s[start:i])
+			b.WriteString(`\ufffd`)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b.WriteString(s[start:])
+	b.WriteByte('"')
+}
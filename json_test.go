@@ -0,0 +1,102 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+var jsonTests = []struct {
+	name     string
+	value    interface{}
+	expected string
+}{
+	{"string", "a \"b\"\n\t<c>", `"a \"b\"\n\t<c>"`},
+	{"control", "\x01", `"\u0001"`},
+	{"invalid-utf8", "a\xffb", `"a\ufffdb"`},
+	{"unicode", "café", `"café"`},
+	{"int", -12, `-12`},
+	{"uint64", uint64(1 << 63), `9223372036854775808`},
+	{"float", 1.25, `1.25`},
+	{"nan", testNaN(), `"NaN"`},
+	{"bool", true, `true`},
+	{"nil", nil, `null`},
+	{"slice", []int{1, 2}, `[1,2]`},
+	{"bytes", []byte("raw"), `"raw"`},
+	{"unmarshalable", complex(1, 2), `"(1+2i)"`},
+}
+
+func testNaN() float64 {
+	zero := 0.0
+	return zero / zero
+}
+
+func TestJSONValues(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cf := New(WithJSON())
+	for _, test := range jsonTests {
+		result, err := cf.Format(&log.Entry{
+			Time:  testTime,
+			Level: log.InfoLevel,
+			Data:  log.Fields{"v": test.value},
+		})
+		require.Nil(err, test.name+" should not error")
+		expected := `{"time":"2017-02-13T12:13:45.000Z","ll":"info","v":` + test.expected + `}`
+		assert.Equal(expected, strings.TrimSpace(string(result)), test.name+" should match")
+	}
+}
+
+func TestJSONEntry(t *testing.T) {
+	assert := assert.New(t)
+
+	cf := New(
+		WithConstantField("commit", "abcd"),
+		WithPrimaryFields("status"),
+		WithJSON())
+	result, _ := cf.Format(&log.Entry{
+		Time:    testTime,
+		Level:   log.InfoLevel,
+		Message: "test message",
+		Data: log.Fields{
+			"field1": "value1",
+			"status": "ok",
+		},
+	})
+	expected := `{"time":"2017-02-13T12:13:45.000Z","ll":"info","commit":"abcd","status":"ok","field1":"value1","_msg":"test message"}`
+	assert.Equal(expected, strings.TrimSpace(string(result)))
+}
+
+func TestJSONNilStringer(t *testing.T) {
+	var nilStringer *panicStringer
+	modes := map[string]Config{
+		"json":        WithJSON(),
+		"logstash":    WithLogstashJSON(),
+		"stackdriver": WithStackdriverJSON("proj"),
+		"hec":         WithHECEvent(HECEvent{}),
+		"gelf":        WithGELF("web1"),
+		"emf":         WithEMF("app"),
+	}
+	for name, cfg := range modes {
+		t.Run(name, func(t *testing.T) {
+			result, err := New(cfg).Format(&log.Entry{
+				Time:    testTime,
+				Level:   log.InfoLevel,
+				Message: "msg",
+				Data:    log.Fields{"value": nilStringer},
+			})
+			require.Nil(t, err)
+			assert.Contains(t, string(result), `"<nil>"`)
+		})
+	}
+}
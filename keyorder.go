@@ -0,0 +1,113 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"sort"
+	"sync"
+)
+
+// maxKeyOrders limits the number of distinct sets of field names whose
+// order is cached by each Formatter, so that entries with unbounded key
+// names can't grow the cache indefinitely.
+const maxKeyOrders = 1024
+
+// keyOrder is the order in which the fields of an entry are emitted.
+type keyOrder struct {
+	primary []string // primary fields present, in the configured order
+	keys    []string // remaining keys, sorted
+}
+
+// keyOrderCache memoizes the keyOrder of each set of field names seen by a
+// Formatter.  Services tend to log the same few sets of fields repeatedly,
+// so this saves collecting and sorting the keys of each entry.
+type keyOrderCache struct {
+	mu     sync.RWMutex
+	orders map[uint64][]*keyOrder // indexed by keySetHash
+	n      int
+}
+
+// get returns the order of the fields in data.
+func (c *keyOrderCache) get(data map[string]interface{}, primary []string) *keyOrder {
+	h := keySetHash(data)
+	c.mu.RLock()
+	for _, o := range c.orders[h] {
+		if o.matches(data) {
+			c.mu.RUnlock()
+			return o
+		}
+	}
+	c.mu.RUnlock()
+
+	o := newKeyOrder(data, primary)
+	c.mu.Lock()
+	if c.n < maxKeyOrders {
+		if c.orders == nil {
+			c.orders = make(map[uint64][]*keyOrder)
+		}
+		c.orders[h] = append(c.orders[h], o)
+		c.n++
+	}
+	c.mu.Unlock()
+	return o
+}
+
+func newKeyOrder(data map[string]interface{}, primary []string) *keyOrder {
+	o := new(keyOrder)
+	var skip map[string]struct{}
+	if len(primary) > 0 {
+		skip = make(map[string]struct{})
+		for _, k := range primary {
+			if _, ok := data[k]; ok {
+				skip[k] = struct{}{}
+				o.primary = append(o.primary, k)
+			}
+		}
+	}
+
+	o.keys = make([]string, 0, len(data)-len(o.primary))
+	for k := range data {
+		if _, ok := skip[k]; ok {
+			continue
+		}
+		o.keys = append(o.keys, k)
+	}
+	sort.Strings(o.keys)
+	return o
+}
+
+// matches reports whether data has exactly the keys in o.
+func (o *keyOrder) matches(data map[string]interface{}) bool {
+	if len(o.primary)+len(o.keys) != len(data) {
+		return false
+	}
+	for _, k := range o.keys {
+		if _, ok := data[k]; !ok {
+			return false
+		}
+	}
+	for _, k := range o.primary {
+		if _, ok := data[k]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// keySetHash returns a hash of the keys of data that's independent of the
+// order in which they're iterated.
+func keySetHash(data map[string]interface{}) uint64 {
+	var sum uint64
+	for k := range data {
+		// FNV-1a, inlined to avoid allocating a hash.Hash64
+		h := uint64(14695981039346656037)
+		for i := 0; i < len(k); i++ {
+			h ^= uint64(k[i])
+			h *= 1099511628211
+		}
+		sum += h
+	}
+	return sum
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyOrderCache(t *testing.T) {
+	var c keyOrderCache
+	primary := []string{"status", "action"}
+	data := map[string]interface{}{"b": 1, "a": 2, "action": "get", "c": 3}
+
+	o := c.get(data, primary)
+	assert.Equal(t, []string{"action"}, o.primary)
+	assert.Equal(t, []string{"a", "b", "c"}, o.keys)
+	assert.True(t, o == c.get(map[string]interface{}{"c": 0, "action": 0, "a": 0, "b": 0}, primary), "should be cached")
+
+	// sets that differ
+	o = c.get(map[string]interface{}{"b": 1, "a": 2}, primary)
+	assert.Nil(t, o.primary)
+	assert.Equal(t, []string{"a", "b"}, o.keys)
+	o = c.get(map[string]interface{}{"b": 1, "a": 2, "status": 200, "action": "get", "c": 3}, primary)
+	assert.Equal(t, []string{"status", "action"}, o.primary)
+	assert.Equal(t, []string{"a", "b", "c"}, o.keys)
+}
+
+func TestKeyOrderCacheCollision(t *testing.T) {
+	var c keyOrderCache
+	a := map[string]interface{}{"x": 1}
+	b := map[string]interface{}{"y": 1}
+
+	// force b's order into a's slot
+	c.orders = map[uint64][]*keyOrder{keySetHash(a): {newKeyOrder(b, nil)}}
+	assert.Equal(t, []string{"x"}, c.get(a, nil).keys)
+	assert.Len(t, c.orders[keySetHash(a)], 2)
+}
+
+func TestKeyOrderCacheLimit(t *testing.T) {
+	var c keyOrderCache
+	for i := 0; i < maxKeyOrders+10; i++ {
+		key := fmt.Sprint("k", i)
+		assert.Equal(t, []string{key}, c.get(map[string]interface{}{key: i}, nil).keys)
+	}
+	assert.Equal(t, maxKeyOrders, c.n)
+}
@@ -0,0 +1,114 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// SnakeCaseKeys matches lowercase snake_case keys such as "request_id", for
+// use with WithKeyPolicy.
+var SnakeCaseKeys = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+// KeyPolicy selects what WithKeyPolicy does with an entry that has a key
+// not matching the policy's pattern.
+type KeyPolicy int
+
+const (
+	// ReportBadKeys passes a KeyPolicyError for each key that doesn't match
+	// to the handler set by WithErrorHandler and logs the entry as usual.
+	ReportBadKeys KeyPolicy = iota
+
+	// RejectBadKeys causes Format to return a KeyPolicyError for the first
+	// key, in sorted order, that doesn't match, rather than formatting the
+	// entry.  Entries rejected by a Logger are passed to the error handler.
+	RejectBadKeys
+)
+
+// KeyPolicyError is reported for a key that doesn't match the pattern set by
+// WithKeyPolicy.
+type KeyPolicyError struct {
+	Key     string // the full key, including the key of any Loggable holding it
+	Pattern string // the pattern the key failed to match
+}
+
+func (e *KeyPolicyError) Error() string {
+	return fmt.Sprintf("kvlog: field key %q doesn't match key policy %s", e.Key, e.Pattern)
+}
+
+type keyPolicy struct {
+	pattern *regexp.Regexp
+	reject  bool
+}
+
+// WithKeyPolicy checks the key of each field logged against pattern,
+// reporting or rejecting entries with keys that don't match, according to
+// policy.  It's intended for development and tests, so that keys breaking a
+// naming convention are caught before they reach production logs.
+//
+// eg.
+//
+//	kvlog.New(kvlog.WithKeyPolicy(kvlog.SnakeCaseKeys, kvlog.RejectBadKeys))
+//
+// The keys produced by Loggable and OrderedFields values are checked
+// individually, without the key of the field holding them or their leading
+// dot, so that SnakeCaseKeys allows "user.id" to be logged from a Loggable
+// but not as a single key.  Constant field keys aren't checked.
+func WithKeyPolicy(pattern *regexp.Regexp, policy KeyPolicy) Config {
+	return func(kvf *Formatter) {
+		kvf.keyPolicy = &keyPolicy{pattern: pattern, reject: policy == RejectBadKeys}
+	}
+}
+
+// checkKeys checks the keys of entry against the policy set by
+// WithKeyPolicy, returning an error if the entry should be rejected.
+func (cf *Formatter) checkKeys(entry *Record) error {
+	if cf.keyPolicy == nil {
+		return nil
+	}
+	var bad []string
+	for k, v := range entry.Data {
+		bad = cf.keyPolicy.check(bad, "", false, k, v)
+	}
+	if len(bad) == 0 {
+		return nil
+	}
+	sort.Strings(bad)
+	pattern := cf.keyPolicy.pattern.String()
+	if cf.keyPolicy.reject {
+		return &KeyPolicyError{Key: bad[0], Pattern: pattern}
+	}
+	for _, k := range bad {
+		cf.reportError(&KeyPolicyError{Key: k, Pattern: pattern})
+	}
+	return nil
+}
+
+// check appends prefix+k, and the keys of any fields v expands to, to bad if
+// they don't match the pattern.  nested is true for keys produced by a
+// Loggable or OrderedFields value.  Lazy values aren't evaluated.
+func (p *keyPolicy) check(bad []string, prefix string, nested bool, k string, v interface{}) []string {
+	name := k
+	if nested {
+		name = strings.TrimPrefix(k, ".")
+	}
+	if name != "" && !p.pattern.MatchString(name) {
+		bad = append(bad, prefix+k)
+	}
+	switch v := v.(type) {
+	case OrderedFields:
+		for _, kv := range v {
+			bad = p.check(bad, prefix+k, true, kv.Key, kv.Value)
+		}
+	case Loggable:
+		for sk, sv := range v.LogValues() {
+			bad = p.check(bad, prefix+k, true, sk, sv)
+		}
+	}
+	return bad
+}
@@ -0,0 +1,76 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestKeyPolicyReject(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    log.Fields
+		badKey  string
+		partial string
+	}{
+		{"ok", log.Fields{"request_id": 1, "user": Ordered(".id", 2, ".first_name", "joe")}, "", `request_id=1 user.id=2 user.first_name="joe"`},
+		{"top-level", log.Fields{"requestID": 1, "Z": 2}, "Z", ""},
+		{"dotted", log.Fields{"user.id": 1}, "user.id", ""},
+		{"nested", log.Fields{"user": Ordered(".ok", 1, ".FirstName", "joe")}, "user.FirstName", ""},
+		{"top-level-ordered", log.Fields{"": Ordered("step", 1, "bad-key", 2)}, "bad-key", ""},
+	}
+
+	cf := New(WithKeyPolicy(SnakeCaseKeys, RejectBadKeys))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := cf.Format(&log.Entry{Time: testTime, Level: log.InfoLevel, Data: test.data})
+			if test.badKey == "" {
+				require.Nil(t, err)
+				assert.Contains(t, string(result), test.partial)
+				return
+			}
+			assert.Nil(t, result)
+			assert.Equal(t, &KeyPolicyError{Key: test.badKey, Pattern: SnakeCaseKeys.String()}, err)
+		})
+	}
+}
+
+func TestKeyPolicyReport(t *testing.T) {
+	var errs []error
+	cf := New(WithKeyPolicy(regexp.MustCompile(`^[a-z]+$`), ReportBadKeys), WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+
+	var buf bytes.Buffer
+	NewLogger(&buf, cf).Log(log.InfoLevel, "done", String("ok", "a"), Int("Bad", 1), Int("bad2", 2))
+	assert.Contains(t, buf.String(), ` Bad=1 bad2=2 ok="a" _msg="done"`)
+	require.Len(t, errs, 2)
+	assert.Equal(t, `kvlog: field key "Bad" doesn't match key policy ^[a-z]+$`, errs[0].Error())
+	assert.Equal(t, "bad2", errs[1].(*KeyPolicyError).Key)
+}
+
+func TestKeyPolicyLoggerReject(t *testing.T) {
+	var errs []error
+	cf := New(WithKeyPolicy(SnakeCaseKeys, RejectBadKeys), WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, cf)
+	logger.Log(log.InfoLevel, "rejected", Int("userID", 1))
+	logger.WithFields(log.Fields{"user_id": 1}).Info("kept")
+	assert.NotContains(t, buf.String(), "rejected")
+	assert.Contains(t, buf.String(), `user_id=1 _msg="kept"`)
+	require.Len(t, errs, 1)
+	assert.Equal(t, "userID", errs[0].(*KeyPolicyError).Key)
+}
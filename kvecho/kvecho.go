@@ -0,0 +1,96 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Package kvecho provides Echo middleware that logs requests and recovered
+panics through logrus, for use with a kvlog Formatter.
+
+eg.
+
+	e := echo.New()
+	e.Use(kvecho.Logger(logrus.StandardLogger()), kvecho.Recovery(logrus.StandardLogger()))
+*/
+package kvecho
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/labstack/echo/v4"
+)
+
+// Logger returns middleware that logs one entry to logger for each request
+// once it has been handled.
+//
+// Each entry includes the request's method, path, route template, the name
+// of the handler that served it and the client's remote_ip, along with the
+// response status, the number of body bytes written and the time taken as
+// duration_ms.  An error returned by the handler is passed to Echo's error
+// handler before logging, so that the logged status reflects the response
+// actually sent, and is included in an error field.
+func Logger(logger *log.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			start := time.Now()
+			err := next(c)
+			if err != nil {
+				c.Error(err)
+			}
+
+			req, resp := c.Request(), c.Response()
+			fields := log.Fields{
+				"method":      req.Method,
+				"path":        req.URL.Path,
+				"route":       c.Path(),
+				"handler":     handlerName(c),
+				"status":      resp.Status,
+				"bytes":       resp.Size,
+				"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+				"remote_ip":   c.RealIP(),
+			}
+			if err != nil {
+				fields["error"] = err
+			}
+			logger.WithFields(fields).Info("request")
+			return nil
+		}
+	}
+}
+
+// Recovery returns middleware that recovers from any panic raised by a
+// later handler, logs it to logger at ErrorLevel with the panic value in a
+// panic field, and passes an error to Echo's error handler so that a 500
+// status is returned.
+func Recovery(logger *log.Logger) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					logger.WithFields(log.Fields{
+						"method":  c.Request().Method,
+						"path":    c.Request().URL.Path,
+						"route":   c.Path(),
+						"handler": handlerName(c),
+						"panic":   fmt.Sprint(r),
+					}).Error("panic recovered")
+					err = fmt.Errorf("panic: %v", r)
+				}
+			}()
+			return next(c)
+		}
+	}
+}
+
+// handlerName returns the name Echo recorded for the route that matched the
+// request, which is the fully qualified function name of its handler.
+func handlerName(c echo.Context) string {
+	method, path := c.Request().Method, c.Path()
+	for _, r := range c.Echo().Routes() {
+		if r.Method == method && r.Path == path {
+			return r.Name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvecho
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gwatts/kvlog"
+)
+
+func getWidget(c echo.Context) error {
+	return c.String(http.StatusOK, "widget "+c.Param("id"))
+}
+
+func TestLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger := &log.Logger{Out: &buf, Formatter: kvlog.New(), Level: log.InfoLevel}
+	e := echo.New()
+	e.Use(Logger(logger))
+	e.GET("/widgets/:id", getWidget)
+
+	req := httptest.NewRequest("GET", "/widgets/12", nil)
+	req.RemoteAddr = "10.1.2.3:4567"
+	e.ServeHTTP(httptest.NewRecorder(), req)
+
+	entry, err := kvlog.Parse(buf.Bytes())
+	require.Nil(t, err)
+	assert.Equal("request", entry.Message)
+	assert.Equal("GET", entry.Fields["method"])
+	assert.Equal("/widgets/12", entry.Fields["path"])
+	assert.Equal("/widgets/:id", entry.Fields["route"])
+	assert.Equal("github.com/gwatts/kvlog/kvecho.getWidget", entry.Fields["handler"])
+	assert.Equal(int64(200), entry.Fields["status"])
+	assert.Equal(int64(9), entry.Fields["bytes"])
+	assert.Equal("10.1.2.3", entry.Fields["remote_ip"])
+	assert.Contains(entry.Fields, "duration_ms")
+}
+
+func TestLoggerError(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger := &log.Logger{Out: &buf, Formatter: kvlog.New(), Level: log.InfoLevel}
+	e := echo.New()
+	e.Use(Logger(logger))
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/missing", nil))
+	assert.Equal(http.StatusNotFound, rec.Code)
+
+	entry, err := kvlog.Parse(buf.Bytes())
+	require.Nil(t, err)
+	assert.Equal(int64(404), entry.Fields["status"])
+	assert.Contains(entry.Fields, "error")
+}
+
+func TestRecovery(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger := &log.Logger{Out: &buf, Formatter: kvlog.New(), Level: log.InfoLevel}
+	e := echo.New()
+	e.Use(Recovery(logger))
+	e.GET("/boom", func(c echo.Context) error { panic("kaboom") })
+
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/boom", nil))
+	assert.Equal(http.StatusInternalServerError, rec.Code)
+
+	entry, err := kvlog.Parse(buf.Bytes())
+	require.Nil(t, err)
+	assert.Equal(log.ErrorLevel, entry.Level)
+	assert.Equal("/boom", entry.Fields["route"])
+	assert.Equal("kaboom", entry.Fields["panic"])
+}
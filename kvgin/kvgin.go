@@ -0,0 +1,73 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Package kvgin provides Gin middleware that logs requests and recovered
+panics through logrus, for use with a kvlog Formatter.
+
+eg.
+
+	r := gin.New()
+	r.Use(kvgin.Logger(logrus.StandardLogger()), kvgin.Recovery(logrus.StandardLogger()))
+*/
+package kvgin
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+)
+
+// Logger returns middleware that logs one entry to logger for each request
+// once it has been handled.
+//
+// Each entry includes the request's method, path, route template, the name
+// of the handler that served it and the client's remote_ip, along with the
+// response status, the number of body bytes written and the time taken as
+// duration_ms.  Requests that don't match a route have an empty route.
+func Logger(logger *log.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		size := c.Writer.Size()
+		if size < 0 {
+			size = 0
+		}
+		logger.WithFields(log.Fields{
+			"method":      c.Request.Method,
+			"path":        c.Request.URL.Path,
+			"route":       c.FullPath(),
+			"handler":     c.HandlerName(),
+			"status":      c.Writer.Status(),
+			"bytes":       size,
+			"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+			"remote_ip":   c.ClientIP(),
+		}).Info("request")
+	}
+}
+
+// Recovery returns middleware that recovers from any panic raised by a
+// later handler, logs it to logger at ErrorLevel with the panic value in a
+// panic field, and responds with a 500 status.
+func Recovery(logger *log.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if r := recover(); r != nil {
+				logger.WithFields(log.Fields{
+					"method":  c.Request.Method,
+					"path":    c.Request.URL.Path,
+					"route":   c.FullPath(),
+					"handler": c.HandlerName(),
+					"panic":   fmt.Sprint(r),
+				}).Error("panic recovered")
+				c.AbortWithStatus(http.StatusInternalServerError)
+			}
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvgin
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gwatts/kvlog"
+)
+
+func init() {
+	gin.SetMode(gin.ReleaseMode)
+}
+
+func getWidget(c *gin.Context) {
+	c.String(http.StatusOK, "widget "+c.Param("id"))
+}
+
+func TestLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger := &log.Logger{Out: &buf, Formatter: kvlog.New(), Level: log.InfoLevel}
+	r := gin.New()
+	r.Use(Logger(logger))
+	r.GET("/widgets/:id", getWidget)
+
+	req := httptest.NewRequest("GET", "/widgets/12", nil)
+	req.RemoteAddr = "10.1.2.3:4567"
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	entry, err := kvlog.Parse(buf.Bytes())
+	require.Nil(t, err)
+	assert.Equal("request", entry.Message)
+	assert.Equal("GET", entry.Fields["method"])
+	assert.Equal("/widgets/12", entry.Fields["path"])
+	assert.Equal("/widgets/:id", entry.Fields["route"])
+	assert.Equal("github.com/gwatts/kvlog/kvgin.getWidget", entry.Fields["handler"])
+	assert.Equal(int64(200), entry.Fields["status"])
+	assert.Equal(int64(9), entry.Fields["bytes"])
+	assert.Equal("10.1.2.3", entry.Fields["remote_ip"])
+	assert.Contains(entry.Fields, "duration_ms")
+}
+
+func TestRecovery(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger := &log.Logger{Out: &buf, Formatter: kvlog.New(), Level: log.InfoLevel}
+	r := gin.New()
+	r.Use(Recovery(logger))
+	r.GET("/boom", func(c *gin.Context) { panic("kaboom") })
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/boom", nil))
+	assert.Equal(http.StatusInternalServerError, rec.Code)
+
+	entry, err := kvlog.Parse(buf.Bytes())
+	require.Nil(t, err)
+	assert.Equal(log.ErrorLevel, entry.Level)
+	assert.Equal("panic recovered", entry.Message)
+	assert.Equal("/boom", entry.Fields["route"])
+	assert.Equal("kaboom", entry.Fields["panic"])
+}
@@ -0,0 +1,136 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Package kvgrpc provides a grpclog.LoggerV2 backed by logrus, so that gRPC's
+internal messages, such as connection errors and resolver events, are
+emitted as k=v lines by a kvlog Formatter rather than as free form text.
+
+eg.
+
+	grpclog.SetLoggerV2(kvgrpc.New(logrus.StandardLogger(), 0))
+
+gRPC prefixes messages from its internal components with the component name
+in brackets, eg. "[transport] ...".  The prefix is removed from the message
+and included as a grpc_component field instead.
+*/
+package kvgrpc
+
+import (
+	"fmt"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"google.golang.org/grpc/grpclog"
+)
+
+// Logger implements grpclog.LoggerV2 by logging to a logrus Logger.
+type Logger struct {
+	logger    *log.Logger
+	verbosity int
+}
+
+var _ grpclog.LoggerV2 = (*Logger)(nil)
+
+// New creates a Logger that logs to logger.  verbosity sets the level
+// reported by V, which gRPC uses to decide whether to log verbose messages;
+// 0 suppresses all verbose logging.
+func New(logger *log.Logger, verbosity int) *Logger {
+	return &Logger{logger: logger, verbosity: verbosity}
+}
+
+// entry returns an entry holding the message with any component prefix
+// moved into a grpc_component field.
+func (l *Logger) entry(msg string) (*log.Entry, string) {
+	entry := log.NewEntry(l.logger)
+	msg = strings.TrimRight(msg, "\n")
+	if strings.HasPrefix(msg, "[") {
+		if end := strings.Index(msg, "] "); end > 1 && !strings.ContainsAny(msg[1:end], " []") {
+			entry = entry.WithField("grpc_component", msg[1:end])
+			msg = msg[end+2:]
+		}
+	}
+	return entry, msg
+}
+
+// Info implements grpclog.LoggerV2.
+func (l *Logger) Info(args ...interface{}) {
+	e, msg := l.entry(fmt.Sprint(args...))
+	e.Info(msg)
+}
+
+// Infoln implements grpclog.LoggerV2.
+func (l *Logger) Infoln(args ...interface{}) {
+	e, msg := l.entry(fmt.Sprintln(args...))
+	e.Info(msg)
+}
+
+// Infof implements grpclog.LoggerV2.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	e, msg := l.entry(fmt.Sprintf(format, args...))
+	e.Info(msg)
+}
+
+// Warning implements grpclog.LoggerV2.
+func (l *Logger) Warning(args ...interface{}) {
+	e, msg := l.entry(fmt.Sprint(args...))
+	e.Warn(msg)
+}
+
+// Warningln implements grpclog.LoggerV2.
+func (l *Logger) Warningln(args ...interface{}) {
+	e, msg := l.entry(fmt.Sprintln(args...))
+	e.Warn(msg)
+}
+
+// Warningf implements grpclog.LoggerV2.
+func (l *Logger) Warningf(format string, args ...interface{}) {
+	e, msg := l.entry(fmt.Sprintf(format, args...))
+	e.Warn(msg)
+}
+
+// Error implements grpclog.LoggerV2.
+func (l *Logger) Error(args ...interface{}) {
+	e, msg := l.entry(fmt.Sprint(args...))
+	e.Error(msg)
+}
+
+// Errorln implements grpclog.LoggerV2.
+func (l *Logger) Errorln(args ...interface{}) {
+	e, msg := l.entry(fmt.Sprintln(args...))
+	e.Error(msg)
+}
+
+// Errorf implements grpclog.LoggerV2.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	e, msg := l.entry(fmt.Sprintf(format, args...))
+	e.Error(msg)
+}
+
+// Fatal implements grpclog.LoggerV2.  The program exits after the entry is
+// logged.
+func (l *Logger) Fatal(args ...interface{}) {
+	e, msg := l.entry(fmt.Sprint(args...))
+	e.Fatal(msg)
+}
+
+// Fatalln implements grpclog.LoggerV2.  The program exits after the entry is
+// logged.
+func (l *Logger) Fatalln(args ...interface{}) {
+	e, msg := l.entry(fmt.Sprintln(args...))
+	e.Fatal(msg)
+}
+
+// Fatalf implements grpclog.LoggerV2.  The program exits after the entry is
+// logged.
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	e, msg := l.entry(fmt.Sprintf(format, args...))
+	e.Fatal(msg)
+}
+
+// V implements grpclog.LoggerV2, reporting whether verbose messages at level
+// v should be logged.
+func (l *Logger) V(v int) bool {
+	return v <= l.verbosity
+}
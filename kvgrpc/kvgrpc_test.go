@@ -0,0 +1,39 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvgrpc
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/gwatts/kvlog"
+)
+
+var timestampRE = regexp.MustCompile(`(?m)^\S+ `)
+
+func TestLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	l := New(&log.Logger{Out: &buf, Formatter: kvlog.New(), Level: log.InfoLevel}, 2)
+
+	l.Infof("[transport] transport: loopyWriter exiting with error: %v", "EOF")
+	l.Warningln("[core]", "addrConn.createTransport failed")
+	l.Error("plain message")
+	l.Info("[not a component prefix")
+
+	expected := `ll="info" grpc_component="transport" _msg="transport: loopyWriter exiting with error: EOF"
+ll="warning" grpc_component="core" _msg="addrConn.createTransport failed"
+ll="error" _msg="plain message"
+ll="info" _msg="[not a component prefix"
+`
+	assert.Equal(expected, timestampRE.ReplaceAllString(buf.String(), ""))
+	assert.True(l.V(2))
+	assert.False(l.V(3))
+}
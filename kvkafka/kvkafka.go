@@ -0,0 +1,149 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Package kvkafka provides a writer that publishes each formatted entry to a
+Kafka topic.
+
+eg.
+
+	w := kvkafka.New([]string{"kafka1:9092", "kafka2:9092"}, "app-logs",
+	    kvkafka.KeyField("tenant_id"))
+	defer w.Close()
+	logrus.SetOutput(w)
+
+Each line written becomes the value of one message, with its trailing
+newline removed.  The line may be k=v or JSON, such as that produced by
+kvlog.WithJSON.  Messages are published asynchronously in batches, so writes
+don't wait for the brokers; delivery failures are reported to the function
+set by ErrorHandler.
+*/
+package kvkafka
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"time"
+
+	"github.com/gwatts/kvlog"
+	"github.com/segmentio/kafka-go"
+)
+
+// Config represents a configuration function to be passed to New.
+type Config func(w *Writer)
+
+// KeyField sets the field whose value is used as each message's key, such
+// as "tenant_id", so that entries with the same value are published to the
+// same partition and remain in order.  Lines without the field are
+// distributed across partitions in turn.
+func KeyField(key string) Config {
+	return func(w *Writer) {
+		w.keyField = key
+	}
+}
+
+// Batch sets the maximum number of messages sent to a partition in a single
+// request and the maximum time a message is held before being sent.  The
+// defaults are 100 messages and one second.
+func Batch(size int, timeout time.Duration) Config {
+	return func(w *Writer) {
+		w.kw.BatchSize = size
+		w.kw.BatchTimeout = timeout
+	}
+}
+
+// ErrorHandler sets a function to be called with the lines that could not
+// be delivered, and the error that prevented delivery.
+func ErrorHandler(f func(err error, lines [][]byte)) Config {
+	return func(w *Writer) {
+		w.onError = f
+	}
+}
+
+// TLS causes connections to the brokers to be made using TLS with the given
+// configuration, such as one returned by kvlog.NewTLSConfig.
+func TLS(cfg *tls.Config) Config {
+	return func(w *Writer) {
+		w.kw.Transport = &kafka.Transport{TLS: cfg}
+	}
+}
+
+// Configure calls f with the underlying kafka.Writer before it's used,
+// allowing settings such as Transport, for TLS and SASL, RequiredAcks or
+// Compression to be changed.
+func Configure(f func(kw *kafka.Writer)) Config {
+	return func(w *Writer) {
+		f(w.kw)
+	}
+}
+
+// producer is the subset of kafka.Writer used by Writer.
+type producer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Writer is an io.Writer that publishes each line to a Kafka topic.
+type Writer struct {
+	kw       *kafka.Writer
+	p        producer
+	keyField string
+	onError  func(err error, lines [][]byte)
+}
+
+// New creates a Writer that publishes to topic using the given brokers.
+func New(brokers []string, topic string, cfgs ...Config) *Writer {
+	w := &Writer{
+		kw: &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			BatchTimeout: time.Second,
+			Async:        true,
+		},
+	}
+	for _, cfg := range cfgs {
+		cfg(w)
+	}
+	w.kw.Completion = w.completion
+	w.p = w.kw
+	kvlog.RegisterShutdown(w)
+	return w
+}
+
+// Write implements io.Writer, queuing p to be published.
+func (w *Writer) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	msg := kafka.Message{Value: append([]byte(nil), bytes.TrimRight(p, "\n")...)}
+	if w.keyField != "" {
+		if key, ok := kvlog.LineField(p, w.keyField); ok {
+			msg.Key = []byte(key)
+		}
+	}
+	if err := w.p.WriteMessages(context.Background(), msg); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close publishes any queued messages and closes the connections to the
+// brokers.
+func (w *Writer) Close() error {
+	kvlog.UnregisterShutdown(w)
+	return w.p.Close()
+}
+
+func (w *Writer) completion(msgs []kafka.Message, err error) {
+	if err == nil || w.onError == nil {
+		return
+	}
+	lines := make([][]byte, len(msgs))
+	for i, msg := range msgs {
+		lines[i] = msg.Value
+	}
+	w.onError(err, lines)
+}
@@ -0,0 +1,91 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvkafka
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testProducer struct {
+	msgs   []kafka.Message
+	closed bool
+}
+
+func (p *testProducer) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	p.msgs = append(p.msgs, msgs...)
+	return nil
+}
+
+func (p *testProducer) Close() error {
+	p.closed = true
+	return nil
+}
+
+func TestWriter(t *testing.T) {
+	tp := new(testProducer)
+	w := New([]string{"localhost:9092"}, "logs", KeyField("tenant_id"))
+	w.p = tp
+
+	lines := []string{
+		`2017-02-13T12:13:45.000Z ll="info" tenant_id="acme" _msg="one"`,
+		`{"time":"2017-02-13T12:13:45.000Z","ll":"info","tenant_id":"globex","_msg":"two"}`,
+		`2017-02-13T12:13:45.000Z ll="info" _msg="three"`,
+	}
+	for _, line := range lines {
+		n, err := w.Write([]byte(line + "\n"))
+		require.Nil(t, err)
+		assert.Equal(t, len(line)+1, n)
+	}
+	require.Nil(t, w.Close())
+	assert.True(t, tp.closed)
+
+	require.Len(t, tp.msgs, 3)
+	for i, line := range lines {
+		assert.Equal(t, line, string(tp.msgs[i].Value))
+	}
+	assert.Equal(t, "acme", string(tp.msgs[0].Key))
+	assert.Equal(t, "globex", string(tp.msgs[1].Key))
+	assert.Nil(t, tp.msgs[2].Key)
+}
+
+func TestWriterConfig(t *testing.T) {
+	tlsConfig := &tls.Config{ServerName: "kafka"}
+	w := New([]string{"k1:9092", "k2:9092"}, "logs",
+		Batch(10, 0),
+		TLS(tlsConfig),
+		Configure(func(kw *kafka.Writer) { kw.RequiredAcks = kafka.RequireAll }))
+	assert.Equal(t, "logs", w.kw.Topic)
+	assert.Equal(t, "k1:9092,k2:9092", w.kw.Addr.String())
+	assert.Equal(t, 10, w.kw.BatchSize)
+	assert.Equal(t, kafka.RequireAll, w.kw.RequiredAcks)
+	assert.True(t, w.kw.Async)
+	if assert.IsType(t, &kafka.Transport{}, w.kw.Transport) {
+		assert.Equal(t, tlsConfig, w.kw.Transport.(*kafka.Transport).TLS)
+	}
+}
+
+func TestWriterDeliveryError(t *testing.T) {
+	var failed [][]byte
+	var failErr error
+	w := New([]string{"localhost:9092"}, "logs", ErrorHandler(func(err error, lines [][]byte) {
+		failErr = err
+		failed = lines
+	}))
+
+	w.completion([]kafka.Message{{Value: []byte("one")}, {Value: []byte("two")}}, errors.New("broker down"))
+	assert.EqualError(t, failErr, "broker down")
+	assert.Equal(t, [][]byte{[]byte("one"), []byte("two")}, failed)
+
+	failed = nil
+	w.completion([]kafka.Message{{Value: []byte("three")}}, nil)
+	assert.Nil(t, failed)
+}
@@ -0,0 +1,342 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Package kvkinesis provides writers that deliver entries to an Amazon Kinesis
+data stream or an Amazon Data Firehose delivery stream, so that services can
+stream events into a data lake without running a separate shipper.
+
+eg.
+
+	cfg, err := config.LoadDefaultConfig(ctx)
+	...
+	w := kvkinesis.NewFirehoseWriter(firehose.NewFromConfig(cfg), "app-events",
+	    kvkinesis.Aggregate())
+	defer w.Close()
+	logrus.SetOutput(w)
+
+Lines are sent in the background in batches sized to fit the service's
+limits on the number of records and bytes per request.  Each record holds
+one or more complete lines, including their trailing newlines, so that the
+objects Firehose writes to S3 are newline delimited.
+
+Records that the service rejects, such as when a stream is throttled, are
+retried; lines that still can't be delivered are passed to the function set
+by ErrorHandler.
+*/
+package kvkinesis
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/firehose"
+	ftypes "github.com/aws/aws-sdk-go-v2/service/firehose/types"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	ktypes "github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/gwatts/kvlog"
+)
+
+// StreamClient is the subset of *kinesis.Client used by a stream writer.
+type StreamClient interface {
+	PutRecords(ctx context.Context, in *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error)
+}
+
+// FirehoseClient is the subset of *firehose.Client used by a Firehose
+// writer.
+type FirehoseClient interface {
+	PutRecordBatch(ctx context.Context, in *firehose.PutRecordBatchInput, optFns ...func(*firehose.Options)) (*firehose.PutRecordBatchOutput, error)
+}
+
+// Config represents a configuration function to be passed to
+// NewStreamWriter or NewFirehoseWriter.
+type Config func(w *Writer)
+
+// PartitionKeyField sets the field whose value is used as the partition key
+// of each Kinesis record, so that entries with the same value, such as a
+// tenant ID, are delivered to the same shard in order.  Lines without the
+// field, or all lines if no field is set, are given a random key so that
+// they are spread across shards.  Firehose doesn't use partition keys.
+func PartitionKeyField(key string) Config {
+	return func(w *Writer) {
+		w.keyField = key
+	}
+}
+
+// Aggregate causes multiple lines to be packed into each record, up to the
+// service's maximum record size, reducing the number of records and hence
+// the cost of delivery.  With a Kinesis stream, only lines with the same
+// partition key are combined.
+func Aggregate() Config {
+	return func(w *Writer) {
+		w.aggregate = true
+	}
+}
+
+// FlushInterval sets the maximum time a line is held before being sent.
+// The default is one second.
+func FlushInterval(d time.Duration) Config {
+	return func(w *Writer) {
+		w.interval = d
+	}
+}
+
+// Retries sets the number of times records rejected by the service are
+// retried.  The default is 3.
+func Retries(n int) Config {
+	return func(w *Writer) {
+		w.retries = n
+	}
+}
+
+// ErrorHandler sets a function to be called with lines that could not be
+// delivered, and the error that prevented delivery.
+func ErrorHandler(f func(err error, lines [][]byte)) Config {
+	return func(w *Writer) {
+		w.onError = f
+	}
+}
+
+// record is a Kinesis or Firehose record holding one or more lines.
+type record struct {
+	key  string
+	data []byte
+}
+
+// Writer is an io.Writer that delivers lines to Kinesis or Firehose.
+type Writer struct {
+	put           func(recs []record) (failed []record, err error)
+	maxRecords    int
+	maxRecordSize int
+	maxBatchSize  int
+	useKeys       bool
+	keyField      string
+	aggregate     bool
+	interval      time.Duration
+	retries       int
+	backoff       time.Duration
+	onError       func(err error, lines [][]byte)
+
+	mu      sync.Mutex
+	pending []record
+	open    map[string]int // index of the record in pending accepting lines for each key
+	sendMu  sync.Mutex
+	kick    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewStreamWriter creates a Writer that sends records to the named Kinesis
+// data stream using client, typically created by kinesis.NewFromConfig.
+func NewStreamWriter(client StreamClient, stream string, cfgs ...Config) *Writer {
+	w := &Writer{
+		maxRecords:    500,
+		maxRecordSize: 1 << 20,
+		maxBatchSize:  5 << 20,
+		useKeys:       true,
+	}
+	w.put = func(recs []record) ([]record, error) {
+		entries := make([]ktypes.PutRecordsRequestEntry, len(recs))
+		for i, r := range recs {
+			entries[i] = ktypes.PutRecordsRequestEntry{Data: r.data, PartitionKey: aws.String(r.key)}
+		}
+		out, err := client.PutRecords(context.Background(), &kinesis.PutRecordsInput{
+			StreamName: aws.String(stream),
+			Records:    entries,
+		})
+		if err != nil {
+			return recs, err
+		}
+		var failed []record
+		for i, res := range out.Records {
+			if res.ErrorCode != nil && i < len(recs) {
+				failed = append(failed, recs[i])
+				err = fmt.Errorf("kvkinesis: %s: %s", aws.ToString(res.ErrorCode), aws.ToString(res.ErrorMessage))
+			}
+		}
+		return failed, err
+	}
+	return w.start(cfgs)
+}
+
+// NewFirehoseWriter creates a Writer that sends records to the named
+// Firehose delivery stream using client, typically created by
+// firehose.NewFromConfig.
+func NewFirehoseWriter(client FirehoseClient, deliveryStream string, cfgs ...Config) *Writer {
+	w := &Writer{
+		maxRecords:    500,
+		maxRecordSize: 1000 << 10,
+		maxBatchSize:  4 << 20,
+	}
+	w.put = func(recs []record) ([]record, error) {
+		entries := make([]ftypes.Record, len(recs))
+		for i, r := range recs {
+			entries[i] = ftypes.Record{Data: r.data}
+		}
+		out, err := client.PutRecordBatch(context.Background(), &firehose.PutRecordBatchInput{
+			DeliveryStreamName: aws.String(deliveryStream),
+			Records:            entries,
+		})
+		if err != nil {
+			return recs, err
+		}
+		var failed []record
+		for i, res := range out.RequestResponses {
+			if res.ErrorCode != nil && i < len(recs) {
+				failed = append(failed, recs[i])
+				err = fmt.Errorf("kvkinesis: %s: %s", aws.ToString(res.ErrorCode), aws.ToString(res.ErrorMessage))
+			}
+		}
+		return failed, err
+	}
+	return w.start(cfgs)
+}
+
+func (w *Writer) start(cfgs []Config) *Writer {
+	w.interval = time.Second
+	w.retries = 3
+	w.backoff = 100 * time.Millisecond
+	w.open = make(map[string]int)
+	w.kick = make(chan struct{}, 1)
+	w.done = make(chan struct{})
+	w.stopped = make(chan struct{})
+	for _, cfg := range cfgs {
+		cfg(w)
+	}
+	go w.run()
+	kvlog.RegisterShutdown(w)
+	return w
+}
+
+// Write implements io.Writer, queuing p to be sent.
+func (w *Writer) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	line := p
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line = append(line[:len(line):len(line)], '\n')
+	}
+
+	var key string
+	if w.useKeys {
+		if w.keyField != "" {
+			key, _ = kvlog.LineField(p, w.keyField)
+		}
+		if key == "" {
+			key = strconv.FormatUint(rand.Uint64(), 36)
+		}
+	}
+	if len(line)+len(key) > w.maxRecordSize {
+		if w.onError != nil {
+			w.onError(errors.New("kvkinesis: line exceeds maximum record size"), [][]byte{bytes.TrimRight(p, "\n")})
+		}
+		return len(p), nil
+	}
+
+	w.mu.Lock()
+	if i, ok := w.open[key]; ok && w.aggregate && len(w.pending[i].data)+len(line)+len(key) <= w.maxRecordSize {
+		w.pending[i].data = append(w.pending[i].data, line...)
+	} else {
+		w.pending = append(w.pending, record{key: key, data: append([]byte(nil), line...)})
+		w.open[key] = len(w.pending) - 1
+	}
+	full := len(w.pending) >= w.maxRecords
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+	return len(p), nil
+}
+
+// Flush synchronously sends all queued lines, returning the first error
+// encountered.
+func (w *Writer) Flush() error {
+	w.sendMu.Lock()
+	defer w.sendMu.Unlock()
+
+	w.mu.Lock()
+	recs := w.pending
+	w.pending = nil
+	w.open = make(map[string]int)
+	w.mu.Unlock()
+
+	var firstErr error
+	for len(recs) > 0 {
+		n, size := 0, 0
+		for n < len(recs) && n < w.maxRecords {
+			rs := len(recs[n].data) + len(recs[n].key)
+			if n > 0 && size+rs > w.maxBatchSize {
+				break
+			}
+			size += rs
+			n++
+		}
+		if err := w.send(recs[:n]); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		recs = recs[n:]
+	}
+	return firstErr
+}
+
+// Close stops the writer after sending any queued lines.
+func (w *Writer) Close() error {
+	kvlog.UnregisterShutdown(w)
+	w.once.Do(func() { close(w.done) })
+	<-w.stopped
+	return w.Flush()
+}
+
+func (w *Writer) run() {
+	defer close(w.stopped)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.kick:
+		case <-ticker.C:
+		case <-w.done:
+			return
+		}
+		w.Flush()
+	}
+}
+
+// send puts recs, retrying those that fail and reporting any that can't be
+// delivered.
+func (w *Writer) send(recs []record) error {
+	backoff := w.backoff
+	for attempt := 0; ; attempt++ {
+		failed, err := w.put(recs)
+		if len(failed) == 0 {
+			return nil
+		}
+		if attempt >= w.retries {
+			if w.onError != nil {
+				var lines [][]byte
+				for _, r := range failed {
+					lines = append(lines, bytes.Split(bytes.TrimRight(r.data, "\n"), []byte{'\n'})...)
+				}
+				w.onError(err, lines)
+			}
+			return err
+		}
+		recs = failed
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvkinesis
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/firehose"
+	ftypes "github.com/aws/aws-sdk-go-v2/service/firehose/types"
+	"github.com/aws/aws-sdk-go-v2/service/kinesis"
+	ktypes "github.com/aws/aws-sdk-go-v2/service/kinesis/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testStream struct {
+	inputs []*kinesis.PutRecordsInput
+	fail   func(attempt int, data []byte) bool
+}
+
+func (s *testStream) PutRecords(ctx context.Context, in *kinesis.PutRecordsInput, optFns ...func(*kinesis.Options)) (*kinesis.PutRecordsOutput, error) {
+	s.inputs = append(s.inputs, in)
+	out := &kinesis.PutRecordsOutput{Records: make([]ktypes.PutRecordsResultEntry, len(in.Records))}
+	for i, r := range in.Records {
+		if s.fail != nil && s.fail(len(s.inputs), r.Data) {
+			out.Records[i].ErrorCode = aws.String("ProvisionedThroughputExceededException")
+			out.Records[i].ErrorMessage = aws.String("rate exceeded")
+		}
+	}
+	return out, nil
+}
+
+type testFirehose struct {
+	inputs []*firehose.PutRecordBatchInput
+}
+
+func (f *testFirehose) PutRecordBatch(ctx context.Context, in *firehose.PutRecordBatchInput, optFns ...func(*firehose.Options)) (*firehose.PutRecordBatchOutput, error) {
+	f.inputs = append(f.inputs, in)
+	return &firehose.PutRecordBatchOutput{RequestResponses: make([]ftypes.PutRecordBatchResponseEntry, len(in.Records))}, nil
+}
+
+var testLines = []string{
+	`2017-02-13T12:13:45.000Z ll="info" tenant_id="acme" _msg="one"`,
+	`2017-02-13T12:13:45.000Z ll="info" tenant_id="globex" _msg="two"`,
+	`2017-02-13T12:13:45.000Z ll="info" tenant_id="acme" _msg="three"`,
+}
+
+func TestStreamWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfgs     []Config
+		expected []record
+	}{
+		{
+			name: "per-line",
+			cfgs: []Config{PartitionKeyField("tenant_id")},
+			expected: []record{
+				{"acme", []byte(testLines[0] + "\n")},
+				{"globex", []byte(testLines[1] + "\n")},
+				{"acme", []byte(testLines[2] + "\n")},
+			},
+		}, {
+			name: "aggregate",
+			cfgs: []Config{PartitionKeyField("tenant_id"), Aggregate()},
+			expected: []record{
+				{"acme", []byte(testLines[0] + "\n" + testLines[2] + "\n")},
+				{"globex", []byte(testLines[1] + "\n")},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := new(testStream)
+			w := NewStreamWriter(client, "events", append(test.cfgs, FlushInterval(time.Hour))...)
+			for _, line := range testLines {
+				w.Write([]byte(line + "\n"))
+			}
+			require.Nil(t, w.Close())
+
+			require.Len(t, client.inputs, 1)
+			in := client.inputs[0]
+			assert.Equal(t, "events", aws.ToString(in.StreamName))
+			var recs []record
+			for _, r := range in.Records {
+				recs = append(recs, record{aws.ToString(r.PartitionKey), r.Data})
+			}
+			assert.Equal(t, test.expected, recs)
+		})
+	}
+}
+
+func TestStreamWriterRandomKey(t *testing.T) {
+	client := new(testStream)
+	w := NewStreamWriter(client, "events", FlushInterval(time.Hour))
+	w.Write([]byte(testLines[0]))
+	require.Nil(t, w.Close())
+	require.Len(t, client.inputs, 1)
+	assert.NotEmpty(t, aws.ToString(client.inputs[0].Records[0].PartitionKey))
+	assert.Equal(t, testLines[0]+"\n", string(client.inputs[0].Records[0].Data))
+}
+
+func TestStreamWriterRetry(t *testing.T) {
+	var failed []string
+	client := &testStream{fail: func(attempt int, data []byte) bool {
+		// "two" always fails; "one" succeeds on retry
+		return strings.Contains(string(data), "two") || attempt == 1
+	}}
+	w := NewStreamWriter(client, "events",
+		FlushInterval(time.Hour),
+		Retries(1),
+		ErrorHandler(func(err error, lines [][]byte) {
+			assert.Contains(t, err.Error(), "ProvisionedThroughputExceededException")
+			for _, l := range lines {
+				failed = append(failed, string(l))
+			}
+		}))
+	w.Write([]byte(testLines[0] + "\n"))
+	w.Write([]byte(testLines[1] + "\n"))
+	assert.NotNil(t, w.Close())
+
+	require.Len(t, client.inputs, 2)
+	assert.Len(t, client.inputs[0].Records, 2)
+	assert.Len(t, client.inputs[1].Records, 2)
+	assert.Equal(t, []string{testLines[1]}, failed)
+}
+
+func TestFirehoseWriter(t *testing.T) {
+	client := new(testFirehose)
+	w := NewFirehoseWriter(client, "lake", Aggregate(), FlushInterval(time.Hour))
+	for _, line := range testLines {
+		w.Write([]byte(line + "\n"))
+	}
+	require.Nil(t, w.Close())
+
+	require.Len(t, client.inputs, 1)
+	in := client.inputs[0]
+	assert.Equal(t, "lake", aws.ToString(in.DeliveryStreamName))
+	require.Len(t, in.Records, 1)
+	assert.Equal(t, strings.Join(testLines, "\n")+"\n", string(in.Records[0].Data))
+}
+
+func TestBatchLimits(t *testing.T) {
+	client := new(testFirehose)
+	w := NewFirehoseWriter(client, "lake", FlushInterval(time.Hour))
+	for i := 0; i < 1200; i++ {
+		w.Write([]byte(testLines[0] + "\n"))
+	}
+	require.Nil(t, w.Close())
+
+	total := 0
+	for _, in := range client.inputs {
+		assert.True(t, len(in.Records) <= 500, "batch of %d records", len(in.Records))
+		total += len(in.Records)
+	}
+	assert.Equal(t, 1200, total)
+	assert.True(t, len(client.inputs) >= 3)
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Package kvlambda attaches details of an AWS Lambda invocation to a context
+as kvlog context fields, so that every entry logged during the invocation
+can be correlated in CloudWatch.
+
+eg.
+
+	func handler(ctx context.Context, event Event) error {
+		ctx = kvlambda.ContextWithInvocationFields(ctx)
+		kvlog.FromContext(ctx, logrus.StandardLogger()).Info("processing event")
+		...
+	}
+
+produces
+
+	2017-01-02T12:00:00.000Z ll="info" aws_request_id="c6af9ac6-7b61-11e6-9a41-93e812345678" function_name="orders" function_version="$LATEST" remaining_ms=2873 _msg="processing event"
+*/
+package kvlambda
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+
+	"github.com/gwatts/kvlog"
+)
+
+// ContextWithInvocationFields returns a copy of ctx with fields describing
+// the current Lambda invocation added using kvlog.ContextWithFields:
+//
+//	aws_request_id    the invocation's request ID
+//	function_name     the name of the function
+//	function_version  the version of the function being executed
+//	remaining_ms      milliseconds remaining before the invocation times out
+//
+// remaining_ms is calculated each time an entry is formatted, rather than
+// when the context is created.  Fields whose values aren't available from
+// ctx or the Lambda environment are omitted.
+func ContextWithInvocationFields(ctx context.Context) context.Context {
+	fields := make(log.Fields)
+	if lc, ok := lambdacontext.FromContext(ctx); ok && lc.AwsRequestID != "" {
+		fields["aws_request_id"] = lc.AwsRequestID
+	}
+	if lambdacontext.FunctionName != "" {
+		fields["function_name"] = lambdacontext.FunctionName
+	}
+	if lambdacontext.FunctionVersion != "" {
+		fields["function_version"] = lambdacontext.FunctionVersion
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		fields["remaining_ms"] = remaining(deadline)
+	}
+	return kvlog.ContextWithFields(ctx, fields)
+}
+
+// remaining formats as the number of milliseconds until its deadline at the
+// time it's logged.
+type remaining time.Time
+
+// MarshalLogValue implements the kvlog.Marshaler interface.
+func (r remaining) MarshalLogValue() string {
+	ms := int64(time.Until(time.Time(r)) / time.Millisecond)
+	if ms < 0 {
+		ms = 0
+	}
+	return strconv.FormatInt(ms, 10)
+}
@@ -0,0 +1,56 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlambda
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/gwatts/kvlog"
+)
+
+func TestContextWithInvocationFields(t *testing.T) {
+	assert := assert.New(t)
+
+	lambdacontext.FunctionName = "orders"
+	lambdacontext.FunctionVersion = "$LATEST"
+	defer func() {
+		lambdacontext.FunctionName = ""
+		lambdacontext.FunctionVersion = ""
+	}()
+
+	ctx := lambdacontext.NewContext(context.Background(), &lambdacontext.LambdaContext{
+		AwsRequestID: "c6af9ac6-7b61-11e6-9a41-93e812345678",
+	})
+	ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+	defer cancel()
+	ctx = ContextWithInvocationFields(ctx)
+
+	var buf bytes.Buffer
+	logger := &log.Logger{Out: &buf, Formatter: kvlog.New(), Level: log.InfoLevel}
+	kvlog.FromContext(ctx, logger).Info("processing event")
+
+	entry, err := kvlog.Parse(buf.Bytes())
+	require.Nil(t, err)
+	assert.Equal([]string{"aws_request_id", "function_name", "function_version", "remaining_ms"}, entry.Keys)
+	assert.Equal("c6af9ac6-7b61-11e6-9a41-93e812345678", entry.Fields["aws_request_id"])
+	assert.Equal("orders", entry.Fields["function_name"])
+	assert.Equal("$LATEST", entry.Fields["function_version"])
+	remaining, ok := entry.Fields["remaining_ms"].(int64)
+	require.True(t, ok)
+	assert.True(remaining > 2000 && remaining <= 3000, "unexpected remaining_ms %d", remaining)
+}
+
+func TestContextWithInvocationFieldsEmpty(t *testing.T) {
+	ctx := ContextWithInvocationFields(context.Background())
+	assert.Empty(t, kvlog.ContextFields(ctx))
+}
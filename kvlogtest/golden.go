@@ -0,0 +1,135 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlogtest
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+// Update causes AssertGolden to write the output it's given to the golden
+// file rather than comparing them.  It's set by the -update test flag, eg.
+//
+//	go test ./... -update
+//
+// A test package that defines its own update flag should remove it and use
+// this one, as the two can't both be registered.
+var Update = flag.Bool("update", false, "update golden files")
+
+type replacement struct {
+	re   *regexp.Regexp
+	repl []byte
+}
+
+// The replacements made by Normalize, keeping the output parseable.
+var defaultReplacements = []replacement{
+	{regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:\d{2})`), []byte("0001-01-01T00:00:00.000Z")},
+	{regexp.MustCompile(`\b(srcline|goroutine|goid)=\d+`), []byte("${1}=0")},
+	{regexp.MustCompile(`"(srcline|goroutine|goid)":\d+`), []byte(`"${1}":0`)},
+	{regexp.MustCompile(`\bgoroutine \d+ \[`), []byte("goroutine 0 [")},
+}
+
+// GoldenConfig represents a configuration function to be passed to
+// Normalize or AssertGolden.
+type GoldenConfig func(g *golden)
+
+type golden struct {
+	replacements []replacement
+}
+
+// Replace additionally replaces text matching the regular expression
+// pattern with repl, which may refer to submatches as for
+// regexp.Regexp.ReplaceAll, such as to normalize request IDs or durations.
+// It panics if pattern isn't valid.
+func Replace(pattern, repl string) GoldenConfig {
+	return func(g *golden) {
+		g.replacements = append(g.replacements, replacement{regexp.MustCompile(pattern), []byte(repl)})
+	}
+}
+
+// Normalize returns output with the parts that vary from run to run
+// replaced by fixed values: timestamps become 0001-01-01T00:00:00.000Z and
+// srcline values, along with goroutine IDs in goroutine and goid fields and
+// stack traces, become 0.  The result is still valid k=v or JSON output.
+func Normalize(output []byte, cfgs ...GoldenConfig) []byte {
+	g := golden{replacements: defaultReplacements}
+	for _, cfg := range cfgs {
+		cfg(&g)
+	}
+	for _, r := range g.replacements {
+		output = r.re.ReplaceAll(output, r.repl)
+	}
+	return output
+}
+
+// AssertGolden normalizes output and compares it with the contents of the
+// golden file at path, conventionally under testdata, reporting an error to
+// t describing the first line that differs.  With -update, the file is
+// written instead, creating any missing directories.
+//
+// eg.
+//
+//	var buf bytes.Buffer
+//	logger := kvlog.NewLogger(&buf, kvlog.New(kvlog.IncludeCaller()))
+//	runScenario(logger)
+//	kvlogtest.AssertGolden(t, "testdata/scenario.golden", buf.Bytes())
+func AssertGolden(t TestingT, path string, output []byte, cfgs ...GoldenConfig) bool {
+	t.Helper()
+	got := Normalize(output, cfgs...)
+	if *Update {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Errorf("failed to update golden file: %v", err)
+			return false
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Errorf("failed to update golden file: %v", err)
+			return false
+		}
+		return true
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Errorf("failed to read golden file; run with -update to create it: %v", err)
+		return false
+	}
+	if bytes.Equal(got, want) {
+		return true
+	}
+	t.Errorf("output differs from %s; run with -update to accept it\n%s", path, lineDiff(want, got))
+	return false
+}
+
+// lineDiff describes the first line that differs between want and got.
+func lineDiff(want, got []byte) string {
+	wl := bytes.Split(want, []byte{'\n'})
+	gl := bytes.Split(got, []byte{'\n'})
+	for i := 0; ; i++ {
+		var w, g []byte
+		wok, gok := i < len(wl), i < len(gl)
+		if wok {
+			w = wl[i]
+		}
+		if gok {
+			g = gl[i]
+		}
+		if wok && gok && bytes.Equal(w, g) {
+			continue
+		}
+		return fmt.Sprintf("line %d:\n\twant: %s\n\tgot:  %s", i+1, describeLine(w, wok), describeLine(g, gok))
+	}
+}
+
+func describeLine(line []byte, ok bool) string {
+	if !ok {
+		return "<end of output>"
+	}
+	return string(line)
+}
@@ -0,0 +1,78 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlogtest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gwatts/kvlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		cfgs     []GoldenConfig
+		expected string
+	}{
+		{"kv",
+			`2017-02-13T12:13:45.123Z ll="info" srcfnc="run" srcline=42 goroutine=17 started="2017-02-13T12:13:45+01:00" _msg="ok"`, nil,
+			`0001-01-01T00:00:00.000Z ll="info" srcfnc="run" srcline=0 goroutine=0 started="0001-01-01T00:00:00.000Z" _msg="ok"`},
+		{"json",
+			`{"time":"2017-02-13T12:13:45.000Z","srcline":42,"goid":3}`, nil,
+			`{"time":"0001-01-01T00:00:00.000Z","srcline":0,"goid":0}`},
+		{"stack",
+			`stack="goroutine 12 [running]:"`, nil,
+			`stack="goroutine 0 [running]:"`},
+		{"custom",
+			`request_id="a1b2" duration_ms=12.5`, []GoldenConfig{Replace(`request_id="\w+"`, `request_id="x"`), Replace(`(duration_ms)=[\d.]+`, "${1}=1")},
+			`request_id="x" duration_ms=1`},
+		{"unrelated", `srclines=12 id=2017`, nil, `srclines=12 id=2017`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, string(Normalize([]byte(test.input), test.cfgs...)))
+		})
+	}
+}
+
+func TestAssertGolden(t *testing.T) {
+	var buf bytes.Buffer
+	logger := kvlog.NewLogger(&buf, kvlog.New(kvlog.IncludeCaller()))
+	logger.WithFields(log.Fields{"action": "login", "status": "ok"}).Info("user logged in")
+	logger.Warn("slow request")
+	AssertGolden(t, "testdata/logger.golden", buf.Bytes())
+}
+
+func TestAssertGoldenMismatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlogtest")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sub", "out.golden")
+
+	rt := new(recordingT)
+	assert.False(t, AssertGolden(rt, path, []byte("a\n")))
+	require.Len(t, rt.errors, 1)
+	assert.Contains(t, rt.errors[0], "run with -update to create it")
+
+	*Update = true
+	ok := AssertGolden(rt, path, []byte("2017-02-13T12:13:45.000Z a=1\nb=2\n"))
+	*Update = false
+	assert.True(t, ok)
+
+	rt = new(recordingT)
+	assert.True(t, AssertGolden(rt, path, []byte("2020-01-01T00:00:00.000Z a=1\nb=2\n")))
+	assert.False(t, AssertGolden(rt, path, []byte("2020-01-01T00:00:00.000Z a=1\n")))
+	require.Len(t, rt.errors, 1)
+	assert.Equal(t, "output differs from "+path+"; run with -update to accept it\nline 2:\n\twant: b=2\n\tgot:  ", rt.errors[0])
+}
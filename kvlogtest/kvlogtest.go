@@ -0,0 +1,225 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Package kvlogtest helps tests check what was logged without matching the
+raw formatted output.
+
+A Recorder captures entries, formatted by a kvlog Formatter and parsed back
+into kvlog.Entry values, so that assertions see the fields exactly as they'd
+appear in production output, after redaction, Loggable expansion and so on.
+
+eg.
+
+	logger, rec := kvlogtest.NewLogger()
+	handler := NewHandler(logger)
+	handler.ServeHTTP(w, req)
+
+	rec.AssertLogged(t, log.InfoLevel, kvlogtest.Fields{
+	    "_msg":        "request complete",
+	    "status":      200,
+	    "duration_ms": kvlogtest.Present(),
+	    "path":        kvlogtest.HasPrefix("/api/"),
+	})
+
+Field values in Fields may be Matchers or plain values, which are compared
+with Eq.  The key "_msg" matches the entry's message.
+*/
+package kvlogtest
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gwatts/kvlog"
+)
+
+// msgKey is the key used in Fields to match an entry's message.
+const msgKey = "_msg"
+
+// TestingT is the subset of testing.TB used by the assertions.
+type TestingT interface {
+	Helper()
+	Errorf(format string, args ...interface{})
+}
+
+// Recorder captures log entries in memory.  It's an io.Writer, to be used
+// as the output of a logger using a kvlog Formatter, and a logrus.Hook, which
+// formats entries with its own Formatter.  It's safe for concurrent use.
+type Recorder struct {
+	cf      *kvlog.Formatter
+	mu      sync.Mutex
+	entries []kvlog.Entry
+}
+
+// NewRecorder creates a Recorder.  cfgs configure the Formatter used to
+// format entries passed to Fire; they aren't used for lines passed to Write.
+func NewRecorder(cfgs ...kvlog.Config) *Recorder {
+	return &Recorder{cf: kvlog.New(cfgs...)}
+}
+
+// NewLogger returns a logrus Logger, logging at every level, whose output
+// is recorded by the returned Recorder.  cfgs configure the Logger's
+// Formatter.
+func NewLogger(cfgs ...kvlog.Config) (*log.Logger, *Recorder) {
+	rec := NewRecorder(cfgs...)
+	logger := log.New()
+	logger.Out = rec
+	logger.Formatter = rec.cf
+	logger.Level = log.TraceLevel
+	return logger, rec
+}
+
+// Write implements io.Writer, parsing and recording each k=v line in p.
+// Lines that can't be parsed are recorded as entries holding the whole line
+// as their message.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, line := range bytes.Split(p, []byte{'\n'}) {
+		if len(line) == 0 {
+			continue
+		}
+		entry, err := kvlog.Parse(line)
+		if err != nil {
+			entry = kvlog.Entry{Message: string(line), Fields: map[string]interface{}{}}
+		}
+		r.entries = append(r.entries, entry)
+	}
+	return len(p), nil
+}
+
+// Levels implements logrus.Hook.
+func (r *Recorder) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements logrus.Hook, formatting and recording entry.
+func (r *Recorder) Fire(entry *log.Entry) error {
+	e := *entry
+	e.Buffer = nil
+	line, err := r.cf.Format(&e)
+	if err != nil {
+		return err
+	}
+	_, err = r.Write(line)
+	return err
+}
+
+// Entries returns a copy of the entries recorded.
+func (r *Recorder) Entries() []kvlog.Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]kvlog.Entry(nil), r.entries...)
+}
+
+// Reset discards the entries recorded.
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	r.entries = nil
+	r.mu.Unlock()
+}
+
+// Find returns the entries recorded at level whose fields match fields.
+func (r *Recorder) Find(level log.Level, fields Fields) []kvlog.Entry {
+	var found []kvlog.Entry
+	for _, entry := range r.Entries() {
+		if entry.Level == level && fields.match(entry) {
+			found = append(found, entry)
+		}
+	}
+	return found
+}
+
+// AssertLogged reports an error to t if no entry was recorded at level
+// matching fields, listing the entries that were recorded at that level.
+func (r *Recorder) AssertLogged(t TestingT, level log.Level, fields Fields) bool {
+	t.Helper()
+	if len(r.Find(level, fields)) > 0 {
+		return true
+	}
+	t.Errorf("no %s entry logged matching %s\n%s", level, fields, r.describe(level))
+	return false
+}
+
+// AssertNotLogged reports an error to t if an entry was recorded at level
+// matching fields.
+func (r *Recorder) AssertNotLogged(t TestingT, level log.Level, fields Fields) bool {
+	t.Helper()
+	found := r.Find(level, fields)
+	if len(found) == 0 {
+		return true
+	}
+	t.Errorf("%d %s entries logged matching %s, eg.\n\t%s", len(found), level, fields, formatEntry(found[0]))
+	return false
+}
+
+// describe lists the entries recorded at level.
+func (r *Recorder) describe(level log.Level) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s entries logged:", level)
+	n := 0
+	for _, entry := range r.Entries() {
+		if entry.Level == level {
+			b.WriteString("\n\t")
+			b.WriteString(formatEntry(entry))
+			n++
+		}
+	}
+	if n == 0 {
+		b.WriteString(" none")
+	}
+	return b.String()
+}
+
+func formatEntry(entry kvlog.Entry) string {
+	var b strings.Builder
+	for i, k := range entry.Keys {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s=%#v", k, entry.Fields[k])
+	}
+	if entry.Message != "" {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		fmt.Fprintf(&b, "%s=%q", msgKey, entry.Message)
+	}
+	return b.String()
+}
+
+// Fields maps keys to the values expected in an entry.  Values may be
+// Matchers or plain values, which are compared with Eq.
+type Fields map[string]interface{}
+
+func (f Fields) match(entry kvlog.Entry) bool {
+	for k, want := range f {
+		v, ok := entry.Fields[k]
+		if k == msgKey {
+			v, ok = entry.Message, true
+		}
+		if !matcherFor(want).Match(v, ok) {
+			return false
+		}
+	}
+	return true
+}
+
+func (f Fields) String() string {
+	keys := make([]string, 0, len(f))
+	for k := range f {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = fmt.Sprintf("%s=%s", k, matcherFor(f[k]))
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
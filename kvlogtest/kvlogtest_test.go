@@ -0,0 +1,85 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlogtest
+
+import (
+	"fmt"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gwatts/kvlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingT records failures instead of failing the test.
+type recordingT struct {
+	errors []string
+}
+
+func (t *recordingT) Helper() {}
+
+func (t *recordingT) Errorf(format string, args ...interface{}) {
+	t.errors = append(t.errors, fmt.Sprintf(format, args...))
+}
+
+func TestRecorder(t *testing.T) {
+	logger, rec := NewLogger(kvlog.WithRedactedKeys("password"))
+	logger.WithFields(log.Fields{
+		"status":   200,
+		"path":     "/api/users",
+		"password": "hunter2",
+		"user":     kvlog.Ordered(".id", 42),
+	}).Info("request complete")
+	logger.Debug("details")
+
+	rec.AssertLogged(t, log.InfoLevel, Fields{
+		"_msg":     "request complete",
+		"status":   200,
+		"path":     HasPrefix("/api/"),
+		"password": kvlog.Redacted,
+		"user.id":  Eq("42"),
+		"missing":  Absent(),
+	})
+	rec.AssertLogged(t, log.DebugLevel, Fields{"_msg": Contains("detail")})
+	rec.AssertNotLogged(t, log.ErrorLevel, nil)
+	assert.Len(t, rec.Find(log.InfoLevel, Fields{"path": Regexp(`^/api/\w+$`)}), 1)
+	assert.Len(t, rec.Entries(), 2)
+
+	rec.Reset()
+	assert.Len(t, rec.Entries(), 0)
+}
+
+func TestAssertFailures(t *testing.T) {
+	logger, rec := NewLogger()
+	logger.WithField("status", 500).Error("failed")
+
+	rt := new(recordingT)
+	assert.False(t, rec.AssertLogged(rt, log.ErrorLevel, Fields{"status": 200}))
+	assert.False(t, rec.AssertLogged(rt, log.InfoLevel, Fields{"status": Present()}))
+	assert.False(t, rec.AssertNotLogged(rt, log.ErrorLevel, Fields{"status": Func("5xx", func(v interface{}) bool {
+		n, ok := v.(int64)
+		return ok && n >= 500
+	})}))
+	require.Len(t, rt.errors, 3)
+	assert.Equal(t, "no error entry logged matching {status=200}\nerror entries logged:\n\tstatus=500 _msg=\"failed\"", rt.errors[0])
+	assert.Equal(t, "no info entry logged matching {status=<present>}\ninfo entries logged: none", rt.errors[1])
+	assert.Equal(t, "1 error entries logged matching {status=5xx}, eg.\n\tstatus=500 _msg=\"failed\"", rt.errors[2])
+}
+
+func TestRecorderHook(t *testing.T) {
+	rec := NewRecorder()
+	logger := log.New()
+	logger.Out = new(nopWriter)
+	logger.AddHook(rec)
+	logger.WithField("k", "v").Warn("hooked")
+	rec.AssertLogged(t, log.WarnLevel, Fields{"k": "v", "_msg": "hooked"})
+}
+
+type nopWriter struct{}
+
+func (nopWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlogtest
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Matcher checks the value of a field in a recorded entry.
+type Matcher interface {
+	// Match reports whether v matches.  present is false, and v nil, if the
+	// entry doesn't have the field.
+	Match(v interface{}, present bool) bool
+
+	// String describes the values matched, for failure messages.
+	String() string
+}
+
+type matcher struct {
+	desc  string
+	match func(v interface{}, present bool) bool
+}
+
+func (m matcher) Match(v interface{}, present bool) bool { return m.match(v, present) }
+func (m matcher) String() string                         { return m.desc }
+
+func matcherFor(v interface{}) Matcher {
+	if m, ok := v.(Matcher); ok {
+		return m
+	}
+	return Eq(v)
+}
+
+// Eq matches a field whose value, as logged, is the same as that of want.
+// Values are compared by their string form, so Eq(200) matches status=200
+// and Eq("200") matches both status=200 and status="200".  A nil want
+// matches a field logged with a nil value.
+func Eq(want interface{}) Matcher {
+	s := stringValue(want)
+	return matcher{fmt.Sprintf("%#v", want), func(v interface{}, present bool) bool {
+		return present && stringValue(v) == s
+	}}
+}
+
+// Present matches a field with any value.
+func Present() Matcher {
+	return matcher{"<present>", func(v interface{}, present bool) bool {
+		return present
+	}}
+}
+
+// Absent matches an entry that doesn't have the field.
+func Absent() Matcher {
+	return matcher{"<absent>", func(v interface{}, present bool) bool {
+		return !present
+	}}
+}
+
+// Contains matches a field whose string form contains substr.
+func Contains(substr string) Matcher {
+	return matcher{fmt.Sprintf("<contains %q>", substr), func(v interface{}, present bool) bool {
+		return present && strings.Contains(stringValue(v), substr)
+	}}
+}
+
+// HasPrefix matches a field whose string form begins with prefix.
+func HasPrefix(prefix string) Matcher {
+	return matcher{fmt.Sprintf("<prefix %q>", prefix), func(v interface{}, present bool) bool {
+		return present && strings.HasPrefix(stringValue(v), prefix)
+	}}
+}
+
+// Regexp matches a field whose string form matches the regular expression
+// pattern.  It panics if pattern isn't valid.
+func Regexp(pattern string) Matcher {
+	re := regexp.MustCompile(pattern)
+	return matcher{fmt.Sprintf("<matching %s>", pattern), func(v interface{}, present bool) bool {
+		return present && re.MatchString(stringValue(v))
+	}}
+}
+
+// Func matches a field for which f returns true.  desc describes the values
+// matched, for failure messages.
+func Func(desc string, f func(v interface{}) bool) Matcher {
+	return matcher{desc, func(v interface{}, present bool) bool {
+		return present && f(v)
+	}}
+}
+
+func stringValue(v interface{}) string {
+	if v == nil {
+		return "<nil>"
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,81 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlogtest
+
+import (
+	"bytes"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gwatts/kvlog"
+)
+
+// LogT is the subset of testing.TB used by TestWriter.
+type LogT interface {
+	Helper()
+	Log(args ...interface{})
+	Cleanup(func())
+}
+
+// TestWriter is an io.Writer that passes each line written to t.Log, so
+// that entries logged by the code under test are shown along with the
+// test's own output, and only when the test fails or go test is run with
+// -v.
+//
+// The testing package attributes each line to the function in the logging
+// package that wrote it, rather than the code that logged the entry; use a
+// Formatter with kvlog.IncludeCaller, as NewTestLogger does, to include the
+// actual caller in each line.
+//
+// Lines written after the test has completed, such as by a goroutine the
+// test didn't wait for, are discarded, as t.Log would panic.
+type TestWriter struct {
+	t    LogT
+	mu   sync.Mutex
+	done bool
+}
+
+// NewTestWriter creates a TestWriter logging to t.
+func NewTestWriter(t LogT) *TestWriter {
+	w := &TestWriter{t: t}
+	t.Cleanup(func() {
+		w.mu.Lock()
+		w.done = true
+		w.mu.Unlock()
+	})
+	return w
+}
+
+// Write implements io.Writer, logging each line in p.
+func (w *TestWriter) Write(p []byte) (int, error) {
+	w.t.Helper()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.done || len(p) == 0 {
+		return len(p), nil
+	}
+	for _, line := range bytes.Split(bytes.TrimRight(p, "\n"), []byte{'\n'}) {
+		w.t.Log(string(line))
+	}
+	return len(p), nil
+}
+
+// NewTestLogger returns a logrus Logger, logging at every level, whose
+// output is passed to t.Log by a TestWriter.  Its Formatter includes the
+// caller, followed by cfgs.
+//
+// eg.
+//
+//	func TestHandler(t *testing.T) {
+//	    h := NewHandler(kvlogtest.NewTestLogger(t))
+//	    ...
+//	}
+func NewTestLogger(t LogT, cfgs ...kvlog.Config) *log.Logger {
+	logger := log.New()
+	logger.Out = NewTestWriter(t)
+	logger.Formatter = kvlog.New(append([]kvlog.Config{kvlog.IncludeCaller()}, cfgs...)...)
+	logger.Level = log.TraceLevel
+	return logger
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlogtest
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gwatts/kvlog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logT records lines logged and cleanup functions.
+type logT struct {
+	lines    []string
+	cleanups []func()
+}
+
+func (t *logT) Helper() {}
+
+func (t *logT) Log(args ...interface{}) {
+	t.lines = append(t.lines, fmt.Sprint(args...))
+}
+
+func (t *logT) Cleanup(f func()) {
+	t.cleanups = append(t.cleanups, f)
+}
+
+func TestTestLogger(t *testing.T) {
+	lt := new(logT)
+	logger := NewTestLogger(lt, kvlog.WithClock(func() time.Time { return time.Time{} }))
+	logger.WithField("k", 1).Debug("one")
+	logger.Info("two")
+	require.Len(t, lt.lines, 2)
+	assert.Regexp(t, `^0001-01-01T00:00:00.000Z ll="debug" srcfnc="TestTestLogger" srcline=\d+ k=1 _msg="one"$`, lt.lines[0])
+	assert.Regexp(t, `ll="info" .* _msg="two"$`, lt.lines[1])
+
+	for _, f := range lt.cleanups {
+		f()
+	}
+	logger.Info("after")
+	assert.Len(t, lt.lines, 2)
+}
+
+func TestTestWriter(t *testing.T) {
+	lt := new(logT)
+	w := NewTestWriter(lt)
+	n, err := w.Write([]byte("a=1\nb=2\n"))
+	require.Nil(t, err)
+	assert.Equal(t, 8, n)
+	assert.Equal(t, []string{"a=1", "b=2"}, lt.lines)
+
+	// a real testing.T
+	logger := kvlog.NewLogger(NewTestWriter(t), nil)
+	logger.Info("shown with -v")
+}
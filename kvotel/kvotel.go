@@ -0,0 +1,113 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Package kvotel provides a logrus hook that adds the IDs of the active
+OpenTelemetry span to each entry, so that logs can be correlated with
+traces.
+
+eg.
+
+	logrus.AddHook(kvotel.NewHook())
+	...
+	logrus.WithContext(ctx).Info("order placed")
+
+produces
+
+	2017-01-02T12:00:00.000Z ll="info" span_id="00f067aa0ba902b7" trace_id="4bf92f3577b34da6a3ce929d0e0e4736" _msg="order placed"
+
+The span is taken from the entry's context, as set by WithContext or by
+kvlog.FromContext.  Entries without a context, or whose context doesn't hold
+a valid span, are left unchanged.
+
+The DatadogIDs option additionally adds the IDs in the form Datadog expects
+for log and trace correlation.
+*/
+package kvotel
+
+import (
+	"encoding/binary"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Config represents a configuration function to be passed to NewHook.
+type Config func(h *Hook)
+
+// TraceIDKey sets the field key used for the trace ID.  The default is
+// "trace_id", which the kvlog JSON output modes also recognize.
+func TraceIDKey(key string) Config {
+	return func(h *Hook) {
+		h.traceKey = key
+	}
+}
+
+// SpanIDKey sets the field key used for the span ID.  The default is
+// "span_id".
+func SpanIDKey(key string) Config {
+	return func(h *Hook) {
+		h.spanKey = key
+	}
+}
+
+// DatadogIDs causes the hook to also add dd.trace_id and dd.span_id fields
+// holding the IDs in the decimal format Datadog uses to correlate logs with
+// traces, such as when tracing with Datadog's OpenTelemetry API support.
+//
+// Datadog trace IDs are 64 bits, so dd.trace_id is formed from the low 64
+// bits of the OpenTelemetry trace ID.  The values are logged as strings, as
+// Datadog recommends, to avoid loss of precision by JSON parsers.
+func DatadogIDs() Config {
+	return func(h *Hook) {
+		h.datadog = true
+	}
+}
+
+// Hook is a logrus hook that adds trace and span ID fields to entries
+// logged with a context holding an OpenTelemetry span.
+type Hook struct {
+	traceKey string
+	spanKey  string
+	datadog  bool
+}
+
+// NewHook creates a Hook, which should be registered with logrus using
+// AddHook.
+func NewHook(cfgs ...Config) *Hook {
+	h := &Hook{
+		traceKey: "trace_id",
+		spanKey:  "span_id",
+	}
+	for _, cfg := range cfgs {
+		cfg(h)
+	}
+	return h
+}
+
+// Levels implements the logrus.Hook interface.
+func (h *Hook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements the logrus.Hook interface, adding the IDs of the span
+// held by the entry's context.
+func (h *Hook) Fire(entry *log.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	sc := trace.SpanContextFromContext(entry.Context)
+	if !sc.IsValid() {
+		return nil
+	}
+	entry.Data[h.traceKey] = sc.TraceID().String()
+	entry.Data[h.spanKey] = sc.SpanID().String()
+	if h.datadog {
+		tid, sid := sc.TraceID(), sc.SpanID()
+		entry.Data["dd.trace_id"] = strconv.FormatUint(binary.BigEndian.Uint64(tid[8:]), 10)
+		entry.Data["dd.span_id"] = strconv.FormatUint(binary.BigEndian.Uint64(sid[:]), 10)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvotel
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/gwatts/kvlog"
+)
+
+var timestampRE = regexp.MustCompile(`(?m)^\S+ `)
+
+func spanContext() context.Context {
+	tid, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	sid, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: tid, SpanID: sid, TraceFlags: trace.FlagsSampled})
+	return trace.ContextWithSpanContext(context.Background(), sc)
+}
+
+func TestHook(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfgs     []Config
+		ctx      context.Context
+		expected string
+	}{
+		{
+			name:     "default-keys",
+			ctx:      spanContext(),
+			expected: `ll="info" span_id="00f067aa0ba902b7" trace_id="4bf92f3577b34da6a3ce929d0e0e4736" _msg="hello"` + "\n",
+		}, {
+			name:     "custom-keys",
+			cfgs:     []Config{TraceIDKey("traceid"), SpanIDKey("spanid")},
+			ctx:      spanContext(),
+			expected: `ll="info" spanid="00f067aa0ba902b7" traceid="4bf92f3577b34da6a3ce929d0e0e4736" _msg="hello"` + "\n",
+		}, {
+			name:     "datadog",
+			cfgs:     []Config{DatadogIDs()},
+			ctx:      spanContext(),
+			expected: `ll="info" dd.span_id="67667974448284343" dd.trace_id="11803532876627986230" span_id="00f067aa0ba902b7" trace_id="4bf92f3577b34da6a3ce929d0e0e4736" _msg="hello"` + "\n",
+		}, {
+			name:     "no-span",
+			ctx:      context.Background(),
+			expected: `ll="info" _msg="hello"` + "\n",
+		}, {
+			name:     "no-context",
+			expected: `ll="info" _msg="hello"` + "\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			logger := &log.Logger{
+				Out:       &buf,
+				Formatter: kvlog.New(),
+				Hooks:     make(log.LevelHooks),
+				Level:     log.InfoLevel,
+			}
+			logger.AddHook(NewHook(test.cfgs...))
+
+			entry := log.NewEntry(logger)
+			if test.ctx != nil {
+				entry = entry.WithContext(test.ctx)
+			}
+			entry.Info("hello")
+			assert.Equal(t, test.expected, timestampRE.ReplaceAllString(buf.String(), ""))
+		})
+	}
+}
+
+func TestHookFromContext(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &log.Logger{
+		Out:       &buf,
+		Formatter: kvlog.New(),
+		Hooks:     make(log.LevelHooks),
+		Level:     log.InfoLevel,
+	}
+	logger.AddHook(NewHook())
+
+	ctx := kvlog.ContextWithFields(spanContext(), log.Fields{"request_id": "abc"})
+	kvlog.FromContext(ctx, logger).Info("hello")
+	assert.Equal(t, `ll="info" request_id="abc" span_id="00f067aa0ba902b7" trace_id="4bf92f3577b34da6a3ce929d0e0e4736" _msg="hello"`+"\n",
+		timestampRE.ReplaceAllString(buf.String(), ""))
+}
@@ -0,0 +1,152 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+/*
+Package kvprom exposes counters of kvlog's logging activity as Prometheus
+metrics, so that alerts can be raised on the rate of error entries or on
+entries being silently lost by the log pipeline.
+
+eg.
+
+	if _, err := kvprom.Register(prometheus.DefaultRegisterer); err != nil {
+	    log.Fatal(err)
+	}
+
+registers the following metrics:
+
+	kvlog_lines_total{level}              lines formatted or written, by level
+	kvlog_bytes_total                     bytes formatted or written
+	kvlog_format_errors_total             entries that couldn't be formatted
+	kvlog_dropped_entries_total{reason}   entries discarded by sinks and samplers
+	kvlog_delivery_failures_total{sink}   failures delivering entries to a destination
+
+Lines are counted when formatted by a kvlog Formatter or written by a
+kvlog Logger, so lines written by a logrus Logger whose output fails are
+still counted.
+*/
+package kvprom
+
+import (
+	log "github.com/Sirupsen/logrus"
+	"github.com/gwatts/kvlog"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Config represents a configuration function to be passed to NewCollector
+// or Register.
+type Config func(c *config)
+
+type config struct {
+	namespace   string
+	constLabels prometheus.Labels
+}
+
+// Namespace sets the prefix of the metric names.  The default is "kvlog".
+func Namespace(ns string) Config {
+	return func(c *config) {
+		c.namespace = ns
+	}
+}
+
+// ConstLabels sets labels added to every metric, such as the name of the
+// service.
+func ConstLabels(labels prometheus.Labels) Config {
+	return func(c *config) {
+		c.constLabels = labels
+	}
+}
+
+// Collector is a prometheus.Collector holding counters of logging activity.
+// It implements kvlog.Observer, and must be registered with
+// kvlog.RegisterObserver to receive updates, as Register does.
+type Collector struct {
+	lines            *prometheus.CounterVec
+	bytes            prometheus.Counter
+	formatErrors     prometheus.Counter
+	dropped          *prometheus.CounterVec
+	deliveryFailures *prometheus.CounterVec
+}
+
+// NewCollector creates a Collector.  The lines counter is initialized for
+// every level, so that rates can be calculated before the first entry at a
+// level is logged.
+func NewCollector(cfgs ...Config) *Collector {
+	cfg := config{namespace: "kvlog"}
+	for _, f := range cfgs {
+		f(&cfg)
+	}
+	opts := func(name, help string) prometheus.CounterOpts {
+		return prometheus.CounterOpts{
+			Namespace:   cfg.namespace,
+			Name:        name,
+			Help:        help,
+			ConstLabels: cfg.constLabels,
+		}
+	}
+	c := &Collector{
+		lines:            prometheus.NewCounterVec(opts("lines_total", "Log lines formatted or written, by level."), []string{"level"}),
+		bytes:            prometheus.NewCounter(opts("bytes_total", "Bytes of log lines formatted or written.")),
+		formatErrors:     prometheus.NewCounter(opts("format_errors_total", "Log entries that couldn't be formatted.")),
+		dropped:          prometheus.NewCounterVec(opts("dropped_entries_total", "Log entries discarded by sinks and samplers, by reason."), []string{"reason"}),
+		deliveryFailures: prometheus.NewCounterVec(opts("delivery_failures_total", "Failures delivering log entries to a destination, by sink."), []string{"sink"}),
+	}
+	for _, level := range log.AllLevels {
+		c.lines.WithLabelValues(level.String())
+	}
+	return c
+}
+
+// Register creates a Collector, registers it with reg and adds it to the
+// observers notified by kvlog.  If reg is nil, prometheus.DefaultRegisterer
+// is used.
+func Register(reg prometheus.Registerer, cfgs ...Config) (*Collector, error) {
+	if reg == nil {
+		reg = prometheus.DefaultRegisterer
+	}
+	c := NewCollector(cfgs...)
+	if err := reg.Register(c); err != nil {
+		return nil, err
+	}
+	kvlog.RegisterObserver(c)
+	return c, nil
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.lines.Describe(ch)
+	c.bytes.Describe(ch)
+	c.formatErrors.Describe(ch)
+	c.dropped.Describe(ch)
+	c.deliveryFailures.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.lines.Collect(ch)
+	c.bytes.Collect(ch)
+	c.formatErrors.Collect(ch)
+	c.dropped.Collect(ch)
+	c.deliveryFailures.Collect(ch)
+}
+
+// LineWritten implements kvlog.Observer.
+func (c *Collector) LineWritten(level log.Level, n int) {
+	c.lines.WithLabelValues(level.String()).Inc()
+	c.bytes.Add(float64(n))
+}
+
+// FormatFailed implements kvlog.Observer.
+func (c *Collector) FormatFailed(err error) {
+	c.formatErrors.Inc()
+}
+
+// EntriesDropped implements kvlog.Observer.
+func (c *Collector) EntriesDropped(reason string, n int) {
+	c.dropped.WithLabelValues(reason).Add(float64(n))
+}
+
+// DeliveryFailed implements kvlog.Observer.
+func (c *Collector) DeliveryFailed(sink string, err error) {
+	c.deliveryFailures.WithLabelValues(sink).Inc()
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvprom
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/gwatts/kvlog"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestCollector(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	c, err := Register(reg, ConstLabels(prometheus.Labels{"app": "test"}))
+	require.Nil(t, err)
+	defer kvlog.UnregisterObserver(c)
+
+	var buf bytes.Buffer
+	logger := kvlog.NewLogger(&buf, kvlog.New())
+	logger.Info("one")
+	logger.Error("two")
+	logger.Debug("filtered")
+
+	cf := kvlog.New(kvlog.WithKeyPolicy(regexp.MustCompile(`^[a-z]+$`), kvlog.RejectBadKeys))
+	_, err = cf.Format(&log.Entry{Level: log.InfoLevel, Data: log.Fields{"Bad": 1}})
+	require.NotNil(t, err)
+
+	s := kvlog.NewSampler(ioutil.Discard, kvlog.SampleByField("id"), kvlog.SampleRate(log.InfoLevel, 1000000))
+	s.WriteLevel(log.InfoLevel, []byte(`ll="info" id="b" _msg="x"`+"\n"))
+
+	kvlog.NewLogger(failWriter{}, nil).Warn("lost")
+
+	expected := `
+# HELP kvlog_lines_total Log lines formatted or written, by level.
+# TYPE kvlog_lines_total counter
+kvlog_lines_total{app="test",level="debug"} 0
+kvlog_lines_total{app="test",level="error"} 1
+kvlog_lines_total{app="test",level="fatal"} 0
+kvlog_lines_total{app="test",level="info"} 1
+kvlog_lines_total{app="test",level="panic"} 0
+kvlog_lines_total{app="test",level="trace"} 0
+kvlog_lines_total{app="test",level="warning"} 1
+# HELP kvlog_format_errors_total Log entries that couldn't be formatted.
+# TYPE kvlog_format_errors_total counter
+kvlog_format_errors_total{app="test"} 1
+# HELP kvlog_dropped_entries_total Log entries discarded by sinks and samplers, by reason.
+# TYPE kvlog_dropped_entries_total counter
+kvlog_dropped_entries_total{app="test",reason="sampled"} 1
+# HELP kvlog_delivery_failures_total Failures delivering log entries to a destination, by sink.
+# TYPE kvlog_delivery_failures_total counter
+kvlog_delivery_failures_total{app="test",sink="output"} 1
+`
+	assert.Nil(t, testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"kvlog_lines_total", "kvlog_format_errors_total", "kvlog_dropped_entries_total", "kvlog_delivery_failures_total"))
+
+	size := buf.Len() + len(`2017-02-13T12:13:45.000Z ll="warning" _msg="lost"`+"\n")
+	assert.Equal(t, float64(size), testutil.ToFloat64(c.bytes))
+}
@@ -0,0 +1,47 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+// LazyValue is a field value computed by a function only when the entry
+// holding it is formatted.  It's created with Lazy.
+//
+// The function is held in a struct, rather than LazyValue being a function
+// type, as logrus discards fields with function values.
+type LazyValue struct {
+	f func() interface{}
+}
+
+// Lazy returns a value whose function f is only called if the entry it's
+// logged with is formatted, so that expensive values, such as a serialized
+// request body or a diff, cost nothing for entries discarded because of
+// their level, or whose key is redacted.  f may return any value that could
+// be logged directly, including a Loggable.
+//
+// eg.
+//
+//	log.WithField("body", kvlog.Lazy(func() interface{} {
+//	    return dumpBody(req)
+//	})).Debug("received request")
+//
+// f is called each time the entry is formatted, so it may be called more
+// than once if the entry is written by several formatters or hooks.  Entries
+// dropped by a writer such as Sampler have already been formatted.
+func Lazy(f func() interface{}) LazyValue {
+	return LazyValue{f}
+}
+
+// resolveLazy returns the value computed by v, if it's a LazyValue.
+func resolveLazy(v interface{}) interface{} {
+	for {
+		l, ok := v.(LazyValue)
+		if !ok {
+			return v
+		}
+		if l.f == nil {
+			return nil
+		}
+		v = l.f()
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestLazy(t *testing.T) {
+	var calls int
+	value := Lazy(func() interface{} {
+		calls++
+		return Ordered(".size", 42, ".type", "json")
+	})
+
+	var buf bytes.Buffer
+	logger := log.New()
+	logger.Out = &buf
+	logger.Formatter = New(WithRedactedKeys("secret"))
+	logger.Level = log.InfoLevel
+
+	logger.WithField("body", value).Debug("filtered")
+	assert.Equal(t, 0, calls)
+	assert.Equal(t, "", buf.String())
+
+	logger.WithField("secret", value).Info("redacted")
+	assert.Equal(t, 0, calls)
+	assert.Contains(t, buf.String(), ` secret="[REDACTED]" _msg="redacted"`)
+
+	buf.Reset()
+	logger.WithField("body", value).Info("kept")
+	assert.Equal(t, 1, calls)
+	assert.Contains(t, buf.String(), ` body.size=42 body.type="json" _msg="kept"`)
+}
+
+func TestLazyFormats(t *testing.T) {
+	value := Lazy(func() interface{} { return "abc" })
+	tests := []struct {
+		name     string
+		cfg      Config
+		expected string
+	}{
+		{"kv", nil, ` v="abc" `},
+		{"json", WithJSON(), `"v":"abc"`},
+		{"hashed", WithHashedKeys([]byte("k"), "v"), ` v="` + HashedValue([]byte("k"), "abc") + `"`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var cfgs []Config
+			if test.cfg != nil {
+				cfgs = append(cfgs, test.cfg)
+			}
+			result, _ := New(cfgs...).Format(&log.Entry{Time: testTime, Level: log.InfoLevel, Data: log.Fields{"v": value}, Message: "msg"})
+			assert.Contains(t, string(result), test.expected)
+		})
+	}
+}
+
+func TestLazyTypedFields(t *testing.T) {
+	var calls int
+	value := Lazy(func() interface{} {
+		calls++
+		return 12
+	})
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, nil)
+	logger.Log(log.DebugLevel, "filtered", Any("n", value))
+	assert.Equal(t, 0, calls)
+	logger.Log(log.InfoLevel, "kept", Any("n", value))
+	assert.Equal(t, 1, calls)
+	assert.Contains(t, buf.String(), ` n=12 _msg="kept"`)
+}
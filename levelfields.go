@@ -0,0 +1,49 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+// WithLevelFields restricts fields whose keys match any of keys to entries
+// logged at level or a more verbose level, so that detail such as SQL
+// queries or request payloads can be logged from the same call site as an
+// entry's other fields, but only appears when debugging.
+//
+// eg.
+//
+//	kvlog.New(kvlog.WithLevelFields(log.DebugLevel, "sql_query", "raw_payload"))
+//
+// includes sql_query in debug and trace entries, but strips it from info,
+// warning and error entries.  Keys may be exact names or glob patterns, as
+// for WithRedactedKeys, and are matched against the keys produced by
+// Loggable values as well as the keys they're logged with.
+func WithLevelFields(level log.Level, keys ...string) Config {
+	return func(kvf *Formatter) {
+		kvf.levelFields = append(kvf.levelFields[:len(kvf.levelFields):len(kvf.levelFields)], levelFields{
+			level: level,
+			keys:  (*keyMatcher)(nil).with(keys, false),
+		})
+	}
+}
+
+// levelFields holds keys that are only emitted at level or more verbose
+// levels.
+type levelFields struct {
+	level log.Level
+	keys  *keyMatcher
+}
+
+// hiddenAt reports whether a field with key k should be omitted from an
+// entry logged at level.
+func (cf *Formatter) hiddenAt(k string, level log.Level) bool {
+	for _, lf := range cf.levelFields {
+		if level < lf.level && lf.keys.match(k) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestLevelFields(t *testing.T) {
+	cf := New(
+		WithLevelFields(log.DebugLevel, "sql_query", "*.payload"),
+		WithLevelFields(log.InfoLevel, "rows"))
+	data := log.Fields{
+		"sql_query": "select 1",
+		"req":       Ordered(".id", 7, ".payload", "{}"),
+		"rows":      1,
+		"status":    "ok",
+	}
+	tests := []struct {
+		level    log.Level
+		expected string
+	}{
+		{log.TraceLevel, `req.id=7 req.payload="{}" rows=1 sql_query="select 1" status="ok"`},
+		{log.DebugLevel, `req.id=7 req.payload="{}" rows=1 sql_query="select 1" status="ok"`},
+		{log.InfoLevel, `req.id=7 rows=1 status="ok"`},
+		{log.ErrorLevel, `req.id=7 status="ok"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.level.String(), func(t *testing.T) {
+			result, err := cf.Format(&log.Entry{Time: testTime, Level: test.level, Data: data})
+			require.Nil(t, err)
+			assert.Equal(t, `2017-02-13T12:13:45.000Z ll="`+test.level.String()+`" `+test.expected, strings.TrimSuffix(string(result), "\n"))
+		})
+	}
+}
+
+func TestLevelFieldsTypedFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, New(WithLevelFields(log.DebugLevel, "sql_query")))
+	logger.SetLevel(log.DebugLevel)
+	for _, level := range []log.Level{log.DebugLevel, log.InfoLevel} {
+		logger.Log(level, "query", String("sql_query", "select 1"), Int("rows", 1))
+	}
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.Regexp(t, ` ll="debug" rows=1 sql_query="select 1" _msg="query"$`, lines[0])
+	assert.Regexp(t, ` ll="info" rows=1 _msg="query"$`, lines[1])
+}
@@ -0,0 +1,202 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"unicode/utf8"
+)
+
+// LineLimit selects how WithMaxLineLength shortens an entry that's too
+// long.
+type LineLimit int
+
+const (
+	// TruncateLine drops the fields that don't fit and shortens string
+	// values to fit, ending them with "...".  A _truncated=true field is
+	// added after the level.
+	TruncateLine LineLimit = iota
+
+	// SplitLine writes the fields that don't fit onto continuation lines,
+	// splitting long string values across several lines.  Each line has a
+	// _lid field, holding an ID shared by all of the entry's lines, and a
+	// _part field numbering the lines from 1, added after the level.  A
+	// split value can be reassembled by concatenating the values of its key
+	// in order of _part.
+	SplitLine
+)
+
+// WithMaxLineLength limits the length of each line, including its
+// trailing newline, to n bytes, such as the maximum accepted by a log
+// collector, shortening or splitting longer entries according to policy.
+// The timestamp, level and caller are always included, so n should allow
+// room for them.
+//
+// Only the default k=v format is limited; JSON and other output modes are
+// unaffected.
+func WithMaxLineLength(n int, policy LineLimit) Config {
+	return func(kvf *Formatter) {
+		kvf.maxLine = n
+		kvf.lineLimit = policy
+	}
+}
+
+var (
+	truncatedMarker = []byte(" _truncated=true")
+	truncatedSuffix = "..."
+)
+
+// formatLong renders an entry that exceeds the maximum line length.
+// entryFields are the fields already resolved from the entry by
+// entryFields, so that values aren't computed, nor fields counted or
+// checked, a second time.
+func (cf *Formatter) formatLong(b *bytes.Buffer, entry *Record, fc *fieldConfig, entryFields []field) {
+	fields := append(append([]field{}, cf.entryConstants(fc, entryFields)...), entryFields...)
+	if entry.Message != "" {
+		fields = append(fields, field{"_msg", entry.Message})
+	}
+	if cf.lineLimit == SplitLine {
+		cf.splitLine(b, entry, fields)
+		return
+	}
+
+	cf.writeLineHeader(b, entry)
+	b.Write(truncatedMarker)
+	room := cf.lineMax() - b.Len() - 1
+	var chunk bytes.Buffer
+	for _, f := range fields {
+		chunk.Reset()
+		cf.emit(&chunk, f.key, f.value, 0)
+		if chunk.Len() <= room {
+			b.Write(chunk.Bytes())
+			room -= chunk.Len()
+			continue
+		}
+		if s, ok := quotedString(f.value); ok {
+			if part, n := cf.fitString(f.key, s, truncatedSuffix, room); n > 0 {
+				b.Write(part)
+				room -= len(part)
+			}
+		}
+	}
+	b.WriteByte('\n')
+}
+
+// splitLine renders fields over as many lines as needed to keep each
+// within the maximum length.
+func (cf *Formatter) splitLine(b *bytes.Buffer, entry *Record, fields []field) {
+	lid := fmt.Sprintf("%016x", rand.Uint64())
+	part := 0
+	var lineStart, headerLen int
+	newLine := func() {
+		if part > 0 {
+			b.WriteByte('\n')
+		}
+		part++
+		lineStart = b.Len()
+		cf.writeLineHeader(b, entry)
+		b.WriteString(` _lid="`)
+		b.WriteString(lid)
+		b.WriteString(`" _part=`)
+		b.WriteString(strconv.Itoa(part))
+		headerLen = b.Len() - lineStart
+	}
+	room := func() int { return cf.lineMax() - (b.Len() - lineStart) - 1 }
+	empty := func() bool { return b.Len()-lineStart == headerLen }
+
+	newLine()
+	var chunk bytes.Buffer
+	for _, f := range fields {
+		chunk.Reset()
+		cf.emit(&chunk, f.key, f.value, 0)
+		if chunk.Len() > room() && !empty() {
+			newLine()
+		}
+		s, ok := quotedString(f.value)
+		if chunk.Len() <= room() || !ok {
+			// a value that isn't a string is written whole, even if it
+			// makes the line too long
+			b.Write(chunk.Bytes())
+			continue
+		}
+		for len(s) > 0 {
+			part, n := cf.fitString(f.key, s, "", room())
+			if n == 0 {
+				// not even the key fits on an empty line
+				b.Write(chunk.Bytes())
+				break
+			}
+			b.Write(part)
+			if s = s[n:]; len(s) > 0 {
+				newLine()
+			}
+		}
+	}
+	b.WriteByte('\n')
+}
+
+// lineMax returns the maximum length of a line before any checksum is
+// added.
+func (cf *Formatter) lineMax() int {
+	if cf.checksum {
+		return cf.maxLine - checksumLen
+	}
+	return cf.maxLine
+}
+
+// writeLineHeader writes the timestamp, level and caller that begin every
+// line.
+func (cf *Formatter) writeLineHeader(b *bytes.Buffer, entry *Record) {
+	cf.emitTimestamp(b, entry.Time)
+	cf.emitLogLevel(b, entry.level())
+	if cf.includeCaller {
+		cf.emitCaller(b, entry)
+	}
+}
+
+// quotedString returns the string form of v if emitValue renders it as a
+// quoted string.
+func quotedString(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case Loggable, OrderedFields:
+		return "", false
+	case fmt.Stringer, string, error, []byte:
+	case *string:
+		if v == nil {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	return valueString(v), true
+}
+
+// fitString returns the longest prefix of s, followed by suffix, that can
+// be rendered as a key=value pair within room bytes, along with the length
+// of the prefix.  n is 0 if none of s fits.
+func (cf *Formatter) fitString(key, s, suffix string, room int) (chunk []byte, n int) {
+	key = sanitizeKey(key)
+	n = room - len(key) - len(suffix) - 4 // space, equals and quotes
+	if n > len(s) {
+		n = len(s)
+	}
+	for n > 0 {
+		for n > 0 && n < len(s) && !utf8.RuneStart(s[n]) {
+			n--
+		}
+		if n == 0 {
+			break
+		}
+		chunk = cf.appendString([]byte(" "+key+"="), s[:n]+suffix)
+		if len(chunk) <= room {
+			return chunk, n
+		}
+		n -= len(chunk) - room
+	}
+	return nil, 0
+}
@@ -0,0 +1,99 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func longEntry() *log.Entry {
+	return &log.Entry{
+		Time:    testTime,
+		Level:   log.InfoLevel,
+		Message: "request failed",
+		Data: log.Fields{
+			"body":   strings.Repeat("abcdefghij", 30) + "é",
+			"status": 500,
+		},
+	}
+}
+
+func TestMaxLineLengthShort(t *testing.T) {
+	cf := New(WithMaxLineLength(1000, TruncateLine))
+	out, err := cf.Format(longEntry())
+	require.Nil(t, err)
+	expected, _ := New().Format(longEntry())
+	assert.Equal(t, string(expected), string(out))
+}
+
+func TestMaxLineLengthTruncate(t *testing.T) {
+	cf := New(WithMaxLineLength(200, TruncateLine), WithConstantField("app", "billing"))
+	out, err := cf.Format(longEntry())
+	require.Nil(t, err)
+
+	assert.True(t, len(out) <= 200, "line too long: %d", len(out))
+	entry, err := Parse(bytes.TrimRight(out, "\n"))
+	require.Nil(t, err)
+	assert.Equal(t, true, entry.Fields["_truncated"])
+	assert.Equal(t, "billing", entry.Fields["app"])
+	body := entry.Fields["body"].(string)
+	assert.True(t, strings.HasPrefix(body, "abcdefghij"))
+	assert.True(t, strings.HasSuffix(body, "..."))
+
+	// fields that no longer fit are dropped
+	assert.NotContains(t, entry.Fields, "status")
+	assert.Equal(t, "", entry.Message)
+}
+
+func TestMaxLineLengthSplit(t *testing.T) {
+	e := longEntry()
+	cf := New(WithMaxLineLength(120, SplitLine))
+	out, err := cf.Format(e)
+	require.Nil(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(string(out), "\n"), "\n")
+	require.True(t, len(lines) > 1)
+
+	var body string
+	var lid interface{}
+	for i, line := range lines {
+		assert.True(t, len(line)+1 <= 120, "line %d too long: %d", i, len(line)+1)
+		entry, err := Parse([]byte(line))
+		require.Nil(t, err)
+		if i == 0 {
+			lid = entry.Fields["_lid"]
+		}
+		assert.Equal(t, lid, entry.Fields["_lid"])
+		assert.EqualValues(t, i+1, entry.Fields["_part"])
+		if v, ok := entry.Fields["body"]; ok {
+			body += v.(string)
+		}
+		if i == len(lines)-1 {
+			assert.Equal(t, "request failed", entry.Message)
+			assert.EqualValues(t, 500, entry.Fields["status"])
+		}
+	}
+	assert.Equal(t, e.Data["body"], body)
+}
+
+func TestMaxLineLengthResolvesOnce(t *testing.T) {
+	calls := 0
+	cf := New(WithMaxLineLength(100, TruncateLine), WithDeniedKeys("secret"))
+	entry := longEntry()
+	entry.Data["lazy"] = Lazy(func() interface{} { calls++; return "value" })
+	entry.Data["secret"] = "x"
+	_, err := cf.Format(entry)
+	require.Nil(t, err)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, int64(1), cf.SuppressedFields())
+}
@@ -25,10 +25,14 @@ package kvlog
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
 	"runtime"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	log "github.com/Sirupsen/logrus"
@@ -38,7 +42,10 @@ var (
 	defaultStackDepth = 5
 )
 
-// Config represents a configuration function to be passed to New.
+// Config represents a configuration function to be passed to New or Child.
+// Config functions must not be applied to a Formatter that's in use; see
+// SetPrimaryFields and AddConstantField for changes that are safe to make
+// while entries are being formatted.
 type Config func(kvf *Formatter)
 
 // WithPrimaryFields specifies a number of field names that should always
@@ -47,7 +54,18 @@ type Config func(kvf *Formatter)
 // always appear that need to be seen quickly such as "status" or "action".
 func WithPrimaryFields(field ...string) Config {
 	return func(kvf *Formatter) {
-		kvf.primaryFields = append([]string{}, field...)
+		kvf.fields().primaryFields = append([]string{}, field...)
+	}
+}
+
+// WithUnsortedFields causes fields other than primary fields to be emitted
+// in no particular order, rather than sorted, saving the cost of sorting
+// their keys.  Entries with the same fields may list them in a different
+// order each time.  Typed fields passed to Logger.Log are emitted in the
+// order given.
+func WithUnsortedFields() Config {
+	return func(kvf *Formatter) {
+		kvf.unsorted = true
 	}
 }
 
@@ -55,14 +73,37 @@ func WithPrimaryFields(field ...string) Config {
 // in every log entry before any others (including primary fields).
 func WithConstantField(key string, value interface{}) Config {
 	return func(kvf *Formatter) {
-		var buf bytes.Buffer
-		kvf.emit(&buf, key, value, 0)
-		kvf.constantFields = append(kvf.constantFields, buf.Bytes())
+		fc := kvf.fields()
+		fc.constants = appendField(fc.constants, key, value)
+	}
+}
+
+// WithSystemFields adds hostname, pid and app constant fields identifying
+// the process, where app is the base name of the running executable.  The
+// values are resolved once, when the Formatter is created.
+func WithSystemFields() Config {
+	return func(kvf *Formatter) {
+		hostname, err := os.Hostname()
+		if err != nil {
+			hostname = "unknown"
+		}
+		app := filepath.Base(os.Args[0])
+		if exe, err := os.Executable(); err == nil {
+			app = filepath.Base(exe)
+		}
+		fc := kvf.fields()
+		fc.constants = appendField(fc.constants, "hostname", hostname)
+		fc.constants = appendField(fc.constants, "pid", os.Getpid())
+		fc.constants = appendField(fc.constants, "app", app)
 	}
 }
 
 // IncludeCaller causes the Formatter to include the calling function name
 // in each log entry.
+//
+// If the logrus Logger has ReportCaller set, the caller it reports is used;
+// otherwise the caller is found by searching the stack for the first
+// function outside of this package and the logging package calling it.
 func IncludeCaller() Config {
 	return func(kvf *Formatter) {
 		kvf.includeCaller = true
@@ -71,71 +112,291 @@ func IncludeCaller() Config {
 
 // Formatter emits plain text log lines with k="v" pairs.
 type Formatter struct {
-	primaryFields  []string
-	constantFields [][]byte
-	includeCaller  bool
-	calcDepthOnce  sync.Once
-	stackDepth     int
+	suppressed    int64        // accessed atomically; first for alignment
+	fieldCfg      atomic.Value // *fieldConfig
+	updateMu      sync.Mutex   // serializes runtime changes
+	includeCaller bool
+	color         bool
+	calcDepthOnce sync.Once
+	stackDepth    int
+	encode        encoder
+	maxLine       int
+	lineLimit     LineLimit
+	checksum      bool
+	unsorted      bool
+	quoter        func(dst []byte, s string) []byte
+	redact        *keyMatcher
+	hashers       []valueHasher
+	allow         *keyMatcher
+	deny          *keyMatcher
+	scrub         []ScrubRule
+	strict        bool
+	maxFields     int
+	keys          *keyTracker
+	onError       func(error)
+	levelFields   []levelFields
+	levels        atomic.Value // *minLevels
+	schema        *schemaConfig
+	keyPolicy     *keyPolicy
+	dupKeys       *duplicateKeys
+	clock         func() time.Time
+	callerFunc    func(name string, line int) (string, int)
+	omitEmpty     EmptyKind
+	placeholder   interface{}
+}
+
+// encoder renders an entry in an output mode other than the default k=v
+// format.
+type encoder func(cf *Formatter, b *bytes.Buffer, entry *Record)
+
+// field is a single key/value pair to be included in a log entry.
+type field struct {
+	key   string
+	value interface{}
+}
+
+// appendField appends k and v to fields, expanding Loggable and
+// OrderedFields values into their individual prefixed keys.
+func appendField(fields []field, k string, v interface{}) []field {
+	v = resolveLazy(v)
+	if v, ok := v.(OrderedFields); ok {
+		for _, kv := range v {
+			fields = appendField(fields, k+kv.Key, kv.Value)
+		}
+		return fields
+	}
+	if v, ok := v.(Loggable); ok {
+		kvs := v.LogValues()
+		keys := make([]string, 0, len(kvs))
+		for k := range kvs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, sk := range keys {
+			fields = appendField(fields, k+sk, kvs[sk])
+		}
+		return fields
+	}
+	return append(fields, field{k, v})
 }
 
 // New creates a new Formatter.
 func New(cfgs ...Config) *Formatter {
 	kvf := new(Formatter)
+	fc := &fieldConfig{keyOrders: new(keyOrderCache)}
+	kvf.fieldCfg.Store(fc)
 	for _, cfg := range cfgs {
 		cfg(kvf)
 	}
+	kvf.renderConstants(fc)
 	return kvf
 }
 
-// Format a single log entry into a plain text log line.
+// Child creates a new Formatter that inherits the primary fields, constant
+// fields and other settings of cf, and then applies cfgs.  cf is unchanged.
+//
+// eg.
+//
+//	cacheFormatter := formatter.Child(kvlog.WithConstantField("component", "cache"))
+//
+// Constant fields added to the child are included after those of the
+// parent, except that a constant field with the same key as one of the
+// parent's replaces the parent's value.  WithPrimaryFields replaces the
+// parent's primary fields.
+func (cf *Formatter) Child(cfgs ...Config) *Formatter {
+	pfc := cf.fields()
+	kvf := &Formatter{
+		includeCaller: cf.includeCaller,
+		color:         cf.color,
+		encode:        cf.encode,
+		maxLine:       cf.maxLine,
+		lineLimit:     cf.lineLimit,
+		checksum:      cf.checksum,
+		unsorted:      cf.unsorted,
+		quoter:        cf.quoter,
+		redact:        cf.redact,
+		hashers:       cf.hashers,
+		allow:         cf.allow,
+		deny:          cf.deny,
+		scrub:         cf.scrub,
+		strict:        cf.strict,
+		maxFields:     cf.maxFields,
+		keys:          cf.keys,
+		onError:       cf.onError,
+		levelFields:   cf.levelFields,
+		schema:        cf.schema,
+		keyPolicy:     cf.keyPolicy,
+		dupKeys:       cf.dupKeys,
+		clock:         cf.clock,
+		callerFunc:    cf.callerFunc,
+		omitEmpty:     cf.omitEmpty,
+		placeholder:   cf.placeholder,
+	}
+	fc := &fieldConfig{
+		primaryFields: append([]string{}, pfc.primaryFields...),
+		constants:     append([]field{}, pfc.constants...),
+		keyOrders:     new(keyOrderCache),
+	}
+	kvf.fieldCfg.Store(fc)
+	if m := cf.minLevels(); m != nil {
+		kvf.levels.Store(m)
+	}
+	for _, cfg := range cfgs {
+		cfg(kvf)
+	}
+	fc.constants = dedupeFields(fc.constants)
+	kvf.renderConstants(fc)
+	return kvf
+}
+
+// renderConstants pre-renders the constant fields of fc for the k=v format.
+func (cf *Formatter) renderConstants(fc *fieldConfig) {
+	fc.constantFields = nil
+	for _, f := range fc.constants {
+		var buf bytes.Buffer
+		cf.emit(&buf, f.key, f.value, 0)
+		fc.constantFields = append(fc.constantFields, buf.Bytes())
+	}
+}
+
+// dedupeFields returns fields with only the first occurrence of each key,
+// holding the value of the key's last occurrence.
+func dedupeFields(fields []field) []field {
+	pos := make(map[string]int, len(fields))
+	result := fields[:0]
+	for _, f := range fields {
+		if i, ok := pos[f.key]; ok {
+			result[i].value = f.value
+			continue
+		}
+		pos[f.key] = len(result)
+		result = append(result, f)
+	}
+	return result
+}
+
+// Format a single log entry into a plain text log line.  If logrus has
+// supplied a buffer in entry.Buffer the line is appended to it, avoiding an
+// allocation, and the returned slice refers to the buffer's contents.
 func (cf *Formatter) Format(entry *log.Entry) ([]byte, error) {
-	var buf bytes.Buffer
+	b := entry.Buffer
+	if b == nil {
+		b = new(bytes.Buffer)
+	}
+	return cf.render(b, cf.record(entry))
+}
 
-	cf.emitTimestamp(&buf, entry.Time)
-	cf.emitLogLevel(&buf, entry.Level)
-	if cf.includeCaller {
-		cf.emitCaller(&buf)
+// render appends r to b, notifying observers of the result, and returns the
+// contents of b.
+func (cf *Formatter) render(b *bytes.Buffer, r *Record) ([]byte, error) {
+	start := b.Len()
+	if err := cf.format(b, r); err != nil {
+		observeFormatError(err)
+		return nil, err
+	}
+	if n := b.Len() - start; n > 0 {
+		observeLine(r.level(), n)
 	}
+	return b.Bytes(), nil
+}
 
-	for _, f := range cf.constantFields {
-		buf.Write(f)
+// format renders entry to b in the configured output mode.  Nothing is
+// written if the entry is below the minimum level for its source, or if
+// it's rejected by the policy set by WithKeyPolicy, in which case the error
+// is returned.
+func (cf *Formatter) format(b *bytes.Buffer, entry *Record) error {
+	if !cf.levelEnabled(entry, nil) {
+		return nil
+	}
+	if err := cf.checkKeys(entry); err != nil {
+		return err
+	}
+	if cf.encode != nil {
+		cf.encode(cf, b, entry)
+		return nil
 	}
 
-	var skip map[string]struct{}
-	if len(cf.primaryFields) > 0 {
-		skip = make(map[string]struct{})
-		for _, k := range cf.primaryFields {
-			if v, ok := entry.Data[k]; ok {
-				skip[k] = struct{}{}
-				cf.emit(&buf, k, v, 0)
-			}
-		}
+	start := b.Len()
+	if cf.color {
+		b.WriteString(colorFaint)
+		cf.emitTimestamp(b, entry.Time)
+		b.WriteString(colorReset)
+	} else {
+		cf.emitTimestamp(b, entry.Time)
+	}
+	cf.emitLogLevel(b, entry.level())
+	if cf.includeCaller {
+		cf.emitCaller(b, entry)
 	}
 
-	keys := make([]string, 0, len(entry.Data))
-	for k := range entry.Data {
-		if _, ok := skip[k]; ok {
+	fc := cf.fields()
+	fields := cf.entryFields(fc, entry)
+	for i, f := range fc.constantFields {
+		if cf.dupKeys != nil && cf.constantReplaced(fc.constants[i].key, fields) {
 			continue
 		}
-		keys = append(keys, k)
+		b.Write(f)
 	}
-	sort.Strings(keys)
 
-	for _, k := range keys {
-		cf.emit(&buf, k, entry.Data[k], 0)
+	for _, f := range fields {
+		cf.emit(b, f.key, f.value, 0)
 	}
 
 	if entry.Message != "" {
-		cf.emit(&buf, "_msg", entry.Message, 0)
+		cf.emit(b, "_msg", entry.Message, 0)
 	}
 
-	buf.Write([]byte("\n"))
+	b.Write([]byte("\n"))
 
-	return buf.Bytes(), nil
+	if cf.maxLine > 0 && !cf.color && b.Len()-start > cf.lineMax() {
+		b.Truncate(start)
+		cf.formatLong(b, entry, fc, fields)
+	}
+	if cf.checksum && !cf.color {
+		addChecksums(b, start)
+	}
+	return nil
+}
+
+// entryFields returns the primary fields of the entry, as set in fc,
+// followed by the remaining fields in sorted order, unless
+// WithUnsortedFields was used, with repeated keys resolved as set by
+// WithDuplicateKeys, limited as set by WithMaxFields, checked against any
+// schema set by WithSchema and with placeholders for absent primary fields
+// set by WithPrimaryPlaceholder.  Constant fields are not included; see
+// entryConstants.
+func (cf *Formatter) entryFields(fc *fieldConfig, entry *Record) []field {
+	fields := make([]field, 0, len(entry.Data))
+	if len(entry.Data) == 0 {
+		return cf.fillPrimary(fc, cf.checkSchema(fc, fields))
+	}
+	if cf.unsorted {
+		for _, k := range fc.primaryFields {
+			if v, ok := entry.Data[k]; ok {
+				fields = cf.appendEntryField(fields, entry.level(), k, v)
+			}
+		}
+		for k, v := range entry.Data {
+			if len(fc.primaryFields) > 0 && isPrimary(fc.primaryFields, k) {
+				continue
+			}
+			fields = cf.appendEntryField(fields, entry.level(), k, v)
+		}
+		return cf.fillPrimary(fc, cf.checkSchema(fc, cf.limitFields(cf.resolveDuplicates(fc, fields))))
+	}
+	order := fc.keyOrders.get(entry.Data, fc.primaryFields)
+	for _, k := range order.primary {
+		fields = cf.appendEntryField(fields, entry.level(), k, entry.Data[k])
+	}
+	for _, k := range order.keys {
+		fields = cf.appendEntryField(fields, entry.level(), k, entry.Data[k])
+	}
+	return cf.fillPrimary(fc, cf.checkSchema(fc, cf.limitFields(cf.resolveDuplicates(fc, fields))))
 }
 
 func (cf *Formatter) emitTimestamp(b *bytes.Buffer, t time.Time) {
-	buf := make([]byte, 0, 20)
+	var scratch [24]byte
+	buf := scratch[:0]
 
 	year, month, day := t.UTC().Date()
 	hour, min, sec := t.UTC().Clock()
@@ -159,6 +420,13 @@ func (cf *Formatter) emitTimestamp(b *bytes.Buffer, t time.Time) {
 }
 
 func (cf *Formatter) emit(b *bytes.Buffer, k string, v interface{}, n int) {
+	v = resolveLazy(v)
+	if v, ok := v.(OrderedFields); ok {
+		for _, kv := range v {
+			cf.emit(b, k+kv.Key, kv.Value, n+1)
+		}
+		return
+	}
 	if v, ok := v.(Loggable); ok {
 		kvs := v.LogValues()
 		keys := make([]string, 0, len(kvs))
@@ -173,89 +441,230 @@ func (cf *Formatter) emit(b *bytes.Buffer, k string, v interface{}, n int) {
 	}
 
 	if n > -1 {
-		b.Write([]byte{' '})
+		b.WriteByte(' ')
+	}
+
+	if cf.color {
+		cf.emitColor(b, k, v)
+		return
 	}
 
-	b.Write([]byte(k))
-	b.Write([]byte{'='})
+	b.WriteString(sanitizeKey(k))
+	b.WriteByte('=')
+	cf.emitValue(b, v)
+}
 
+func (cf *Formatter) emitValue(b *bytes.Buffer, v interface{}) {
+	// common types are appended directly rather than through fmt, which
+	// accounts for most of the cost of formatting an entry
+	var scratch [64]byte
 	switch data := v.(type) {
+	case time.Duration:
+		if cf.quoter != nil {
+			cf.writeString(b, data.String())
+		} else {
+			// kept separate so the string doesn't escape on the default path
+			writeQuoted(b, data.String())
+		}
+
 	case fmt.Stringer:
-		fmt.Fprintf(b, "%+q", data)
+		// fmt recovers from String methods that panic, eg. on a nil receiver
+		if cf.quoter != nil {
+			cf.writeString(b, fmt.Sprint(data))
+		} else {
+			fmt.Fprintf(b, "%+q", data)
+		}
 
 	case string:
-		fmt.Fprintf(b, "%+q", data)
+		cf.writeString(b, data)
 
 	case *string:
 		if data == nil {
-			b.Write([]byte("<nil>"))
+			b.WriteString("<nil>")
 		} else {
-			fmt.Fprintf(b, "%+q", *data)
+			cf.writeString(b, *data)
 		}
 
 	case error:
-		fmt.Fprintf(b, "%+q", data.Error())
+		cf.writeString(b, data.Error())
 
 	case []byte:
-		fmt.Fprintf(b, "%+q", data)
+		cf.writeString(b, string(data))
 
 	case Marshaler:
-		b.Write([]byte(data.MarshalLogValue()))
+		cf.writeRaw(b, marshalValue(data))
+
+	case int:
+		b.Write(strconv.AppendInt(scratch[:0], int64(data), 10))
+	case int8:
+		b.Write(strconv.AppendInt(scratch[:0], int64(data), 10))
+	case int16:
+		b.Write(strconv.AppendInt(scratch[:0], int64(data), 10))
+	case int32:
+		b.Write(strconv.AppendInt(scratch[:0], int64(data), 10))
+	case int64:
+		b.Write(strconv.AppendInt(scratch[:0], data, 10))
+	case uint:
+		b.Write(strconv.AppendUint(scratch[:0], uint64(data), 10))
+	case uint8:
+		b.Write(strconv.AppendUint(scratch[:0], uint64(data), 10))
+	case uint16:
+		b.Write(strconv.AppendUint(scratch[:0], uint64(data), 10))
+	case uint32:
+		b.Write(strconv.AppendUint(scratch[:0], uint64(data), 10))
+	case uint64:
+		b.Write(strconv.AppendUint(scratch[:0], data, 10))
+	case float32:
+		b.Write(strconv.AppendFloat(scratch[:0], float64(data), 'g', -1, 32))
+	case float64:
+		b.Write(strconv.AppendFloat(scratch[:0], data, 'g', -1, 64))
+	case bool:
+		b.Write(strconv.AppendBool(scratch[:0], data))
+
+	default:
+		if cf.strict {
+			cf.writeRaw(b, fmt.Sprint(data))
+		} else {
+			fmt.Fprintf(b, "%v", data)
+		}
+	}
+}
 
+// valueString returns the unquoted string form of v.
+func valueString(v interface{}) string {
+	switch data := resolveLazy(v).(type) {
+	case fmt.Stringer:
+		// fmt recovers from String methods that panic, eg. on a nil receiver
+		return fmt.Sprint(data)
+	case string:
+		return data
+	case *string:
+		if data == nil {
+			return "<nil>"
+		}
+		return *data
+	case error:
+		return data.Error()
+	case []byte:
+		return string(data)
+	case Marshaler:
+		return marshalValue(data)
 	default:
-		fmt.Fprintf(b, "%v", data)
+		return fmt.Sprintf("%v", data)
 	}
 }
 
 func (cf *Formatter) emitLogLevel(b *bytes.Buffer, level log.Level) {
-	fmt.Fprintf(b, " ll=%q", level)
+	if cf.color {
+		cf.emitColorLevel(b, level)
+		return
+	}
+	b.WriteString(" ll=")
+	cf.writeString(b, levelName(level))
+}
+
+// levelName returns level.String() without the allocation it makes.
+func levelName(level log.Level) string {
+	switch level {
+	case log.PanicLevel:
+		return "panic"
+	case log.FatalLevel:
+		return "fatal"
+	case log.ErrorLevel:
+		return "error"
+	case log.WarnLevel:
+		return "warning"
+	case log.InfoLevel:
+		return "info"
+	case log.DebugLevel:
+		return "debug"
+	}
+	return level.String()
 }
 
 func (cf *Formatter) findCaller() (string, int) {
-	callers := make([]uintptr, 10)
-	runtime.Callers(3, callers) // set to 1 to skip Callers itself
+	_, name, line := cf.findCallerFrame()
+	return name, line
+}
+
+// findCallerFrame returns the package, function name and line number of
+// the first function outside of this package and the logging package
+// calling it.
+func (cf *Formatter) findCallerFrame() (string, string, int) {
+	callers := make([]uintptr, 16)
+	n := runtime.Callers(3, callers) // set to 1 to skip Callers itself
+	frames := runtime.CallersFrames(callers[:n])
 
 	callingPackage := ""
-	thispkg, _ := pkgnameForPC(callers[0])
+	thispkg := ""
 	root := runtime.GOROOT()
 
-	for _, pc := range callers {
-		f := runtime.FuncForPC(pc)
-		if f == nil {
-			continue
+	// entries logged by a native Logger have no intermediate logging package
+	// between this package and the caller.
+	direct := false
+
+	for {
+		frame, more := frames.Next()
+		pkg, funcname := pkgname(frame.Function)
+		if thispkg == "" {
+			thispkg = pkg
 		}
-		pkg, funcname := pkgname(f.Name())
-		fn, _ := f.FileLine(pc)
 
 		switch {
+		case frame.Function == "":
 		case pkg == thispkg:
+			if strings.HasPrefix(funcname, "(*Logger).") || strings.HasPrefix(funcname, "(*Event).") {
+				direct = true
+			}
 		case callingPackage != "" && pkg == callingPackage:
-		case strings.HasPrefix(fn, root): // stdlib
-		case callingPackage == "":
+		case strings.HasPrefix(frame.File, root): // stdlib
+		case callingPackage == "" && !direct:
 			callingPackage = pkg
 		default:
-			_, line := f.FileLine(pc)
-			return funcname, line
+			return pkg, funcname, frame.Line
+		}
+		if !more {
+			break
 		}
 	}
-	return "", -1
+	return "", "", -1
 }
 
-func (cf *Formatter) emitCaller(b *bytes.Buffer) {
-	name, line := cf.findCaller()
+func (cf *Formatter) emitCaller(b *bytes.Buffer, entry *Record) {
+	name, line := cf.caller(entry)
+	if cf.color {
+		if name == "" {
+			name = "unknown"
+		}
+		cf.emit(b, "srcfnc", RawLogString(strconv.Quote(name)), 0)
+		if line > -1 {
+			cf.emit(b, "srcline", line, 0)
+		}
+		return
+	}
 	if name == "" {
-		b.Write([]byte(" srcfnc=\"unknown\""))
+		b.WriteString(" srcfnc=")
+		cf.writeString(b, "unknown")
 		return
 	}
 
-	fmt.Fprintf(b, " srcfnc=%q srcline=%d", name, line)
+	var scratch [64]byte
+	b.WriteString(" srcfnc=")
+	if cf.quoter != nil {
+		b.Write(cf.quoter(nil, name))
+	} else {
+		b.Write(strconv.AppendQuote(scratch[:0], name))
+	}
+	b.WriteString(" srcline=")
+	b.Write(strconv.AppendInt(scratch[:0], int64(line), 10))
 }
 
 // Marshaler is the interface implemented by types that can marshal their own
 // value into a log-friendly format.
 //
 // Values returned by types implementing this interface do not have newlines
-// stripped, nor are their values quoted; they are included verbatim.
+// stripped, nor are their values quoted; they are included verbatim, unless
+// WithStrictValues is used.
 type Marshaler interface {
 	MarshalLogValue() string
 }
@@ -8,6 +8,9 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"math"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -78,6 +81,53 @@ func TestFormatter(t *testing.T) {
 	}
 }
 
+func TestFormatEntryBuffer(t *testing.T) {
+	entry := &log.Entry{
+		Time:    testTime,
+		Level:   log.InfoLevel,
+		Message: "test message",
+		Buffer:  new(bytes.Buffer),
+	}
+	result, err := New().Format(entry)
+	require.Nil(t, err)
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" _msg="test message"`+"\n", string(result))
+	assert.True(t, &result[0] == &entry.Buffer.Bytes()[0], "should use entry buffer")
+
+	// through a logrus Logger, which supplies pooled buffers
+	var buf bytes.Buffer
+	logger := log.New()
+	logger.Out = &buf
+	logger.Formatter = New()
+	logger.Info("one")
+	logger.Info("two")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.True(t, strings.HasSuffix(lines[0], `_msg="one"`))
+	assert.True(t, strings.HasSuffix(lines[1], `_msg="two"`))
+}
+
+func TestUnsortedFields(t *testing.T) {
+	cf := New(WithUnsortedFields(), WithPrimaryFields("action"))
+	result, err := cf.Format(&log.Entry{
+		Time:    testTime,
+		Level:   log.InfoLevel,
+		Message: "done",
+		Data:    log.Fields{"c": 3, "a": 1, "action": "get", "b": 2},
+	})
+	require.Nil(t, err)
+	line := string(result)
+	assert.True(t, strings.HasPrefix(line, `2017-02-13T12:13:45.000Z ll="info" action="get" `), line)
+	assert.True(t, strings.HasSuffix(line, ` _msg="done"`+"\n"), line)
+	for _, kv := range []string{" a=1", " b=2", " c=3"} {
+		assert.Contains(t, line, kv)
+	}
+
+	// typed fields are emitted in the order given
+	var buf bytes.Buffer
+	NewLogger(&buf, cf).Log(log.InfoLevel, "done", Int("c", 3), Int("a", 1), String("action", "get"), Int("c", 4))
+	assert.Regexp(t, `ll="info" action="get" a=1 c=4 _msg="done"\n$`, buf.String())
+}
+
 func TestConstantField(t *testing.T) {
 	assert := assert.New(t)
 	require := require.New(t)
@@ -98,6 +148,168 @@ func TestConstantField(t *testing.T) {
 	assert.Equal(expected, strings.TrimSpace(string(result)))
 }
 
+func TestSystemFields(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	hostname, err := os.Hostname()
+	require.Nil(err)
+	exe, err := os.Executable()
+	require.Nil(err)
+
+	cf := New(WithSystemFields())
+	result, err := cf.Format(&log.Entry{
+		Time:  testTime,
+		Level: log.InfoLevel,
+	})
+	require.Nil(err, "Should not error")
+	expected := fmt.Sprintf(`2017-02-13T12:13:45.000Z ll="info" hostname=%q pid=%d app=%q`,
+		hostname, os.Getpid(), filepath.Base(exe))
+	assert.Equal(expected, strings.TrimSpace(string(result)))
+}
+
+func TestChild(t *testing.T) {
+	parent := New(
+		WithPrimaryFields("action"),
+		WithConstantField("app", "svc"),
+		WithConstantField("component", "main"),
+	)
+	tests := []struct {
+		name     string
+		cf       *Formatter
+		expected string
+	}{
+		{
+			name:     "parent",
+			cf:       parent,
+			expected: `ll="info" app="svc" component="main" action="get" status="ok"`,
+		}, {
+			name:     "inherit",
+			cf:       parent.Child(),
+			expected: `ll="info" app="svc" component="main" action="get" status="ok"`,
+		}, {
+			name:     "add-constant",
+			cf:       parent.Child(WithConstantField("shard", 2)),
+			expected: `ll="info" app="svc" component="main" shard=2 action="get" status="ok"`,
+		}, {
+			name:     "replace-constant",
+			cf:       parent.Child(WithConstantField("component", "cache")),
+			expected: `ll="info" app="svc" component="cache" action="get" status="ok"`,
+		}, {
+			name:     "replace-primary",
+			cf:       parent.Child(WithPrimaryFields("status")),
+			expected: `ll="info" app="svc" component="main" status="ok" action="get"`,
+		}, {
+			name:     "caller",
+			cf:       parent.Child(IncludeCaller()),
+			expected: `ll="info" srcfnc="unknown" app="svc" component="main" action="get" status="ok"`,
+		}, {
+			name:     "json",
+			cf:       parent.Child(WithJSON()),
+			expected: `{"time":"2017-02-13T12:13:45.000Z","ll":"info","app":"svc","component":"main","action":"get","status":"ok"}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := test.cf.Format(&log.Entry{
+				Time:  testTime,
+				Level: log.InfoLevel,
+				Data:  log.Fields{"status": "ok", "action": "get"},
+			})
+			require.Nil(t, err)
+			out := strings.TrimPrefix(strings.TrimSpace(string(result)), "2017-02-13T12:13:45.000Z ")
+			assert.Equal(t, test.expected, out)
+		})
+	}
+}
+
+type panicStringer struct{ s string }
+
+func (p *panicStringer) String() string { return p.s }
+
+func TestValueFormatting(t *testing.T) {
+	str := "ptr"
+	var nilStr *string
+	var nilStringer *panicStringer
+	type named string
+	values := []interface{}{
+		"plain", "quote\"d\n", "unicode é", &str, nilStr,
+		errors.New("failed"), []byte("bytes"), time.Second, nilStringer,
+		int(-1), int8(-8), int16(16), int32(-32), int64(1) << 62,
+		uint(1), uint8(8), uint16(16), uint32(32), uint64(1) << 63,
+		float32(1.5), 0.1, 1e21, 123456789.0, math.Inf(1), math.NaN(),
+		true, false, nil, named("named"), []int{1, 2}, RawLogString("raw value"),
+	}
+	cf := New()
+	for i, v := range values {
+		var expected string
+		switch data := v.(type) {
+		case fmt.Stringer:
+			expected = fmt.Sprintf("%+q", data)
+		case string, []byte:
+			expected = fmt.Sprintf("%+q", data)
+		case *string:
+			if data == nil {
+				expected = "<nil>"
+			} else {
+				expected = fmt.Sprintf("%+q", *data)
+			}
+		case error:
+			expected = fmt.Sprintf("%+q", data.Error())
+		case Marshaler:
+			expected = data.MarshalLogValue()
+		default:
+			expected = fmt.Sprintf("%v", data)
+		}
+		result, err := cf.Format(&log.Entry{Time: testTime, Level: log.InfoLevel, Data: log.Fields{"v": v}})
+		require.Nil(t, err)
+		assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" v=`+expected+"\n", string(result), "value %d", i)
+	}
+}
+
+// allocsPerRun returns the fewest allocations made by f over several
+// measurements, as goroutines left running by other tests may also
+// allocate.
+func allocsPerRun(f func()) float64 {
+	min := math.Inf(1)
+	for i := 0; i < 5; i++ {
+		if n := testing.AllocsPerRun(100, f); n < min {
+			min = n
+		}
+	}
+	return min
+}
+
+func TestValueAllocs(t *testing.T) {
+	cf := New()
+	allocs := func(v interface{}) float64 {
+		entry := &log.Entry{
+			Time:    testTime,
+			Level:   log.InfoLevel,
+			Message: "test message",
+			Data:    log.Fields{"v": v},
+			Buffer:  new(bytes.Buffer),
+		}
+		return allocsPerRun(func() {
+			entry.Buffer.Reset()
+			cf.Format(entry)
+		})
+	}
+
+	// the allocations made for the entry itself, with a value that's
+	// written verbatim
+	base := allocs(RawLogString("raw"))
+	values := []interface{}{
+		"string", int(1), int8(1), int16(1), int32(1), int64(1),
+		uint(1), uint8(1), uint16(1), uint32(1), uint64(1),
+		1.5, true, 1500 * time.Millisecond,
+	}
+	for _, v := range values {
+		assert.Equal(t, base, allocs(v), "%T value should not allocate", v)
+	}
+}
+
 func TestLogEmitter(t *testing.T) {
 	assert := assert.New(t)
 
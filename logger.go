@@ -0,0 +1,266 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Logger writes entries directly to an io.Writer using a Formatter, for
+// programs that want kvlog output without configuring a logrus Logger,
+// hooks or global state.  Output is identical to that of a logrus Logger
+// using the same Formatter.
+//
+// eg.
+//
+//	logger := kvlog.NewLogger(os.Stderr, kvlog.New(kvlog.IncludeCaller()))
+//	logger.WithField("action", "start").Info("service starting")
+//
+// If the output implements LevelWriter, each entry is written using
+// WriteLevel so that it can be routed by level without being parsed.
+//
+// A Logger is safe for concurrent use.  Loggers derived using With,
+// WithField, WithFields or WithFormatter share their parent's output and
+// level.
+type Logger struct {
+	core   *loggerCore
+	cf     *Formatter
+	fields log.Fields
+}
+
+// loggerCore holds the state shared by a Logger and those derived from it.
+type loggerCore struct {
+	mu    sync.Mutex
+	out   io.Writer
+	level uint32
+}
+
+// NewLogger creates a Logger that writes entries formatted by cf to out at
+// InfoLevel and above.  If cf is nil a Formatter with the default
+// configuration is used.
+func NewLogger(out io.Writer, cf *Formatter) *Logger {
+	if cf == nil {
+		cf = New()
+	}
+	return &Logger{core: &loggerCore{out: out, level: uint32(log.InfoLevel)}, cf: cf}
+}
+
+// SetLevel sets the minimum severity of entries written by the logger.
+func (l *Logger) SetLevel(level log.Level) {
+	atomic.StoreUint32(&l.core.level, uint32(level))
+}
+
+// GetLevel returns the logger's current level.
+func (l *Logger) GetLevel() log.Level {
+	return log.Level(atomic.LoadUint32(&l.core.level))
+}
+
+// IsLevelEnabled reports whether entries at level would be written.
+func (l *Logger) IsLevelEnabled(level log.Level) bool {
+	return l.GetLevel() >= level
+}
+
+// SetOutput sets the writer that entries are written to.
+func (l *Logger) SetOutput(out io.Writer) {
+	l.core.mu.Lock()
+	l.core.out = out
+	l.core.mu.Unlock()
+}
+
+// WithField returns a Logger that includes the given field in every entry,
+// in addition to those included by l.
+func (l *Logger) WithField(key string, value interface{}) *Logger {
+	return l.WithFields(log.Fields{key: value})
+}
+
+// WithFields returns a Logger that includes the given fields in every
+// entry, in addition to those included by l.
+func (l *Logger) WithFields(fields log.Fields) *Logger {
+	data := make(log.Fields, len(l.fields)+len(fields))
+	for k, v := range l.fields {
+		data[k] = v
+	}
+	for k, v := range fields {
+		data[k] = v
+	}
+	return &Logger{core: l.core, cf: l.cf, fields: data}
+}
+
+// With returns a Logger that includes the given typed fields in every
+// entry, in addition to those included by l.
+func (l *Logger) With(fields ...Field) *Logger {
+	data := make(log.Fields, len(fields))
+	for _, f := range fields {
+		data[f.key] = f.value()
+	}
+	return l.WithFields(data)
+}
+
+// WithFormatter returns a Logger that shares l's output, level and fields
+// but formats entries using cf, such as a Formatter created by calling
+// Child on l's Formatter.  Changes to the level or output affect both
+// loggers.
+func (l *Logger) WithFormatter(cf *Formatter) *Logger {
+	return &Logger{core: l.core, cf: cf, fields: l.fields}
+}
+
+// WithError returns a Logger that includes err as an error field.
+func (l *Logger) WithError(err error) *Logger {
+	return l.WithField("error", err)
+}
+
+// Debug logs a message at DebugLevel.
+func (l *Logger) Debug(args ...interface{}) {
+	if l.IsLevelEnabled(log.DebugLevel) {
+		l.log(log.DebugLevel, fmt.Sprint(args...))
+	}
+}
+
+// Debugf logs a formatted message at DebugLevel.
+func (l *Logger) Debugf(format string, args ...interface{}) {
+	if l.IsLevelEnabled(log.DebugLevel) {
+		l.log(log.DebugLevel, fmt.Sprintf(format, args...))
+	}
+}
+
+// Info logs a message at InfoLevel.
+func (l *Logger) Info(args ...interface{}) {
+	if l.IsLevelEnabled(log.InfoLevel) {
+		l.log(log.InfoLevel, fmt.Sprint(args...))
+	}
+}
+
+// Infof logs a formatted message at InfoLevel.
+func (l *Logger) Infof(format string, args ...interface{}) {
+	if l.IsLevelEnabled(log.InfoLevel) {
+		l.log(log.InfoLevel, fmt.Sprintf(format, args...))
+	}
+}
+
+// Warn logs a message at WarnLevel.
+func (l *Logger) Warn(args ...interface{}) {
+	if l.IsLevelEnabled(log.WarnLevel) {
+		l.log(log.WarnLevel, fmt.Sprint(args...))
+	}
+}
+
+// Warnf logs a formatted message at WarnLevel.
+func (l *Logger) Warnf(format string, args ...interface{}) {
+	if l.IsLevelEnabled(log.WarnLevel) {
+		l.log(log.WarnLevel, fmt.Sprintf(format, args...))
+	}
+}
+
+// Error logs a message at ErrorLevel.
+func (l *Logger) Error(args ...interface{}) {
+	if l.IsLevelEnabled(log.ErrorLevel) {
+		l.log(log.ErrorLevel, fmt.Sprint(args...))
+	}
+}
+
+// Errorf logs a formatted message at ErrorLevel.
+func (l *Logger) Errorf(format string, args ...interface{}) {
+	if l.IsLevelEnabled(log.ErrorLevel) {
+		l.log(log.ErrorLevel, fmt.Sprintf(format, args...))
+	}
+}
+
+// Fatal logs a message at FatalLevel and then exits the program with a
+// status of 1.
+func (l *Logger) Fatal(args ...interface{}) {
+	l.log(log.FatalLevel, fmt.Sprint(args...))
+	os.Exit(1)
+}
+
+// Fatalf logs a formatted message at FatalLevel and then exits the program
+// with a status of 1.
+func (l *Logger) Fatalf(format string, args ...interface{}) {
+	l.log(log.FatalLevel, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+// Log writes an entry at level with the given message and typed fields.
+// Unlike Fatal, logging at FatalLevel using Log doesn't exit the program.
+//
+// eg.
+//
+//	logger.Log(log.InfoLevel, "request complete",
+//	    kvlog.String("path", path), kvlog.Int("status", 200), kvlog.Dur("elapsed", d))
+//
+// Where the logger has no fields added by WithFields and is using the
+// default k=v format, fields are formatted without allocating a Fields map.
+func (l *Logger) Log(level log.Level, msg string, fields ...Field) {
+	if !l.IsLevelEnabled(level) {
+		return
+	}
+	cf := l.cf
+	if len(l.fields) > 0 || !cf.canFormatFields(fields) {
+		data := make(log.Fields, len(l.fields)+len(fields))
+		for k, v := range l.fields {
+			data[k] = v
+		}
+		for _, f := range fields {
+			data[f.key] = f.value()
+		}
+		l.logEntry(level, msg, data)
+		return
+	}
+
+	b := bufPool.Get().(*bytes.Buffer)
+	b.Reset()
+	r := Record{Time: cf.now(), Level: Level(level), Message: msg}
+	cf.formatFields(b, &r, fields)
+	l.write(level, b.Bytes())
+	bufPool.Put(b)
+}
+
+func (l *Logger) log(level log.Level, msg string) {
+	l.logEntry(level, msg, l.fields)
+}
+
+func (l *Logger) logEntry(level log.Level, msg string, data log.Fields) {
+	b := bufPool.Get().(*bytes.Buffer)
+	b.Reset()
+	err := l.cf.format(b, &Record{
+		Time:    l.cf.now(),
+		Level:   Level(level),
+		Message: msg,
+		Data:    data,
+	})
+	if err != nil {
+		observeFormatError(err)
+		l.cf.reportError(err)
+	} else {
+		l.write(level, b.Bytes())
+	}
+	bufPool.Put(b)
+}
+
+func (l *Logger) write(level log.Level, b []byte) {
+	if len(b) == 0 {
+		return // below the minimum level for its source
+	}
+	observeLine(level, len(b))
+	var err error
+	c := l.core
+	c.mu.Lock()
+	if lw, ok := c.out.(LevelWriter); ok {
+		_, err = lw.WriteLevel(level, b)
+	} else {
+		_, err = c.out.Write(b)
+	}
+	c.mu.Unlock()
+	if err != nil {
+		observeDeliveryError("output", err)
+		internalError(fmt.Errorf("kvlog: failed to write log entry: %w", err))
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"sync"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestLogger(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, New(WithPrimaryFields("action")))
+	logger.Debug("not logged")
+	logger.WithField("action", "start").Info("service ", "starting")
+	logger.WithFields(log.Fields{"count": 3, "action": "load"}).Warnf("loaded %d items", 3)
+	logger.WithError(errors.New("boom")).Error("failed")
+
+	logger.SetLevel(log.DebugLevel)
+	logger.Debugf("now %s", "logged")
+
+	expected := `ll="info" action="start" _msg="service starting"
+ll="warning" action="load" count=3 _msg="loaded 3 items"
+ll="error" error="boom" _msg="failed"
+ll="debug" _msg="now logged"
+`
+	assert.Equal(expected, regexp.MustCompile(`(?m)^\S+ `).ReplaceAllString(buf.String(), ""))
+}
+
+func TestLoggerMatchesLogrus(t *testing.T) {
+	cf := New(WithConstantField("app", "test"))
+	fields := log.Fields{"str": "value", "num": 1.5, "nested": testLoggable{"a": 1}}
+
+	var native, lr bytes.Buffer
+	NewLogger(&native, cf).WithFields(fields).Info("hello")
+	(&log.Logger{Out: &lr, Formatter: cf, Level: log.InfoLevel}).WithFields(fields).Info("hello")
+
+	ts := regexp.MustCompile(`^\S+ `)
+	assert.Equal(t, ts.ReplaceAllString(lr.String(), ""), ts.ReplaceAllString(native.String(), ""))
+}
+
+func TestLoggerCaller(t *testing.T) {
+	var buf bytes.Buffer
+	NewLogger(&buf, New(IncludeCaller())).Info("hello")
+	assert.Regexp(t, `^\S+ ll="info" srcfnc="TestLoggerCaller" srcline=\d+ _msg="hello"\n$`, buf.String())
+}
+
+func TestLoggerDerived(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	parent := NewLogger(&buf, nil)
+	child := parent.WithField("component", "cache")
+	parent.WithField("other", 1)
+
+	parent.SetLevel(log.WarnLevel)
+	child.Info("dropped")
+	assert.Equal(log.WarnLevel, child.GetLevel())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			child.Warn("concurrent")
+		}()
+	}
+	wg.Wait()
+
+	dec := NewDecoder(&buf)
+	n := 0
+	for dec.Next() {
+		assert.Equal(log.Fields{"component": "cache"}, log.Fields(dec.Entry().Fields))
+		n++
+	}
+	assert.Equal(10, n)
+}
+
+func TestLoggerWith(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, nil).With(String("component", "cache"), Int("shard", 2))
+	logger.Info("hit")
+	logger.With(String("component", "lru")).Log(log.InfoLevel, "evicted", Int("count", 3))
+
+	expected := `ll="info" component="cache" shard=2 _msg="hit"
+ll="info" component="lru" count=3 shard=2 _msg="evicted"
+`
+	assert.Equal(t, expected, regexp.MustCompile(`(?m)^\S+ `).ReplaceAllString(buf.String(), ""))
+}
+
+func TestLoggerWithFormatter(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	cf := New(WithPrimaryFields("action"), WithConstantField("app", "svc"))
+	parent := NewLogger(&buf, cf)
+	child := parent.WithFormatter(cf.Child(WithConstantField("component", "cache")))
+
+	parent.SetLevel(log.WarnLevel)
+	child.Info("dropped")
+	child.WithField("action", "evict").Warn("evicted")
+	parent.Warn("parent")
+
+	expected := `ll="warning" app="svc" component="cache" action="evict" _msg="evicted"
+ll="warning" app="svc" _msg="parent"
+`
+	assert.Equal(expected, regexp.MustCompile(`(?m)^\S+ `).ReplaceAllString(buf.String(), ""))
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+)
+
+// reserved keys used by the Logstash event format
+var logstashKeys = map[string]struct{}{
+	"@timestamp": {},
+	"@version":   {},
+	"level":      {},
+	"message":    {},
+}
+
+// WithLogstashJSON causes the Formatter to emit each entry as a Logstash
+// event JSON object rather than as k=v pairs.
+//
+// The event includes the @timestamp, @version, level and message keys along
+// with any caller, constant, primary and remaining fields at the top level,
+// in the same order as they'd appear in the k=v output.  Fields that clash
+// with one of the reserved event keys are prefixed with "fields.".
+//
+// eg.
+//
+//	{"@timestamp":"2017-01-02T12:00:00.000Z","@version":"1","level":"info","message":"User logged in","action":"user_login"}
+func WithLogstashJSON() Config {
+	return func(kvf *Formatter) {
+		kvf.encode = encodeLogstash
+	}
+}
+
+func encodeLogstash(cf *Formatter, b *bytes.Buffer, entry *Record) {
+	obj := newJSONObject(b)
+	obj.key("@timestamp")
+	cf.writeJSONTimestamp(b, entry.Time)
+	obj.str("@version", "1")
+	obj.str("level", entry.level().String())
+	if entry.Message != "" {
+		obj.str("message", entry.Message)
+	}
+
+	if cf.includeCaller {
+		cf.writeJSONCaller(obj, entry)
+	}
+
+	fc := cf.fields()
+	fields := cf.entryFields(fc, entry)
+	for _, f := range cf.entryConstants(fc, fields) {
+		obj.field(fieldKey(logstashKeys, f.key), f.value)
+	}
+	for _, f := range fields {
+		obj.field(fieldKey(logstashKeys, f.key), f.value)
+	}
+	obj.close()
+	b.WriteByte('\n')
+}
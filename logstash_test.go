@@ -0,0 +1,99 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+var logstashTests = []struct {
+	name     string
+	cfgs     []Config
+	entry    *log.Entry
+	expected string
+}{
+	{"simple", nil, &log.Entry{
+		Time:    testTime,
+		Level:   log.InfoLevel,
+		Message: "test message",
+		Data: log.Fields{
+			"field1":      "str with \"quotes\"\n",
+			"field2":      123,
+			"field-three": errors.New("test error"),
+		},
+	}, `{"@timestamp":"2017-02-13T12:13:45.000Z","@version":"1","level":"info","message":"test message","field-three":"test error","field1":"str with \"quotes\"\n","field2":123}`},
+	{"ordered", []Config{WithConstantField("commit", "abcd"), WithPrimaryFields("status")}, &log.Entry{
+		Time:  testTime,
+		Level: log.WarnLevel,
+		Data: log.Fields{
+			"field1": 1.5,
+			"status": "ok",
+		},
+	}, `{"@timestamp":"2017-02-13T12:13:45.000Z","@version":"1","level":"warning","commit":"abcd","status":"ok","field1":1.5}`},
+	{"reserved", nil, &log.Entry{
+		Time:    testTime,
+		Level:   log.InfoLevel,
+		Message: "msg",
+		Data: log.Fields{
+			"message": "clash",
+		},
+	}, `{"@timestamp":"2017-02-13T12:13:45.000Z","@version":"1","level":"info","message":"msg","fields.message":"clash"}`},
+	{"marshaler", nil, &log.Entry{
+		Time:  testTime,
+		Level: log.InfoLevel,
+		Data: log.Fields{
+			"json": RawLogString(`{"a":1}`),
+			"raw":  RawLogString("not json"),
+			"nil":  nil,
+		},
+	}, `{"@timestamp":"2017-02-13T12:13:45.000Z","@version":"1","level":"info","json":{"a":1},"nil":null,"raw":"not json"}`},
+}
+
+func TestLogstashJSON(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	for _, test := range logstashTests {
+		cf := New(append(test.cfgs, WithLogstashJSON())...)
+		result, err := cf.Format(test.entry)
+		require.Nil(err, test.name+" should not error")
+		assert.Equal(test.expected, strings.TrimSpace(string(result)), test.name+" should match")
+		assert.True(json.Valid(result), test.name+" should be valid JSON")
+	}
+}
+
+func TestLogstashLoggable(t *testing.T) {
+	assert := assert.New(t)
+
+	cf := New(WithLogstashJSON())
+	result, _ := cf.Format(&log.Entry{
+		Time:  testTime,
+		Level: log.InfoLevel,
+		Data: log.Fields{
+			"exec_times": testLoggable{"min": 5, "max": 93},
+		},
+	})
+	expected := `{"@timestamp":"2017-02-13T12:13:45.000Z","@version":"1","level":"info","exec_times.max":93,"exec_times.min":5}`
+	assert.Equal(expected, strings.TrimSpace(string(result)))
+}
+
+type testLoggable map[string]interface{}
+
+func (l testLoggable) LogValues() map[string]interface{} {
+	out := make(map[string]interface{}, len(l))
+	for k, v := range l {
+		out["."+k] = v
+	}
+	return out
+}
@@ -0,0 +1,287 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// LokiConfig represents a configuration function to be passed to
+// NewLokiWriter.
+type LokiConfig func(l *LokiWriter)
+
+// LokiLabel adds a stream label with a constant value, such as
+// LokiLabel("app", "billing"), to every line.
+func LokiLabel(name, value string) LokiConfig {
+	return func(l *LokiWriter) {
+		l.static = append(l.static, field{lokiLabelName(name), value})
+	}
+}
+
+// LokiFieldLabels adds a stream label for each of keys, taking its value
+// from the line's field of the same name.  Lines without the field are
+// sent without the label.  Characters that aren't valid in a label name are
+// replaced with underscores.
+//
+// Each distinct combination of label values creates a new stream in Loki,
+// so keys should only be used for fields with a small number of values.
+func LokiFieldLabels(keys ...string) LokiConfig {
+	return func(l *LokiWriter) {
+		l.fieldLabels = append(l.fieldLabels, keys...)
+	}
+}
+
+// LokiLevelLabel adds a "level" stream label holding each line's level.
+func LokiLevelLabel() LokiConfig {
+	return func(l *LokiWriter) {
+		l.levelLabel = true
+	}
+}
+
+// LokiHeader adds an HTTP header to each push request, such as
+// X-Scope-OrgID for multi-tenant installations, or Authorization.
+func LokiHeader(key, value string) LokiConfig {
+	return func(l *LokiWriter) {
+		l.headers.Add(key, value)
+	}
+}
+
+// LokiBatch sets the maximum number of lines sent in a single push request
+// and the maximum time a line is held before being sent.  The defaults are
+// 500 lines and 5 seconds.
+func LokiBatch(size int, interval time.Duration) LokiConfig {
+	return func(l *LokiWriter) {
+		l.batchSize = size
+		l.interval = interval
+	}
+}
+
+// LokiHTTPClient sets the client used to make push requests.
+func LokiHTTPClient(client *http.Client) LokiConfig {
+	return func(l *LokiWriter) {
+		l.client = client
+	}
+}
+
+// LokiTLS sets the TLS configuration used to make push requests, such as one
+// returned by NewTLSConfig.  It replaces any client set by LokiHTTPClient.
+func LokiTLS(cfg *tls.Config) LokiConfig {
+	return func(l *LokiWriter) {
+		l.client = tlsHTTPClient(cfg)
+	}
+}
+
+// LokiRetryPolicy sets how failed push requests are retried.  The default
+// is DefaultRetryPolicy.
+func LokiRetryPolicy(policy RetryPolicy) LokiConfig {
+	return func(l *LokiWriter) {
+		l.retry = policy
+	}
+}
+
+// LokiQueuePolicy sets how many lines are held in memory awaiting
+// sending and what happens when that limit is reached.  The default is
+// DefaultQueuePolicy.
+func LokiQueuePolicy(policy QueuePolicy) LokiConfig {
+	return func(l *LokiWriter) {
+		l.queuePolicy = policy
+	}
+}
+
+// LokiErrorHandler sets a function to be called if a background push
+// fails.
+func LokiErrorHandler(f func(error)) LokiConfig {
+	return func(l *LokiWriter) {
+		l.onError = f
+	}
+}
+
+// LokiWriter is an io.Writer that pushes batches of lines to Grafana Loki,
+// assigning each line to a stream using the labels set by LokiLabel,
+// LokiFieldLabels and LokiLevelLabel.
+//
+// eg.
+//
+//	w := kvlog.NewLokiWriter("http://loki:3100",
+//	    kvlog.LokiLabel("app", "billing"),
+//	    kvlog.LokiFieldLabels("region"),
+//	    kvlog.LokiLevelLabel())
+//	defer w.Close()
+//	logrus.SetOutput(w)
+//
+// Lines are sent unaltered, with their timestamp taken from the line itself.
+// Labels are read from k=v lines only; other lines are sent with the
+// constant labels and the time they were written.
+//
+// Close should be called before the program exits to send any queued lines.
+type LokiWriter struct {
+	url         string
+	static      []field
+	fieldLabels []string
+	levelLabel  bool
+	headers     http.Header
+	client      *http.Client
+	retry       RetryPolicy
+	queuePolicy QueuePolicy
+	batchSize   int
+	interval    time.Duration
+	onError     func(error)
+	batch       *batcher
+	deliver     *deliverer
+}
+
+// NewLokiWriter creates a writer that pushes lines to the Loki server at
+// baseURL, eg. "http://localhost:3100".
+func NewLokiWriter(baseURL string, cfgs ...LokiConfig) *LokiWriter {
+	l := &LokiWriter{
+		url:         baseURL + "/loki/api/v1/push",
+		headers:     make(http.Header),
+		client:      http.DefaultClient,
+		retry:       DefaultRetryPolicy,
+		queuePolicy: DefaultQueuePolicy,
+		batchSize:   500,
+		interval:    5 * time.Second,
+	}
+	for _, cfg := range cfgs {
+		cfg(l)
+	}
+	l.deliver = newDeliverer(l.retry, l.client, "Loki push")
+	l.batch = newBatcher("loki", l.batchSize, l.interval, l.queuePolicy, l.send, l.encodeReport, l.onError)
+	RegisterShutdown(l)
+	return l
+}
+
+// Write implements io.Writer, queuing a line to be pushed.
+func (l *LokiWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if err := l.batch.add(l.encode(p)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// encode returns the queued item for a line, holding the stream's labels as
+// a JSON object and the line's [timestamp, line] value, separated by a
+// newline.
+func (l *LokiWriter) encode(p []byte) []byte {
+	line := bytes.TrimRight(p, "\n")
+	ts := time.Now()
+
+	var b bytes.Buffer
+	obj := newJSONObject(&b)
+	for _, f := range l.static {
+		obj.str(f.key, valueString(f.value))
+	}
+	if entry, err := Parse(line); err == nil {
+		ts = entry.Time
+		if l.levelLabel {
+			obj.str("level", entry.Level.String())
+		}
+		for _, k := range l.fieldLabels {
+			if v, ok := entry.Fields[k]; ok {
+				obj.str(lokiLabelName(k), fmt.Sprint(v))
+			}
+		}
+	}
+	obj.close()
+
+	b.WriteString("\n[")
+	writeJSONString(&b, strconv.FormatInt(ts.UnixNano(), 10))
+	b.WriteByte(',')
+	writeJSONString(&b, string(line))
+	b.WriteByte(']')
+	return b.Bytes()
+}
+
+// encodeReport encodes a dropped line report using the default k=v format.
+func (l *LokiWriter) encodeReport(entry *log.Entry) []byte {
+	line, _ := reportFormatter.Format(entry)
+	return l.encode(line)
+}
+
+// Dropped returns the number of lines discarded, either because the queue
+// was full or because they couldn't be pushed.
+func (l *LokiWriter) Dropped() int64 {
+	return l.batch.dropped()
+}
+
+// Backlog returns the number of lines queued awaiting sending.
+func (l *LokiWriter) Backlog() int {
+	return l.batch.backlog()
+}
+
+// Flush synchronously pushes all queued lines.
+func (l *LokiWriter) Flush() error {
+	return l.batch.flush()
+}
+
+// Close stops the writer after pushing any queued lines.  Pushes are
+// attempted once, without waiting to retry, and a retry in progress is
+// abandoned, so that Close isn't held up by an unavailable endpoint.
+func (l *LokiWriter) Close() error {
+	UnregisterShutdown(l)
+	l.deliver.close()
+	return l.batch.close()
+}
+
+func (l *LokiWriter) send(items [][]byte) error {
+	// group values by stream, preserving the order streams first appear
+	var order []string
+	streams := make(map[string][][]byte)
+	for _, item := range items {
+		nl := bytes.IndexByte(item, '\n')
+		labels := string(item[:nl])
+		if _, ok := streams[labels]; !ok {
+			order = append(order, labels)
+		}
+		streams[labels] = append(streams[labels], item[nl+1:])
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`{"streams":[`)
+	for i, labels := range order {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(`{"stream":`)
+		b.WriteString(labels)
+		b.WriteString(`,"values":[`)
+		b.Write(bytes.Join(streams[labels], []byte{','}))
+		b.WriteString(`]}`)
+	}
+	b.WriteString(`]}`)
+
+	return l.deliver.do(func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", l.url, bytes.NewReader(b.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range l.headers {
+			req.Header[k] = v
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+}
+
+// lokiLabelName converts name into a valid Prometheus label name.
+func lokiLabelName(name string) string {
+	b := []byte(name)
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c >= '0' && c <= '9' && i > 0) {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
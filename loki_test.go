@@ -0,0 +1,81 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+type lokiPush struct {
+	Streams []struct {
+		Stream map[string]string
+		Values [][2]string
+	}
+}
+
+func TestLokiWriter(t *testing.T) {
+	var pushes []lokiPush
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/loki/api/v1/push", r.URL.Path)
+		assert.Equal(t, "tenant1", r.Header.Get("X-Scope-OrgID"))
+		body, _ := ioutil.ReadAll(r.Body)
+		var push lokiPush
+		if err := json.Unmarshal(body, &push); err != nil {
+			t.Errorf("invalid request body %s: %v", body, err)
+		}
+		pushes = append(pushes, push)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	w := NewLokiWriter(srv.URL,
+		LokiLabel("app", "billing"),
+		LokiFieldLabels("region", "http.method"),
+		LokiLevelLabel(),
+		LokiHeader("X-Scope-OrgID", "tenant1"),
+		LokiBatch(10, time.Hour))
+
+	lines := []string{
+		`2017-02-13T12:13:45.000Z ll="info" region="eu" http.method="GET" _msg="one"`,
+		`2017-02-13T12:13:45.001Z ll="error" region="eu" _msg="two"`,
+		`2017-02-13T12:13:45.002Z ll="info" region="eu" http.method="GET" _msg="three"`,
+	}
+	for _, line := range lines {
+		w.Write([]byte(line + "\n"))
+	}
+	require.Nil(t, w.Close())
+
+	require.Len(t, pushes, 1)
+	streams := pushes[0].Streams
+	require.Len(t, streams, 2)
+	assert.Equal(t, map[string]string{"app": "billing", "level": "info", "region": "eu", "http_method": "GET"}, streams[0].Stream)
+	assert.Equal(t, [][2]string{
+		{"1486988025000000000", lines[0]},
+		{"1486988025002000000", lines[2]},
+	}, streams[0].Values)
+	assert.Equal(t, map[string]string{"app": "billing", "level": "error", "region": "eu"}, streams[1].Stream)
+	assert.Equal(t, [][2]string{{"1486988025001000000", lines[1]}}, streams[1].Values)
+}
+
+func TestLokiWriterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	w := NewLokiWriter(srv.URL)
+	w.Write([]byte("not a kv line\n"))
+	assert.NotNil(t, w.Close())
+}
@@ -0,0 +1,33 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+// fieldsDroppedKey is the key of the field added by WithMaxFields.
+const fieldsDroppedKey = "fields_dropped"
+
+// WithMaxFields limits the number of fields emitted for each entry to n,
+// as protection against code that adds the whole of a large map to an
+// entry's fields.  Primary fields are kept first, followed by the remaining
+// fields in key order, and any beyond n are dropped and counted in a
+// fields_dropped field.  The fields of a Loggable value are counted
+// individually.  Constant fields aren't counted.
+//
+// With WithUnsortedFields, which fields are dropped may vary from entry to
+// entry.
+func WithMaxFields(n int) Config {
+	return func(kvf *Formatter) {
+		kvf.maxFields = n
+	}
+}
+
+// limitFields truncates fields to the limit set by WithMaxFields, adding a
+// fields_dropped field if any were removed.
+func (cf *Formatter) limitFields(fields []field) []field {
+	if cf.maxFields <= 0 || len(fields) <= cf.maxFields {
+		return fields
+	}
+	dropped := len(fields) - cf.maxFields
+	return append(fields[:cf.maxFields], field{fieldsDroppedKey, dropped})
+}
@@ -0,0 +1,51 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestMaxFields(t *testing.T) {
+	data := log.Fields{"e": 5, "d": 4, "c": 3, "b": 2, "a": 1, "status": "ok"}
+	tests := []struct {
+		name     string
+		cfgs     []Config
+		expected string
+	}{
+		{"under", []Config{WithMaxFields(6)}, `a=1 b=2 c=3 d=4 e=5 status="ok"`},
+		{"over", []Config{WithMaxFields(3)}, `a=1 b=2 c=3 fields_dropped=3`},
+		{"primary", []Config{WithMaxFields(3), WithPrimaryFields("status")}, `status="ok" a=1 b=2 fields_dropped=3`},
+		{"constants", []Config{WithMaxFields(1), WithConstantField("app", "x")}, `app="x" a=1 fields_dropped=5`},
+		{"unlimited", nil, `a=1 b=2 c=3 d=4 e=5 status="ok"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := New(test.cfgs...).Format(&log.Entry{Time: testTime, Level: log.InfoLevel, Data: data})
+			require.Nil(t, err)
+			assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" `+test.expected, strings.TrimSuffix(string(result), "\n"))
+		})
+	}
+}
+
+func TestMaxFieldsTypedFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, New(WithMaxFields(2)))
+	logger.Log(log.InfoLevel, "few", Int("a", 1), Int("b", 2))
+	logger.Log(log.InfoLevel, "many", Int("c", 3), Int("a", 1), Int("b", 2))
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.Regexp(t, ` a=1 b=2 _msg="few"$`, lines[0])
+	assert.Regexp(t, ` a=1 b=2 fields_dropped=1 _msg="many"$`, lines[1])
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"net"
+	"net/http"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// HTTPMiddleware returns middleware that logs one entry to logger for each
+// request served by the wrapped handler, once the handler has returned.
+//
+// eg.
+//
+//	http.ListenAndServe(":8080", kvlog.HTTPMiddleware(logrus.StandardLogger())(mux))
+//
+// Each entry includes the request's method, path, remote_ip and user_agent
+// along with the response status, the number of body bytes written and the
+// time taken to serve the request as duration_ms.  Fields are ordered by the
+// logger's Formatter as usual, so any of them may be made primary fields.
+//
+// If the request includes a traceparent or X-Amzn-Trace-Id header, it is
+// added to the request's context with ContextWithTraceparent or
+// ContextWithXRayTraceID respectively.  The logged entry is created using
+// FromContext, so it includes any fields attached to the request's context
+// and hooks such as XRayHook can make use of it.
+func HTTPMiddleware(logger *log.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			if header := r.Header.Get("Traceparent"); header != "" {
+				r = r.WithContext(ContextWithTraceparent(r.Context(), header))
+			}
+			if header := r.Header.Get("X-Amzn-Trace-Id"); header != "" {
+				r = r.WithContext(ContextWithXRayTraceID(r.Context(), header))
+			}
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			if sw.status == 0 {
+				sw.status = http.StatusOK
+			}
+
+			remoteIP := r.RemoteAddr
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				remoteIP = host
+			}
+
+			FromContext(r.Context(), logger).WithFields(log.Fields{
+				"method":      r.Method,
+				"path":        r.URL.Path,
+				"status":      sw.status,
+				"bytes":       sw.bytes,
+				"duration_ms": float64(time.Since(start)) / float64(time.Millisecond),
+				"remote_ip":   remoteIP,
+				"user_agent":  r.UserAgent(),
+			}).Info("request")
+		})
+	}
+}
+
+// statusWriter records the status code and number of bytes written to a
+// ResponseWriter.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// Flush implements http.Flusher if the underlying ResponseWriter does.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
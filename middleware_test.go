@@ -0,0 +1,79 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int64
+		bytes   int64
+	}{
+		{
+			name: "implicit-ok",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, "hello")
+			},
+			status: 200,
+			bytes:  5,
+		}, {
+			name: "explicit-status",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusNotFound)
+				io.WriteString(w, "not found")
+			},
+			status: 404,
+			bytes:  9,
+		}, {
+			name:    "no-body",
+			handler: func(w http.ResponseWriter, r *http.Request) {},
+			status:  200,
+			bytes:   0,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert := assert.New(t)
+			var buf bytes.Buffer
+			logger := &log.Logger{
+				Out:       &buf,
+				Formatter: New(WithPrimaryFields("method", "path", "status")),
+				Level:     log.InfoLevel,
+			}
+
+			req := httptest.NewRequest("GET", "/widgets?id=1", nil)
+			req.RemoteAddr = "10.1.2.3:4567"
+			req.Header.Set("User-Agent", "test-agent")
+			HTTPMiddleware(logger)(test.handler).ServeHTTP(httptest.NewRecorder(), req)
+
+			entry, err := Parse(buf.Bytes())
+			require.Nil(t, err)
+			assert.Equal(log.InfoLevel, entry.Level)
+			assert.Equal("request", entry.Message)
+			assert.Equal([]string{"method", "path", "status", "bytes", "duration_ms", "remote_ip", "user_agent"}, entry.Keys)
+			assert.Equal("GET", entry.Fields["method"])
+			assert.Equal("/widgets", entry.Fields["path"])
+			assert.Equal(test.status, entry.Fields["status"])
+			assert.Equal(test.bytes, entry.Fields["bytes"])
+			assert.Equal("10.1.2.3", entry.Fields["remote_ip"])
+			assert.Equal("test-agent", entry.Fields["user_agent"])
+		})
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// WithPackageLevels sets the minimum level of entries logged from each of
+// the given packages, identified by import path, so that a single noisy
+// package can be turned down to, say, warnings without raising the level of
+// the whole program.  A package's setting also applies to the packages
+// beneath it, unless they have their own.  Entries from other packages are
+// unaffected.
+//
+// eg.
+//
+//	kvlog.New(kvlog.WithPackageLevels(map[string]log.Level{
+//	    "github.com/example/app/cache": log.WarnLevel,
+//	}))
+//
+// The calling package is taken from the entry if the logrus Logger has
+// ReportCaller set, and otherwise found by searching the stack, which adds
+// to the cost of formatting each entry.
+//
+// Levels can only be raised in this way: entries below the level set on the
+// logger are discarded before reaching the Formatter.  Entries discarded by
+// the Formatter are formatted as an empty line, which a logrus Logger
+// passes to its output as an empty write; the writers in this package
+// ignore empty writes, but other writers may need to do the same.
+func WithPackageLevels(levels map[string]log.Level) Config {
+	return func(kvf *Formatter) {
+		m := kvf.minLevels().with()
+		for pkg, level := range levels {
+			m.packages[strings.TrimSuffix(pkg, "/")] = level
+		}
+		kvf.levels.Store(m)
+	}
+}
+
+// WithComponentLevels is like WithPackageLevels, but identifies the source
+// of each entry by the value of its key field, such as "component", rather
+// than by its package.  Where both are set the component's level takes
+// precedence.
+func WithComponentLevels(key string, levels map[string]log.Level) Config {
+	return func(kvf *Formatter) {
+		m := kvf.minLevels().with()
+		m.componentKey = key
+		for name, level := range levels {
+			m.components[name] = level
+		}
+		kvf.levels.Store(m)
+	}
+}
+
+// defaultComponentKey is the field used to identify components if levels
+// are set by SetComponentLevels without WithComponentLevels.
+const defaultComponentKey = "component"
+
+// PackageLevels returns the minimum levels of packages set by
+// WithPackageLevels or SetPackageLevels.
+func (cf *Formatter) PackageLevels() map[string]log.Level {
+	levels := make(map[string]log.Level)
+	if m := cf.minLevels(); m != nil {
+		for k, v := range m.packages {
+			levels[k] = v
+		}
+	}
+	return levels
+}
+
+// SetPackageLevels replaces the minimum levels of packages set by
+// WithPackageLevels.  It's safe to call while cf is in use.
+func (cf *Formatter) SetPackageLevels(levels map[string]log.Level) {
+	cf.updateMu.Lock()
+	defer cf.updateMu.Unlock()
+	m := cf.minLevels().with()
+	m.packages = make(map[string]log.Level)
+	for pkg, level := range levels {
+		m.packages[strings.TrimSuffix(pkg, "/")] = level
+	}
+	cf.levels.Store(m)
+}
+
+// ComponentLevels returns the minimum levels of components set by
+// WithComponentLevels or SetComponentLevels.
+func (cf *Formatter) ComponentLevels() map[string]log.Level {
+	levels := make(map[string]log.Level)
+	if m := cf.minLevels(); m != nil {
+		for k, v := range m.components {
+			levels[k] = v
+		}
+	}
+	return levels
+}
+
+// SetComponentLevels replaces the minimum levels of components set by
+// WithComponentLevels.  Components are identified by the key given to
+// WithComponentLevels or, if it wasn't used, the "component" field.  It's
+// safe to call while cf is in use.
+func (cf *Formatter) SetComponentLevels(levels map[string]log.Level) {
+	cf.updateMu.Lock()
+	defer cf.updateMu.Unlock()
+	m := cf.minLevels().with()
+	if m.componentKey == "" {
+		m.componentKey = defaultComponentKey
+	}
+	m.components = make(map[string]log.Level)
+	for name, level := range levels {
+		m.components[name] = level
+	}
+	cf.levels.Store(m)
+}
+
+// minLevels returns the current minimum levels of cf, or nil if none have
+// been set.
+func (cf *Formatter) minLevels() *minLevels {
+	m, _ := cf.levels.Load().(*minLevels)
+	return m
+}
+
+// minLevels holds the minimum levels set by WithPackageLevels and
+// WithComponentLevels.  It's replaced rather than modified once configured,
+// so may be shared by a Formatter and its children.
+type minLevels struct {
+	packages     map[string]log.Level
+	componentKey string
+	components   map[string]log.Level
+}
+
+// with returns a copy of m, which may be nil.
+func (m *minLevels) with() *minLevels {
+	n := &minLevels{
+		packages:   make(map[string]log.Level),
+		components: make(map[string]log.Level),
+	}
+	if m != nil {
+		for k, v := range m.packages {
+			n.packages[k] = v
+		}
+		for k, v := range m.components {
+			n.components[k] = v
+		}
+		n.componentKey = m.componentKey
+	}
+	return n
+}
+
+// packageLevel returns the minimum level for pkg, set either for pkg itself
+// or the closest package above it.
+func (m *minLevels) packageLevel(pkg string) (log.Level, bool) {
+	for pkg != "" {
+		if level, ok := m.packages[pkg]; ok {
+			return level, true
+		}
+		i := strings.LastIndexByte(pkg, '/')
+		if i < 0 {
+			break
+		}
+		pkg = pkg[:i]
+	}
+	return 0, false
+}
+
+// levelEnabled reports whether r should be logged given the minimum levels
+// of its component and package.  fields holds typed fields to be logged in
+// place of r's Data, if any.
+func (cf *Formatter) levelEnabled(r *Record, fields []Field) bool {
+	m := cf.minLevels()
+	if m == nil {
+		return true
+	}
+	if len(m.components) > 0 {
+		v, ok := r.Data[m.componentKey]
+		if i := lastField(fields, m.componentKey); i != -1 {
+			v, ok = fields[i].value(), true
+		}
+		if ok {
+			if level, ok := m.components[valueString(v)]; ok {
+				return r.level() <= level
+			}
+		}
+	}
+	if len(m.packages) > 0 {
+		if level, ok := m.packageLevel(cf.callerPackage(r)); ok {
+			return r.level() <= level
+		}
+	}
+	return true
+}
@@ -0,0 +1,123 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestPackageLevels(t *testing.T) {
+	cf := New(WithPackageLevels(map[string]log.Level{
+		"github.com/example/app/cache":      log.WarnLevel,
+		"github.com/example/app/cache/lru/": log.DebugLevel,
+	}))
+	tests := []struct {
+		function string
+		level    log.Level
+		logged   bool
+	}{
+		{"github.com/example/app/cache.(*Cache).Get", log.InfoLevel, false},
+		{"github.com/example/app/cache.(*Cache).Get", log.WarnLevel, true},
+		{"github.com/example/app/cache/disk.load", log.InfoLevel, false},
+		{"github.com/example/app/cache/lru.evict", log.DebugLevel, true},
+		{"github.com/example/app/cachex.get", log.InfoLevel, true},
+		{"github.com/example/app.main", log.DebugLevel, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.function+"@"+test.level.String(), func(t *testing.T) {
+			result, err := cf.Format(&log.Entry{
+				Time:    testTime,
+				Level:   test.level,
+				Message: "msg",
+				Caller:  &runtime.Frame{Function: test.function, Line: 10},
+			})
+			require.Nil(t, err)
+			if test.logged {
+				assert.Contains(t, string(result), `_msg="msg"`)
+			} else {
+				assert.Empty(t, result)
+			}
+		})
+	}
+}
+
+func TestPackageLevelsStack(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, New(IncludeCaller(), WithPackageLevels(map[string]log.Level{
+		"github.com/gwatts": log.WarnLevel,
+	})))
+	logger.Log(log.InfoLevel, "dropped", Int("a", 1))
+	logger.WithField("b", 2).Info("dropped")
+	logger.Log(log.ErrorLevel, "kept", Int("a", 1))
+	assert.Regexp(t, `^\S+ ll="error" srcfnc="TestPackageLevelsStack" srcline=\d+ a=1 _msg="kept"\n$`, buf.String())
+}
+
+func TestComponentLevels(t *testing.T) {
+	var buf bytes.Buffer
+	cf := New(
+		WithComponentLevels("component", map[string]log.Level{"cache": log.ErrorLevel}),
+		WithPackageLevels(map[string]log.Level{"github.com/gwatts": log.InfoLevel}))
+	logger := NewLogger(&buf, cf)
+	logger.Log(log.WarnLevel, "dropped", String("component", "cache"))
+	logger.WithField("component", "cache").Warn("dropped")
+	logger.Log(log.WarnLevel, "kept", String("component", "db"))
+	logger.Log(log.ErrorLevel, "kept", String("component", "cache"))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	assert.Regexp(t, ` ll="warning" component="db" _msg="kept"$`, lines[0])
+	assert.Regexp(t, ` ll="error" component="cache" _msg="kept"$`, lines[1])
+}
+
+func TestComponentLevelsRuntime(t *testing.T) {
+	var buf bytes.Buffer
+	cf := New()
+	logger := NewLogger(&buf, cf)
+	logger.Log(log.InfoLevel, "kept", String("component", "cache"))
+	cf.SetComponentLevels(map[string]log.Level{"cache": log.WarnLevel})
+	logger.Log(log.InfoLevel, "dropped", String("component", "cache"))
+	cf.SetComponentLevels(nil)
+	logger.Log(log.InfoLevel, "kept", String("component", "cache"))
+	assert.Equal(t, 2, strings.Count(buf.String(), `_msg="kept"`))
+	assert.NotContains(t, buf.String(), "dropped")
+}
+
+func TestComponentLevelsEmptyWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// a logrus Logger writes filtered entries as empty lines, which must
+	// neither use up a rate limit token nor be spooled as a blank record
+	sink := &flakySink{}
+	s, err := NewSpool(dir, sink, SpoolRetryInterval(5*time.Millisecond))
+	require.Nil(t, err)
+	defer s.Close()
+	logger := &log.Logger{
+		Out:       NewRateLimitWriter(s, 1),
+		Formatter: New(WithComponentLevels("component", map[string]log.Level{"cache": log.ErrorLevel})),
+		Hooks:     make(log.LevelHooks),
+		Level:     log.InfoLevel,
+	}
+	logger.WithField("component", "cache").Info("dropped")
+	logger.WithField("component", "db").Info("kept")
+
+	lines := waitForLines(t, sink, 1)
+	require.Len(t, lines, 1)
+	assert.Contains(t, lines[0], `_msg="kept"`)
+}
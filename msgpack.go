@@ -0,0 +1,158 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// Minimal MessagePack encoding, sufficient for the Fluentd forward protocol.
+
+func msgpackArray(b *bytes.Buffer, n int) {
+	switch {
+	case n < 16:
+		b.WriteByte(0x90 | byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(0xdc)
+		msgpackUint16(b, uint16(n))
+	default:
+		b.WriteByte(0xdd)
+		msgpackUint32(b, uint32(n))
+	}
+}
+
+func msgpackMap(b *bytes.Buffer, n int) {
+	switch {
+	case n < 16:
+		b.WriteByte(0x80 | byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(0xde)
+		msgpackUint16(b, uint16(n))
+	default:
+		b.WriteByte(0xdf)
+		msgpackUint32(b, uint32(n))
+	}
+}
+
+func msgpackString(b *bytes.Buffer, s string) {
+	n := len(s)
+	switch {
+	case n < 32:
+		b.WriteByte(0xa0 | byte(n))
+	case n <= math.MaxUint8:
+		b.WriteByte(0xd9)
+		b.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(0xda)
+		msgpackUint16(b, uint16(n))
+	default:
+		b.WriteByte(0xdb)
+		msgpackUint32(b, uint32(n))
+	}
+	b.WriteString(s)
+}
+
+func msgpackInt(b *bytes.Buffer, n int64) {
+	switch {
+	case n >= 0 && n < 128:
+		b.WriteByte(byte(n))
+	case n < 0 && n >= -32:
+		b.WriteByte(byte(n))
+	default:
+		b.WriteByte(0xd3)
+		var buf [8]byte
+		binary.BigEndian.PutUint64(buf[:], uint64(n))
+		b.Write(buf[:])
+	}
+}
+
+func msgpackUint(b *bytes.Buffer, n uint64) {
+	if n < 128 {
+		b.WriteByte(byte(n))
+		return
+	}
+	b.WriteByte(0xcf)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], n)
+	b.Write(buf[:])
+}
+
+func msgpackFloat(b *bytes.Buffer, f float64) {
+	b.WriteByte(0xcb)
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], math.Float64bits(f))
+	b.Write(buf[:])
+}
+
+func msgpackBool(b *bytes.Buffer, v bool) {
+	if v {
+		b.WriteByte(0xc3)
+	} else {
+		b.WriteByte(0xc2)
+	}
+}
+
+// msgpackEventTime writes t as a Fluentd EventTime extension, which holds
+// the time with nanosecond precision.
+func msgpackEventTime(b *bytes.Buffer, t time.Time) {
+	b.WriteByte(0xd7) // fixext 8
+	b.WriteByte(0x00) // EventTime
+	msgpackUint32(b, uint32(t.Unix()))
+	msgpackUint32(b, uint32(t.Nanosecond()))
+}
+
+// msgpackValue writes v, preserving numeric and boolean types.  All other
+// values are converted to strings.
+func msgpackValue(b *bytes.Buffer, v interface{}) {
+	switch data := v.(type) {
+	case nil:
+		b.WriteByte(0xc0)
+	case bool:
+		msgpackBool(b, data)
+	case int:
+		msgpackInt(b, int64(data))
+	case int8:
+		msgpackInt(b, int64(data))
+	case int16:
+		msgpackInt(b, int64(data))
+	case int32:
+		msgpackInt(b, int64(data))
+	case int64:
+		msgpackInt(b, data)
+	case uint:
+		msgpackUint(b, uint64(data))
+	case uint8:
+		msgpackUint(b, uint64(data))
+	case uint16:
+		msgpackUint(b, uint64(data))
+	case uint32:
+		msgpackUint(b, uint64(data))
+	case uint64:
+		msgpackUint(b, data)
+	case float32:
+		msgpackFloat(b, float64(data))
+	case float64:
+		msgpackFloat(b, data)
+	case Metric:
+		msgpackFloat(b, data.Value)
+	default:
+		msgpackString(b, valueString(data))
+	}
+}
+
+func msgpackUint16(b *bytes.Buffer, n uint16) {
+	var buf [2]byte
+	binary.BigEndian.PutUint16(buf[:], n)
+	b.Write(buf[:])
+}
+
+func msgpackUint32(b *bytes.Buffer, n uint32) {
+	var buf [4]byte
+	binary.BigEndian.PutUint32(buf[:], n)
+	b.Write(buf[:])
+}
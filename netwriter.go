@@ -0,0 +1,351 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+var errWriterClosed = errors.New("kvlog: writer closed")
+
+// NetConfig represents a configuration function to be passed to
+// NewNetWriter.
+type NetConfig func(w *NetWriter)
+
+// NetTLS causes stream connections to be made using TLS with the given
+// configuration, such as one returned by NewTLSConfig.
+func NetTLS(cfg *tls.Config) NetConfig {
+	return func(w *NetWriter) {
+		w.tlsConfig = cfg
+	}
+}
+
+// NetBackoff sets the minimum and maximum delay between connection
+// attempts.  The delay starts at min and doubles after each failed attempt
+// up to max.  The defaults are 100ms and 30 seconds.
+func NetBackoff(min, max time.Duration) NetConfig {
+	return func(w *NetWriter) {
+		w.minBackoff = min
+		w.maxBackoff = max
+	}
+}
+
+// NetBufferSize sets the maximum number of entries held in memory while
+// the connection is down.  Once full, the oldest entries are dropped.  The
+// default is 10000.
+func NetBufferSize(n int) NetConfig {
+	return func(w *NetWriter) {
+		w.queuePolicy.Size = n
+	}
+}
+
+// NetQueuePolicy sets how many entries are held in memory awaiting sending
+// and what happens when that limit is reached.  The default is
+// DefaultQueuePolicy.
+func NetQueuePolicy(policy QueuePolicy) NetConfig {
+	return func(w *NetWriter) {
+		w.queuePolicy = policy
+	}
+}
+
+// NetReportFormatter sets the Formatter used for the entries the writer
+// sends to report dropped entries, so they match the format of the rest of
+// the stream.  The default is New().
+func NetReportFormatter(cf *Formatter) NetConfig {
+	return func(w *NetWriter) {
+		w.reportFormatter = cf
+	}
+}
+
+// NetDialTimeout sets the timeout for each connection attempt.  The default
+// is 10 seconds.
+func NetDialTimeout(d time.Duration) NetConfig {
+	return func(w *NetWriter) {
+		w.dialTimeout = d
+	}
+}
+
+// NetErrorHandler sets a function to be called when a connection attempt
+// or write fails.
+func NetErrorHandler(f func(error)) NetConfig {
+	return func(w *NetWriter) {
+		w.onError = f
+	}
+}
+
+// NetWriter is an io.Writer that streams entries to a remote aggregator
+// over TCP, TLS or UDP, reconnecting automatically if the connection fails.
+//
+// eg.
+//
+//	w := kvlog.NewNetWriter("tcp", "logs.example.com:5140")
+//	defer w.Close()
+//	logrus.SetOutput(w)
+//
+// Writes never block on the network: each entry is queued and sent by a
+// background goroutine.  While disconnected, entries are held in memory, up
+// to the limit set by NetQueuePolicy, and sent once the connection has been
+// re-established.  Once the limit is reached, entries are dropped or Write
+// blocks according to the policy.  With stream connections, an entry being
+// written when the connection fails may be lost or received twice.
+//
+// Each call to Write is treated as a single entry and sent as a separate
+// datagram on packet oriented networks such as UDP.
+type NetWriter struct {
+	network         string
+	addr            string
+	tlsConfig       *tls.Config
+	minBackoff      time.Duration
+	maxBackoff      time.Duration
+	queuePolicy     QueuePolicy
+	reportFormatter *Formatter
+	dialTimeout     time.Duration
+	onError         func(error)
+	dialer          func(d *net.Dialer) (net.Conn, error)
+	nulFraming      bool // replace each entry's trailing newline with a NUL
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	space   *sync.Cond // signalled when entries are taken from queue
+	queue   [][]byte
+	drops   dropCounter
+	closed  bool
+	closing chan struct{}
+	done    chan struct{}
+	err     error // error that prevented delivery at close
+}
+
+// NewNetWriter creates a NetWriter that connects to addr on the named
+// network, such as "tcp", "udp" or "unix".  The connection is made in the
+// background, so an unreachable address doesn't prevent creation.
+func NewNetWriter(network, addr string, cfgs ...NetConfig) *NetWriter {
+	w := newNetWriter(network, addr, cfgs)
+	w.start()
+	return w
+}
+
+func newNetWriter(network, addr string, cfgs []NetConfig) *NetWriter {
+	w := &NetWriter{
+		network:         network,
+		addr:            addr,
+		minBackoff:      100 * time.Millisecond,
+		maxBackoff:      30 * time.Second,
+		queuePolicy:     DefaultQueuePolicy,
+		reportFormatter: reportFormatter,
+		dialTimeout:     10 * time.Second,
+		closing:         make(chan struct{}),
+		done:            make(chan struct{}),
+	}
+	for _, cfg := range cfgs {
+		cfg(w)
+	}
+	w.cond = sync.NewCond(&w.mu)
+	w.space = sync.NewCond(&w.mu)
+	return w
+}
+
+// start starts the goroutines that send entries and report those dropped.
+func (w *NetWriter) start() {
+	RegisterShutdown(w)
+	go w.run()
+	if w.queuePolicy.ReportInterval > 0 {
+		go w.drops.run(w.queuePolicy.ReportInterval, w.closing, w.report)
+	}
+}
+
+// Write implements io.Writer, queuing a copy of p to be sent.
+func (w *NetWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	entry := w.frame(p)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if max := w.queuePolicy.Size; max > 0 {
+		for w.queuePolicy.Overflow == Block && len(w.queue) >= max && !w.closed {
+			w.space.Wait()
+		}
+		if !w.closed && len(w.queue) >= max {
+			w.drops.add(dropQueueFull, 1)
+			if w.queuePolicy.Overflow != DropOldest {
+				return len(p), nil
+			}
+			w.queue = w.queue[1:]
+		}
+	}
+	if w.closed {
+		return 0, errWriterClosed
+	}
+	w.queue = append(w.queue, entry)
+	w.cond.Signal()
+	return len(p), nil
+}
+
+// frame returns a copy of p, delimited as required by the destination.
+func (w *NetWriter) frame(p []byte) []byte {
+	entry := append([]byte(nil), p...)
+	if w.nulFraming {
+		entry = append(bytes.TrimRight(entry, "\n"), 0)
+	}
+	return entry
+}
+
+// report queues a dropped entry report, regardless of the queue limit.
+func (w *NetWriter) report(entry *log.Entry) {
+	line, err := w.reportFormatter.Format(entry)
+	if err != nil {
+		return
+	}
+	item := w.frame(line)
+	w.mu.Lock()
+	if !w.closed {
+		w.queue = append(w.queue, item)
+		w.cond.Signal()
+	}
+	w.mu.Unlock()
+}
+
+// Dropped returns the number of entries discarded because the queue was
+// full.
+func (w *NetWriter) Dropped() int64 {
+	return w.drops.dropped()
+}
+
+// Backlog returns the number of entries queued awaiting sending.
+func (w *NetWriter) Backlog() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.queue)
+}
+
+// Close sends any queued entries and closes the connection.  If the
+// connection is down, a single attempt is made to reconnect; if that fails
+// the queued entries are discarded and the error returned.
+func (w *NetWriter) Close() error {
+	UnregisterShutdown(w)
+	if w.queuePolicy.ReportInterval > 0 {
+		w.drops.report(w.report)
+	}
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.closing)
+		w.cond.Signal()
+		w.space.Broadcast()
+	}
+	w.mu.Unlock()
+	<-w.done
+	return w.err
+}
+
+func (w *NetWriter) dial() (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: w.dialTimeout}
+	if w.dialer != nil {
+		return w.dialer(dialer)
+	}
+	if w.tlsConfig != nil {
+		return tls.DialWithDialer(dialer, w.network, w.addr, w.tlsConfig)
+	}
+	return dialer.Dial(w.network, w.addr)
+}
+
+func (w *NetWriter) fail(err error) {
+	observeDeliveryError("net", err)
+	sinkError(w.onError, err)
+}
+
+// run owns the connection, sending queued entries and reconnecting with
+// backoff after failures.
+func (w *NetWriter) run() {
+	defer close(w.done)
+	var conn net.Conn
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	backoff := w.minBackoff
+
+	for {
+		w.mu.Lock()
+		for len(w.queue) == 0 && !w.closed {
+			w.cond.Wait()
+		}
+		batch := w.queue
+		w.queue = nil
+		closing := w.closed
+		w.space.Broadcast()
+		w.mu.Unlock()
+
+		if len(batch) == 0 && closing {
+			return
+		}
+
+		if conn == nil {
+			var err error
+			conn, err = w.dial()
+			if err != nil {
+				w.fail(err)
+				if closing {
+					w.err = err
+					return
+				}
+				w.requeue(batch)
+				w.sleep(backoff)
+				if backoff *= 2; backoff > w.maxBackoff {
+					backoff = w.maxBackoff
+				}
+				continue
+			}
+			backoff = w.minBackoff
+		}
+
+		for i, entry := range batch {
+			if _, err := conn.Write(entry); err != nil {
+				w.fail(err)
+				conn.Close()
+				conn = nil
+				if closing {
+					w.err = err
+					return
+				}
+				w.requeue(batch[i:])
+				break
+			}
+		}
+	}
+}
+
+// requeue returns unsent entries to the front of the queue.  Unless the
+// policy is Block, in which case no more entries are accepted until the
+// queue is emptied, the oldest entries are dropped if the queue is full.
+func (w *NetWriter) requeue(entries [][]byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.queue = append(entries, w.queue...)
+	max := w.queuePolicy.Size
+	if max > 0 && len(w.queue) > max && w.queuePolicy.Overflow != Block {
+		drop := len(w.queue) - max
+		w.queue = w.queue[drop:]
+		w.drops.add(dropQueueFull, drop)
+	}
+}
+
+// sleep waits for d, returning early if the writer is closed.
+func (w *NetWriter) sleep(d time.Duration) {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-w.closing:
+	}
+}
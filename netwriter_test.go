@@ -0,0 +1,134 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bufio"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+// readLines returns a channel receiving each line sent to the first
+// connection accepted by l.
+func readLines(l net.Listener) (<-chan string, <-chan net.Conn) {
+	lines := make(chan string, 100)
+	conns := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conns <- conn
+		s := bufio.NewScanner(conn)
+		for s.Scan() {
+			lines <- s.Text()
+		}
+	}()
+	return lines, conns
+}
+
+func recvLine(t *testing.T, lines <-chan string) string {
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for line")
+	}
+	return ""
+}
+
+func TestNetWriterTCP(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer l.Close()
+	lines, _ := readLines(l)
+
+	w := NewNetWriter("tcp", l.Addr().String())
+	w.Write([]byte("line one\n"))
+	w.Write([]byte("line two\n"))
+	assert.Equal(t, "line one", recvLine(t, lines))
+	assert.Equal(t, "line two", recvLine(t, lines))
+	assert.Nil(t, w.Close())
+
+	_, err = w.Write([]byte("closed\n"))
+	assert.NotNil(t, err)
+}
+
+func TestNetWriterReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addr := l.Addr().String()
+	lines, conns := readLines(l)
+
+	w := NewNetWriter("tcp", addr, NetBackoff(10*time.Millisecond, 50*time.Millisecond))
+	defer w.Close()
+	w.Write([]byte("before\n"))
+	assert.Equal(t, "before", recvLine(t, lines))
+
+	// drop the connection and listener; entries written while the
+	// aggregator is unavailable are buffered until it returns.
+	(<-conns).Close()
+	l.Close()
+
+	l, err = net.Listen("tcp", addr)
+	require.Nil(t, err)
+	defer l.Close()
+	lines, _ = readLines(l)
+
+	// the first write following a dropped connection may be lost, so keep
+	// writing until one arrives.
+	deadline := time.After(5 * time.Second)
+	for {
+		w.Write([]byte("after\n"))
+		select {
+		case line := <-lines:
+			assert.Equal(t, "after", line)
+			return
+		case <-time.After(20 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("timed out waiting for reconnect")
+		}
+	}
+}
+
+func TestNetWriterBuffer(t *testing.T) {
+	// reserve an address with nothing listening on it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	addr := l.Addr().String()
+	l.Close()
+
+	w := NewNetWriter("tcp", addr, NetBufferSize(2), NetBackoff(time.Hour, time.Hour))
+	for i := 0; i < 5; i++ {
+		w.Write([]byte("entry\n"))
+	}
+	assert.True(t, w.Dropped() >= 2, "dropped=%d", w.Dropped())
+	assert.NotNil(t, w.Close())
+}
+
+func TestNetWriterUDP(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer pc.Close()
+
+	w := NewNetWriter("udp", pc.LocalAddr().String())
+	defer w.Close()
+	w.Write([]byte(`ll="info" _msg="one"` + "\n"))
+	w.Write([]byte(`ll="info" _msg="two"` + "\n"))
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, expected := range []string{"one", "two"} {
+		n, _, err := pc.ReadFrom(buf)
+		require.Nil(t, err)
+		assert.Equal(t, `ll="info" _msg="`+expected+`"`+"\n", string(buf[:n]))
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"sync"
+	"sync/atomic"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Observer receives notifications of logging activity, so that it can be
+// exported as metrics, such as by the kvprom package.  Observers are added
+// with RegisterObserver.
+//
+// Methods may be called concurrently and from the goroutine logging an
+// entry, so they should be fast and must not log through kvlog themselves.
+type Observer interface {
+	// LineWritten is called for each line of n bytes formatted by a
+	// Formatter or written by a Logger.
+	LineWritten(level log.Level, n int)
+
+	// FormatFailed is called when an entry can't be formatted, such as one
+	// rejected by WithKeyPolicy.
+	FormatFailed(err error)
+
+	// EntriesDropped is called when n entries are discarded by a sink or
+	// writer.  reason is "queue_full", "send_failed", "circuit_open" or
+	// "rate_limited", as for QueuePolicy reports, or "sampled" for those
+	// discarded by a Sampler.
+	EntriesDropped(reason string, n int)
+
+	// DeliveryFailed is called when a sink fails to deliver entries to its
+	// destination.  sink identifies the type of sink, such as "loki", "otlp",
+	// "hec", "fluent", "net", "spool", "audit" or "output" for the writer of
+	// a Logger.
+	DeliveryFailed(sink string, err error)
+}
+
+var (
+	observerMu sync.Mutex
+	observerV  atomic.Value // []Observer
+)
+
+// RegisterObserver adds o to the set of observers notified of logging
+// activity.
+func RegisterObserver(o Observer) {
+	observerMu.Lock()
+	defer observerMu.Unlock()
+	current := loadObservers()
+	observerV.Store(append(append([]Observer{}, current...), o))
+}
+
+// UnregisterObserver removes o from the set of observers notified of
+// logging activity.
+func UnregisterObserver(o Observer) {
+	observerMu.Lock()
+	defer observerMu.Unlock()
+	current := loadObservers()
+	for i, co := range current {
+		if co == o {
+			updated := append(append([]Observer{}, current[:i]...), current[i+1:]...)
+			observerV.Store(updated)
+			return
+		}
+	}
+}
+
+func loadObservers() []Observer {
+	obs, _ := observerV.Load().([]Observer)
+	return obs
+}
+
+func observeLine(level log.Level, n int) {
+	for _, o := range loadObservers() {
+		o.LineWritten(level, n)
+	}
+}
+
+func observeFormatError(err error) {
+	for _, o := range loadObservers() {
+		o.FormatFailed(err)
+	}
+}
+
+func observeDrops(reason string, n int) {
+	for _, o := range loadObservers() {
+		o.EntriesDropped(reason, n)
+	}
+}
+
+func observeDeliveryError(sink string, err error) {
+	for _, o := range loadObservers() {
+		o.DeliveryFailed(sink, err)
+	}
+}
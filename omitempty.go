@@ -0,0 +1,83 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"reflect"
+	"time"
+)
+
+// EmptyKind selects the kinds of empty value dropped by WithOmitEmpty.
+// Kinds may be combined with |.
+type EmptyKind int
+
+const (
+	// EmptyStrings drops empty strings, including those of types derived
+	// from string such as RawLogString.
+	EmptyStrings EmptyKind = 1 << iota
+
+	// NilValues drops nil values and nil pointers.
+	NilValues
+
+	// ZeroTimes drops zero time.Time values.
+	ZeroTimes
+
+	// EmptyCollections drops slices, arrays and maps of length zero,
+	// including nil slices and maps.
+	EmptyCollections
+
+	// AllEmpty drops every kind of empty value.
+	AllEmpty = EmptyStrings | NilValues | ZeroTimes | EmptyCollections
+)
+
+// WithOmitEmpty causes fields whose values are empty to be dropped, so that
+// lines from code that always sets optional fields aren't cluttered with
+// key="" or key=<nil>.  kinds selects which empty values are dropped; all of
+// them are if none are given.
+//
+// eg.
+//
+//	kvlog.New(kvlog.WithOmitEmpty(kvlog.EmptyStrings | kvlog.NilValues))
+//
+// drops user_agent="" and parent_id=<nil> but keeps tags=[].  The values
+// produced by Loggable values are checked individually.  Constant fields
+// are always emitted.
+//
+// Repeated use adds to the kinds dropped.
+func WithOmitEmpty(kinds ...EmptyKind) Config {
+	return func(kvf *Formatter) {
+		if len(kinds) == 0 {
+			kvf.omitEmpty |= AllEmpty
+		}
+		for _, kind := range kinds {
+			kvf.omitEmpty |= kind
+		}
+	}
+}
+
+// omitted reports whether v is empty and dropped by WithOmitEmpty.
+func (cf *Formatter) omitted(v interface{}) bool {
+	if cf.omitEmpty == 0 {
+		return false
+	}
+	switch v := v.(type) {
+	case nil:
+		return cf.omitEmpty&NilValues != 0
+	case string:
+		return v == "" && cf.omitEmpty&EmptyStrings != 0
+	case time.Time:
+		return v.IsZero() && cf.omitEmpty&ZeroTimes != 0
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.String:
+		return rv.Len() == 0 && cf.omitEmpty&EmptyStrings != 0
+	case reflect.Ptr, reflect.Interface, reflect.Func, reflect.Chan:
+		return rv.IsNil() && cf.omitEmpty&NilValues != 0
+	case reflect.Slice, reflect.Map, reflect.Array:
+		return rv.Len() == 0 && cf.omitEmpty&EmptyCollections != 0
+	}
+	return false
+}
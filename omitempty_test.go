@@ -0,0 +1,61 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestOmitEmpty(t *testing.T) {
+	var nilPtr *string
+	data := log.Fields{
+		"str":    "",
+		"raw":    RawLogString(""),
+		"nil":    nil,
+		"ptr":    nilPtr,
+		"time":   time.Time{},
+		"slice":  []string{},
+		"map":    map[string]int(nil),
+		"group":  Ordered(".a", "", ".b", 1),
+		"zero":   0,
+		"false":  false,
+		"status": "ok",
+	}
+	tests := []struct {
+		name     string
+		kinds    []EmptyKind
+		expected string
+	}{
+		{"all", nil, `false=false group.b=1 status="ok" zero=0`},
+		{"strings", []EmptyKind{EmptyStrings}, `false=false group.b=1 map=map[] nil=<nil> ptr=<nil> slice=[] status="ok" time="0001-01-01 00:00:00 +0000 UTC" zero=0`},
+		{"nil-time", []EmptyKind{NilValues | ZeroTimes}, `false=false group.a="" group.b=1 map=map[] raw= slice=[] status="ok" str="" zero=0`},
+		{"collections", []EmptyKind{EmptyCollections}, `false=false group.a="" group.b=1 nil=<nil> ptr=<nil> raw= status="ok" str="" time="0001-01-01 00:00:00 +0000 UTC" zero=0`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cf := New(WithOmitEmpty(test.kinds...), WithConstantField("app", ""))
+			result, err := cf.Format(&log.Entry{Time: testTime, Level: log.InfoLevel, Data: data})
+			require.Nil(t, err)
+			assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" app="" `+test.expected, strings.TrimSuffix(string(result), "\n"))
+		})
+	}
+}
+
+func TestOmitEmptyTypedFields(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, New(WithOmitEmpty()))
+	logger.Log(log.InfoLevel, "sent", String("user_agent", ""), Int("bytes", 0))
+	assert.Regexp(t, ` ll="info" bytes=0 _msg="sent"\n$`, buf.String())
+}
@@ -0,0 +1,49 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import "fmt"
+
+// KV is a single key/value pair of an OrderedFields value.
+type KV struct {
+	Key   string
+	Value interface{}
+}
+
+// OrderedFields is a list of key/value pairs that are emitted in the order
+// given, rather than sorted, for fields that read better in a logical
+// order such as request, step and result.
+//
+// As with a Loggable value, each key is prefixed with the key of the field
+// holding the OrderedFields and the pairs are emitted in its place.  Using
+// an empty key includes them as top level fields, which sort before any
+// other fields apart from primary fields.
+//
+// eg.
+//
+//	log.WithField("", kvlog.Ordered("request", id, "step", "auth", "result", "ok")).Info("done")
+//
+//	// Output:
+//	//  2017-01-02T12:00:00.000Z ll="info" request="42" step="auth" result="ok" _msg="done"
+type OrderedFields []KV
+
+// Ordered returns an OrderedFields from alternating keys and values.  A key
+// that's not a string is converted to one using fmt.Sprint and a trailing key
+// without a value is given a nil value.
+func Ordered(keysAndValues ...interface{}) OrderedFields {
+	fields := make(OrderedFields, 0, (len(keysAndValues)+1)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key, ok := keysAndValues[i].(string)
+		if !ok {
+			key = fmt.Sprint(keysAndValues[i])
+		}
+		var value interface{}
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		fields = append(fields, KV{key, value})
+	}
+	return fields
+}
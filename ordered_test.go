@@ -0,0 +1,61 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestOrderedFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfgs     []Config
+		data     log.Fields
+		expected string
+	}{
+		{"top-level", nil,
+			log.Fields{"": Ordered("request", 42, "step", "auth", "result", "ok"), "a": 1},
+			`2017-02-13T12:13:45.000Z ll="info" request=42 step="auth" result="ok" a=1 _msg="done"` + "\n"},
+		{"prefixed", nil,
+			log.Fields{"req": OrderedFields{{".path", "/"}, {".method", "GET"}}, "a": 1},
+			`2017-02-13T12:13:45.000Z ll="info" a=1 req.path="/" req.method="GET" _msg="done"` + "\n"},
+		{"primary", []Config{WithPrimaryFields("status")},
+			log.Fields{"": Ordered("z", 1, "y", 2), "status": "ok"},
+			`2017-02-13T12:13:45.000Z ll="info" status="ok" z=1 y=2 _msg="done"` + "\n"},
+		{"json", []Config{WithJSON()},
+			log.Fields{"": Ordered("z", 1, "y", 2)},
+			`{"time":"2017-02-13T12:13:45.000Z","ll":"info","z":1,"y":2,"_msg":"done"}` + "\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := New(test.cfgs...).Format(&log.Entry{
+				Time:    testTime,
+				Level:   log.InfoLevel,
+				Message: "done",
+				Data:    test.data,
+			})
+			require.Nil(t, err)
+			assert.Equal(t, test.expected, string(result))
+		})
+	}
+}
+
+func TestOrderedFieldsLogger(t *testing.T) {
+	var buf bytes.Buffer
+	NewLogger(&buf, New()).Log(log.InfoLevel, "done", Int("a", 1), Any("", Ordered("z", 1, "y", 2)))
+	assert.Regexp(t, ` ll="info" z=1 y=2 a=1 _msg="done"\n$`, buf.String())
+}
+
+func TestOrdered(t *testing.T) {
+	assert.Equal(t, OrderedFields{{"a", 1}, {"2", "b"}, {"c", nil}}, Ordered("a", 1, 2, "b", "c"))
+}
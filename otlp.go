@@ -0,0 +1,314 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// OTLPConfig represents a configuration function to be passed to
+// NewOTLPExporter.
+type OTLPConfig func(e *OTLPExporter)
+
+// OTLPServiceName sets the service.name resource attribute attached to every
+// exported record.
+func OTLPServiceName(name string) OTLPConfig {
+	return func(e *OTLPExporter) {
+		e.resource = append(e.resource, field{"service.name", name})
+	}
+}
+
+// OTLPResourceAttribute adds a resource attribute attached to every exported
+// record, such as "deployment.environment".
+func OTLPResourceAttribute(key string, value interface{}) OTLPConfig {
+	return func(e *OTLPExporter) {
+		e.resource = append(e.resource, field{key, value})
+	}
+}
+
+// OTLPHeader adds an HTTP header to each export request, typically used for
+// authentication.
+func OTLPHeader(key, value string) OTLPConfig {
+	return func(e *OTLPExporter) {
+		e.headers.Add(key, value)
+	}
+}
+
+// OTLPBatch sets the maximum number of records sent in a single export
+// request and the maximum time a record is held before being sent.
+// The defaults are 512 records and 5 seconds.
+func OTLPBatch(size int, interval time.Duration) OTLPConfig {
+	return func(e *OTLPExporter) {
+		e.batchSize = size
+		e.interval = interval
+	}
+}
+
+// OTLPHTTPClient sets the client used to make export requests.
+func OTLPHTTPClient(client *http.Client) OTLPConfig {
+	return func(e *OTLPExporter) {
+		e.client = client
+	}
+}
+
+// OTLPTLS sets the TLS configuration used to make export requests, such as one
+// returned by NewTLSConfig.  It replaces any client set by OTLPHTTPClient.
+func OTLPTLS(cfg *tls.Config) OTLPConfig {
+	return func(e *OTLPExporter) {
+		e.client = tlsHTTPClient(cfg)
+	}
+}
+
+// OTLPRetryPolicy sets how failed export requests are retried.  The
+// default is DefaultRetryPolicy.
+func OTLPRetryPolicy(policy RetryPolicy) OTLPConfig {
+	return func(e *OTLPExporter) {
+		e.retry = policy
+	}
+}
+
+// OTLPQueuePolicy sets how many records are held in memory awaiting
+// sending and what happens when that limit is reached.  The default is
+// DefaultQueuePolicy.
+func OTLPQueuePolicy(policy QueuePolicy) OTLPConfig {
+	return func(e *OTLPExporter) {
+		e.queuePolicy = policy
+	}
+}
+
+// OTLPErrorHandler sets a function to be called if a background export
+// fails.
+func OTLPErrorHandler(f func(error)) OTLPConfig {
+	return func(e *OTLPExporter) {
+		e.onError = f
+	}
+}
+
+// OTLPExporter is a logrus hook that converts each entry into an
+// OpenTelemetry LogRecord and pushes batches of records to a collector using
+// OTLP/HTTP with JSON encoding.
+//
+// Record attributes are taken from the Formatter the exporter is created
+// with, so constant fields, primary field ordering and Loggable values are
+// handled identically to the formatted output.  The entry message becomes
+// the record body and "trace_id" and "span_id" fields populate the record's
+// trace context.
+//
+// Close should be called before the program exits to send any queued
+// records.
+type OTLPExporter struct {
+	cf          *Formatter
+	endpoint    string
+	resource    []field
+	headers     http.Header
+	client      *http.Client
+	retry       RetryPolicy
+	queuePolicy QueuePolicy
+	batchSize   int
+	interval    time.Duration
+	onError     func(error)
+	batch       *batcher
+	deliver     *deliverer
+}
+
+// NewOTLPExporter creates an exporter that sends records to endpoint, which
+// should be the collector's full logs URL, eg.
+// "http://localhost:4318/v1/logs".  The exporter should be registered with
+// logrus using AddHook.
+func NewOTLPExporter(cf *Formatter, endpoint string, cfgs ...OTLPConfig) *OTLPExporter {
+	e := &OTLPExporter{
+		cf:          cf,
+		endpoint:    endpoint,
+		headers:     make(http.Header),
+		client:      http.DefaultClient,
+		retry:       DefaultRetryPolicy,
+		queuePolicy: DefaultQueuePolicy,
+		batchSize:   512,
+		interval:    5 * time.Second,
+	}
+	for _, cfg := range cfgs {
+		cfg(e)
+	}
+	e.deliver = newDeliverer(e.retry, e.client, "OTLP export")
+	e.batch = newBatcher("otlp", e.batchSize, e.interval, e.queuePolicy, e.send, e.encode, e.onError)
+	RegisterShutdown(e)
+	return e
+}
+
+// Levels implements the logrus.Hook interface.
+func (e *OTLPExporter) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements the logrus.Hook interface, queuing the entry for export.
+func (e *OTLPExporter) Fire(entry *log.Entry) error {
+	return e.batch.add(e.encode(entry))
+}
+
+func (e *OTLPExporter) encode(entry *log.Entry) []byte {
+	var b bytes.Buffer
+	e.writeRecord(&b, e.cf.record(entry))
+	return b.Bytes()
+}
+
+// Dropped returns the number of records discarded, either because the
+// queue was full or because they couldn't be exported.
+func (e *OTLPExporter) Dropped() int64 {
+	return e.batch.dropped()
+}
+
+// Backlog returns the number of records queued awaiting sending.
+func (e *OTLPExporter) Backlog() int {
+	return e.batch.backlog()
+}
+
+// Flush synchronously exports all queued records.
+func (e *OTLPExporter) Flush() error {
+	return e.batch.flush()
+}
+
+// Close stops the exporter after exporting any queued records.  Exports are
+// attempted once, without waiting to retry, and a retry in progress is
+// abandoned, so that Close isn't held up by an unavailable endpoint.
+func (e *OTLPExporter) Close() error {
+	UnregisterShutdown(e)
+	e.deliver.close()
+	return e.batch.close()
+}
+
+func (e *OTLPExporter) writeRecord(b *bytes.Buffer, entry *Record) {
+	cf := e.cf
+	ts := strconv.FormatInt(entry.Time.UnixNano(), 10)
+
+	rec := newJSONObject(b)
+	rec.str("timeUnixNano", ts)
+	rec.str("observedTimeUnixNano", strconv.FormatInt(time.Now().UnixNano(), 10))
+	rec.field("severityNumber", otlpSeverity(entry.level()))
+	rec.str("severityText", strings.ToUpper(entry.level().String()))
+	if entry.Message != "" {
+		rec.key("body")
+		writeOTLPValue(b, entry.Message)
+	}
+
+	fc := cf.fields()
+	fields := cf.entryFields(fc, entry)
+	rec.key("attributes")
+	b.WriteByte('[')
+	n := 0
+	attr := func(k string, v interface{}) {
+		if n > 0 {
+			b.WriteByte(',')
+		}
+		n++
+		writeOTLPAttribute(b, k, v)
+	}
+	if cf.includeCaller {
+		if name, line := cf.caller(entry); name != "" {
+			attr("code.function", name)
+			attr("code.lineno", line)
+		}
+	}
+	for _, f := range cf.entryConstants(fc, fields) {
+		attr(f.key, f.value)
+	}
+	for _, f := range fields {
+		if f.key == "trace_id" || f.key == "span_id" {
+			continue
+		}
+		attr(f.key, f.value)
+	}
+	b.WriteByte(']')
+
+	for _, f := range fields {
+		switch f.key {
+		case "trace_id":
+			rec.str("traceId", valueString(f.value))
+		case "span_id":
+			rec.str("spanId", valueString(f.value))
+		}
+	}
+	rec.close()
+}
+
+func (e *OTLPExporter) send(records [][]byte) error {
+	var b bytes.Buffer
+	b.WriteString(`{"resourceLogs":[{"resource":{"attributes":[`)
+	for i, f := range e.resource {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		writeOTLPAttribute(&b, f.key, f.value)
+	}
+	b.WriteString(`]},"scopeLogs":[{"scope":{"name":"github.com/gwatts/kvlog"},"logRecords":[`)
+	b.Write(bytes.Join(records, []byte{','}))
+	b.WriteString(`]}]}]}`)
+
+	return e.deliver.do(func() (*http.Request, error) {
+		req, err := http.NewRequest("POST", e.endpoint, bytes.NewReader(b.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range e.headers {
+			req.Header[k] = v
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	})
+}
+
+// otlpSeverity maps a logrus level to an OpenTelemetry SeverityNumber.
+func otlpSeverity(level log.Level) int {
+	switch level {
+	case log.PanicLevel:
+		return 24
+	case log.FatalLevel:
+		return 21
+	case log.ErrorLevel:
+		return 17
+	case log.WarnLevel:
+		return 13
+	case log.InfoLevel:
+		return 9
+	default:
+		return 5
+	}
+}
+
+func writeOTLPAttribute(b *bytes.Buffer, k string, v interface{}) {
+	obj := newJSONObject(b)
+	obj.str("key", k)
+	obj.key("value")
+	writeOTLPValue(b, v)
+	obj.close()
+}
+
+// writeOTLPValue writes v as an OTLP AnyValue, preserving numeric and
+// boolean types.  All other values are converted to strings.
+func writeOTLPValue(b *bytes.Buffer, v interface{}) {
+	obj := newJSONObject(b)
+	switch data := v.(type) {
+	case bool:
+		obj.field("boolValue", data)
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32:
+		obj.str("intValue", fmt.Sprintf("%d", data))
+	case uint64:
+		obj.str("intValue", strconv.FormatUint(data, 10))
+	case float32, float64:
+		obj.field("doubleValue", data)
+	case Metric:
+		obj.field("doubleValue", data.Value)
+	default:
+		obj.str("stringValue", valueString(data))
+	}
+	obj.close()
+}
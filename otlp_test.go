@@ -0,0 +1,116 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+type otlpRequest struct {
+	ResourceLogs []struct {
+		Resource struct {
+			Attributes []otlpAttribute
+		}
+		ScopeLogs []struct {
+			LogRecords []struct {
+				TimeUnixNano   string
+				SeverityNumber int
+				SeverityText   string
+				Body           map[string]interface{}
+				Attributes     []otlpAttribute
+				TraceID        string `json:"traceId"`
+				SpanID         string `json:"spanId"`
+			}
+		}
+	}
+}
+
+type otlpAttribute struct {
+	Key   string
+	Value map[string]interface{}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	var mu sync.Mutex
+	var reqs []otlpRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		var req otlpRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Errorf("invalid request body %s: %v", body, err)
+		}
+		assert.Equal("secret", r.Header.Get("Authorization"))
+		mu.Lock()
+		reqs = append(reqs, req)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	exp := NewOTLPExporter(
+		New(WithConstantField("commit", "abcd")),
+		srv.URL,
+		OTLPServiceName("test-svc"),
+		OTLPHeader("Authorization", "secret"),
+		OTLPBatch(10, time.Hour))
+
+	logger := log.New()
+	logger.Out = ioutil.Discard
+	logger.Hooks.Add(exp)
+	logger.WithFields(log.Fields{
+		"count":    3,
+		"ratio":    0.5,
+		"ok":       true,
+		"trace_id": "0af7651916cd43dd8448eb211c80319c",
+		"span_id":  "b7ad6b7169203331",
+	}).Warn("test message")
+	logger.Info("second")
+
+	require.Nil(exp.Close())
+	require.Len(reqs, 1)
+	rl := reqs[0].ResourceLogs[0]
+	assert.Equal([]otlpAttribute{{"service.name", map[string]interface{}{"stringValue": "test-svc"}}}, rl.Resource.Attributes)
+
+	recs := rl.ScopeLogs[0].LogRecords
+	require.Len(recs, 2)
+	rec := recs[0]
+	assert.Equal(13, rec.SeverityNumber)
+	assert.Equal("WARNING", rec.SeverityText)
+	assert.Equal(map[string]interface{}{"stringValue": "test message"}, rec.Body)
+	assert.Equal("0af7651916cd43dd8448eb211c80319c", rec.TraceID)
+	assert.Equal("b7ad6b7169203331", rec.SpanID)
+	assert.Equal([]otlpAttribute{
+		{"commit", map[string]interface{}{"stringValue": "abcd"}},
+		{"count", map[string]interface{}{"intValue": "3"}},
+		{"ok", map[string]interface{}{"boolValue": true}},
+		{"ratio", map[string]interface{}{"doubleValue": 0.5}},
+	}, rec.Attributes)
+	assert.Equal(9, recs[1].SeverityNumber)
+}
+
+func TestOTLPExporterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	exp := NewOTLPExporter(New(), srv.URL, OTLPRetryPolicy(RetryPolicy{}))
+	exp.Fire(&log.Entry{Time: testTime, Level: log.InfoLevel, Message: "msg"})
+	assert.NotNil(t, exp.Close())
+}
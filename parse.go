@@ -0,0 +1,421 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const timestampFormat = "2006-01-02T15:04:05.000Z"
+
+// Entry is a log entry decoded from a k=v log line by Parse.
+type Entry struct {
+	Time    time.Time
+	Level   log.Level
+	Caller  string // calling function name, if IncludeCaller was used
+	Line    int    // calling line number, or 0 if not known
+	Message string
+
+	// Checksummed is true if the line had a valid _cksum field, as added by
+	// WithChecksum.
+	Checksummed bool
+
+	// Fields holds all other values from the line.  Quoted values are
+	// unquoted into strings; unquoted values are converted to int64, float64
+	// or bool where possible and a value of <nil> is returned as nil.
+	// Any other value is returned as a string.
+	Fields map[string]interface{}
+
+	// Keys holds the keys of Fields in the order they appeared in the line.
+	Keys []string
+
+	// verbatim holds the text of values that wouldn't be reproduced by
+	// formatting their parsed value, such as unquoted Marshaler output,
+	// so that LogEntry can restore them.
+	verbatim map[string]verbatimValue
+}
+
+// verbatimValue is the parsed value of a field and its text in the line.
+type verbatimValue struct {
+	value interface{}
+	text  string
+}
+
+// Group returns the fields whose keys begin with prefix followed by a dot,
+// as produced by a Loggable value whose keys begin with a dot, with the
+// prefix and dot removed from their keys.
+//
+// eg. Group("exec_times") for a line including exec_times.max_ms=93 would
+// return a map with a "max_ms" key.  Nil is returned if there are no
+// matching keys.
+func (e Entry) Group(prefix string) map[string]interface{} {
+	var group map[string]interface{}
+	prefix += "."
+	for _, k := range e.Keys {
+		if !strings.HasPrefix(k, prefix) {
+			continue
+		}
+		sk := k[len(prefix):]
+		if group == nil {
+			group = make(map[string]interface{})
+		}
+		group[sk] = e.Fields[k]
+	}
+	return group
+}
+
+// LogEntry converts e into a logrus entry so that it can be rendered by a
+// Formatter.  The caller, if known, is included in the entry's data as
+// srcfnc and srcline fields.
+//
+// Values that were written verbatim, such as by a Marshaler, are included
+// as a RawLogString of their original text, unless they've been changed
+// since the line was parsed, so that a line formatted by a Formatter with
+// default settings is reproduced exactly by formatting its parsed entry.
+func (e Entry) LogEntry() *log.Entry {
+	data := make(log.Fields, len(e.Fields)+2)
+	for k, v := range e.Fields {
+		if vv, ok := e.verbatim[k]; ok && vv.value == v {
+			data[k] = RawLogString(vv.text)
+			continue
+		}
+		data[k] = v
+	}
+	if e.Caller != "" {
+		data["srcfnc"] = e.Caller
+		if e.Line > 0 {
+			data["srcline"] = e.Line
+		}
+	}
+	return &log.Entry{
+		Time:    e.Time,
+		Level:   e.Level,
+		Message: e.Message,
+		Data:    data,
+	}
+}
+
+// SyntaxError describes a log line that could not be parsed.
+type SyntaxError struct {
+	msg    string
+	Offset int // byte offset in the line at which the error occurred
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("kvlog: %s at offset %d", e.msg, e.Offset)
+}
+
+// Parse decodes a single k=v log line as produced by a Formatter, reversing
+// the quoting applied to values.  A trailing newline is ignored.
+//
+// The timestamp, level, caller and message are returned in their own Entry
+// fields; all other values are returned in Fields.  Values produced by a
+// Marshaler are included verbatim in the log line and so may not be
+// recovered exactly if they contain spaces or quotes, unless the Formatter
+// used WithStrictValues.
+//
+// Formatting the result of the entry's LogEntry method with a Formatter
+// using the same settings as the one that produced the line, other than
+// a checksum, reproduces the line exactly.
+//
+// A trailing _cksum field, as added by WithChecksum, is verified and
+// removed; ErrChecksum is returned if it doesn't match the line.  A
+// trailing _sig field, as added by SigningWriter, is removed without being
+// verified; use a Verifier to check it.
+func Parse(line []byte) (Entry, error) {
+	line = bytes.TrimRight(line, "\r\n")
+	entry := Entry{Fields: make(map[string]interface{})}
+
+	line, _, _ = splitSignature(line)
+	line, present, valid := splitChecksum(line)
+	if present && !valid {
+		return Entry{}, ErrChecksum
+	}
+	entry.Checksummed = present
+
+	sp := bytes.IndexByte(line, ' ')
+	if sp == -1 {
+		sp = len(line)
+	}
+	t, err := time.Parse(timestampFormat, string(line[:sp]))
+	if err != nil {
+		return Entry{}, &SyntaxError{"invalid timestamp", 0}
+	}
+	entry.Time = t
+
+	hasLevel := false
+	p := sp
+	for p < len(line) {
+		if line[p] == ' ' {
+			p++
+			continue
+		}
+		eq := bytes.IndexByte(line[p:], '=')
+		if eq < 1 {
+			return Entry{}, &SyntaxError{"missing key", p}
+		}
+		key := string(line[p : p+eq])
+		for _, c := range line[p : p+eq] {
+			if unsafeKeyByte(c) {
+				return Entry{}, &SyntaxError{"malformed key", p}
+			}
+		}
+		p += eq + 1
+		start := p
+
+		var value interface{}
+		var text string
+		canonical := true
+		if p < len(line) && line[p] == '"' {
+			end, ok := quotedEnd(line, p)
+			if !ok {
+				return Entry{}, &SyntaxError{"unterminated quoted value", p}
+			}
+			text = string(line[p:end])
+			s, err := strconv.Unquote(text)
+			if err != nil {
+				return Entry{}, &SyntaxError{"invalid quoted value", p}
+			}
+			value = s
+			canonical = string(appendQuoted(nil, s)) == text
+			p = end
+		} else {
+			end := rawEnd(line, p)
+			text = string(line[p:end])
+			value = parseRaw(text)
+			_, isStr := value.(string)
+			canonical = !isStr
+			p = end
+		}
+
+		switch {
+		case key == "ll" && !hasLevel:
+			level, err := log.ParseLevel(fmt.Sprint(value))
+			if err != nil {
+				return Entry{}, &SyntaxError{"invalid level", start}
+			}
+			entry.Level = level
+			hasLevel = true
+		case key == "srcfnc" && entry.Caller == "" && canonical && value != "":
+			entry.Caller, _ = value.(string)
+		case key == "srcline" && entry.Line == 0 && entry.Caller != "" && isPositive(value):
+			entry.Line = int(value.(int64))
+		case key == "_msg" && p == len(line) && canonical:
+			// the message is always last; an earlier _msg is a field
+			entry.Message = fmt.Sprint(value)
+		default:
+			if _, ok := entry.Fields[key]; !ok {
+				entry.Keys = append(entry.Keys, key)
+			}
+			entry.Fields[key] = value
+			if canonical {
+				delete(entry.verbatim, key)
+				break
+			}
+			if entry.verbatim == nil {
+				entry.verbatim = make(map[string]verbatimValue)
+			}
+			entry.verbatim[key] = verbatimValue{value, text}
+		}
+	}
+	if !hasLevel {
+		return Entry{}, &SyntaxError{"missing level", len(line)}
+	}
+	return entry, nil
+}
+
+// LineField returns the value of key in a formatted line, which may be
+// either a k=v line or a JSON object such as produced by WithJSON, as a
+// string.  It's intended for writers that route or partition lines by the
+// value of a field.  ok is false if the line can't be parsed or doesn't
+// include key.
+func LineField(line []byte, key string) (value string, ok bool) {
+	line = bytes.TrimSpace(line)
+	if len(line) > 0 && line[0] == '{' {
+		var obj map[string]interface{}
+		if json.Unmarshal(line, &obj) != nil {
+			return "", false
+		}
+		v, ok := obj[key]
+		if !ok {
+			return "", false
+		}
+		if s, isStr := v.(string); isStr {
+			return s, true
+		}
+		return fmt.Sprint(v), true
+	}
+	entry, err := Parse(line)
+	if err != nil {
+		return "", false
+	}
+	v, ok := entry.Fields[key]
+	if !ok {
+		return "", false
+	}
+	if s, isStr := v.(string); isStr {
+		return s, true
+	}
+	return fmt.Sprint(v), true
+}
+
+// AddFields returns a copy of a formatted line, either a k=v line or a JSON
+// object, with fields added, for tools that annotate lines already written.
+// On a k=v line they're added before the message and any _cksum field is
+// recalculated.  A _sig field, which would no longer match, is removed.
+func AddFields(line []byte, fields ...Field) []byte {
+	body := bytes.TrimRight(line, "\r\n")
+	if unsigned, _, ok := splitSignature(body); ok {
+		line = append(unsigned[:len(unsigned):len(unsigned)], line[len(body):]...)
+	}
+	add := make([]field, len(fields))
+	for i, f := range fields {
+		add[i] = field{f.key, f.value()}
+	}
+	return addLineFields(line, add...)
+}
+
+// addLineFields returns a copy of a formatted line with fields added.  On
+// a k=v line they're added before the message, which is always last apart
+// from any checksum, which is recalculated, and on a JSON line they're
+// added as members of the object.
+func addLineFields(line []byte, fields ...field) []byte {
+	body := bytes.TrimRight(line, "\r\n")
+	nl := line[len(body):]
+	var b bytes.Buffer
+	if n := len(body); n > 0 && body[0] == '{' && body[n-1] == '}' {
+		b.Write(body[:n-1])
+		members := bytes.TrimSpace(body[1 : n-1])
+		for i, f := range fields {
+			if i > 0 || len(members) > 0 {
+				b.WriteByte(',')
+			}
+			writeJSONString(&b, f.key)
+			b.WriteByte(':')
+			writeJSONValue(&b, f.value)
+		}
+		b.WriteByte('}')
+	} else {
+		body, checksummed, _ := splitChecksum(body)
+		end := msgOffset(body)
+		b.Write(body[:end])
+		for _, f := range fields {
+			reportFormatter.emit(&b, f.key, f.value, 0)
+		}
+		b.Write(body[end:])
+		if checksummed {
+			sum := appendChecksum(b.Bytes())
+			b.Reset()
+			b.Write(sum)
+		}
+	}
+	b.Write(nl)
+	return b.Bytes()
+}
+
+// msgOffset returns the offset of the space preceding the _msg key of a k=v
+// line, or the length of the line if it has no message.
+func msgOffset(line []byte) int {
+	p := bytes.IndexByte(line, ' ')
+	if p == -1 {
+		return len(line)
+	}
+	for p < len(line) {
+		if line[p] == ' ' {
+			p++
+			continue
+		}
+		eq := bytes.IndexByte(line[p:], '=')
+		if eq < 1 {
+			return len(line)
+		}
+		if string(line[p:p+eq]) == "_msg" {
+			return p - 1
+		}
+		p += eq + 1
+		if p < len(line) && line[p] == '"' {
+			end, ok := quotedEnd(line, p)
+			if !ok {
+				return len(line)
+			}
+			p = end
+		} else {
+			p = rawEnd(line, p)
+		}
+	}
+	return len(line)
+}
+
+// quotedEnd returns the offset following the closing quote of the quoted
+// string starting at line[start].
+func quotedEnd(line []byte, start int) (int, bool) {
+	for i := start + 1; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1, true
+		}
+	}
+	return 0, false
+}
+
+// rawEnd returns the end offset of the unquoted value starting at
+// line[start].  The value ends at the next space that is followed by a
+// key=value pair, so that verbatim Marshaler values containing spaces are
+// kept intact where possible.
+func rawEnd(line []byte, start int) int {
+	p := start
+	for {
+		sp := bytes.IndexByte(line[p:], ' ')
+		if sp == -1 {
+			return len(line)
+		}
+		p += sp
+		next := line[p+1:]
+		if end := bytes.IndexByte(next, ' '); end != -1 {
+			next = next[:end]
+		}
+		if len(next) == 0 || bytes.IndexByte(next, '=') > 0 {
+			return p
+		}
+		p++
+	}
+}
+
+// parseRaw converts an unquoted value to the most specific type possible.
+// Numbers are only converted if they'd be formatted the same way, so that
+// values such as 007 or 1e5 aren't changed, nor precision lost from
+// integers too large for an int64.
+func parseRaw(s string) interface{} {
+	switch s {
+	case "<nil>":
+		return nil
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(n, 10) == s {
+		return n
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && strconv.FormatFloat(f, 'g', -1, 64) == s {
+		return f
+	}
+	return s
+}
+
+// isPositive reports whether v is an int64 greater than zero.
+func isPositive(v interface{}) bool {
+	n, ok := v.(int64)
+	return ok && n > 0
+}
@@ -0,0 +1,155 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestParseRoundTrip(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cf := New(WithConstantField("commit", "abcd"))
+	line, err := cf.Format(&log.Entry{
+		Time:    testTime,
+		Level:   log.WarnLevel,
+		Message: "test \"message\"\n",
+		Data: log.Fields{
+			"str":        "str with spaces",
+			"int":        -123,
+			"float":      1.5,
+			"bool":       true,
+			"err":        errors.New("test error"),
+			"unicode":    "café",
+			"nil":        nil,
+			"raw":        RawLogString("raw value"),
+			"exec_times": testLoggable{"min": 5, "max": 93},
+		},
+	})
+	require.Nil(err)
+
+	entry, err := Parse(line)
+	require.Nil(err)
+	assert.True(testTime.Equal(entry.Time))
+	assert.Equal(log.WarnLevel, entry.Level)
+	assert.Equal("test \"message\"\n", entry.Message)
+	assert.Equal(map[string]interface{}{
+		"commit":         "abcd",
+		"bool":           true,
+		"err":            "test error",
+		"exec_times.max": int64(93),
+		"exec_times.min": int64(5),
+		"float":          1.5,
+		"int":            int64(-123),
+		"nil":            nil,
+		"raw":            "raw value",
+		"str":            "str with spaces",
+		"unicode":        "café",
+	}, entry.Fields)
+	assert.Equal([]string{"commit", "bool", "err", "exec_times.max", "exec_times.min",
+		"float", "int", "nil", "raw", "str", "unicode"}, entry.Keys)
+	assert.Equal(map[string]interface{}{"max": int64(93), "min": int64(5)}, entry.Group("exec_times"))
+	assert.Nil(entry.Group("missing"))
+}
+
+func TestParseCaller(t *testing.T) {
+	assert := assert.New(t)
+
+	entry, err := Parse([]byte(`2017-02-13T12:13:45.000Z ll="info" srcfnc="(*T).run" srcline=42 a=1` + "\n"))
+	assert.Nil(err)
+	assert.Equal("(*T).run", entry.Caller)
+	assert.Equal(42, entry.Line)
+	assert.Equal(map[string]interface{}{"a": int64(1)}, entry.Fields)
+}
+
+var parseErrorTests = []struct {
+	name   string
+	line   string
+	offset int
+}{
+	{"empty", "", 0},
+	{"bad-time", `yesterday ll="info"`, 0},
+	{"no-level", `2017-02-13T12:13:45.000Z a=1`, 28},
+	{"bad-level", `2017-02-13T12:13:45.000Z ll="loud"`, 28},
+	{"unterminated", `2017-02-13T12:13:45.000Z ll="info" a="foo`, 37},
+	{"no-key", `2017-02-13T12:13:45.000Z ll="info" =1`, 35},
+}
+
+func TestParseErrors(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, test := range parseErrorTests {
+		_, err := Parse([]byte(test.line))
+		if serr, ok := err.(*SyntaxError); assert.True(ok, test.name+" should return a SyntaxError") {
+			assert.Equal(test.offset, serr.Offset, test.name+" offset should match")
+		}
+	}
+}
+
+func TestAddFields(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected string
+	}{
+		{"kv", `2017-02-13T12:13:45.000Z ll="info" a=1 _msg="x"` + "\n", `2017-02-13T12:13:45.000Z ll="info" a=1 source="web" n=2 _msg="x"` + "\n"},
+		{"kv-no-msg", `2017-02-13T12:13:45.000Z ll="info"`, `2017-02-13T12:13:45.000Z ll="info" source="web" n=2`},
+		{"json", `{"ll":"info"}`, `{"ll":"info","source":"web","n":2}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			line := AddFields([]byte(test.line), String("source", "web"), Int("n", 2))
+			assert.Equal(t, test.expected, string(line))
+		})
+	}
+}
+
+func TestAddFieldsChecksumSignature(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(NewSigningWriter(&buf, []byte("secret")), New(WithChecksum()))
+	logger.Log(log.InfoLevel, "x", Int("a", 1))
+
+	line := AddFields(buf.Bytes(), String("source", "web"))
+	assert.NotContains(t, string(line), "_sig=")
+	entry, err := Parse(bytes.TrimSpace(line))
+	require.Nil(t, err)
+	assert.Equal(t, "web", entry.Fields["source"])
+	assert.Equal(t, "x", entry.Message)
+}
+
+func TestLineField(t *testing.T) {
+	tests := []struct {
+		name  string
+		line  string
+		value string
+		ok    bool
+	}{
+		{"kv-string", `2017-02-13T12:13:45.000Z ll="info" tenant_id="acme" _msg="x"` + "\n", "acme", true},
+		{"kv-number", `2017-02-13T12:13:45.000Z ll="info" tenant_id=42`, "42", true},
+		{"kv-missing", `2017-02-13T12:13:45.000Z ll="info" other="x"`, "", false},
+		{"json-string", `{"time":"2017-02-13T12:13:45.000Z","ll":"info","tenant_id":"acme"}` + "\n", "acme", true},
+		{"json-number", `{"tenant_id":42}`, "42", true},
+		{"json-missing", `{"other":"x"}`, "", false},
+		{"invalid", `not a log line`, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, ok := LineField([]byte(test.line), "tenant_id")
+			assert.Equal(t, test.ok, ok)
+			assert.Equal(t, test.value, value)
+		})
+	}
+}
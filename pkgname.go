@@ -5,7 +5,6 @@
 package kvlog
 
 import (
-	"runtime"
 	"strings"
 )
 
@@ -31,11 +30,3 @@ func pkgname(name string) (string, string) {
 
 	return name[:termDot], fullName[termDot+1:]
 }
-
-func pkgnameForPC(pc uintptr) (string, string) {
-	f := runtime.FuncForPC(pc)
-	if f == nil {
-		return "", ""
-	}
-	return pkgname(f.Name())
-}
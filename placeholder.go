@@ -0,0 +1,77 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"strings"
+)
+
+// WithPrimaryPlaceholder causes every primary field set by WithPrimaryFields
+// to be emitted, with placeholder as its value if an entry doesn't include
+// it, so that primary fields stay in the same columns from line to line
+// for people scanning a terminal and for tools that split lines on spaces.
+//
+// eg.
+//
+//	kvlog.New(kvlog.WithPrimaryFields("action", "status"), kvlog.WithPrimaryPlaceholder("-"))
+//
+// emits status=- for an entry without a status.  placeholder is written
+// verbatim, as a RawLogString would be, so it should be a value that
+// wouldn't otherwise be logged.  Primary fields dropped by options such as
+// WithOmitEmpty or WithDeniedKeys are also replaced.  Placeholders are only
+// used in the default k=v format, not by output modes such as WithJSON or
+// WithPretty, nor for keys that are also constant fields.
+func WithPrimaryPlaceholder(placeholder string) Config {
+	return func(kvf *Formatter) {
+		kvf.placeholder = RawLogString(placeholder)
+	}
+}
+
+// fillPrimary returns fields with a placeholder inserted for each primary
+// field that's absent, if set by WithPrimaryPlaceholder.  Primary fields,
+// including those expanded from a Loggable value, are expected to be at the
+// start of fields in the order they were declared.
+func (cf *Formatter) fillPrimary(fc *fieldConfig, fields []field) []field {
+	if cf.placeholder == nil || cf.encode != nil || len(fc.primaryFields) == 0 {
+		return fields
+	}
+	var filled []field
+	copied, i := 0, 0
+	for _, pk := range fc.primaryFields {
+		start := i
+		for i < len(fields) && isPrimaryKey(fields[i].key, pk) {
+			i++
+		}
+		if i > start || isConstant(fc, pk) {
+			continue
+		}
+		if filled == nil {
+			filled = make([]field, 0, len(fields)+len(fc.primaryFields))
+		}
+		filled = append(filled, fields[copied:i]...)
+		filled = append(filled, field{pk, cf.placeholder})
+		copied = i
+	}
+	if filled == nil {
+		return fields
+	}
+	return append(filled, fields[copied:]...)
+}
+
+// isPrimaryKey reports whether k is the primary field pk, or one of the
+// keys expanded from it by a Loggable value.
+func isPrimaryKey(k, pk string) bool {
+	return strings.HasPrefix(k, pk) && (len(k) == len(pk) || k[len(pk)] == '.')
+}
+
+// isConstant reports whether k is the key of a constant field.
+func isConstant(fc *fieldConfig, k string) bool {
+	for _, c := range fc.constants {
+		if c.key == k {
+			return true
+		}
+	}
+	return false
+}
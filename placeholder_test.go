@@ -0,0 +1,55 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestPrimaryPlaceholder(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfgs     []Config
+		data     log.Fields
+		expected string
+	}{
+		{"all-present", nil, log.Fields{"action": "login", "status": 200, "user": "joe"}, `action="login" status=200 user="joe"`},
+		{"first-absent", nil, log.Fields{"status": 200, "user": "joe"}, `action=- status=200 user="joe"`},
+		{"last-absent", nil, log.Fields{"action": "login", "user": "joe"}, `action="login" status=- user="joe"`},
+		{"none", nil, log.Fields{}, `action=- status=-`},
+		{"loggable", nil, log.Fields{"action": Ordered(".name", "login")}, `action.name="login" status=-`},
+		{"omitted", []Config{WithOmitEmpty()}, log.Fields{"action": "", "status": 200}, `action=- status=200`},
+		{"unsorted", []Config{WithUnsortedFields()}, log.Fields{"status": 200}, `action=- status=200`},
+		{"constant", []Config{WithConstantField("action", "boot")}, log.Fields{}, `action="boot" status=-`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfgs := append([]Config{WithPrimaryFields("action", "status"), WithPrimaryPlaceholder("-")}, test.cfgs...)
+			result, err := New(cfgs...).Format(&log.Entry{Time: testTime, Level: log.InfoLevel, Data: test.data})
+			require.Nil(t, err)
+			assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" `+test.expected, strings.TrimSuffix(string(result), "\n"))
+		})
+	}
+}
+
+func TestPrimaryPlaceholderOutputModes(t *testing.T) {
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, New(WithPrimaryFields("status"), WithPrimaryPlaceholder("-")))
+	logger.Log(log.InfoLevel, "typed", Int("bytes", 10))
+	assert.Regexp(t, ` ll="info" status=- bytes=10 _msg="typed"\n$`, buf.String())
+
+	result, err := New(WithJSON(), WithPrimaryFields("status"), WithPrimaryPlaceholder("-")).Format(&log.Entry{Time: testTime, Level: log.InfoLevel})
+	require.Nil(t, err)
+	assert.NotContains(t, string(result), "status")
+}
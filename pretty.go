@@ -0,0 +1,156 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	prettyIndent = "    "
+	prettyWidth  = 100
+)
+
+// WithPretty causes the Formatter to emit each entry over multiple lines for
+// easier reading during local development.
+//
+// The first line holds the timestamp, level and message and is followed by
+// one indented "key: value" line per field in the usual order, with values
+// formatted as they would be in k=v output.  Values that would extend a line
+// beyond 100 columns are wrapped onto continuation lines.  Pretty output may
+// be combined with WithColor.
+//
+// eg.
+//
+//	2017-01-02T12:00:00.000Z INFO  User logged in
+//	    action:   "user_login"
+//	    status:   "ok"
+//	    username: "joe_user"
+func WithPretty() Config {
+	return func(kvf *Formatter) {
+		kvf.encode = encodePretty
+	}
+}
+
+func encodePretty(cf *Formatter, b *bytes.Buffer, entry *Record) {
+	if cf.color {
+		b.WriteString(colorFaint)
+	}
+	cf.emitTimestamp(b, entry.Time)
+	if cf.color {
+		b.WriteString(colorReset)
+	}
+	b.WriteByte(' ')
+	if cf.color {
+		b.WriteString(colorBold)
+		b.WriteString(levelColor(entry.level()))
+	}
+	b.WriteString(prettyLevel(entry.level()))
+	if cf.color {
+		b.WriteString(colorReset)
+	}
+	if entry.Message != "" {
+		b.WriteByte(' ')
+		b.WriteString(entry.Message)
+	}
+	b.WriteByte('\n')
+
+	var fields []field
+	if cf.includeCaller {
+		if name, line := cf.caller(entry); name == "" {
+			fields = append(fields, field{"srcfnc", "unknown"})
+		} else {
+			fields = append(fields, field{"srcfnc", name}, field{"srcline", line})
+		}
+	}
+	fc := cf.fields()
+	entryFields := cf.entryFields(fc, entry)
+	fields = append(fields, cf.entryConstants(fc, entryFields)...)
+	fields = append(fields, entryFields...)
+
+	keyWidth := 0
+	for i, f := range fields {
+		fields[i].key = sanitizeKey(f.key)
+		if n := utf8.RuneCountInString(fields[i].key); n > keyWidth {
+			keyWidth = n
+		}
+	}
+
+	var val bytes.Buffer
+	for _, f := range fields {
+		val.Reset()
+		cf.emitValue(&val, f.value)
+
+		b.WriteString(prettyIndent)
+		if cf.color {
+			b.WriteString(colorCyan)
+		}
+		b.WriteString(f.key)
+		b.WriteByte(':')
+		if cf.color {
+			b.WriteString(colorReset)
+		}
+		pad := keyWidth - utf8.RuneCountInString(f.key) + 1
+		b.WriteString(strings.Repeat(" ", pad))
+
+		if cf.color {
+			if val.Len() > 0 && val.Bytes()[0] == '"' {
+				b.WriteString(colorGreen)
+			} else {
+				b.WriteString(colorMagenta)
+			}
+		}
+		col := len(prettyIndent) + keyWidth + 2
+		writeWrapped(b, val.String(), col, prettyWidth)
+		if cf.color {
+			b.WriteString(colorReset)
+		}
+		b.WriteByte('\n')
+	}
+}
+
+// writeWrapped writes s, which starts at column col, breaking it onto
+// continuation lines indented to col so that no line exceeds width columns.
+func writeWrapped(b *bytes.Buffer, s string, col, width int) {
+	avail := width - col
+	if avail < 20 {
+		avail = 20
+	}
+	for utf8.RuneCountInString(s) > avail {
+		i, n := 0, 0
+		for n < avail {
+			_, size := utf8.DecodeRuneInString(s[i:])
+			i += size
+			n++
+		}
+		b.WriteString(s[:i])
+		b.WriteByte('\n')
+		b.WriteString(strings.Repeat(" ", col))
+		s = s[i:]
+	}
+	b.WriteString(s)
+}
+
+// prettyLevel returns level as an upper case string padded to a fixed width.
+func prettyLevel(level log.Level) string {
+	switch level {
+	case log.PanicLevel:
+		return "PANIC"
+	case log.FatalLevel:
+		return "FATAL"
+	case log.ErrorLevel:
+		return "ERROR"
+	case log.WarnLevel:
+		return "WARN "
+	case log.InfoLevel:
+		return "INFO "
+	default:
+		return "DEBUG"
+	}
+}
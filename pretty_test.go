@@ -0,0 +1,60 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestPretty(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cf := New(
+		WithConstantField("commit", "abcd"),
+		WithPrimaryFields("status"),
+		WithPretty())
+	result, err := cf.Format(&log.Entry{
+		Time:    testTime,
+		Level:   log.WarnLevel,
+		Message: "test message",
+		Data: log.Fields{
+			"status":    "ok",
+			"count":     12,
+			"long_text": strings.Repeat("abcdefghij", 12),
+		},
+	})
+	require.Nil(err)
+	expected := `2017-02-13T12:13:45.000Z WARN  test message
+    commit:    "abcd"
+    status:    "ok"
+    count:     12
+    long_text: "abcdefghijabcdefghijabcdefghijabcdefghijabcdefghijabcdefghijabcdefghijabcdefghijabcd
+               efghijabcdefghijabcdefghijabcdefghij"
+`
+	assert.Equal(expected, string(result))
+}
+
+func TestPrettyColor(t *testing.T) {
+	assert := assert.New(t)
+
+	cf := New(WithPretty(), WithColor())
+	result, _ := cf.Format(&log.Entry{
+		Time:    testTime,
+		Level:   log.ErrorLevel,
+		Message: "test message",
+		Data:    log.Fields{"field1": "value1"},
+	})
+	expected := "2017-02-13T12:13:45.000Z ERROR test message\n    field1: \"value1\"\n"
+	assert.Equal(expected, ansiRE.ReplaceAllString(string(result), ""))
+	assert.Contains(string(result), "\x1b[31mERROR")
+}
@@ -0,0 +1,77 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// WithQuoter replaces the function used to quote and escape string values
+// in the default k=v format, for downstream parsers that expect a different
+// convention, such as single quotes or escaping only with backslashes.
+// quote should append s, quoted, to dst and return the extended slice, in
+// the style of strconv.AppendQuote.
+//
+// Values, levels, callers and messages are all quoted using quote.  Lines
+// quoted differently to the default may not be readable by Parse.
+func WithQuoter(quote func(dst []byte, s string) []byte) Config {
+	return func(kvf *Formatter) {
+		kvf.quoter = quote
+	}
+}
+
+// appendString appends s to buf, quoted by the configured quoter.  buf is
+// not passed to a custom quoter, so that callers' stack buffers don't escape
+// to the heap when the default is used.
+func (cf *Formatter) appendString(buf []byte, s string) []byte {
+	if cf.quoter != nil {
+		return append(buf, cf.quoter(nil, s)...)
+	}
+	return appendQuoted(buf, s)
+}
+
+// writeString writes s to b, quoted by the configured quoter.
+func (cf *Formatter) writeString(b *bytes.Buffer, s string) {
+	if cf.quoter != nil {
+		b.Write(cf.quoter(nil, s))
+		return
+	}
+	writeQuoted(b, s)
+}
+
+// needsEscape reports whether s holds any byte that strconv.QuoteToASCII
+// would escape.  Most values are plain ASCII, which can be copied between
+// quotes unchanged far more cheaply than by strconv.
+func needsEscape(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c < ' ' || c > '~' || c == '"' || c == '\\' {
+			return true
+		}
+	}
+	return false
+}
+
+// appendQuoted appends s to buf quoted as by strconv.AppendQuoteToASCII.
+func appendQuoted(buf []byte, s string) []byte {
+	if needsEscape(s) {
+		return strconv.AppendQuoteToASCII(buf, s)
+	}
+	buf = append(buf, '"')
+	buf = append(buf, s...)
+	return append(buf, '"')
+}
+
+// writeQuoted writes s to b quoted as by strconv.QuoteToASCII.
+func writeQuoted(b *bytes.Buffer, s string) {
+	if needsEscape(s) {
+		var scratch [64]byte
+		b.Write(strconv.AppendQuoteToASCII(scratch[:0], s))
+		return
+	}
+	b.WriteByte('"')
+	b.WriteString(s)
+	b.WriteByte('"')
+}
@@ -0,0 +1,89 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAppendQuoted(t *testing.T) {
+	inputs := []string{
+		"", "plain_identifier", "with space", "quote\"d", `back\slash`,
+		"new\nline", "tab\t", "del\x7f", "unicode é", "invalid \xff", "~ and !",
+	}
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		b := make([]byte, rnd.Intn(20))
+		for j := range b {
+			b[j] = byte(rnd.Intn(256))
+		}
+		inputs = append(inputs, string(b))
+	}
+
+	for _, s := range inputs {
+		expected := strconv.QuoteToASCII(s)
+		assert.Equal(t, expected, string(appendQuoted([]byte("x"), s))[1:], "%q", s)
+		var b bytes.Buffer
+		writeQuoted(&b, s)
+		assert.Equal(t, expected, b.String(), "%q", s)
+	}
+}
+
+// singleQuote quotes s with single quotes, escaping only single quotes and
+// backslashes.
+func singleQuote(dst []byte, s string) []byte {
+	dst = append(dst, '\'')
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\'' || s[i] == '\\' {
+			dst = append(dst, '\\')
+		}
+		dst = append(dst, s[i])
+	}
+	return append(dst, '\'')
+}
+
+func TestWithQuoter(t *testing.T) {
+	cf := New(WithQuoter(singleQuote), WithConstantField("app", "it's"))
+	testTime := time.Date(2017, 2, 13, 12, 13, 45, 0, time.UTC)
+	result, err := cf.Format(&log.Entry{
+		Time:    testTime,
+		Level:   log.InfoLevel,
+		Message: "line\nbreak",
+		Data: log.Fields{
+			"err":     errors.New(`say "hi"`),
+			"elapsed": time.Second,
+			"count":   3,
+		},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll='info' app='it\'s' count=3 elapsed='1s' err='say "hi"' _msg='line`+"\n"+`break'`+"\n", string(result))
+
+	var buf bytes.Buffer
+	NewLogger(&buf, cf.Child()).Log(log.WarnLevel, "typed", String("s", "a'b"), Dur("d", time.Second))
+	assert.Regexp(t, ` ll='warning' app='it\\'s' d='1s' s='a\\'b' _msg='typed'\n$`, buf.String())
+}
+
+func BenchmarkAppendQuoted(b *testing.B) {
+	buf := make([]byte, 0, 64)
+	for i := 0; i < b.N; i++ {
+		buf = appendQuoted(buf[:0], "user_login_succeeded")
+	}
+}
+
+func BenchmarkAppendQuoteToASCII(b *testing.B) {
+	buf := make([]byte, 0, 64)
+	for i := 0; i < b.N; i++ {
+		buf = strconv.AppendQuoteToASCII(buf[:0], "user_login_succeeded")
+	}
+}
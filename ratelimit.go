@@ -0,0 +1,173 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const dropRateLimited = "rate_limited"
+
+// RateLimitConfig represents a configuration function to be passed to
+// NewRateLimitWriter.
+type RateLimitConfig func(w *RateLimitWriter)
+
+// RateLimitBurst sets the number of entries that may be written in a burst
+// above the sustained rate.  The default is one second's worth.
+func RateLimitBurst(n int) RateLimitConfig {
+	return func(w *RateLimitWriter) {
+		w.burst = float64(n)
+	}
+}
+
+// RateLimitReportInterval sets how long after entries start being dropped
+// the summary of dropped entries is written.  The default is one second.
+func RateLimitReportInterval(d time.Duration) RateLimitConfig {
+	return func(w *RateLimitWriter) {
+		w.interval = d
+	}
+}
+
+// RateLimitFormatter sets the Formatter used to write the summary of
+// dropped entries, so that it matches the format of the rest of the output.
+// The default is New().
+func RateLimitFormatter(cf *Formatter) RateLimitConfig {
+	return func(w *RateLimitWriter) {
+		w.cf = cf
+	}
+}
+
+// RateLimitWriter is an io.Writer that passes entries to another writer at
+// no more than a maximum rate, discarding the excess, so that a component
+// stuck in a tight loop can't flood the destination.
+//
+// eg.
+//
+//	w := kvlog.NewRateLimitWriter(os.Stderr, 1000, kvlog.RateLimitBurst(5000))
+//	logrus.SetOutput(w)
+//
+// The rate is enforced using a token bucket, so short bursts above the rate
+// are passed through.  Once entries start being discarded, a summary entry
+// such as
+//
+//	2017-02-13T12:13:45.000Z ll="warning" dropped=142 reason="rate_limited" _msg="kvlog: dropped log entries"
+//
+// is written after the report interval with the number discarded.
+type RateLimitWriter struct {
+	out      io.Writer
+	rate     float64
+	burst    float64
+	interval time.Duration
+	cf       *Formatter
+	drops    dropCounter
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+	timer  *time.Timer // pending summary
+	closed bool
+}
+
+// NewRateLimitWriter creates a RateLimitWriter that writes at most
+// perSecond entries per second to out.
+func NewRateLimitWriter(out io.Writer, perSecond float64, cfgs ...RateLimitConfig) *RateLimitWriter {
+	w := &RateLimitWriter{
+		out:      out,
+		rate:     perSecond,
+		burst:    perSecond,
+		interval: time.Second,
+		cf:       reportFormatter,
+	}
+	for _, cfg := range cfgs {
+		cfg(w)
+	}
+	if w.burst < 1 {
+		w.burst = 1
+	}
+	w.tokens = w.burst
+	w.last = time.Now()
+	RegisterShutdown(w)
+	return w
+}
+
+// Write implements io.Writer, writing p to the underlying writer unless the
+// rate has been exceeded.  Discarded entries are reported as written.
+func (w *RateLimitWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return 0, errWriterClosed
+	}
+	if !w.allow() {
+		w.drops.add(dropRateLimited, 1)
+		if w.timer == nil {
+			w.timer = time.AfterFunc(w.interval, w.report)
+		}
+		return len(p), nil
+	}
+	return w.out.Write(p)
+}
+
+// allow takes a token from the bucket, if one is available; w.mu must be
+// held.
+func (w *RateLimitWriter) allow() bool {
+	now := time.Now()
+	w.tokens += now.Sub(w.last).Seconds() * w.rate
+	if w.tokens > w.burst {
+		w.tokens = w.burst
+	}
+	w.last = now
+	if w.tokens < 1 {
+		return false
+	}
+	w.tokens--
+	return true
+}
+
+// report writes the summary of discarded entries.
+func (w *RateLimitWriter) report() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.timer = nil
+	w.drops.report(w.writeEntry)
+}
+
+// writeEntry writes an entry generated by the writer; w.mu must be held.
+func (w *RateLimitWriter) writeEntry(entry *log.Entry) {
+	if b, err := w.cf.Format(entry); err == nil {
+		w.out.Write(b)
+	}
+}
+
+// Dropped returns the number of entries discarded.
+func (w *RateLimitWriter) Dropped() int64 {
+	return w.drops.dropped()
+}
+
+// Close writes the summary of any entries discarded since the last.  The
+// underlying writer is left open.
+func (w *RateLimitWriter) Close() error {
+	UnregisterShutdown(w)
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	if w.timer != nil {
+		w.timer.Stop()
+		w.timer = nil
+	}
+	w.drops.report(w.writeEntry)
+	w.mu.Unlock()
+	return nil
+}
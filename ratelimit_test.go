@@ -0,0 +1,67 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestRateLimitWriter(t *testing.T) {
+	out := new(syncBuffer)
+	w := NewRateLimitWriter(out, 1, RateLimitBurst(5), RateLimitReportInterval(time.Hour))
+	for i := 0; i < 20; i++ {
+		w.Write([]byte("entry\n"))
+	}
+	assert.Equal(t, int64(15), w.Dropped())
+	assert.Equal(t, strings.Repeat("entry\n", 5), string(out.Bytes()))
+
+	require.Nil(t, w.Close())
+	assert.False(t, out.closed)
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	require.Len(t, lines, 6)
+	entry, err := Parse(lines[5])
+	require.Nil(t, err)
+	assert.Equal(t, "kvlog: dropped log entries", entry.Message)
+	assert.Equal(t, "rate_limited", entry.Fields["reason"])
+	assert.EqualValues(t, 15, entry.Fields["dropped"])
+
+	_, err = w.Write([]byte("entry\n"))
+	assert.NotNil(t, err)
+}
+
+func TestRateLimitWriterRefill(t *testing.T) {
+	out := new(syncBuffer)
+	w := NewRateLimitWriter(out, 100, RateLimitBurst(1))
+	defer w.Close()
+	w.Write([]byte("one\n"))
+	w.Write([]byte("dropped\n"))
+	time.Sleep(20 * time.Millisecond)
+	w.Write([]byte("two\n"))
+	assert.Equal(t, "one\ntwo\n", string(out.Bytes()))
+}
+
+func TestRateLimitWriterReport(t *testing.T) {
+	out := new(syncBuffer)
+	w := NewRateLimitWriter(out, 1, RateLimitReportInterval(10*time.Millisecond),
+		RateLimitFormatter(New(WithJSON())))
+	defer w.Close()
+	for i := 0; i < 4; i++ {
+		w.Write([]byte("entry\n"))
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !bytes.Contains(out.Bytes(), []byte("dropped")) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Contains(t, string(out.Bytes()), `"dropped":3`)
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+// fieldConfig holds the primary and constant fields of a Formatter.  Once a
+// Formatter has been created its fieldConfig is never modified; changes
+// replace it with an updated copy, so that an entry is always formatted
+// using a consistent set of fields without taking a lock.
+type fieldConfig struct {
+	primaryFields  []string
+	constants      []field
+	constantFields [][]byte       // constants pre-rendered for the k=v format
+	keyOrders      *keyOrderCache // depends on primaryFields
+}
+
+// fields returns the current field configuration of cf.  Config functions
+// run before the Formatter is shared and may modify it in place.  A
+// Formatter that wasn't created by New is given its own empty configuration
+// on first use.
+func (cf *Formatter) fields() *fieldConfig {
+	if fc, ok := cf.fieldCfg.Load().(*fieldConfig); ok {
+		return fc
+	}
+	cf.fieldCfg.CompareAndSwap(nil, &fieldConfig{keyOrders: new(keyOrderCache)})
+	return cf.fieldCfg.Load().(*fieldConfig)
+}
+
+// updateFields replaces the field configuration of cf with a copy modified
+// by f.
+func (cf *Formatter) updateFields(f func(fc *fieldConfig)) {
+	cf.updateMu.Lock()
+	defer cf.updateMu.Unlock()
+	old := cf.fields()
+	fc := &fieldConfig{
+		primaryFields: old.primaryFields,
+		constants:     append([]field{}, old.constants...),
+		keyOrders:     old.keyOrders,
+	}
+	f(fc)
+	cf.renderConstants(fc)
+	cf.fieldCfg.Store(fc)
+}
+
+// SetPrimaryFields replaces the primary fields of cf, as set by
+// WithPrimaryFields.  Unlike applying a Config, it's safe to call while cf
+// is in use; entries being formatted at the time use either the old or the
+// new fields.  Formatters previously created by Child are unaffected.
+func (cf *Formatter) SetPrimaryFields(field ...string) {
+	cf.updateFields(func(fc *fieldConfig) {
+		fc.primaryFields = append([]string{}, field...)
+		fc.keyOrders = new(keyOrderCache)
+	})
+}
+
+// AddConstantField adds a constant field to cf, as WithConstantField does,
+// replacing the value of any constant field with the same key.  It's safe
+// to call while cf is in use.  Formatters previously created by Child are
+// unaffected.
+func (cf *Formatter) AddConstantField(key string, value interface{}) {
+	cf.updateFields(func(fc *fieldConfig) {
+		fc.constants = dedupeFields(appendField(fc.constants, key, value))
+	})
+}
+
+// RemoveConstantField removes the constant field with the given key from cf.
+// It's safe to call while cf is in use.
+func (cf *Formatter) RemoveConstantField(key string) {
+	cf.updateFields(func(fc *fieldConfig) {
+		constants := fc.constants[:0]
+		for _, f := range fc.constants {
+			if f.key != key {
+				constants = append(constants, f)
+			}
+		}
+		fc.constants = constants
+	})
+}
@@ -0,0 +1,110 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestReconfigure(t *testing.T) {
+	cf := New(WithPrimaryFields("b"), WithConstantField("app", "billing"))
+	child := cf.Child()
+	format := func(cf *Formatter) string {
+		result, err := cf.Format(&log.Entry{
+			Time:  testTime,
+			Level: log.InfoLevel,
+			Data:  log.Fields{"a": 1, "b": 2, "c": 3},
+		})
+		require.Nil(t, err)
+		return strings.TrimSuffix(string(result), "\n")
+	}
+
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" app="billing" b=2 a=1 c=3`, format(cf))
+
+	cf.SetPrimaryFields("c", "a")
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" app="billing" c=3 a=1 b=2`, format(cf))
+
+	cf.AddConstantField("region", "eu")
+	cf.AddConstantField("app", "payments")
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" app="payments" region="eu" c=3 a=1 b=2`, format(cf))
+
+	cf.RemoveConstantField("app")
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" region="eu" c=3 a=1 b=2`, format(cf))
+
+	// existing children keep the settings they were created with
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" app="billing" b=2 a=1 c=3`, format(child))
+
+	// new children inherit the current settings
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" region="eu" c=3 a=1 b=2`, format(cf.Child()))
+}
+
+func TestReconfigureTypedFields(t *testing.T) {
+	cf := New()
+	var buf bytes.Buffer
+	logger := NewLogger(&buf, cf)
+	cf.SetPrimaryFields("b")
+	cf.AddConstantField("app", "billing")
+	logger.Log(log.InfoLevel, "ok", Int("a", 1), Int("b", 2))
+	assert.Regexp(t, ` ll="info" app="billing" b=2 a=1 _msg="ok"\n$`, buf.String())
+}
+
+func TestReconfigureConcurrent(t *testing.T) {
+	cf := New()
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				_, err := cf.Format(&log.Entry{
+					Time:  testTime,
+					Level: log.InfoLevel,
+					Data:  log.Fields{"a": 1, "b": 2},
+				})
+				assert.Nil(t, err)
+			}
+		}()
+	}
+	for j := 0; j < 200; j++ {
+		if j%2 == 0 {
+			cf.SetPrimaryFields("b")
+		} else {
+			cf.SetPrimaryFields("a")
+		}
+		cf.AddConstantField("n", j)
+	}
+	wg.Wait()
+
+	result, err := cf.Format(&log.Entry{Time: testTime, Level: log.InfoLevel})
+	require.Nil(t, err)
+	assert.Contains(t, string(result), " n=199")
+}
+
+func TestReconfigureZeroFormatter(t *testing.T) {
+	// Formatters not created by New don't share their field configuration
+	cf1, cf2 := new(Formatter), new(Formatter)
+	WithPrimaryFields("b")(cf1)
+	cf1.AddConstantField("app", "one")
+	entry := &log.Entry{Time: testTime, Level: log.InfoLevel, Data: log.Fields{"a": 1, "b": 2}}
+
+	result, err := cf1.Format(entry)
+	require.Nil(t, err)
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" app="one" b=2 a=1`+"\n", string(result))
+	result, err = cf2.Format(entry)
+	require.Nil(t, err)
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" a=1 b=2`+"\n", string(result))
+	result, err = new(Formatter).Format(entry)
+	require.Nil(t, err)
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" a=1 b=2`+"\n", string(result))
+}
@@ -0,0 +1,123 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Level is the severity of a Record.  Levels are numbered as they are by
+// both the github.com/Sirupsen/logrus and github.com/sirupsen/logrus import
+// paths, so that either's level converts directly, eg. kvlog.Level(e.Level).
+type Level uint32
+
+// Levels, from most to least severe.
+const (
+	PanicLevel Level = iota
+	FatalLevel
+	ErrorLevel
+	WarnLevel
+	InfoLevel
+	DebugLevel
+	TraceLevel
+)
+
+// Record is a log entry from any logging package, to be rendered by
+// FormatRecord.  The backends in this package, such as logrus and the
+// native Logger, convert their entries into Records too, so that all output
+// modes share the same formatting code.
+//
+// FormatRecord allows a Formatter to be used by backends other than the
+// logrus import path this package is built against, such as the lowercase
+// github.com/sirupsen/logrus path, which can't be imported alongside it.
+// An adapter for such a backend need only convert its entries:
+//
+//	type Formatter struct{ *kvlog.Formatter }
+//
+//	func (f Formatter) Format(e *logrus.Entry) ([]byte, error) {
+//	    return f.FormatRecord(kvlog.Record{
+//	        Time:    e.Time,
+//	        Level:   kvlog.Level(e.Level),
+//	        Message: e.Message,
+//	        Data:    e.Data,
+//	    })
+//	}
+type Record struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Data    map[string]interface{}
+
+	// Caller and Line identify the calling function, if known by the
+	// backend, as a name without its package path such as "(*T).run".  If
+	// Caller is empty and the Formatter includes the caller, it's found by
+	// walking the stack.
+	Caller string
+	Line   int
+
+	// Package is the import path of the calling function's package, if
+	// known.
+	Package string
+}
+
+// FormatRecord renders r as Format does a logrus entry, returning the
+// formatted line.
+func (cf *Formatter) FormatRecord(r Record) ([]byte, error) {
+	if cf.clock != nil {
+		r.Time = cf.clock()
+	}
+	return cf.render(new(bytes.Buffer), &r)
+}
+
+// newRecord adapts a logrus entry.  If the logger was configured to report
+// the caller, the function it found is used in preference to searching the
+// stack.
+func newRecord(entry *log.Entry) *Record {
+	r := &Record{
+		Time:    entry.Time,
+		Level:   Level(entry.Level),
+		Message: entry.Message,
+		Data:    entry.Data,
+	}
+	if entry.Caller != nil {
+		if pkg, name := pkgname(entry.Caller.Function); name != "" {
+			r.Caller = name
+			r.Line = entry.Caller.Line
+			r.Package = pkg
+		}
+	}
+	return r
+}
+
+// level returns the record's level as a logrus level.
+func (r *Record) level() log.Level {
+	return log.Level(r.Level)
+}
+
+// caller returns the calling function name and line number for r, or an
+// empty name if it can't be determined.
+func (cf *Formatter) caller(r *Record) (string, int) {
+	name, line := r.Caller, r.Line
+	if name == "" {
+		name, line = cf.findCaller()
+	}
+	if cf.callerFunc != nil {
+		name, line = cf.callerFunc(name, line)
+	}
+	return name, line
+}
+
+// callerPackage returns the import path of the calling function's package
+// for r, or an empty string if it can't be determined.  A caller found by
+// walking the stack is saved in r, so that it's only searched for once.
+func (cf *Formatter) callerPackage(r *Record) string {
+	if r.Package == "" && r.Caller == "" {
+		r.Package, r.Caller, r.Line = cf.findCallerFrame()
+	}
+	return r.Package
+}
@@ -0,0 +1,72 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"regexp"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+// helper logs through logrus directly, so that the stack search would
+// attribute the entry to its caller rather than to helper itself.
+func helper(logger *log.Logger) {
+	logger.Info("from helper")
+}
+
+func TestReportCaller(t *testing.T) {
+	var buf bytes.Buffer
+	logger := &log.Logger{
+		Out:          &buf,
+		Formatter:    New(IncludeCaller()),
+		Level:        log.InfoLevel,
+		ReportCaller: true,
+	}
+	helper(logger)
+	assert.Regexp(t, `^\S+ ll="info" srcfnc="helper" srcline=\d+ _msg="from helper"\n$`, buf.String())
+}
+
+func TestNativeMatchesLogrusModes(t *testing.T) {
+	modes := map[string]Config{
+		"json":        WithJSON(),
+		"logstash":    WithLogstashJSON(),
+		"stackdriver": WithStackdriverJSON("proj"),
+		"pretty":      WithPretty(),
+		"color":       WithColor(),
+	}
+	ts := regexp.MustCompile(`\d{4}-\d\d-\d\dT[\d:.]+Z`)
+	for name, cfg := range modes {
+		t.Run(name, func(t *testing.T) {
+			cf := New(cfg, WithConstantField("app", "svc"))
+			fields := log.Fields{"action": "get", "count": 2}
+
+			var native, lr bytes.Buffer
+			NewLogger(&native, cf).WithFields(fields).Info("hello")
+			(&log.Logger{Out: &lr, Formatter: cf, Level: log.InfoLevel}).WithFields(fields).Info("hello")
+			assert.Equal(t, ts.ReplaceAllString(lr.String(), "TS"), ts.ReplaceAllString(native.String(), "TS"))
+		})
+	}
+}
+
+func TestFormatRecord(t *testing.T) {
+	cf := New(IncludeCaller(), WithConstantField("app", "svc"))
+	result, err := cf.FormatRecord(Record{
+		Time:    testTime,
+		Level:   Level(log.WarnLevel),
+		Message: "hello",
+		Data:    log.Fields{"action": "get", "count": 2},
+		Caller:  "TestFormatRecord",
+		Line:    10,
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="warning" srcfnc="TestFormatRecord" srcline=10 app="svc" action="get" count=2 _msg="hello"`+"\n", string(result))
+	assert.Equal(t, WarnLevel, Level(log.WarnLevel))
+	assert.Equal(t, TraceLevel, Level(log.TraceLevel))
+}
@@ -0,0 +1,162 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"path"
+	"strings"
+	"sync/atomic"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// Redacted is the value logged in place of the value of a redacted field.
+const Redacted = "[REDACTED]"
+
+// WithRedactedKeys causes the values of fields whose keys match any of keys
+// to be replaced with Redacted, as a backstop against secrets such as
+// passwords and authorization headers being logged by mistake.
+//
+// Keys may be exact names or glob patterns, such as "*_token", matched as
+// by path.Match.  Matching is case sensitive; use WithRedactedKeysFold to
+// ignore case.  Keys produced by Loggable values, such as "user.password",
+// are matched individually, and a matching key with a Loggable value is
+// redacted as a whole.  Constant fields are not redacted.
+//
+// eg.
+//
+//	kvlog.New(kvlog.WithRedactedKeys("password", "authorization", "ssn", "*_secret"))
+func WithRedactedKeys(keys ...string) Config {
+	return func(kvf *Formatter) {
+		kvf.redact = kvf.redact.with(keys, false)
+	}
+}
+
+// WithRedactedKeysFold is like WithRedactedKeys, but matches keys without
+// regard to case, so that "Authorization" and "AUTHORIZATION" are redacted
+// along with "authorization".
+func WithRedactedKeysFold(keys ...string) Config {
+	return func(kvf *Formatter) {
+		kvf.redact = kvf.redact.with(keys, true)
+	}
+}
+
+// keyMatcher matches field keys against a set of exact names and glob
+// patterns.  It's not modified once created, so may be shared by a
+// Formatter and its children.
+type keyMatcher struct {
+	exact map[string]struct{}
+	fold  map[string]struct{} // lower cased
+	globs []keyGlob
+}
+
+type keyGlob struct {
+	pattern string
+	fold    bool // pattern is lower cased and matched against lower cased keys
+}
+
+// with returns a copy of m that also matches keys.  m may be nil.
+func (m *keyMatcher) with(keys []string, fold bool) *keyMatcher {
+	n := &keyMatcher{
+		exact: make(map[string]struct{}),
+		fold:  make(map[string]struct{}),
+	}
+	if m != nil {
+		for k := range m.exact {
+			n.exact[k] = struct{}{}
+		}
+		for k := range m.fold {
+			n.fold[k] = struct{}{}
+		}
+		n.globs = append(n.globs, m.globs...)
+	}
+	for _, k := range keys {
+		if fold {
+			k = strings.ToLower(k)
+		}
+		switch {
+		case strings.ContainsAny(k, `*?[\`):
+			n.globs = append(n.globs, keyGlob{k, fold})
+		case fold:
+			n.fold[k] = struct{}{}
+		default:
+			n.exact[k] = struct{}{}
+		}
+	}
+	return n
+}
+
+// match reports whether key matches any of m's names or patterns.
+func (m *keyMatcher) match(key string) bool {
+	if _, ok := m.exact[key]; ok {
+		return true
+	}
+	var lower string
+	if len(m.fold) > 0 {
+		lower = strings.ToLower(key)
+		if _, ok := m.fold[lower]; ok {
+			return true
+		}
+	}
+	for _, g := range m.globs {
+		k := key
+		if g.fold {
+			if lower == "" {
+				lower = strings.ToLower(key)
+			}
+			k = lower
+		}
+		if ok, _ := path.Match(g.pattern, k); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// appendEntryField appends k and v to fields of an entry logged at level as
+// appendField does, dropping suppressed keys, those hidden at level and
+// values omitted by WithOmitEmpty, replacing the values of redacted and
+// hashed keys and scrubbing the rest.
+func (cf *Formatter) appendEntryField(fields []field, level log.Level, k string, v interface{}) []field {
+	if !cf.filtersFields() {
+		return appendField(fields, k, v)
+	}
+	if cf.hiddenAt(k, level) {
+		return fields
+	}
+	if cf.deny != nil && cf.deny.match(k) {
+		atomic.AddInt64(&cf.suppressed, 1)
+		return fields
+	}
+	if cf.redact != nil && cf.redact.match(k) {
+		if cf.suppress(k, k) {
+			return fields
+		}
+		return append(fields, field{k, Redacted})
+	}
+	n := len(fields)
+	fields = appendField(fields, k, v)
+	kept := fields[:n]
+	for _, f := range fields[n:] {
+		if (f.key != k && cf.hiddenAt(f.key, level)) || cf.suppress(f.key, k) || cf.omitted(f.value) {
+			continue
+		}
+		if cf.redact != nil && cf.redact.match(f.key) {
+			f.value = Redacted
+		} else if h := cf.hasher(f.key); h != nil {
+			f.value = HashedValue(h.key, f.value)
+		} else if cf.scrub != nil {
+			f.value = cf.scrubValue(f.value)
+		}
+		kept = append(kept, f)
+	}
+	return kept
+}
+
+// filtersFields reports whether cf drops or alters any entry fields.
+func (cf *Formatter) filtersFields() bool {
+	return cf.redact != nil || cf.hashers != nil || cf.scrub != nil || cf.allow != nil ||
+		cf.deny != nil || cf.keys != nil || cf.levelFields != nil || cf.omitEmpty != 0
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestRedactedKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		data     log.Fields
+		expected string
+	}{
+		{"exact", WithRedactedKeys("password"), log.Fields{"password": "hunter2", "Password": "x", "user": "joe"},
+			`Password="x" password="[REDACTED]" user="joe"`},
+		{"glob", WithRedactedKeys("*_token", "ssn"), log.Fields{"api_token": "abc", "token": "def", "ssn": 123456789},
+			`api_token="[REDACTED]" ssn="[REDACTED]" token="def"`},
+		{"fold", WithRedactedKeysFold("Authorization", "*SECRET*"), log.Fields{"authorization": "Bearer x", "AUTHORIZATION": "Basic y", "client_secret_id": 1, "id": 2},
+			`AUTHORIZATION="[REDACTED]" authorization="[REDACTED]" client_secret_id="[REDACTED]" id=2`},
+		{"expanded-key", WithRedactedKeys("*.password"), log.Fields{"user": Ordered(".name", "joe", ".password", "hunter2")},
+			`user.name="joe" user.password="[REDACTED]"`},
+		{"whole-value", WithRedactedKeys("user"), log.Fields{"user": Ordered(".name", "joe"), "other": 1},
+			`other=1 user="[REDACTED]"`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cf := New(test.cfg)
+			result, err := cf.Format(&log.Entry{Time: testTime, Level: log.InfoLevel, Data: test.data})
+			require.Nil(t, err)
+			assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" `+test.expected, strings.TrimSuffix(string(result), "\n"))
+		})
+	}
+}
+
+func TestRedactedKeysChild(t *testing.T) {
+	cf := New(WithRedactedKeys("password")).Child(WithRedactedKeys("pin"), WithJSON())
+	result, err := cf.Format(&log.Entry{
+		Time:  testTime,
+		Level: log.InfoLevel,
+		Data:  log.Fields{"password": "hunter2", "pin": 1234},
+	})
+	require.Nil(t, err)
+	assert.Contains(t, string(result), `"password":"[REDACTED]","pin":"[REDACTED]"`)
+}
+
+func TestRedactedKeysTypedFields(t *testing.T) {
+	var buf bytes.Buffer
+	NewLogger(&buf, New(WithRedactedKeys("password", "pin"))).Log(log.InfoLevel, "login",
+		String("user", "joe"), String("password", "hunter2"), Int("pin", 1234))
+	assert.Regexp(t, ` password="\[REDACTED\]" pin="\[REDACTED\]" user="joe" _msg="login"\n$`, buf.String())
+}
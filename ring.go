@@ -0,0 +1,111 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"io"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// RingConfig represents a configuration function to be passed to
+// NewRingBuffer.
+type RingConfig func(r *RingBuffer)
+
+// RingTrigger sets the least severe level that causes the buffered entries
+// to be written.  The default is ErrorLevel.
+func RingTrigger(level log.Level) RingConfig {
+	return func(r *RingBuffer) {
+		r.trigger = level
+	}
+}
+
+// RingBuffer is a LevelWriter that holds the most recent debug and info
+// entries in memory rather than writing them, writing them only once an
+// error occurs.  This provides the detail leading up to a failure without
+// the cost of storing debug output for everything that succeeded.
+//
+// eg.
+//
+//	logrus.SetLevel(logrus.DebugLevel)
+//	logrus.SetOutput(kvlog.NewRingBuffer(os.Stderr, 1000))
+//
+// Entries at WarnLevel and above are written immediately.  When an entry at
+// the trigger level or above is written, the buffered entries are written
+// first, in order, with a replayed=true field added, and the buffer is
+// emptied.  Once the buffer is full, the oldest entries are discarded.
+type RingBuffer struct {
+	out     io.Writer
+	trigger log.Level
+
+	mu    sync.Mutex
+	ring  []ringEntry
+	start int // index of the oldest entry
+	n     int // number of entries held
+}
+
+type ringEntry struct {
+	level log.Level
+	line  []byte
+}
+
+// NewRingBuffer creates a RingBuffer holding up to size entries that writes
+// to out.
+func NewRingBuffer(out io.Writer, size int, cfgs ...RingConfig) *RingBuffer {
+	if size < 1 {
+		size = 1
+	}
+	r := &RingBuffer{out: out, trigger: log.ErrorLevel, ring: make([]ringEntry, size)}
+	for _, cfg := range cfgs {
+		cfg(r)
+	}
+	return r
+}
+
+// Write implements io.Writer, reading the entry's level from the line.
+func (r *RingBuffer) Write(p []byte) (int, error) {
+	return r.WriteLevel(lineLevel(p), p)
+}
+
+// WriteLevel implements LevelWriter.
+func (r *RingBuffer) WriteLevel(level log.Level, p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if level > log.WarnLevel {
+		i := (r.start + r.n) % len(r.ring)
+		if r.n == len(r.ring) {
+			r.start = (r.start + 1) % len(r.ring)
+		} else {
+			r.n++
+		}
+		r.ring[i] = ringEntry{level, append(r.ring[i].line[:0], p...)}
+		return len(p), nil
+	}
+	if level <= r.trigger {
+		if err := r.dump(); err != nil {
+			return 0, err
+		}
+	}
+	return writeLevel(r.out, level, p)
+}
+
+// dump writes and discards the buffered entries; r.mu must be held.
+func (r *RingBuffer) dump() error {
+	for r.n > 0 {
+		e := r.ring[r.start]
+		line := addLineFields(e.line, field{"replayed", true})
+		if _, err := writeLevel(r.out, e.level, line); err != nil {
+			return err
+		}
+		r.start = (r.start + 1) % len(r.ring)
+		r.n--
+	}
+	r.start = 0
+	return nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestRingBuffer(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRingBuffer(&buf, 3)
+	write := func(level, msg string) {
+		fmt.Fprintf(r, "2017-02-13T12:13:45.000Z ll=%q _msg=%q\n", level, msg)
+	}
+
+	for i := 1; i <= 5; i++ {
+		write("debug", fmt.Sprint("step", i))
+	}
+	write("warning", "slow")
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="warning" _msg="slow"`+"\n", buf.String())
+
+	buf.Reset()
+	write("error", "failed")
+	expected := []string{
+		`2017-02-13T12:13:45.000Z ll="debug" replayed=true _msg="step3"`,
+		`2017-02-13T12:13:45.000Z ll="debug" replayed=true _msg="step4"`,
+		`2017-02-13T12:13:45.000Z ll="debug" replayed=true _msg="step5"`,
+		`2017-02-13T12:13:45.000Z ll="error" _msg="failed"`,
+	}
+	assert.Equal(t, strings.Join(expected, "\n")+"\n", buf.String())
+
+	// the buffer is emptied after being written
+	buf.Reset()
+	write("info", "next")
+	write("error", "failed again")
+	expected = []string{
+		`2017-02-13T12:13:45.000Z ll="info" replayed=true _msg="next"`,
+		`2017-02-13T12:13:45.000Z ll="error" _msg="failed again"`,
+	}
+	assert.Equal(t, strings.Join(expected, "\n")+"\n", buf.String())
+}
+
+func TestRingBufferTrigger(t *testing.T) {
+	var buf bytes.Buffer
+	r := NewRingBuffer(&buf, 10, RingTrigger(log.WarnLevel))
+	r.WriteLevel(log.InfoLevel, []byte(`{"ll":"info","_msg":"a"}`+"\n"))
+	assert.Equal(t, 0, buf.Len())
+	r.WriteLevel(log.WarnLevel, []byte(`{"ll":"warning","_msg":"b"}`+"\n"))
+	assert.Equal(t, `{"ll":"info","_msg":"a","replayed":true}`+"\n"+`{"ll":"warning","_msg":"b"}`+"\n", buf.String())
+}
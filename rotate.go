@@ -0,0 +1,378 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// RotateConfig represents a configuration function to be passed to
+// NewRotatingFile.
+type RotateConfig func(f *RotatingFile)
+
+// RotateMaxSize causes the file to be rotated before a write would take it
+// beyond size bytes.  The default is 100MB; 0 disables size based rotation.
+func RotateMaxSize(size int64) RotateConfig {
+	return func(f *RotatingFile) {
+		f.maxSize = size
+	}
+}
+
+// RotateInterval causes the file to be rotated once it has been open for
+// longer than d, such as every 24 hours.
+func RotateInterval(d time.Duration) RotateConfig {
+	return func(f *RotatingFile) {
+		f.interval = d
+	}
+}
+
+// RotateMaxBackups sets the number of rotated files to keep.  Older files
+// are deleted.  The default of 0 keeps all rotated files, subject to
+// RotateMaxAge.
+func RotateMaxBackups(n int) RotateConfig {
+	return func(f *RotatingFile) {
+		f.maxBackups = n
+	}
+}
+
+// RotateMaxAge causes rotated files older than d to be deleted.
+func RotateMaxAge(d time.Duration) RotateConfig {
+	return func(f *RotatingFile) {
+		f.maxAge = d
+	}
+}
+
+// RotateCompress causes rotated files to be compressed with gzip, adding a
+// .gz extension.
+func RotateCompress() RotateConfig {
+	return func(f *RotatingFile) {
+		f.compress = true
+	}
+}
+
+// RotateReopenOnSignal causes the file to be reopened whenever the program
+// receives SIGHUP, for use with an external tool such as logrotate that
+// moves the file aside and then signals the program.  Signals aren't
+// supported on Windows, where this has no effect.
+func RotateReopenOnSignal() RotateConfig {
+	return func(f *RotatingFile) {
+		f.reopenOnSignal = true
+	}
+}
+
+// RotatingFile is an io.Writer that appends to a file, moving it aside and
+// starting a new one once it reaches a maximum size or age.
+//
+// eg.
+//
+//	f, err := kvlog.NewRotatingFile("/var/log/app.log",
+//	    kvlog.RotateMaxSize(50<<20), kvlog.RotateMaxBackups(10), kvlog.RotateCompress())
+//	...
+//	logrus.SetOutput(f)
+//
+// Rotated files are renamed by adding the time of rotation to the file
+// name, eg. app-2017-02-13T12-13-45.000.log.  Rotation only happens between
+// writes, so as long as each entry is written with a single call to Write,
+// as logrus and Logger do, entries are never split across files.
+//
+// Compression and deletion of old files happen in a background goroutine.
+// Close waits for any such work to finish.
+//
+// Where files are instead rotated by an external tool, such as logrotate,
+// use RotateMaxSize(0) to disable size based rotation and either call
+// Reopen after the file has been moved or use RotateReopenOnSignal, so that
+// the tool doesn't need its copytruncate option, which can lose entries.
+type RotatingFile struct {
+	path       string
+	maxSize    int64
+	interval   time.Duration
+	maxBackups int
+	maxAge     time.Duration
+	compress   bool
+
+	reopenOnSignal bool
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	closed   bool
+
+	mill    chan struct{}
+	closing chan struct{}
+	done    sync.WaitGroup
+}
+
+// NewRotatingFile opens the file at path for appending, creating it and
+// its directory if necessary.
+func NewRotatingFile(path string, cfgs ...RotateConfig) (*RotatingFile, error) {
+	f := &RotatingFile{
+		path:    path,
+		maxSize: 100 << 20,
+		mill:    make(chan struct{}, 1),
+		closing: make(chan struct{}),
+	}
+	for _, cfg := range cfgs {
+		cfg(f)
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	f.done.Add(1)
+	go f.runMill()
+	if f.reopenOnSignal {
+		f.handleSignals()
+	}
+	RegisterShutdown(f)
+	return f, nil
+}
+
+// Write implements io.Writer, rotating the file first if p would take it
+// beyond its maximum size or the rotation interval has passed.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+
+	sizeExceeded := f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize
+	expired := f.interval > 0 && time.Since(f.openedAt) >= f.interval
+	if sizeExceeded || expired {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Rotate moves the current file aside and starts a new one.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	return f.rotate()
+}
+
+// Reopen closes the file and opens the file at its path again, creating
+// it if it has been moved or deleted.  As with rotation, it waits for any
+// write in progress to complete, so entries are never split between the
+// old and new files.
+func (f *RotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	return f.open()
+}
+
+// Sync commits the current file's contents to stable storage.
+func (f *RotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	return f.file.Sync()
+}
+
+// Close closes the file and waits for any background compression or
+// deletion of rotated files to complete.
+func (f *RotatingFile) Close() error {
+	UnregisterShutdown(f)
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return nil
+	}
+	f.closed = true
+	err := f.file.Close()
+	close(f.mill)
+	close(f.closing)
+	f.mu.Unlock()
+
+	f.done.Wait()
+	return err
+}
+
+func (f *RotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = time.Now()
+	return nil
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(f.path, f.backupName(time.Now())); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	select {
+	case f.mill <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// backupName returns an unused name for a file rotated at t.
+func (f *RotatingFile) backupName(t time.Time) string {
+	dir, prefix, ext := f.nameParts()
+	for {
+		name := filepath.Join(dir, prefix+t.UTC().Format(backupTimeFormat)+ext)
+		if _, err := os.Stat(name); os.IsNotExist(err) {
+			if _, err := os.Stat(name + ".gz"); os.IsNotExist(err) {
+				return name
+			}
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+func (f *RotatingFile) nameParts() (dir, prefix, ext string) {
+	dir = filepath.Dir(f.path)
+	base := filepath.Base(f.path)
+	ext = filepath.Ext(base)
+	return dir, strings.TrimSuffix(base, ext) + "-", ext
+}
+
+// runMill compresses and deletes rotated files after each rotation.
+func (f *RotatingFile) runMill() {
+	defer f.done.Done()
+	for range f.mill {
+		f.millOnce()
+	}
+}
+
+type backupFile struct {
+	path string
+	t    time.Time
+}
+
+func (f *RotatingFile) millOnce() {
+	backups := f.backups()
+	sort.Slice(backups, func(i, j int) bool { return backups[i].t.After(backups[j].t) })
+
+	var keep []backupFile
+	for i, b := range backups {
+		if (f.maxBackups > 0 && i >= f.maxBackups) || (f.maxAge > 0 && time.Since(b.t) > f.maxAge) {
+			os.Remove(b.path)
+			continue
+		}
+		keep = append(keep, b)
+	}
+
+	if !f.compress {
+		return
+	}
+	for _, b := range keep {
+		if !strings.HasSuffix(b.path, ".gz") {
+			if err := compressFile(b.path); err != nil {
+				internalError(fmt.Errorf("kvlog: failed to compress %s: %w", b.path, err))
+			}
+		}
+	}
+}
+
+// backups returns the rotated files belonging to f.
+func (f *RotatingFile) backups() []backupFile {
+	dir, prefix, ext := f.nameParts()
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var backups []backupFile
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		ts := strings.TrimPrefix(name, prefix)
+		switch {
+		case strings.HasSuffix(ts, ext+".gz"):
+			ts = strings.TrimSuffix(ts, ext+".gz")
+		case strings.HasSuffix(ts, ext):
+			ts = strings.TrimSuffix(ts, ext)
+		default:
+			continue
+		}
+		t, err := time.Parse(backupTimeFormat, ts)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backupFile{filepath.Join(dir, name), t})
+	}
+	return backups
+}
+
+// compressFile replaces the file at path with a gzip compressed copy.
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := path + ".gz.tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(out)
+	_, err = io.Copy(gz, in)
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path+".gz")
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Remove(path)
+}
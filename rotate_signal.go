@@ -0,0 +1,36 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+//go:build !windows && !plan9
+
+package kvlog
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleSignals reopens the file each time SIGHUP is received, until the
+// file is closed.
+func (f *RotatingFile) handleSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+	f.done.Add(1)
+	go func() {
+		defer f.done.Done()
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ch:
+				if err := f.Reopen(); err != nil && err != os.ErrClosed {
+					internalError(fmt.Errorf("kvlog: failed to reopen %s: %w", f.path, err))
+				}
+			case <-f.closing:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,10 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+//go:build windows || plan9
+
+package kvlog
+
+// handleSignals does nothing as SIGHUP isn't supported on this platform.
+func (f *RotatingFile) handleSignals() {}
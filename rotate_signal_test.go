@@ -0,0 +1,50 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+//go:build !windows && !plan9
+
+package kvlog_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestRotatingFileReopenOnSignal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	f, err := NewRotatingFile(path, RotateMaxSize(0), RotateReopenOnSignal())
+	require.Nil(t, err)
+	defer f.Close()
+	fmt.Fprintln(f, "line=1")
+
+	require.Nil(t, os.Rename(path, path+".1"))
+	require.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGHUP))
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	fmt.Fprintln(f, "line=2")
+
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, "line=2\n", string(data))
+}
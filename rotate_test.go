@@ -0,0 +1,158 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+// readLogs returns the lines in every file in dir, decompressing gzip files.
+func readLogs(t *testing.T, dir string) (files []string, lines []string) {
+	entries, err := ioutil.ReadDir(dir)
+	require.Nil(t, err)
+	for _, e := range entries {
+		files = append(files, e.Name())
+		f, err := os.Open(filepath.Join(dir, e.Name()))
+		require.Nil(t, err)
+		var data []byte
+		if strings.HasSuffix(e.Name(), ".gz") {
+			gz, err := gzip.NewReader(f)
+			require.Nil(t, err)
+			data, err = ioutil.ReadAll(gz)
+			require.Nil(t, err)
+		} else {
+			data, err = ioutil.ReadAll(f)
+			require.Nil(t, err)
+		}
+		f.Close()
+		lines = append(lines, strings.Split(strings.TrimSpace(string(data)), "\n")...)
+	}
+	sort.Strings(lines)
+	return files, lines
+}
+
+func TestRotatingFileSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	f, err := NewRotatingFile(filepath.Join(dir, "app.log"), RotateMaxSize(60))
+	require.Nil(t, err)
+	var expected []string
+	for i := 0; i < 10; i++ {
+		line := fmt.Sprintf("line=%02d padding=\"xxxxxxxx\"", i)
+		expected = append(expected, line)
+		_, err := f.Write([]byte(line + "\n"))
+		require.Nil(t, err)
+	}
+	require.Nil(t, f.Close())
+
+	files, lines := readLogs(t, dir)
+	assert.Len(t, files, 5)
+	assert.Contains(t, files, "app.log")
+	assert.Equal(t, expected, lines, "no lines should be lost or split")
+}
+
+func TestRotatingFileMaxBackupsCompress(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	f, err := NewRotatingFile(filepath.Join(dir, "app.log"), RotateMaxBackups(2), RotateCompress())
+	require.Nil(t, err)
+	for i := 0; i < 5; i++ {
+		fmt.Fprintf(f, "line=%d\n", i)
+		require.Nil(t, f.Rotate())
+	}
+	fmt.Fprintf(f, "line=5\n")
+	require.Nil(t, f.Close())
+
+	files, lines := readLogs(t, dir)
+	require.Len(t, files, 3)
+	for _, name := range files {
+		if name != "app.log" {
+			assert.Regexp(t, `^app-\d{4}-\d\d-\d\dT\d\d-\d\d-\d\d\.\d{3}\.log\.gz$`, name)
+		}
+	}
+	assert.Equal(t, []string{"line=3", "line=4", "line=5"}, lines)
+}
+
+func TestRotatingFileInterval(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	f, err := NewRotatingFile(filepath.Join(dir, "app.log"), RotateInterval(20*time.Millisecond))
+	require.Nil(t, err)
+	fmt.Fprintf(f, "line=1\n")
+	time.Sleep(30 * time.Millisecond)
+	fmt.Fprintf(f, "line=2\n")
+	require.Nil(t, f.Close())
+
+	files, _ := readLogs(t, dir)
+	assert.Len(t, files, 2)
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "sub", "app.log")
+	for i := 0; i < 2; i++ {
+		f, err := NewRotatingFile(path)
+		require.Nil(t, err)
+		fmt.Fprintf(f, "line=%d\n", i)
+		require.Nil(t, f.Close())
+	}
+	data, err := ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, "line=0\nline=1\n", string(data))
+
+	f, err := NewRotatingFile(path)
+	require.Nil(t, err)
+	f.Close()
+	_, err = f.Write([]byte("x\n"))
+	assert.NotNil(t, err)
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "app.log")
+	f, err := NewRotatingFile(path, RotateMaxSize(0))
+	require.Nil(t, err)
+	fmt.Fprintln(f, "line=1")
+
+	// rotate the file as logrotate would
+	require.Nil(t, os.Rename(path, path+".1"))
+	fmt.Fprintln(f, "line=2")
+	require.Nil(t, f.Reopen())
+	fmt.Fprintln(f, "line=3")
+	require.Nil(t, f.Close())
+	assert.Equal(t, os.ErrClosed, f.Reopen())
+
+	data, err := ioutil.ReadFile(path + ".1")
+	require.Nil(t, err)
+	assert.Equal(t, "line=1\nline=2\n", string(data))
+	data, err = ioutil.ReadFile(path)
+	require.Nil(t, err)
+	assert.Equal(t, "line=3\n", string(data))
+}
@@ -0,0 +1,147 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"io"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// LevelWriter is implemented by writers that treat entries differently
+// depending on their level.  Logger calls WriteLevel rather than Write for
+// writers that implement it.
+//
+// The writers in this package treat an empty write as a no-op, as a logrus
+// Logger writes an empty line for an entry discarded by its Formatter, such
+// as one below the level set by WithPackageLevels.
+type LevelWriter interface {
+	io.Writer
+	WriteLevel(level log.Level, p []byte) (int, error)
+}
+
+// LevelsAtLeast returns the levels at least as severe as level, eg.
+// LevelsAtLeast(log.WarnLevel) returns the panic, fatal, error and warning
+// levels.
+func LevelsAtLeast(level log.Level) []log.Level {
+	var levels []log.Level
+	for _, l := range log.AllLevels {
+		if l <= level {
+			levels = append(levels, l)
+		}
+	}
+	return levels
+}
+
+// LevelRouter is a LevelWriter that sends each entry to the writers routed
+// for its level.  An entry is written to every writer whose route includes
+// its level, and is discarded if there are none.
+//
+// eg.
+//
+//	router := kvlog.NewLevelRouter().
+//	    Route(appLog, log.DebugLevel, log.InfoLevel).
+//	    Route(errLog, kvlog.LevelsAtLeast(log.WarnLevel)...).
+//	    Route(forwarder, kvlog.LevelsAtLeast(log.ErrorLevel)...)
+//
+// When used as the output of a logrus Logger, which only calls Write, the
+// level is read from the ll key of each k=v or JSON line; lines without
+// one are routed as InfoLevel.
+type LevelRouter struct {
+	routes [][]io.Writer // indexed by level
+}
+
+// NewLevelRouter creates a LevelRouter with no routes.
+func NewLevelRouter() *LevelRouter {
+	return &LevelRouter{routes: make([][]io.Writer, len(log.AllLevels))}
+}
+
+// NewStdSplitter creates a LevelRouter that writes info and debug entries
+// to stdout and warning entries and above to stderr, as many log collectors,
+// such as Kubernetes', use the stream to assign a severity.
+//
+// eg.
+//
+//	logrus.SetOutput(kvlog.NewStdSplitter(os.Stdout, os.Stderr))
+func NewStdSplitter(stdout, stderr io.Writer) *LevelRouter {
+	return NewLevelRouter().
+		Route(stdout, log.InfoLevel, log.DebugLevel).
+		Route(stderr, LevelsAtLeast(log.WarnLevel)...)
+}
+
+// Route adds w as a destination for entries at each of levels and returns
+// the router so that calls may be chained.  Route must not be called once
+// the router is in use.
+func (r *LevelRouter) Route(w io.Writer, levels ...log.Level) *LevelRouter {
+	for _, l := range levels {
+		if int(l) < len(r.routes) {
+			r.routes[l] = append(r.routes[l], w)
+		}
+	}
+	return r
+}
+
+// Write implements io.Writer, routing p using the level found in the line.
+func (r *LevelRouter) Write(p []byte) (int, error) {
+	return r.WriteLevel(lineLevel(p), p)
+}
+
+// WriteLevel implements LevelWriter.  All routed writers are written to
+// even if one fails; the first error is returned.
+func (r *LevelRouter) WriteLevel(level log.Level, p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if int(level) >= len(r.routes) {
+		return len(p), nil
+	}
+	var firstErr error
+	for _, w := range r.routes[level] {
+		if _, err := w.Write(p); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return 0, firstErr
+	}
+	return len(p), nil
+}
+
+// writeLevel writes p to w, using WriteLevel if w is a LevelWriter.
+func writeLevel(w io.Writer, level log.Level, p []byte) (int, error) {
+	if lw, ok := w.(LevelWriter); ok {
+		return lw.WriteLevel(level, p)
+	}
+	return w.Write(p)
+}
+
+var (
+	kvLevelKey   = []byte(` ll="`)
+	jsonLevelKey = []byte(`"ll":"`)
+)
+
+// lineLevel returns the level of a formatted k=v or JSON line, or InfoLevel
+// if it can't be determined.
+func lineLevel(line []byte) log.Level {
+	i := bytes.Index(line, kvLevelKey)
+	n := len(kvLevelKey)
+	if i == -1 {
+		i, n = bytes.Index(line, jsonLevelKey), len(jsonLevelKey)
+	}
+	if i == -1 {
+		return log.InfoLevel
+	}
+	rest := line[i+n:]
+	end := bytes.IndexByte(rest, '"')
+	if end == -1 {
+		return log.InfoLevel
+	}
+	level, err := log.ParseLevel(string(rest[:end]))
+	if err != nil {
+		return log.InfoLevel
+	}
+	return level
+}
@@ -0,0 +1,112 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestLevelsAtLeast(t *testing.T) {
+	assert.Equal(t, []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel, log.WarnLevel}, LevelsAtLeast(log.WarnLevel))
+	assert.Equal(t, []log.Level{log.PanicLevel}, LevelsAtLeast(log.PanicLevel))
+}
+
+func TestLevelRouter(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Config
+	}{
+		{"kv", WithPrimaryFields()},
+		{"json", WithJSON()},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name+"-logrus", func(t *testing.T) {
+			var app, errs, fwd bytes.Buffer
+			router := NewLevelRouter().
+				Route(&app, log.DebugLevel, log.InfoLevel).
+				Route(&errs, LevelsAtLeast(log.WarnLevel)...).
+				Route(&fwd, LevelsAtLeast(log.ErrorLevel)...)
+			logger := &log.Logger{Out: router, Formatter: New(test.format), Level: log.DebugLevel}
+
+			logger.Debug("debug")
+			logger.Info("info")
+			logger.Warn("warn")
+			logger.Error("error")
+			checkRoutes(t, &app, &errs, &fwd)
+		})
+
+		t.Run(test.name+"-native", func(t *testing.T) {
+			var app, errs, fwd bytes.Buffer
+			router := NewLevelRouter().
+				Route(&app, log.DebugLevel, log.InfoLevel).
+				Route(&errs, LevelsAtLeast(log.WarnLevel)...).
+				Route(&fwd, LevelsAtLeast(log.ErrorLevel)...)
+			logger := NewLogger(router, New(test.format))
+			logger.SetLevel(log.DebugLevel)
+
+			logger.Debug("debug")
+			logger.Info("info")
+			logger.Warn("warn")
+			logger.Error("error")
+			checkRoutes(t, &app, &errs, &fwd)
+		})
+	}
+}
+
+func checkRoutes(t *testing.T, app, errs, fwd *bytes.Buffer) {
+	msgs := func(b *bytes.Buffer) []string {
+		var result []string
+		for _, m := range regexp.MustCompile(`_msg"?[=:]"(\w+)"`).FindAllStringSubmatch(b.String(), -1) {
+			result = append(result, m[1])
+		}
+		return result
+	}
+	assert.Equal(t, []string{"debug", "info"}, msgs(app))
+	assert.Equal(t, []string{"warn", "error"}, msgs(errs))
+	assert.Equal(t, []string{"error"}, msgs(fwd))
+}
+
+type failWriter struct{}
+
+func (failWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("failed")
+}
+
+func TestLevelRouterError(t *testing.T) {
+	var buf bytes.Buffer
+	router := NewLevelRouter().Route(failWriter{}, log.InfoLevel).Route(&buf, log.InfoLevel)
+	_, err := router.Write([]byte("2017-02-13T12:13:45.000Z ll=\"info\" _msg=\"x\"\n"))
+	assert.NotNil(t, err)
+	assert.NotEmpty(t, buf.String(), "later writers should still be written to")
+
+	line := []byte("2017-02-13T12:13:45.000Z ll=\"debug\" _msg=\"x\"\n")
+	n, err := router.Write(line)
+	assert.Nil(t, err, "unrouted levels should be discarded")
+	assert.Equal(t, len(line), n)
+}
+
+func TestStdSplitter(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	logger := NewLogger(NewStdSplitter(&stdout, &stderr), nil)
+	logger.SetLevel(log.DebugLevel)
+
+	logger.Debug("debug")
+	logger.Info("info")
+	logger.Warn("warn")
+	logger.Error("error")
+
+	ts := regexp.MustCompile(`(?m)^\S+ `)
+	assert.Equal(t, "ll=\"debug\" _msg=\"debug\"\nll=\"info\" _msg=\"info\"\n", ts.ReplaceAllString(stdout.String(), ""))
+	assert.Equal(t, "ll=\"warning\" _msg=\"warn\"\nll=\"error\" _msg=\"error\"\n", ts.ReplaceAllString(stderr.String(), ""))
+}
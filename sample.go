@@ -0,0 +1,129 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"hash/fnv"
+	"io"
+	"math/rand"
+	"sync/atomic"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// dropSampled is the reason reported to observers for entries discarded by
+// a Sampler.
+const dropSampled = "sampled"
+
+// SampleConfig represents a configuration function to be passed to
+// NewSampler.
+type SampleConfig func(s *Sampler)
+
+// SampleRate causes the sampler to keep, on average, one in n entries at
+// level.  Entries at WarnLevel and above are always kept, so setting a rate
+// for those levels has no effect.
+func SampleRate(level log.Level, n int) SampleConfig {
+	return func(s *Sampler) {
+		s.SetRate(level, n)
+	}
+}
+
+// SampleByField causes entries to be sampled by the value of the field key,
+// such as "request_id", rather than at random, so that either all or none
+// of the entries sharing a value are kept.  The decision depends only on
+// the value, so it's consistent across processes, and a value kept at a
+// rate of one in 100 is also kept at one in 10.  Entries without the field
+// are sampled at random.
+func SampleByField(key string) SampleConfig {
+	return func(s *Sampler) {
+		s.key = key
+	}
+}
+
+// Sampler is a LevelWriter that passes a random sample of low severity
+// entries to another writer, reducing the volume of debug and info output
+// while keeping every warning and error.
+//
+// eg.
+//
+//	s := kvlog.NewSampler(os.Stderr,
+//	    kvlog.SampleRate(log.DebugLevel, 100),
+//	    kvlog.SampleRate(log.InfoLevel, 10))
+//	logrus.SetOutput(s)
+//
+// Entries kept from a sampled level have sampled=true and sample_rate=N
+// fields added, where one in N entries is kept, so that counts derived from
+// them downstream can be scaled back up.  k=v and JSON lines are both
+// supported; when used as the output of a logrus Logger the level is read
+// from the ll key of each line.
+type Sampler struct {
+	out   io.Writer
+	rates []int32 // indexed by level; accessed atomically
+	key   string
+}
+
+// NewSampler creates a Sampler that writes the sampled entries to out.
+// Without a SampleRate all entries are kept.
+func NewSampler(out io.Writer, cfgs ...SampleConfig) *Sampler {
+	s := &Sampler{out: out, rates: make([]int32, len(log.AllLevels))}
+	for _, cfg := range cfgs {
+		cfg(s)
+	}
+	return s
+}
+
+// Rate returns the sampling rate of entries at level, where one in n is
+// kept.  0 and 1 both indicate that all entries are kept.
+func (s *Sampler) Rate(level log.Level) int {
+	if int(level) < len(s.rates) {
+		return int(atomic.LoadInt32(&s.rates[level]))
+	}
+	return 0
+}
+
+// SetRate changes the sampling rate of entries at level, as set by
+// SampleRate.  It's safe to call while the sampler is in use.
+func (s *Sampler) SetRate(level log.Level, n int) {
+	if level > log.WarnLevel && int(level) < len(s.rates) {
+		atomic.StoreInt32(&s.rates[level], int32(n))
+	}
+}
+
+// Write implements io.Writer, sampling p using the level found in the line.
+func (s *Sampler) Write(p []byte) (int, error) {
+	return s.WriteLevel(lineLevel(p), p)
+}
+
+// WriteLevel implements LevelWriter.  Entries that aren't sampled are
+// discarded and reported as written.
+func (s *Sampler) WriteLevel(level log.Level, p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if n := s.Rate(level); n > 1 {
+		if !s.keep(p, n) {
+			observeDrops(dropSampled, 1)
+			return len(p), nil
+		}
+		line := addLineFields(p, field{"sampled", true}, field{"sample_rate", n})
+		if _, err := writeLevel(s.out, level, line); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
+	return writeLevel(s.out, level, p)
+}
+
+// keep reports whether an entry sampled at one in n should be kept.
+func (s *Sampler) keep(p []byte, n int) bool {
+	if s.key != "" {
+		if v, ok := LineField(p, s.key); ok {
+			h := fnv.New64a()
+			io.WriteString(h, v)
+			return h.Sum64()%uint64(n) == 0
+		}
+	}
+	return rand.Intn(n) == 0
+}
@@ -0,0 +1,113 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestSampler(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewSampler(&buf,
+		SampleRate(log.InfoLevel, 10),
+		SampleRate(log.WarnLevel, 10)) // ignored
+	info := []byte(`2017-02-13T12:13:45.000Z ll="info" action="x" _msg="hello world"` + "\n")
+	warn := []byte(`2017-02-13T12:13:45.000Z ll="warning" action="x" _msg="hello world"` + "\n")
+
+	for i := 0; i < 10000; i++ {
+		n, err := s.Write(info)
+		require.Nil(t, err)
+		require.Equal(t, len(info), n)
+	}
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	assert.True(t, len(lines) > 800 && len(lines) < 1200, "kept %d lines", len(lines))
+	assert.Equal(t,
+		`2017-02-13T12:13:45.000Z ll="info" action="x" sampled=true sample_rate=10 _msg="hello world"`,
+		string(lines[0]))
+
+	buf.Reset()
+	for i := 0; i < 100; i++ {
+		s.Write(warn)
+	}
+	assert.Equal(t, 100, bytes.Count(buf.Bytes(), []byte("\n")))
+	assert.NotContains(t, buf.String(), "sampled")
+}
+
+func TestSamplerFormats(t *testing.T) {
+	tests := []struct {
+		name     string
+		line     string
+		expected string
+	}{
+		{"kv-no-message",
+			`2017-02-13T12:13:45.000Z ll="debug" action="x"`,
+			`2017-02-13T12:13:45.000Z ll="debug" action="x" sampled=true sample_rate=2`},
+		{"kv-quoted-msg-key",
+			`2017-02-13T12:13:45.000Z ll="debug" note="a _msg=b" _msg="c"` + "\n",
+			`2017-02-13T12:13:45.000Z ll="debug" note="a _msg=b" sampled=true sample_rate=2 _msg="c"` + "\n"},
+		{"json",
+			`{"ll":"debug","_msg":"c"}` + "\n",
+			`{"ll":"debug","_msg":"c","sampled":true,"sample_rate":2}` + "\n"},
+		{"json-empty",
+			`{}`,
+			`{"sampled":true,"sample_rate":2}`},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			s := NewSampler(&buf, SampleRate(log.DebugLevel, 2))
+			for buf.Len() == 0 {
+				s.WriteLevel(log.DebugLevel, []byte(test.line))
+			}
+			assert.Equal(t, test.expected, buf.String())
+		})
+	}
+}
+
+func TestSamplerByField(t *testing.T) {
+	var buf bytes.Buffer
+	s := NewSampler(&buf,
+		SampleRate(log.DebugLevel, 100),
+		SampleRate(log.InfoLevel, 10),
+		SampleByField("request_id"))
+
+	kept := make(map[string]int)
+	for i := 0; i < 2000; i++ {
+		id := fmt.Sprintf("req-%d", i)
+		for j := 0; j < 3; j++ {
+			buf.Reset()
+			s.Write([]byte(fmt.Sprintf(`2017-02-13T12:13:45.000Z ll="info" request_id=%q step=%d`, id, j)))
+			if buf.Len() > 0 {
+				kept[id]++
+			}
+		}
+	}
+	// each request's entries are either all kept or all dropped
+	assert.True(t, len(kept) > 150 && len(kept) < 250, "kept %d requests", len(kept))
+	for id, n := range kept {
+		assert.Equal(t, 3, n, id)
+	}
+
+	// requests kept at one in 100 are a subset of those kept at one in 10
+	var debugKept int
+	for i := 0; i < 2000; i++ {
+		buf.Reset()
+		s.Write([]byte(fmt.Sprintf(`2017-02-13T12:13:45.000Z ll="debug" request_id="req-%d"`, i)))
+		if buf.Len() > 0 {
+			debugKept++
+			assert.Contains(t, kept, fmt.Sprintf("req-%d", i))
+		}
+	}
+	assert.True(t, debugKept > 5 && debugKept < 40, "kept %d debug entries", debugKept)
+}
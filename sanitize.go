@@ -0,0 +1,78 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// WithStrictValues causes values that are otherwise written verbatim, those
+// of Marshaler types such as RawLogString and of types formatted with %v,
+// to be quoted unless they're already safe: either a single token without
+// spaces or control characters, or a correctly quoted string.  This
+// prevents a value containing a newline or a crafted " key=value" sequence
+// from forging fields or entire log lines.
+func WithStrictValues() Config {
+	return func(kvf *Formatter) {
+		kvf.strict = true
+	}
+}
+
+// unsafeKeyByte reports whether c can't appear in a key without making the
+// line ambiguous to parse.
+func unsafeKeyByte(c byte) bool {
+	return c <= ' ' || c == '=' || c == '"' || c == 0x7f
+}
+
+// sanitizeKey returns k with spaces, equals signs, quotes and control
+// characters replaced with underscores, so that a key taken from untrusted
+// input can't end a field early or start a new line.
+func sanitizeKey(k string) string {
+	if k == "" {
+		return "_"
+	}
+	for i := 0; i < len(k); i++ {
+		if unsafeKeyByte(k[i]) {
+			b := []byte(k)
+			for j := i; j < len(b); j++ {
+				if unsafeKeyByte(b[j]) {
+					b[j] = '_'
+				}
+			}
+			return string(b)
+		}
+	}
+	return k
+}
+
+// safeRawValue reports whether s can be written unquoted without being
+// misread: either a non-empty token without spaces or control characters
+// that doesn't begin with a quote, or a complete double quoted string.
+func safeRawValue(s string) bool {
+	if s == "" {
+		return false
+	}
+	if s[0] == '"' {
+		_, err := strconv.Unquote(s)
+		return err == nil
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; c <= ' ' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// writeRaw writes a value that's normally included verbatim, quoting it if
+// WithStrictValues is set and it isn't safe.
+func (cf *Formatter) writeRaw(b *bytes.Buffer, s string) {
+	if cf.strict && !safeRawValue(s) {
+		cf.writeString(b, s)
+		return
+	}
+	b.WriteString(s)
+}
@@ -0,0 +1,79 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestSanitizeKeys(t *testing.T) {
+	cf := New()
+	result, err := cf.Format(&log.Entry{
+		Time:    testTime,
+		Level:   log.InfoLevel,
+		Message: "ok",
+		Data: log.Fields{
+			"user\n2017-02-13T12:13:45.000Z ll": "error",
+			`a="b" c`:                           1,
+			"":                                  2,
+		},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" _=2 a__b__c=1 user_2017-02-13T12:13:45.000Z_ll="error" _msg="ok"`+"\n", string(result))
+
+	entry, err := Parse(bytes.TrimSuffix(result, []byte("\n")))
+	require.Nil(t, err)
+	assert.Equal(t, log.InfoLevel, entry.Level)
+	assert.Len(t, entry.Fields, 3)
+
+	var buf bytes.Buffer
+	NewLogger(&buf, cf).Log(log.InfoLevel, "typed", String("x\ny", "z"))
+	assert.Regexp(t, ` x_y="z" _msg="typed"\n$`, buf.String())
+}
+
+type rawPair struct {
+	A, B string
+}
+
+func TestStrictValues(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		loose    string
+		expected string
+	}{
+		{"token", RawLogString("abc"), `abc`, `abc`},
+		{"quoted", RawLogString(`"a b"`), `"a b"`, `"a b"`},
+		{"newline", RawLogString("a\n2017-02-13T12:13:45.000Z ll=\"error\""),
+			"a\n2017-02-13T12:13:45.000Z ll=\"error\"", `"a\n2017-02-13T12:13:45.000Z ll=\"error\""`},
+		{"forged-field", RawLogString(`x admin=true`), `x admin=true`, `"x admin=true"`},
+		{"bad-quote", RawLogString(`"a" b="c"`), `"a" b="c"`, `"\"a\" b=\"c\""`},
+		{"empty", RawLogString(""), ``, `""`},
+		{"default", rawPair{"x", "y z"}, `{x y z}`, `"{x y z}"`},
+		{"number", 12, `12`, `12`},
+	}
+
+	loose, strict := New(), New(WithStrictValues())
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			entry := &log.Entry{Time: testTime, Level: log.InfoLevel, Data: log.Fields{"v": test.value}}
+			result, err := loose.Format(entry)
+			require.Nil(t, err)
+			assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" v=`+test.loose, strings.TrimSuffix(string(result), "\n"))
+
+			result, err = strict.Format(entry)
+			require.Nil(t, err)
+			assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" v=`+test.expected, strings.TrimSuffix(string(result), "\n"))
+		})
+	}
+}
@@ -0,0 +1,177 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// schemaErrKey is the key of the field added by MarkSchemaErrors.
+const schemaErrKey = "_schema_err"
+
+// ValueKind is the kind of value a Schema expects a field to hold.
+type ValueKind int
+
+const (
+	// StringValue matches strings, byte slices, errors and fmt.Stringers.
+	StringValue ValueKind = iota + 1
+
+	// IntValue matches any integer type.
+	IntValue
+
+	// NumberValue matches any integer or floating point type, or a Metric.
+	NumberValue
+
+	// BoolValue matches a bool.
+	BoolValue
+
+	// DurationValue matches a time.Duration.
+	DurationValue
+
+	// TimeValue matches a time.Time.
+	TimeValue
+)
+
+var valueKindNames = []string{"", "string", "int", "number", "bool", "duration", "time"}
+
+func (k ValueKind) String() string {
+	if k > 0 && int(k) < len(valueKindNames) {
+		return valueKindNames[k]
+	}
+	return fmt.Sprintf("ValueKind(%d)", int(k))
+}
+
+// matches reports whether v is of kind k.
+func (k ValueKind) matches(v interface{}) bool {
+	switch v.(type) {
+	case time.Duration:
+		return k == DurationValue
+	case time.Time:
+		return k == TimeValue
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return k == IntValue || k == NumberValue
+	case float32, float64, Metric:
+		return k == NumberValue
+	case bool:
+		return k == BoolValue
+	case string, *string, []byte, error, fmt.Stringer:
+		return k == StringValue
+	}
+	return false
+}
+
+// Schema describes the fields entries are expected to have.
+type Schema struct {
+	// Required lists keys that every entry must have, either as an entry
+	// field or a constant field.
+	Required []string
+
+	// Kinds maps keys to the kind of value their fields must hold.  Keys
+	// produced by a Loggable value, such as "user.id", may be listed.
+	Kinds map[string]ValueKind
+}
+
+// SchemaMode selects how WithSchema reports entries that don't match the
+// schema.
+type SchemaMode int
+
+const (
+	// ReportSchemaErrors passes a SchemaError for each violation to the
+	// handler set by WithErrorHandler.
+	ReportSchemaErrors SchemaMode = iota
+
+	// MarkSchemaErrors adds a _schema_err field to the entry describing
+	// its violations.
+	MarkSchemaErrors
+)
+
+// SchemaError describes a field that doesn't match the schema set by
+// WithSchema.
+type SchemaError struct {
+	Key      string
+	Missing  bool        // the field is required but not present
+	Expected ValueKind   // the kind expected, if not Missing
+	Value    interface{} // the value logged, if not Missing
+}
+
+func (e *SchemaError) Error() string {
+	return "kvlog: schema violation: " + e.describe()
+}
+
+func (e *SchemaError) describe() string {
+	if e.Missing {
+		return fmt.Sprintf("%s is missing", e.Key)
+	}
+	return fmt.Sprintf("%s is %T, expected %s", e.Key, e.Value, e.Expected)
+}
+
+type schemaConfig struct {
+	Schema
+	mode SchemaMode
+}
+
+// WithSchema validates the fields of each entry against schema, reporting
+// required fields that are missing and fields whose values are of the wrong
+// kind according to mode.  Entries are logged whether or not they match.
+//
+// eg.
+//
+//	kvlog.New(kvlog.WithSchema(kvlog.Schema{
+//	    Required: []string{"action"},
+//	    Kinds:    map[string]kvlog.ValueKind{"duration_ms": kvlog.NumberValue},
+//	}, kvlog.MarkSchemaErrors))
+//
+// Values are checked as they're logged, after redaction or hashing, and
+// after WithMaxFields has dropped any excess fields.  Constant fields
+// satisfy Required but their kinds aren't checked.
+func WithSchema(schema Schema, mode SchemaMode) Config {
+	return func(kvf *Formatter) {
+		kvf.schema = &schemaConfig{Schema: schema, mode: mode}
+	}
+}
+
+// checkSchema validates fields against the schema set by WithSchema,
+// returning fields with a _schema_err field appended if required.
+func (cf *Formatter) checkSchema(fc *fieldConfig, fields []field) []field {
+	if cf.schema == nil {
+		return fields
+	}
+	var errs []*SchemaError
+	for _, f := range fields {
+		if kind, ok := cf.schema.Kinds[f.key]; ok && !kind.matches(f.value) {
+			errs = append(errs, &SchemaError{Key: f.key, Expected: kind, Value: f.value})
+		}
+	}
+	for _, k := range cf.schema.Required {
+		if !hasField(fields, k) && !hasField(fc.constants, k) {
+			errs = append(errs, &SchemaError{Key: k, Missing: true})
+		}
+	}
+	if len(errs) == 0 {
+		return fields
+	}
+	if cf.schema.mode == MarkSchemaErrors {
+		msgs := make([]string, len(errs))
+		for i, err := range errs {
+			msgs[i] = err.describe()
+		}
+		return append(fields, field{schemaErrKey, strings.Join(msgs, "; ")})
+	}
+	for _, err := range errs {
+		cf.reportError(err)
+	}
+	return fields
+}
+
+func hasField(fields []field, k string) bool {
+	for _, f := range fields {
+		if f.key == k {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+var testSchema = Schema{
+	Required: []string{"action", "env"},
+	Kinds: map[string]ValueKind{
+		"duration_ms": NumberValue,
+		"count":       IntValue,
+		"ok":          BoolValue,
+		"elapsed":     DurationValue,
+		"action":      StringValue,
+	},
+}
+
+func TestSchemaMark(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     log.Fields
+		expected string
+	}{
+		{"valid", log.Fields{"action": "login", "duration_ms": 1.5, "count": 3, "ok": true, "elapsed": time.Second},
+			`action="login" count=3 duration_ms=1.5 elapsed="1s" ok=true`},
+		{"wrong-kind", log.Fields{"action": "login", "duration_ms": "12ms", "count": 1.5},
+			`action="login" count=1.5 duration_ms="12ms" _schema_err="count is float64, expected int; duration_ms is string, expected number"`},
+		{"missing", log.Fields{"ok": 1},
+			`ok=1 _schema_err="ok is int, expected bool; action is missing"`},
+		{"empty", nil, `_schema_err="action is missing"`},
+	}
+
+	cf := New(WithConstantField("env", "prod"), WithSchema(testSchema, MarkSchemaErrors))
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := cf.Format(&log.Entry{Time: testTime, Level: log.InfoLevel, Data: test.data})
+			require.Nil(t, err)
+			assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" env="prod" `+test.expected, strings.TrimSuffix(string(result), "\n"))
+		})
+	}
+}
+
+func TestSchemaReport(t *testing.T) {
+	var errs []error
+	var buf bytes.Buffer
+	cf := New(WithSchema(testSchema, ReportSchemaErrors), WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+	NewLogger(&buf, cf).Log(log.InfoLevel, "done", String("action", "x"), String("duration_ms", "12"))
+
+	assert.Contains(t, buf.String(), ` action="x" duration_ms="12" _msg="done"`)
+	require.Len(t, errs, 2)
+	assert.Equal(t, &SchemaError{Key: "duration_ms", Expected: NumberValue, Value: "12"}, errs[0])
+	assert.Equal(t, "kvlog: schema violation: env is missing", errs[1].Error())
+}
+
+func TestSchemaChild(t *testing.T) {
+	cf := New(WithSchema(Schema{Required: []string{"id"}}, MarkSchemaErrors)).Child(WithJSON())
+	result, err := cf.Format(&log.Entry{Time: testTime, Level: log.InfoLevel, Data: log.Fields{}})
+	require.Nil(t, err)
+	assert.Contains(t, string(result), `"_schema_err":"id is missing"`)
+}
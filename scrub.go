@@ -0,0 +1,135 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"regexp"
+)
+
+// ScrubRule masks text matching a pattern in field values, such as email
+// addresses or card numbers.
+type ScrubRule struct {
+	// Pattern matches the text to be masked.
+	Pattern *regexp.Regexp
+
+	// Replacement replaces each match.  If Valid is nil it may refer to
+	// submatches of Pattern, as in regexp.Regexp.ReplaceAllString.
+	Replacement string
+
+	// Valid, if set, is called with each match and only those for which it
+	// returns true are replaced, to reduce false positives.
+	Valid func(match string) bool
+}
+
+var (
+	// ScrubEmails masks email addresses.
+	ScrubEmails = ScrubRule{
+		Pattern:     regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+		Replacement: "[EMAIL]",
+	}
+
+	// ScrubCardNumbers masks payment card numbers of 13 to 19 digits,
+	// optionally separated by spaces or dashes, that pass the Luhn check.
+	ScrubCardNumbers = ScrubRule{
+		Pattern:     regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`),
+		Replacement: "[CARD]",
+		Valid:       luhnValid,
+	}
+
+	// ScrubBearerTokens masks the token following "Bearer", as found in
+	// HTTP Authorization headers.
+	ScrubBearerTokens = ScrubRule{
+		Pattern:     regexp.MustCompile(`(?i)\b(bearer\s+)[A-Za-z0-9\-._~+/]+=*`),
+		Replacement: "${1}[REDACTED]",
+	}
+
+	// DefaultScrubRules holds the built in rules.
+	DefaultScrubRules = []ScrubRule{ScrubEmails, ScrubCardNumbers, ScrubBearerTokens}
+)
+
+// WithScrubbing causes string, []byte and error field values to be passed
+// through rules before they're emitted, masking any personal information or
+// credentials they contain.  Rules are applied in order, and repeated use
+// adds to the rules already configured.
+//
+// eg.
+//
+//	kvlog.New(
+//	    kvlog.WithScrubbing(kvlog.DefaultScrubRules...),
+//	    kvlog.WithScrubbing(kvlog.ScrubRule{
+//	        Pattern:     regexp.MustCompile(`\bACCT-\d+\b`),
+//	        Replacement: "[ACCOUNT]",
+//	    }))
+//
+// Every matching value is scanned by every rule, which adds noticeably to
+// the cost of formatting entries with many string fields.  The message and
+// constant fields are not scrubbed.
+func WithScrubbing(rules ...ScrubRule) Config {
+	return func(kvf *Formatter) {
+		kvf.scrub = append(kvf.scrub[:len(kvf.scrub):len(kvf.scrub)], rules...)
+	}
+}
+
+// scrubValue returns v with any text matching cf's scrub rules masked.
+// Values other than strings, []byte and errors are returned unchanged.
+func (cf *Formatter) scrubValue(v interface{}) interface{} {
+	var s string
+	switch data := v.(type) {
+	case string:
+		s = data
+	case *string:
+		if data == nil {
+			return v
+		}
+		s = *data
+	case []byte:
+		s = string(data)
+	case error:
+		s = data.Error()
+	default:
+		return v
+	}
+	scrubbed := s
+	for _, rule := range cf.scrub {
+		scrubbed = rule.apply(scrubbed)
+	}
+	if scrubbed == s {
+		return v
+	}
+	return scrubbed
+}
+
+func (r ScrubRule) apply(s string) string {
+	if r.Valid == nil {
+		return r.Pattern.ReplaceAllString(s, r.Replacement)
+	}
+	return r.Pattern.ReplaceAllStringFunc(s, func(m string) string {
+		if !r.Valid(m) {
+			return m
+		}
+		return r.Replacement
+	})
+}
+
+// luhnValid reports whether the digits of s pass the Luhn checksum used by
+// payment card numbers.  Other characters are ignored.
+func luhnValid(s string) bool {
+	sum, double := 0, false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// Flusher is implemented by the writers and hooks that hold entries in
+// memory before writing or sending them, such as LokiWriter, GzipWriter and
+// Deduper.  Flush writes any entries held, waiting for them to be delivered,
+// and returns the first error encountered.
+type Flusher interface {
+	Flush() error
+}
+
+var (
+	shutdownMu      sync.Mutex
+	shutdownClosers []io.Closer
+)
+
+// RegisterShutdown adds c to the set of writers closed by Shutdown.  The
+// writers, hooks and exporters in this package that hold entries in memory,
+// run background goroutines or hold open files register themselves when
+// created and unregister when closed, so this need only be called for
+// other writers that should be closed along with them.
+//
+// Closing a writer that wraps another, such as Deduper, RateLimitWriter,
+// GzipWriter or AuditWriter, doesn't close the writer it wraps; that remains
+// the responsibility of whoever opened it, so Shutdown never closes
+// os.Stderr or a file shared with other writers.
+//
+// A registered writer is referenced until it's closed, so the caller must
+// Close each writer that's no longer needed, such as one created for a
+// single request or test, rather than discarding it; otherwise it, and any
+// goroutines it runs, are never freed.
+func RegisterShutdown(c io.Closer) {
+	shutdownMu.Lock()
+	shutdownClosers = append(shutdownClosers, c)
+	shutdownMu.Unlock()
+}
+
+// UnregisterShutdown removes c from the set of writers closed by Shutdown.
+func UnregisterShutdown(c io.Closer) {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	for i, sc := range shutdownClosers {
+		if sc == c {
+			shutdownClosers = append(shutdownClosers[:i], shutdownClosers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Shutdown closes every open writer, hook and exporter created by this
+// package, along with any added by RegisterShutdown, so that entries held
+// in memory are delivered before the program exits.
+//
+// eg.
+//
+//	sig := make(chan os.Signal, 1)
+//	signal.Notify(sig, syscall.SIGTERM)
+//	<-sig
+//	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+//	defer cancel()
+//	if err := kvlog.Shutdown(ctx); err != nil {
+//	    fmt.Fprintln(os.Stderr, "failed to flush logs:", err)
+//	}
+//
+// Writers are closed one at a time, most recently created first, so that a
+// writer that wraps another, such as a Spool delivering to a LokiWriter, is
+// closed before its destination.  Each Close writes or sends any entries
+// held, stops the writer's background goroutines and releases its
+// resources; Close may be called more than once, and entries written after
+// Close are discarded with an error.
+//
+// Shutdown returns the first error returned by Close, or ctx's error if it
+// expires first, in which case the remaining writers continue to be closed
+// in the background.
+func Shutdown(ctx context.Context) error {
+	shutdownMu.Lock()
+	closers := shutdownClosers
+	shutdownClosers = nil
+	shutdownMu.Unlock()
+
+	done := make(chan error, 1)
+	go func() {
+		var firstErr error
+		for i := len(closers) - 1; i >= 0; i-- {
+			if err := closers[i].Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		done <- firstErr
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
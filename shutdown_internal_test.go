@@ -0,0 +1,61 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func registered() int {
+	shutdownMu.Lock()
+	defer shutdownMu.Unlock()
+	return len(shutdownClosers)
+}
+
+// TestCloseUnregisters checks that every writer that registers for Shutdown
+// unregisters when closed, so that it can be freed.
+func TestCloseUnregisters(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	auditFile, err := os.Create(filepath.Join(dir, "audit.log"))
+	require.Nil(t, err)
+
+	logger := log.New()
+	logger.Out = ioutil.Discard
+	writers := map[string]func() (io.Closer, error){
+		"audit":     func() (io.Closer, error) { return NewAuditWriter(auditFile), nil },
+		"dedup":     func() (io.Closer, error) { return NewDeduper(ioutil.Discard), nil },
+		"fluent":    func() (io.Closer, error) { return NewFluentForwarder(New(), "127.0.0.1:1", "app"), nil },
+		"gzip":      func() (io.Closer, error) { return NewGzipWriter(ioutil.Discard), nil },
+		"heartbeat": func() (io.Closer, error) { return NewHeartbeat(logger, time.Hour), nil },
+		"hec":       func() (io.Closer, error) { return NewHECForwarder(New(), "http://127.0.0.1:1", "token"), nil },
+		"loki":      func() (io.Closer, error) { return NewLokiWriter("http://127.0.0.1:1"), nil },
+		"net":       func() (io.Closer, error) { return NewNetWriter("tcp", "127.0.0.1:1"), nil },
+		"otlp":      func() (io.Closer, error) { return NewOTLPExporter(New(), "http://127.0.0.1:1"), nil },
+		"ratelimit": func() (io.Closer, error) { return NewRateLimitWriter(ioutil.Discard, 10), nil },
+		"rotate":    func() (io.Closer, error) { return NewRotatingFile(filepath.Join(dir, "app.log")) },
+		"spool":     func() (io.Closer, error) { return NewSpool(filepath.Join(dir, "spool"), ioutil.Discard) },
+	}
+	for name, create := range writers {
+		t.Run(name, func(t *testing.T) {
+			before := registered()
+			w, err := create()
+			require.Nil(t, err)
+			assert.Equal(t, before+1, registered())
+			w.Close()
+			assert.Equal(t, before, registered())
+		})
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+type testCloser struct {
+	name  string
+	order *[]string
+	block chan struct{}
+}
+
+func (c *testCloser) Close() error {
+	if c.block != nil {
+		<-c.block
+	}
+	*c.order = append(*c.order, c.name)
+	return nil
+}
+
+func TestShutdown(t *testing.T) {
+	// close anything left open by other tests
+	Shutdown(context.Background())
+
+	recv := new(lokiLines)
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	loki := NewLokiWriter(srv.URL, LokiBatch(100, time.Hour))
+	out := new(syncBuffer)
+	gz := NewGzipWriter(out, GzipFlushInterval(time.Hour))
+	var order []string
+	RegisterShutdown(&testCloser{name: "first", order: &order})
+	RegisterShutdown(&testCloser{name: "second", order: &order})
+
+	loki.Write([]byte("held\n"))
+	gz.Write([]byte("held\n"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	require.Nil(t, Shutdown(ctx))
+
+	assert.Equal(t, []string{"held"}, recv.get())
+	assert.False(t, out.closed)
+	assert.Equal(t, "held\n", gunzip(t, out.Bytes()))
+	assert.Equal(t, []string{"second", "first"}, order)
+
+	_, err := loki.Write([]byte("late\n"))
+	assert.NotNil(t, err)
+	_, err = gz.Write([]byte("late\n"))
+	assert.NotNil(t, err)
+
+	// closed writers aren't closed again
+	require.Nil(t, Shutdown(ctx))
+	assert.Len(t, order, 2)
+}
+
+func TestShutdownUnregister(t *testing.T) {
+	Shutdown(context.Background())
+
+	var order []string
+	c := &testCloser{name: "closer", order: &order}
+	RegisterShutdown(c)
+	UnregisterShutdown(c)
+	require.Nil(t, Shutdown(context.Background()))
+	assert.Len(t, order, 0)
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	Shutdown(context.Background())
+
+	var order []string
+	block := make(chan struct{})
+	RegisterShutdown(&testCloser{name: "slow", order: &order, block: block})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, Shutdown(ctx))
+	close(block)
+}
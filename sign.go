@@ -0,0 +1,182 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"sync"
+)
+
+var (
+	// ErrUnsigned is returned by Verifier.Verify for a line without a _sig
+	// field.
+	ErrUnsigned = errors.New("kvlog: line not signed")
+
+	// ErrSignature is returned by Verifier.Verify for a line whose _sig
+	// field doesn't match its content, indicating that it has been altered
+	// or signed with a different key or, with chained signatures, that it
+	// doesn't follow the line that preceded it when it was written.
+	ErrSignature = errors.New("kvlog: line signature mismatch")
+
+	// ErrChainBreak is returned by Verifier.Verify for a correctly signed
+	// line that starts a new chain part way through the input, as happens
+	// when the writer is restarted, or if the lines before it in its chain
+	// have been removed.
+	ErrChainBreak = errors.New("kvlog: signature chain broken")
+)
+
+const (
+	signatureKey = " _sig="
+	signatureLen = len(signatureKey) + 2*sha256.Size
+)
+
+// SignConfig represents a configuration function to be passed to
+// NewSigningWriter and NewVerifier.
+type SignConfig func(s *signer)
+
+// SignChained causes each line's signature to also cover the signature of
+// the line before it, so that removing, inserting or reordering lines is
+// detected as well as changes to their content.  The Verifier must be
+// configured the same way and given every line, in order.
+func SignChained() SignConfig {
+	return func(s *signer) {
+		s.chained = true
+	}
+}
+
+// signer computes the signatures shared by SigningWriter and Verifier.
+type signer struct {
+	key     []byte
+	chained bool
+	prev    []byte // signature of the previous line, if chained
+}
+
+func newSigner(key []byte, cfgs []SignConfig) signer {
+	s := signer{key: key}
+	for _, cfg := range cfgs {
+		cfg(&s)
+	}
+	return s
+}
+
+// sign returns the hex encoded HMAC-SHA256 of line, chained to prev.
+func (s *signer) sign(line, prev []byte) []byte {
+	mac := hmac.New(sha256.New, s.key)
+	if s.chained {
+		mac.Write(prev)
+		mac.Write([]byte{'\n'})
+	}
+	mac.Write(line)
+	sum := make([]byte, 2*sha256.Size)
+	hex.Encode(sum, mac.Sum(nil))
+	return sum
+}
+
+// SigningWriter is an io.Writer that appends a _sig field to each line,
+// holding an HMAC-SHA256 of the rest of the line computed with a secret
+// key, so that the log can later be shown not to have been altered using
+// a Verifier or the kvverify command.
+//
+// eg.
+//
+//	w := kvlog.NewSigningWriter(f, key, kvlog.SignChained())
+//	logrus.SetOutput(w)
+//
+// The signature must be the last change made to a line, so SigningWriter
+// should write directly to the destination rather than to another writer
+// in this package that adds fields to lines, such as Sampler.
+type SigningWriter struct {
+	out io.Writer
+	mu  sync.Mutex
+	signer
+}
+
+// NewSigningWriter creates a SigningWriter that writes lines signed with
+// key to out.
+func NewSigningWriter(out io.Writer, key []byte, cfgs ...SignConfig) *SigningWriter {
+	return &SigningWriter{out: out, signer: newSigner(key, cfgs)}
+}
+
+// Write implements io.Writer, signing each line in p.
+func (w *SigningWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	var b bytes.Buffer
+	for _, line := range bytes.SplitAfter(p, []byte("\n")) {
+		body := bytes.TrimRight(line, "\r\n")
+		if len(body) == 0 {
+			b.Write(line)
+			continue
+		}
+		sig := w.sign(body, w.prev)
+		b.Write(body)
+		b.WriteString(signatureKey)
+		b.Write(sig)
+		b.Write(line[len(body):])
+		w.prev = sig
+	}
+	if _, err := w.out.Write(b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Verifier checks the signatures of lines written by a SigningWriter.
+type Verifier struct {
+	signer
+}
+
+// NewVerifier creates a Verifier for lines signed with key.  It must be
+// given the same SignConfig options as the SigningWriter.
+func NewVerifier(key []byte, cfgs ...SignConfig) *Verifier {
+	return &Verifier{signer: newSigner(key, cfgs)}
+}
+
+// Verify checks the signature of a single line, which for chained
+// signatures must be the line following the one last passed to Verify.
+//
+// A line that was altered after being signed returns ErrSignature, as does,
+// with chained signatures, a line that doesn't follow the previous line,
+// such as one after a removed line.  A chained line that starts a new chain
+// returns ErrChainBreak; this is the case for the first line written after
+// a program restarts, so a break should be checked against the surrounding
+// lines.
+func (v *Verifier) Verify(line []byte) error {
+	body, sig, ok := splitSignature(bytes.TrimRight(line, "\r\n"))
+	if !ok {
+		return ErrUnsigned
+	}
+	prev := v.prev
+	v.prev = append([]byte(nil), sig...)
+	if hmac.Equal(sig, v.sign(body, prev)) {
+		return nil
+	}
+	if v.chained && len(prev) > 0 && hmac.Equal(sig, v.sign(body, nil)) {
+		return ErrChainBreak
+	}
+	return ErrSignature
+}
+
+// splitSignature returns line without its trailing _sig field, along with
+// the signature.  ok is false if the line isn't signed.
+func splitSignature(line []byte) (body, sig []byte, ok bool) {
+	n := len(line) - signatureLen
+	if n < 0 || !bytes.Equal(line[n:n+len(signatureKey)], []byte(signatureKey)) {
+		return line, nil, false
+	}
+	sig = line[n+len(signatureKey):]
+	if _, err := hex.Decode(make([]byte, sha256.Size), sig); err != nil {
+		return line, nil, false
+	}
+	return line[:n], sig, true
+}
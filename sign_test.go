@@ -0,0 +1,88 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+var signKey = []byte("secret")
+
+func signLines(t *testing.T, cfgs ...SignConfig) []string {
+	var buf bytes.Buffer
+	logger := NewLogger(NewSigningWriter(&buf, signKey, cfgs...), New(WithChecksum()))
+	for _, msg := range []string{"one", "two", "three"} {
+		logger.Log(log.InfoLevel, msg)
+	}
+	return strings.SplitAfter(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func TestSigningWriter(t *testing.T) {
+	lines := signLines(t)
+	require.Len(t, lines, 3)
+	assert.Regexp(t, ` _cksum=[0-9a-f]{8} _sig=[0-9a-f]{64}\n$`, lines[0])
+
+	// the signature is removed by Parse, leaving the checksum to verify
+	entry, err := Parse([]byte(lines[0]))
+	require.Nil(t, err)
+	assert.True(t, entry.Checksummed)
+	assert.Equal(t, "one", entry.Message)
+	assert.Empty(t, entry.Fields)
+
+	v := NewVerifier(signKey)
+	for _, line := range lines {
+		assert.Nil(t, v.Verify([]byte(line)))
+	}
+	// unchained lines verify in any order
+	assert.Nil(t, v.Verify([]byte(lines[0])))
+
+	assert.Equal(t, ErrSignature, NewVerifier([]byte("wrong")).Verify([]byte(lines[0])))
+	assert.Equal(t, ErrSignature, v.Verify([]byte(strings.Replace(lines[1], "two", "2", 1))))
+	assert.Equal(t, ErrUnsigned, v.Verify([]byte(`2017-02-13T12:13:45.000Z ll="info"`)))
+}
+
+func TestSigningWriterChained(t *testing.T) {
+	lines := signLines(t, SignChained())
+
+	v := NewVerifier(signKey, SignChained())
+	for _, line := range lines {
+		assert.Nil(t, v.Verify([]byte(line)))
+	}
+
+	v = NewVerifier(signKey, SignChained())
+	assert.Nil(t, v.Verify([]byte(lines[0])))
+	assert.Equal(t, ErrSignature, v.Verify([]byte(lines[2])), "line removed")
+	assert.Equal(t, ErrChainBreak, v.Verify([]byte(lines[0])), "restarted chain")
+	assert.Nil(t, v.Verify([]byte(lines[1])))
+
+	// an unchained verifier accepts chained lines only at the start
+	assert.Equal(t, ErrSignature, NewVerifier(signKey).Verify([]byte(lines[1])))
+}
+
+func TestDecoderVerifySignatures(t *testing.T) {
+	lines := signLines(t, SignChained())
+	input := lines[0] + strings.Replace(lines[1], "two", "2", 1) + lines[2]
+
+	d := NewDecoder(strings.NewReader(input))
+	d.VerifySignatures(NewVerifier(signKey, SignChained()))
+	var errs []error
+	d.OnMalformed(func(lineNum int, line []byte, err error) {
+		errs = append(errs, err)
+	})
+	var msgs []string
+	for d.Next() {
+		msgs = append(msgs, d.Entry().Message)
+	}
+	assert.Equal(t, []string{"one", "three"}, msgs)
+	assert.Equal(t, []error{ErrSignature}, errs)
+}
@@ -0,0 +1,405 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	spoolExt        = ".spool"
+	spoolCursorFile = "cursor"
+	spoolChunkSize  = 256 << 10
+)
+
+// SpoolConfig represents a configuration function to be passed to
+// NewSpool.
+type SpoolConfig func(s *Spool)
+
+// SpoolMaxSize sets the maximum number of bytes held on disk.  Once
+// exceeded, the oldest entries are discarded.  The default is 100MB.
+func SpoolMaxSize(size int64) SpoolConfig {
+	return func(s *Spool) {
+		s.maxSize = size
+	}
+}
+
+// SpoolSegmentSize sets the size at which a new spool file is started.
+// Files are deleted once all of their entries have been delivered, or when
+// SpoolMaxSize is exceeded.  The default is 4MB.
+func SpoolSegmentSize(size int64) SpoolConfig {
+	return func(s *Spool) {
+		s.segmentSize = size
+	}
+}
+
+// SpoolRetryInterval sets the time to wait before retrying delivery after
+// the destination fails.  The default is one second.
+func SpoolRetryInterval(d time.Duration) SpoolConfig {
+	return func(s *Spool) {
+		s.retryInterval = d
+	}
+}
+
+// SpoolErrorHandler sets a function to be called when delivery to the
+// destination fails.
+func SpoolErrorHandler(f func(error)) SpoolConfig {
+	return func(s *Spool) {
+		s.onError = f
+	}
+}
+
+// Spool is an io.Writer that persists entries to a bounded queue on disk
+// before delivering them to another writer, so that entries written while
+// the destination is unavailable are delivered once it recovers rather
+// than lost, including across restarts of the program.
+//
+// eg.
+//
+//	loki := kvlog.NewLokiWriter("http://loki:3100")
+//	spool, err := kvlog.NewSpool("/var/spool/myapp", loki)
+//	...
+//	defer spool.Close()
+//	logrus.SetOutput(spool)
+//
+// Entries are delivered in order by a background goroutine, one per call to
+// the destination's Write.  If the destination has a Flush method returning
+// an error, as LokiWriter does, it's called after each group of entries so
+// that failed network requests are detected and retried.  Delivery is
+// at-least-once: entries may be delivered again if the destination fails
+// part way through a group, or the program exits before recording that
+// they were delivered.
+//
+// dir should be used by a single Spool at a time.
+type Spool struct {
+	dir           string
+	dst           io.Writer
+	maxSize       int64
+	segmentSize   int64
+	retryInterval time.Duration
+	onError       func(error)
+
+	mu      sync.Mutex
+	segs    []spoolSegment // oldest first; the last is being written
+	cur     *os.File
+	total   int64
+	dropped int64
+	closed  bool
+	readSeq int64
+	readOff int64
+
+	kick    chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+type spoolSegment struct {
+	seq   int64
+	size  int64
+	lines int64
+}
+
+// NewSpool creates a Spool that stores entries in dir, creating it if
+// necessary, and delivers them to dst.  Any entries left undelivered in dir
+// by a previous run are delivered first.
+func NewSpool(dir string, dst io.Writer, cfgs ...SpoolConfig) (*Spool, error) {
+	s := &Spool{
+		dir:           dir,
+		dst:           dst,
+		maxSize:       100 << 20,
+		segmentSize:   4 << 20,
+		retryInterval: time.Second,
+		kick:          make(chan struct{}, 1),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	for _, cfg := range cfgs {
+		cfg(s)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	go s.run()
+	RegisterShutdown(s)
+	return s, nil
+}
+
+// load finds the segments and read position left by a previous run and
+// opens the newest segment for writing.
+func (s *Spool) load() error {
+	names, err := filepath.Glob(filepath.Join(s.dir, "*"+spoolExt))
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		seq, err := strconv.ParseInt(strings.TrimSuffix(filepath.Base(name), spoolExt), 10, 64)
+		if err != nil {
+			continue
+		}
+		data, err := ioutil.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		s.segs = append(s.segs, spoolSegment{seq: seq, size: int64(len(data)), lines: int64(bytes.Count(data, []byte{'\n'}))})
+		s.total += int64(len(data))
+	}
+	sort.Slice(s.segs, func(i, j int) bool { return s.segs[i].seq < s.segs[j].seq })
+
+	if data, err := ioutil.ReadFile(filepath.Join(s.dir, spoolCursorFile)); err == nil {
+		fmt.Sscan(string(data), &s.readSeq, &s.readOff)
+	}
+
+	if len(s.segs) == 0 {
+		return s.newSegment(1)
+	}
+	last := s.segs[len(s.segs)-1]
+	f, err := os.OpenFile(s.segPath(last.seq), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	s.cur = f
+	return nil
+}
+
+func (s *Spool) segPath(seq int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%016d%s", seq, spoolExt))
+}
+
+func (s *Spool) newSegment(seq int64) error {
+	f, err := os.OpenFile(s.segPath(seq), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	if s.cur != nil {
+		s.cur.Close()
+	}
+	s.cur = f
+	s.segs = append(s.segs, spoolSegment{seq: seq})
+	return nil
+}
+
+// Write implements io.Writer, appending p to the spool.  A newline is
+// added if p doesn't end with one.
+func (s *Spool) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	entry := p
+	if len(entry) == 0 || entry[len(entry)-1] != '\n' {
+		entry = append(entry[:len(entry):len(entry)], '\n')
+	}
+
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return 0, errWriterClosed
+	}
+	last := &s.segs[len(s.segs)-1]
+	if last.size > 0 && last.size+int64(len(entry)) > s.segmentSize {
+		if err := s.newSegment(last.seq + 1); err != nil {
+			s.mu.Unlock()
+			return 0, err
+		}
+		last = &s.segs[len(s.segs)-1]
+	}
+	if _, err := s.cur.Write(entry); err != nil {
+		s.mu.Unlock()
+		return 0, err
+	}
+	last.size += int64(len(entry))
+	last.lines++
+	s.total += int64(len(entry))
+	for s.total > s.maxSize && len(s.segs) > 1 {
+		s.dropOldest()
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// dropOldest discards the oldest segment; s.mu must be held.
+func (s *Spool) dropOldest() {
+	seg := s.segs[0]
+	os.Remove(s.segPath(seg.seq))
+	s.segs = s.segs[1:]
+	s.total -= seg.size
+	s.dropped += seg.lines
+	observeDrops(dropQueueFull, int(seg.lines))
+}
+
+// Dropped returns the approximate number of entries discarded because the
+// spool exceeded its maximum size.
+func (s *Spool) Dropped() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close stops delivery and closes the spool.  Entries not yet delivered
+// remain on disk and are delivered by the next Spool created for the same
+// directory.
+func (s *Spool) Close() error {
+	UnregisterShutdown(s)
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil
+	}
+	s.closed = true
+	s.mu.Unlock()
+
+	close(s.done)
+	<-s.stopped
+	return s.cur.Close()
+}
+
+func (s *Spool) run() {
+	defer close(s.stopped)
+	for {
+		if err := s.replay(); err != nil {
+			observeDeliveryError("spool", err)
+			sinkError(s.onError, err)
+			select {
+			case <-time.After(s.retryInterval):
+				continue
+			case <-s.done:
+				return
+			}
+		}
+		select {
+		case <-s.kick:
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// replay delivers spooled entries until none remain or the destination
+// fails.
+func (s *Spool) replay() error {
+	for {
+		select {
+		case <-s.done:
+			return nil
+		default:
+		}
+
+		s.mu.Lock()
+		if s.readSeq < s.segs[0].seq {
+			// unread entries were dropped
+			s.readSeq, s.readOff = s.segs[0].seq, 0
+		}
+		seq, off := s.readSeq, s.readOff
+		active := seq == s.segs[len(s.segs)-1].seq
+		s.mu.Unlock()
+
+		data, err := s.readChunk(seq, off)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if len(data) == 0 {
+			if active {
+				return nil
+			}
+			s.finishSegment(seq)
+			continue
+		}
+
+		if err := s.deliver(data); err != nil {
+			return err
+		}
+		s.mu.Lock()
+		if s.readSeq == seq {
+			s.readOff = off + int64(len(data))
+		}
+		s.mu.Unlock()
+		s.saveCursor()
+	}
+}
+
+// readChunk returns complete lines from segment seq starting at off.  The
+// read is extended beyond spoolChunkSize if needed to include at least one
+// complete line, so that an entry longer than a chunk isn't skipped.
+func (s *Spool) readChunk(seq, off int64) ([]byte, error) {
+	f, err := os.Open(s.segPath(seq))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, spoolChunkSize)
+	for {
+		n, err := f.ReadAt(buf, off)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if end := bytes.LastIndexByte(buf[:n], '\n'); end >= 0 {
+			return buf[:end+1], nil
+		}
+		if n < len(buf) {
+			// no complete line remains
+			return nil, nil
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// finishSegment deletes a fully delivered segment and moves the read
+// position to the next.
+func (s *Spool) finishSegment(seq int64) {
+	s.mu.Lock()
+	if len(s.segs) > 1 && s.segs[0].seq == seq {
+		os.Remove(s.segPath(seq))
+		s.total -= s.segs[0].size
+		s.segs = s.segs[1:]
+	}
+	if s.readSeq == seq {
+		s.readSeq, s.readOff = s.segs[0].seq, 0
+	}
+	s.mu.Unlock()
+	s.saveCursor()
+}
+
+func (s *Spool) deliver(data []byte) error {
+	for len(data) > 0 {
+		end := bytes.IndexByte(data, '\n') + 1
+		if _, err := s.dst.Write(data[:end]); err != nil {
+			return err
+		}
+		data = data[end:]
+	}
+	if f, ok := s.dst.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// saveCursor records the read position so that delivery resumes from it
+// after a restart.
+func (s *Spool) saveCursor() {
+	s.mu.Lock()
+	data := fmt.Sprintf("%d %d\n", s.readSeq, s.readOff)
+	s.mu.Unlock()
+	path := filepath.Join(s.dir, spoolCursorFile)
+	if err := ioutil.WriteFile(path+".tmp", []byte(data), 0644); err == nil {
+		os.Rename(path+".tmp", path)
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+// flakySink records lines written to it, failing while down is set.
+type flakySink struct {
+	mu    sync.Mutex
+	down  bool
+	lines []string
+}
+
+func (f *flakySink) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		return 0, errors.New("sink unavailable")
+	}
+	f.lines = append(f.lines, string(p))
+	return len(p), nil
+}
+
+func (f *flakySink) setDown(down bool) {
+	f.mu.Lock()
+	f.down = down
+	f.mu.Unlock()
+}
+
+func (f *flakySink) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.lines...)
+}
+
+func waitForLines(t *testing.T, sink *flakySink, n int) []string {
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if lines := sink.received(); len(lines) >= n {
+			return lines
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %d lines; got %d", n, len(sink.received()))
+	return nil
+}
+
+func spoolLines(n int) []string {
+	lines := make([]string, n)
+	for i := range lines {
+		lines[i] = fmt.Sprintf("ll=\"info\" n=%d\n", i)
+	}
+	return lines
+}
+
+func TestSpool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := &flakySink{down: true}
+	s, err := NewSpool(dir, sink, SpoolSegmentSize(100), SpoolRetryInterval(5*time.Millisecond))
+	require.Nil(t, err)
+
+	lines := spoolLines(20)
+	for _, line := range lines {
+		s.Write([]byte(line))
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.spool"))
+	assert.True(t, len(files) > 1, "expected multiple segments; got %d", len(files))
+
+	sink.setDown(false)
+	assert.Equal(t, lines, waitForLines(t, sink, len(lines)))
+	require.Nil(t, s.Close())
+
+	// delivered segments, other than the one being written, are removed
+	files, _ = filepath.Glob(filepath.Join(dir, "*.spool"))
+	assert.Len(t, files, 1)
+}
+
+func TestSpoolRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := &flakySink{}
+	s, err := NewSpool(dir, sink, SpoolSegmentSize(100))
+	require.Nil(t, err)
+	lines := spoolLines(10)
+	for _, line := range lines[:4] {
+		s.Write([]byte(line))
+	}
+	waitForLines(t, sink, 4)
+	sink.setDown(true)
+	for _, line := range lines[4:] {
+		s.Write([]byte(line))
+	}
+	require.Nil(t, s.Close())
+
+	// a new spool for the directory delivers only what was outstanding
+	sink2 := new(flakySink)
+	s, err = NewSpool(dir, sink2, SpoolSegmentSize(100))
+	require.Nil(t, err)
+	defer s.Close()
+	assert.Equal(t, lines[4:], waitForLines(t, sink2, 6))
+}
+
+func TestSpoolMaxSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	sink := &flakySink{down: true}
+	lines := spoolLines(40)
+	s, err := NewSpool(dir, sink,
+		SpoolSegmentSize(int64(len(lines[0])*5)),
+		SpoolMaxSize(int64(len(lines[0])*12)),
+		SpoolRetryInterval(5*time.Millisecond))
+	require.Nil(t, err)
+	defer s.Close()
+
+	for _, line := range lines {
+		s.Write([]byte(line))
+	}
+	assert.Equal(t, int64(30), s.Dropped())
+
+	sink.setDown(false)
+	received := waitForLines(t, sink, 10)
+	assert.Equal(t, lines[30:], received)
+	assert.True(t, strings.HasPrefix(received[0], `ll="info" n=30`))
+}
+
+func TestSpoolLongEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	// entries longer than the 256KB read chunk, in both an older segment
+	// and the one being written
+	long := strings.Repeat("x", 300<<10) + "\n"
+	sink := &flakySink{down: true}
+	s, err := NewSpool(dir, sink, SpoolSegmentSize(100), SpoolRetryInterval(5*time.Millisecond))
+	require.Nil(t, err)
+	defer s.Close()
+	lines := []string{long, "small\n", long}
+	for _, line := range lines {
+		s.Write([]byte(line))
+	}
+
+	sink.setDown(false)
+	assert.Equal(t, lines, waitForLines(t, sink, len(lines)))
+}
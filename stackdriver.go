@@ -0,0 +1,110 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"strconv"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	stackdriverSourceKey = "logging.googleapis.com/sourceLocation"
+	stackdriverTraceKey  = "logging.googleapis.com/trace"
+	stackdriverSpanKey   = "logging.googleapis.com/spanId"
+)
+
+// reserved keys used by the Cloud Logging structured payload
+var stackdriverKeys = map[string]struct{}{
+	"severity":           {},
+	"timestamp":          {},
+	"message":            {},
+	stackdriverSourceKey: {},
+	stackdriverTraceKey:  {},
+	stackdriverSpanKey:   {},
+}
+
+// WithStackdriverJSON causes the Formatter to emit each entry as a JSON
+// object in the structure that Google Cloud Logging (formerly Stackdriver)
+// expects to read from stdout.
+//
+// The severity, timestamp and message keys are always included and the
+// calling function is reported as logging.googleapis.com/sourceLocation if
+// IncludeCaller is set.  Constant, primary and remaining fields follow at the
+// top level in the same order as the k=v output, so they appear in the
+// entry's jsonPayload.
+//
+// If an entry has a "trace_id" field it's also emitted as
+// logging.googleapis.com/trace, qualified by projectID, and a "span_id" field
+// is emitted as logging.googleapis.com/spanId so that entries are linked to
+// Cloud Trace.
+func WithStackdriverJSON(projectID string) Config {
+	return func(kvf *Formatter) {
+		kvf.encode = func(cf *Formatter, b *bytes.Buffer, entry *Record) {
+			encodeStackdriver(cf, b, entry, projectID)
+		}
+	}
+}
+
+func encodeStackdriver(cf *Formatter, b *bytes.Buffer, entry *Record, projectID string) {
+	obj := newJSONObject(b)
+	obj.str("severity", stackdriverSeverity(entry.level()))
+	obj.key("timestamp")
+	cf.writeJSONTimestamp(b, entry.Time)
+	if entry.Message != "" {
+		obj.str("message", entry.Message)
+	}
+
+	if cf.includeCaller {
+		if name, line := cf.caller(entry); name != "" {
+			obj.key(stackdriverSourceKey)
+			src := newJSONObject(b)
+			src.str("function", name)
+			src.str("line", strconv.Itoa(line))
+			src.close()
+		}
+	}
+
+	fc := cf.fields()
+	fields := cf.entryFields(fc, entry)
+	for _, f := range fields {
+		switch f.key {
+		case "trace_id":
+			obj.key(stackdriverTraceKey)
+			writeJSONString(b, "projects/"+projectID+"/traces/"+valueString(f.value))
+		case "span_id":
+			obj.key(stackdriverSpanKey)
+			writeJSONString(b, valueString(f.value))
+		}
+	}
+
+	for _, f := range cf.entryConstants(fc, fields) {
+		obj.field(fieldKey(stackdriverKeys, f.key), f.value)
+	}
+	for _, f := range fields {
+		obj.field(fieldKey(stackdriverKeys, f.key), f.value)
+	}
+	obj.close()
+	b.WriteByte('\n')
+}
+
+// stackdriverSeverity maps a logrus level to a Cloud Logging LogSeverity.
+func stackdriverSeverity(level log.Level) string {
+	switch level {
+	case log.PanicLevel:
+		return "ALERT"
+	case log.FatalLevel:
+		return "CRITICAL"
+	case log.ErrorLevel:
+		return "ERROR"
+	case log.WarnLevel:
+		return "WARNING"
+	case log.InfoLevel:
+		return "INFO"
+	default:
+		return "DEBUG"
+	}
+}
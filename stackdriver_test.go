@@ -0,0 +1,66 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestStackdriverJSON(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	cf := New(
+		WithConstantField("commit", "abcd"),
+		WithStackdriverJSON("my-project"))
+	result, err := cf.Format(&log.Entry{
+		Time:    testTime,
+		Level:   log.WarnLevel,
+		Message: "test message",
+		Data: log.Fields{
+			"trace_id": "0af7651916cd43dd8448eb211c80319c",
+			"span_id":  "b7ad6b7169203331",
+			"severity": "clash",
+		},
+	})
+	require.Nil(err)
+	expected := `{"severity":"WARNING","timestamp":"2017-02-13T12:13:45.000Z","message":"test message",` +
+		`"logging.googleapis.com/spanId":"b7ad6b7169203331",` +
+		`"logging.googleapis.com/trace":"projects/my-project/traces/0af7651916cd43dd8448eb211c80319c",` +
+		`"commit":"abcd","fields.severity":"clash","span_id":"b7ad6b7169203331","trace_id":"0af7651916cd43dd8448eb211c80319c"}`
+	assert.Equal(expected, strings.TrimSpace(string(result)))
+}
+
+func TestStackdriverSourceLocation(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf strings.Builder
+	logger := &log.Logger{
+		Out:       &buf,
+		Formatter: New(IncludeCaller(), WithStackdriverJSON("p")),
+		Level:     log.DebugLevel,
+	}
+	logger.Error("failed")
+
+	var result struct {
+		Severity string
+		Source   struct {
+			Function string
+			Line     string
+		} `json:"logging.googleapis.com/sourceLocation"`
+	}
+	assert.Nil(json.Unmarshal([]byte(buf.String()), &result))
+	assert.Equal("ERROR", result.Severity)
+	assert.Equal("TestStackdriverSourceLocation", result.Source.Function)
+	assert.NotEmpty(result.Source.Line)
+}
@@ -0,0 +1,70 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"regexp"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// matches the date and time prefixes added by the standard library's log
+// package with the LstdFlags and Lmicroseconds flags
+var stdLogPrefix = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} )?\d{2}:\d{2}:\d{2}(\.\d{6})? `)
+
+// StdLogWriter is an io.Writer that converts the output of the standard
+// library's log package into entries sent to a logrus Logger, so that
+// libraries that log unstructured text still produce k=v lines.
+//
+// eg.
+//
+//	stdlog.SetFlags(0)
+//	stdlog.SetOutput(kvlog.NewStdLogWriter(logrus.StandardLogger(), logrus.InfoLevel, "legacy"))
+//
+// Each write becomes the message of a single entry.  Any date and time
+// prefix added by the log package is removed, as the entry carries its own
+// timestamp.
+type StdLogWriter struct {
+	entry *log.Entry
+	level log.Level
+}
+
+// NewStdLogWriter creates a StdLogWriter that logs each message to logger at
+// the given level.  If component is not empty, each entry includes a
+// component field with that value.
+//
+// Levels more severe than ErrorLevel are logged at ErrorLevel, so that
+// writes never cause the program to panic or exit.
+func NewStdLogWriter(logger *log.Logger, level log.Level, component string) *StdLogWriter {
+	entry := log.NewEntry(logger)
+	if component != "" {
+		entry = entry.WithField("component", component)
+	}
+	if level < log.ErrorLevel {
+		level = log.ErrorLevel
+	}
+	return &StdLogWriter{entry: entry, level: level}
+}
+
+// Write implements io.Writer.
+func (w *StdLogWriter) Write(p []byte) (int, error) {
+	msg := bytes.TrimRight(p, "\r\n")
+	if loc := stdLogPrefix.FindIndex(msg); loc != nil {
+		msg = msg[loc[1]:]
+	}
+
+	switch w.level {
+	case log.ErrorLevel:
+		w.entry.Error(string(msg))
+	case log.WarnLevel:
+		w.entry.Warn(string(msg))
+	case log.InfoLevel:
+		w.entry.Info(string(msg))
+	default:
+		w.entry.Debug(string(msg))
+	}
+	return len(p), nil
+}
@@ -0,0 +1,50 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	stdlog "log"
+	"regexp"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+var timestampRE = regexp.MustCompile(`^\S+ `)
+
+func TestStdLogWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger := &log.Logger{
+		Out:       &buf,
+		Formatter: New(IncludeCaller()),
+		Level:     log.InfoLevel,
+	}
+
+	std := stdlog.New(NewStdLogWriter(logger, log.WarnLevel, "legacy"), "", stdlog.LstdFlags|stdlog.Lmicroseconds)
+	std.Printf("connection %d reset", 3)
+
+	result := timestampRE.ReplaceAllString(buf.String(), "")
+	result = regexp.MustCompile(`srcline=\d+`).ReplaceAllString(result, "srcline=100")
+	assert.Equal(`ll="warning" srcfnc="TestStdLogWriter" srcline=100 component="legacy" _msg="connection 3 reset"`+"\n", result)
+}
+
+func TestStdLogWriterLevel(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger := &log.Logger{Out: &buf, Formatter: New(), Level: log.InfoLevel}
+
+	stdlog.New(NewStdLogWriter(logger, log.DebugLevel, ""), "", 0).Print("hidden")
+	assert.Equal("", buf.String(), "debug should be filtered")
+
+	stdlog.New(NewStdLogWriter(logger, log.FatalLevel, ""), "", 0).Print("not fatal")
+	assert.Contains(buf.String(), `ll="error" _msg="not fatal"`)
+}
@@ -0,0 +1,156 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Struct returns the exported fields of the struct v, or of the struct v
+// points to, as OrderedFields in the order they're declared, so that a
+// struct can be logged as separate fields.
+//
+// eg.
+//
+//	log.WithField("user", kvlog.Struct(u)).Info("login")
+//
+//	// Output:
+//	//  2017-01-02T12:00:00.000Z ll="info" user.id=42 user.name="joe" _msg="login"
+//
+// Each field's key is the struct field name prefixed with a dot, or the
+// name given by a `kvlog:"name"` tag.  Fields tagged `kvlog:"-"` are
+// omitted.  Fields holding other structs are flattened in turn, using
+// their field names as a further prefix, except for embedded structs,
+// whose fields are included directly, and those that implement
+// fmt.Stringer, error, Marshaler or Loggable, which are formatted as usual.
+//
+// The fields of each struct type are found using reflection only once,
+// the first time the type is logged.  Nested structs are flattened to a
+// depth of 10.
+func Struct(v interface{}) OrderedFields {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return OrderedFields{{"", nil}}
+		}
+		rv = rv.Elem()
+	}
+	if rv.Kind() != reflect.Struct {
+		return OrderedFields{{"", v}}
+	}
+	return structPlanFor(rv.Type()).appendFields(nil, "", rv, 0)
+}
+
+// structPlan lists the fields of a struct type to be logged.
+type structPlan []structField
+
+type structField struct {
+	index  int
+	key    string      // key suffix, starting with a dot, or empty if embedded
+	ptr    bool        // field is a pointer to a nested struct
+	nested *structPlan // plan for a flattened nested struct, or nil
+}
+
+// structPlans caches the structPlan of each struct type logged.
+var structPlans sync.Map
+
+func structPlanFor(t reflect.Type) *structPlan {
+	if p, ok := structPlans.Load(t); ok {
+		return p.(*structPlan)
+	}
+	p := buildStructPlan(t, make(map[reflect.Type]*structPlan))
+	actual, _ := structPlans.LoadOrStore(t, p)
+	return actual.(*structPlan)
+}
+
+// buildStructPlan finds the fields of struct type t.  building holds the
+// plans of types in the process of being built, so that self-referential
+// types terminate.
+func buildStructPlan(t reflect.Type, building map[reflect.Type]*structPlan) *structPlan {
+	if p, ok := building[t]; ok {
+		return p
+	}
+	p := new(structPlan)
+	building[t] = p
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue // unexported
+		}
+		name := sf.Name
+		if tag := sf.Tag.Get("kvlog"); tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+
+		f := structField{index: i, key: "." + name}
+		ft := sf.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+			f.ptr = true
+		}
+		if flattenStruct(ft) {
+			f.nested = buildStructPlan(ft, building)
+			if sf.Anonymous && sf.Tag.Get("kvlog") == "" {
+				f.key = ""
+			}
+		}
+		*p = append(*p, f)
+	}
+	return p
+}
+
+var (
+	stringerType  = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+	errorType     = reflect.TypeOf((*error)(nil)).Elem()
+	marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	loggableType  = reflect.TypeOf((*Loggable)(nil)).Elem()
+)
+
+// flattenStruct reports whether values of type t should be flattened into
+// their fields.
+func flattenStruct(t reflect.Type) bool {
+	if t.Kind() != reflect.Struct {
+		return false
+	}
+	pt := reflect.PtrTo(t)
+	for _, it := range []reflect.Type{stringerType, errorType, marshalerType, loggableType} {
+		if t.Implements(it) || pt.Implements(it) {
+			return false
+		}
+	}
+	return true
+}
+
+// maxStructDepth limits the depth to which nested structs are flattened,
+// so that self-referential values terminate.
+const maxStructDepth = 10
+
+// appendFields appends the fields of v, a struct of the plan's type, to
+// fields with keys prefixed by prefix.
+func (p *structPlan) appendFields(fields OrderedFields, prefix string, v reflect.Value, depth int) OrderedFields {
+	for _, f := range *p {
+		fv := v.Field(f.index)
+		key := prefix + f.key
+		if f.nested == nil || depth >= maxStructDepth {
+			fields = append(fields, KV{key, fv.Interface()})
+			continue
+		}
+		if f.ptr {
+			if fv.IsNil() {
+				if f.key != "" {
+					fields = append(fields, KV{key, nil})
+				}
+				continue
+			}
+			fv = fv.Elem()
+		}
+		fields = f.nested.appendFields(fields, key, fv, depth+1)
+	}
+	return fields
+}
@@ -0,0 +1,88 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+type structAddress struct {
+	City string `kvlog:"city"`
+	Zip  string `kvlog:"-"`
+}
+
+type StructAudit struct {
+	Created time.Time
+}
+
+type structUser struct {
+	StructAudit
+	ID      int    `kvlog:"id"`
+	Name    string `kvlog:"name"`
+	Home    structAddress
+	Work    *structAddress
+	Err     error
+	secret  string
+	Elapsed time.Duration
+}
+
+type structNode struct {
+	Name string
+	Next *structNode
+}
+
+func TestStruct(t *testing.T) {
+	u := structUser{
+		StructAudit: StructAudit{testTime},
+		ID:          42,
+		Name:        "joe",
+		Home:        structAddress{"Paris", "75001"},
+		Err:         errors.New("failed"),
+		secret:      "hidden",
+		Elapsed:     time.Second,
+	}
+	result, err := New().Format(&log.Entry{
+		Time:  testTime,
+		Level: log.InfoLevel,
+		Data:  log.Fields{"user": Struct(&u)},
+	})
+	require.Nil(t, err)
+	assert.Equal(t, `2017-02-13T12:13:45.000Z ll="info" user.Created="2017-02-13 12:13:45 +0000 UTC"`+
+		` user.id=42 user.name="joe" user.Home.city="Paris" user.Work=<nil> user.Err="failed" user.Elapsed="1s"`+"\n",
+		string(result))
+
+	assert.Equal(t, OrderedFields{{"", 5}}, Struct(5))
+	var nilUser *structUser
+	assert.Equal(t, OrderedFields{{"", nil}}, Struct(nilUser))
+}
+
+func TestStructCycle(t *testing.T) {
+	a := &structNode{Name: "a"}
+	a.Next = &structNode{Name: "b", Next: a}
+	fields := Struct(a)
+	require.Len(t, fields, 12)
+	assert.Equal(t, KV{".Name", "a"}, fields[0])
+	assert.Equal(t, KV{".Next.Name", "b"}, fields[1])
+	assert.True(t, strings.HasPrefix(fields[11].Key, ".Next.Next."))
+}
+
+func BenchmarkStruct(b *testing.B) {
+	logger := NewLogger(ioutil.Discard, New())
+	u := structUser{ID: 42, Name: "joe", Home: structAddress{"Paris", "75001"}}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		logger.WithField("user", Struct(&u)).Info("login")
+	}
+}
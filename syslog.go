@@ -0,0 +1,78 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+//go:build !windows && !plan9
+
+package kvlog
+
+import (
+	"bytes"
+	"log/syslog"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// SyslogWriter is a LevelWriter that delivers each entry to a syslog
+// daemon, with the message priority set from the entry's level.
+//
+// eg.
+//
+//	w, err := kvlog.NewSyslogWriter("", "", syslog.LOG_LOCAL0, "myapp")
+//	...
+//	logrus.SetOutput(w)
+//
+// When used as the output of a logrus Logger the level is read from the ll
+// key of each k=v or JSON line, as for LevelRouter.
+type SyslogWriter struct {
+	w *syslog.Writer
+}
+
+// NewSyslogWriter connects to the syslog daemon at raddr using network, eg.
+// "udp" and "logs.example.com:514".  If network is empty, the local syslog
+// daemon is used.  Messages are sent with the given facility and tag.
+func NewSyslogWriter(network, raddr string, facility syslog.Priority, tag string) (*SyslogWriter, error) {
+	w, err := syslog.Dial(network, raddr, facility|syslog.LOG_INFO, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogWriter{w: w}, nil
+}
+
+// Write implements io.Writer.
+func (s *SyslogWriter) Write(p []byte) (int, error) {
+	return s.WriteLevel(lineLevel(p), p)
+}
+
+// WriteLevel implements LevelWriter, sending p with the syslog severity
+// corresponding to level.
+func (s *SyslogWriter) WriteLevel(level log.Level, p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	msg := string(bytes.TrimRight(p, "\n"))
+	var err error
+	switch level {
+	case log.PanicLevel:
+		err = s.w.Emerg(msg)
+	case log.FatalLevel:
+		err = s.w.Crit(msg)
+	case log.ErrorLevel:
+		err = s.w.Err(msg)
+	case log.WarnLevel:
+		err = s.w.Warning(msg)
+	case log.InfoLevel:
+		err = s.w.Info(msg)
+	default:
+		err = s.w.Debug(msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the connection to the syslog daemon.
+func (s *SyslogWriter) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,53 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+//go:build !windows && !plan9
+
+package kvlog_test
+
+import (
+	"log/syslog"
+	"net"
+	"regexp"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestSyslogWriter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer conn.Close()
+
+	w, err := NewSyslogWriter("udp", conn.LocalAddr().String(), syslog.LOG_LOCAL0, "kvtest")
+	require.Nil(t, err)
+	defer w.Close()
+
+	logger := &log.Logger{Out: w, Formatter: New(), Level: log.DebugLevel}
+	logger.Error("failed")
+	logger.Info("started")
+	NewLogger(w, nil).Warn("native")
+
+	expected := []struct {
+		pri string
+		msg string
+	}{
+		{"<131>", `ll="error" _msg="failed"`},   // local0 (16<<3) | err (3)
+		{"<134>", `ll="info" _msg="started"`},   // local0 | info (6)
+		{"<132>", `ll="warning" _msg="native"`}, // local0 | warning (4)
+	}
+	buf := make([]byte, 2048)
+	for _, e := range expected {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		require.Nil(t, err)
+		msg := string(buf[:n])
+		assert.Regexp(t, "^"+regexp.QuoteMeta(e.pri)+`.* kvtest\[\d+\]: \S+ `+regexp.QuoteMeta(e.msg)+"\n$", msg)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"io"
+	"os"
+)
+
+// DetectTerminal selects colorized pretty output if w is a terminal and
+// leaves the Formatter's configuration unchanged otherwise, allowing a single
+// configuration to produce readable output during development and machine
+// readable k=v lines in production.
+//
+// w should normally be the same writer the logger outputs to, eg. os.Stderr.
+// Color is omitted if the NO_COLOR environment variable is set or TERM is
+// "dumb".  DetectTerminal should be passed to New after any other output
+// mode so that it takes precedence when a terminal is detected.
+func DetectTerminal(w io.Writer) Config {
+	return func(kvf *Formatter) {
+		if !IsTerminal(w) {
+			return
+		}
+		kvf.encode = encodePretty
+		if os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" {
+			kvf.color = true
+		}
+	}
+}
+
+// IsTerminal returns true if w is a file connected to a terminal.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	return isTerminalFd(f.Fd())
+}
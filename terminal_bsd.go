@@ -0,0 +1,18 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package kvlog
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+func isTerminalFd(fd uintptr) bool {
+	var termios syscall.Termios
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, syscall.TIOCGETA, uintptr(unsafe.Pointer(&termios)))
+	return errno == 0
+}
@@ -0,0 +1,19 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+//go:build !linux && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package kvlog
+
+import "os"
+
+// isTerminalFd falls back to treating any character device as a terminal
+// on platforms without a termios ioctl.
+func isTerminalFd(fd uintptr) bool {
+	fi, err := os.NewFile(fd, "").Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,47 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestDetectTerminalNonTerminal(t *testing.T) {
+	assert := assert.New(t)
+	require := require.New(t)
+
+	r, w, err := os.Pipe()
+	require.Nil(err)
+	defer r.Close()
+	defer w.Close()
+
+	devnull, err := os.Open(os.DevNull)
+	require.Nil(err)
+	defer devnull.Close()
+
+	entry := &log.Entry{
+		Time:  testTime,
+		Level: log.InfoLevel,
+		Data:  log.Fields{"field1": "value1"},
+	}
+	expected := `2017-02-13T12:13:45.000Z ll="info" field1="value1"`
+
+	for _, out := range []io.Writer{w, devnull, &bytes.Buffer{}} {
+		cf := New(DetectTerminal(out))
+		result, err := cf.Format(entry)
+		require.Nil(err)
+		assert.Equal(expected, strings.TrimSpace(string(result)))
+	}
+}
@@ -0,0 +1,194 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// TLSConfig represents a configuration function to be passed to
+// NewTLSConfig.
+type TLSConfig func(t *tlsFiles)
+
+// TLSCAFile sets a file holding one or more PEM encoded certificates used
+// to verify the server, in place of the system's root certificates.
+func TLSCAFile(path string) TLSConfig {
+	return func(t *tlsFiles) {
+		t.caFile = path
+	}
+}
+
+// TLSClientCert sets the PEM encoded certificate and private key files
+// presented to the server for mutual TLS.
+func TLSClientCert(certFile, keyFile string) TLSConfig {
+	return func(t *tlsFiles) {
+		t.certFile = certFile
+		t.keyFile = keyFile
+	}
+}
+
+// TLSServerName sets the name the server's certificate is verified against,
+// overriding the host name taken from the address being connected to.
+func TLSServerName(name string) TLSConfig {
+	return func(t *tlsFiles) {
+		t.serverName = name
+	}
+}
+
+// NewTLSConfig returns a TLS configuration for use with the network sinks,
+// such as with NetTLS, LokiTLS or OTLPTLS, loading certificates from files.
+//
+// eg.
+//
+//	cfg, err := kvlog.NewTLSConfig(
+//	    kvlog.TLSCAFile("/etc/pki/ca.pem"),
+//	    kvlog.TLSClientCert("/etc/pki/client.pem", "/etc/pki/client-key.pem"))
+//	...
+//	w := kvlog.NewNetWriter("tcp", "logs.internal:6514", kvlog.NetTLS(cfg))
+//
+// The files are checked for changes before each new connection is
+// established, so that certificates rotated on disk are used without
+// restarting the program; connections already open continue to use the
+// previous certificates.  If a changed file can't be loaded, such as while
+// a certificate and its key are being replaced, the previous certificates
+// continue to be used.
+//
+// An error is returned if the files can't be loaded initially.
+func NewTLSConfig(cfgs ...TLSConfig) (*tls.Config, error) {
+	t := new(tlsFiles)
+	for _, cfg := range cfgs {
+		cfg(t)
+	}
+	cfg := &tls.Config{ServerName: t.serverName}
+	if t.certFile != "" {
+		if err := t.loadCert(); err != nil {
+			return nil, err
+		}
+		cfg.GetClientCertificate = t.clientCert
+	}
+	if t.caFile != "" {
+		if err := t.loadCA(); err != nil {
+			return nil, err
+		}
+		// Setting RootCAs would fix the pool for the life of the config,
+		// so the server's certificate is instead verified against the
+		// current pool by verifyServer.
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyConnection = t.verifyServer
+	}
+	return cfg, nil
+}
+
+type tlsFiles struct {
+	caFile     string
+	certFile   string
+	keyFile    string
+	serverName string
+
+	mu      sync.Mutex
+	pool    *x509.CertPool
+	caMod   time.Time
+	cert    *tls.Certificate
+	certMod time.Time
+}
+
+// modTime returns the latest modification time of the given files.
+func modTime(paths ...string) (time.Time, error) {
+	var latest time.Time
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// loadCert loads the client certificate if it has changed since it was
+// last loaded; t.mu must be held or t not yet shared.
+func (t *tlsFiles) loadCert() error {
+	mod, err := modTime(t.certFile, t.keyFile)
+	if err != nil {
+		return err
+	}
+	if t.cert != nil && mod.Equal(t.certMod) {
+		return nil
+	}
+	cert, err := tls.LoadX509KeyPair(t.certFile, t.keyFile)
+	if err != nil {
+		return err
+	}
+	t.cert, t.certMod = &cert, mod
+	return nil
+}
+
+// loadCA loads the CA bundle if it has changed since it was last loaded;
+// t.mu must be held or t not yet shared.
+func (t *tlsFiles) loadCA() error {
+	mod, err := modTime(t.caFile)
+	if err != nil {
+		return err
+	}
+	if t.pool != nil && mod.Equal(t.caMod) {
+		return nil
+	}
+	data, err := ioutil.ReadFile(t.caFile)
+	if err != nil {
+		return err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return fmt.Errorf("kvlog: no certificates found in %s", t.caFile)
+	}
+	t.pool, t.caMod = pool, mod
+	return nil
+}
+
+func (t *tlsFiles) clientCert(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.loadCert() // on failure, keep using the previous certificate
+	return t.cert, nil
+}
+
+func (t *tlsFiles) verifyServer(cs tls.ConnectionState) error {
+	t.mu.Lock()
+	t.loadCA()
+	pool := t.pool
+	t.mu.Unlock()
+
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("kvlog: server presented no certificate")
+	}
+	opts := x509.VerifyOptions{
+		Roots:         pool,
+		DNSName:       cs.ServerName,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
+
+// tlsHTTPClient returns a client using the default transport settings and
+// the given TLS configuration.
+func tlsHTTPClient(cfg *tls.Config) *http.Client {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = cfg
+	return &http.Client{Transport: tr}
+}
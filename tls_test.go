@@ -0,0 +1,165 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.Nil(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.Nil(t, err)
+	return &testCA{cert, key, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue writes a client certificate with the given common name and its key
+// to certFile and keyFile.
+func (ca *testCA) issue(t *testing.T, name, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.Nil(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.cert, &key.PublicKey, ca.key)
+	require.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.Nil(t, err)
+	require.Nil(t, ioutil.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644))
+	require.Nil(t, ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+}
+
+// touch sets the modification time of the given files to d from now.
+func touch(t *testing.T, d time.Duration, paths ...string) {
+	for _, path := range paths {
+		require.Nil(t, os.Chtimes(path, time.Now().Add(d), time.Now().Add(d)))
+	}
+}
+
+func TestTLSConfigMutual(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog-tls")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	clientCA := newTestCA(t)
+	certFile := filepath.Join(dir, "client.pem")
+	keyFile := filepath.Join(dir, "client-key.pem")
+	clientCA.issue(t, "client-1", certFile, keyFile)
+
+	names := make(chan string, 10)
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		names <- r.TLS.PeerCertificates[0].Subject.CommonName
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	pool := x509.NewCertPool()
+	pool.AddCert(clientCA.cert)
+	srv.TLS = &tls.Config{ClientCAs: pool, ClientAuth: tls.RequireAndVerifyClientCert}
+	srv.StartTLS()
+	defer srv.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	require.Nil(t, ioutil.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw}), 0644))
+
+	cfg, err := NewTLSConfig(TLSCAFile(caFile), TLSClientCert(certFile, keyFile))
+	require.Nil(t, err)
+	w := NewLokiWriter(srv.URL, LokiTLS(cfg),
+		LokiRetryPolicy(RetryPolicy{Retries: 1, MinBackoff: time.Millisecond}))
+	defer w.Close()
+
+	w.Write([]byte("line\n"))
+	require.Nil(t, w.Flush())
+	assert.Equal(t, "client-1", <-names)
+
+	// rotate the certificate; it's used once a new connection is made
+	clientCA.issue(t, "client-2", certFile, keyFile)
+	touch(t, time.Minute, certFile, keyFile)
+	srv.CloseClientConnections()
+	w.Write([]byte("line\n"))
+	require.Nil(t, w.Flush())
+	assert.Equal(t, "client-2", <-names)
+
+	// a server certificate from an unknown CA is rejected
+	require.Nil(t, ioutil.WriteFile(caFile, clientCA.pem, 0644))
+	touch(t, 2*time.Minute, caFile)
+	srv.CloseClientConnections()
+	w.Write([]byte("line\n"))
+	assert.NotNil(t, w.Flush())
+}
+
+func TestTLSConfigServerName(t *testing.T) {
+	cfg, err := NewTLSConfig(TLSServerName("logs.internal"))
+	require.Nil(t, err)
+	assert.Equal(t, "logs.internal", cfg.ServerName)
+	assert.False(t, cfg.InsecureSkipVerify)
+	assert.Nil(t, cfg.GetClientCertificate)
+}
+
+func TestTLSConfigErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog-tls")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	empty := filepath.Join(dir, "empty.pem")
+	require.Nil(t, ioutil.WriteFile(empty, nil, 0644))
+
+	tests := []struct {
+		name string
+		cfg  TLSConfig
+	}{
+		{"missing-ca", TLSCAFile(filepath.Join(dir, "missing.pem"))},
+		{"empty-ca", TLSCAFile(empty)},
+		{"missing-cert", TLSClientCert(filepath.Join(dir, "missing.pem"), empty)},
+		{"bad-cert", TLSClientCert(empty, empty)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := NewTLSConfig(test.cfg)
+			assert.NotNil(t, err)
+			assert.Nil(t, cfg)
+		})
+	}
+}
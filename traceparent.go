@@ -0,0 +1,123 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const traceparentContextKey contextKey = 2
+
+var errInvalidTraceparent = errors.New("kvlog: invalid traceparent header")
+
+// Traceparent holds the values of a W3C Trace Context traceparent header.
+// Its String method returns the header value, so a Traceparent may be logged
+// directly as a field value.
+type Traceparent struct {
+	TraceID string // 32 lower case hex digits
+	SpanID  string // 16 lower case hex digits identifying the parent span
+	Flags   byte
+}
+
+// Sampled reports whether the sampled flag is set.
+func (t Traceparent) Sampled() bool {
+	return t.Flags&1 == 1
+}
+
+// String returns t formatted as a version 00 traceparent header value.
+func (t Traceparent) String() string {
+	return fmt.Sprintf("00-%s-%s-%02x", t.TraceID, t.SpanID, t.Flags)
+}
+
+// ParseTraceparent parses a traceparent header value, eg.
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+//
+// Headers with a version greater than 00 are accepted as long as they begin
+// with the version 00 fields, as the specification requires.
+func ParseTraceparent(header string) (Traceparent, error) {
+	header = strings.TrimSpace(header)
+	if len(header) < 55 || (len(header) > 55 && header[55] != '-') {
+		return Traceparent{}, errInvalidTraceparent
+	}
+	version, traceID, spanID, flags := header[0:2], header[3:35], header[36:52], header[53:55]
+	if header[2] != '-' || header[35] != '-' || header[52] != '-' {
+		return Traceparent{}, errInvalidTraceparent
+	}
+	if !isLowerHex(version) || version == "ff" || (version == "00" && len(header) != 55) {
+		return Traceparent{}, errInvalidTraceparent
+	}
+	if !isLowerHex(traceID) || traceID == strings.Repeat("0", 32) ||
+		!isLowerHex(spanID) || spanID == strings.Repeat("0", 16) || !isLowerHex(flags) {
+		return Traceparent{}, errInvalidTraceparent
+	}
+	f, _ := strconv.ParseUint(flags, 16, 8)
+	return Traceparent{TraceID: traceID, SpanID: spanID, Flags: byte(f)}, nil
+}
+
+func isLowerHex(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ContextWithTraceparent parses a traceparent header received with an
+// incoming request and returns a copy of ctx holding it.  The trace and
+// parent span IDs are also added to the context's fields as trace_id and
+// span_id, so that they're included in entries logged with FromContext.
+//
+// If the header is invalid, ctx is returned unchanged.  HTTPMiddleware
+// calls this automatically for requests that include a traceparent header.
+func ContextWithTraceparent(ctx context.Context, header string) context.Context {
+	tp, err := ParseTraceparent(header)
+	if err != nil {
+		return ctx
+	}
+	ctx = ContextWithFields(ctx, log.Fields{"trace_id": tp.TraceID, "span_id": tp.SpanID})
+	return context.WithValue(ctx, traceparentContextKey, tp)
+}
+
+// TraceparentFromContext returns the Traceparent added to ctx by
+// ContextWithTraceparent, if any.
+func TraceparentFromContext(ctx context.Context) (Traceparent, bool) {
+	if ctx == nil {
+		return Traceparent{}, false
+	}
+	tp, ok := ctx.Value(traceparentContextKey).(Traceparent)
+	return tp, ok
+}
+
+// TraceparentHook is a logrus hook that adds the full traceparent header
+// value held by an entry's context as a traceparent field, for correlating
+// logs with traces using tools that expect the W3C format.
+type TraceparentHook struct{}
+
+// NewTraceparentHook creates a TraceparentHook, which should be registered
+// with logrus using AddHook.
+func NewTraceparentHook() *TraceparentHook {
+	return &TraceparentHook{}
+}
+
+// Levels implements the logrus.Hook interface.
+func (h *TraceparentHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements the logrus.Hook interface.
+func (h *TraceparentHook) Fire(entry *log.Entry) error {
+	if tp, ok := TraceparentFromContext(entry.Context); ok {
+		entry.Data["traceparent"] = tp
+	}
+	return nil
+}
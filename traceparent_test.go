@@ -0,0 +1,116 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+const traceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		expected Traceparent
+		valid    bool
+	}{
+		{
+			name:     "sampled",
+			header:   traceparent,
+			expected: Traceparent{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Flags: 1},
+			valid:    true,
+		}, {
+			name:     "not-sampled",
+			header:   "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00",
+			expected: Traceparent{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"},
+			valid:    true,
+		}, {
+			name:     "future-version",
+			header:   "cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-what-the-future-holds",
+			expected: Traceparent{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7", Flags: 1},
+			valid:    true,
+		},
+		{name: "empty", header: ""},
+		{name: "short", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0"},
+		{name: "v00-trailing", header: traceparent + "-extra"},
+		{name: "invalid-version", header: "ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+		{name: "upper-case", header: "00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01"},
+		{name: "zero-trace", header: "00-00000000000000000000000000000000-00f067aa0ba902b7-01"},
+		{name: "zero-span", header: "00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01"},
+		{name: "bad-separator", header: "00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tp, err := ParseTraceparent(test.header)
+			if !test.valid {
+				assert.NotNil(t, err)
+				return
+			}
+			require.Nil(t, err)
+			assert.Equal(t, test.expected, tp)
+		})
+	}
+}
+
+func TestTraceparentString(t *testing.T) {
+	tp, err := ParseTraceparent(traceparent)
+	require.Nil(t, err)
+	assert.Equal(t, traceparent, tp.String())
+	assert.True(t, tp.Sampled())
+}
+
+func TestContextWithTraceparent(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := ContextWithTraceparent(context.Background(), traceparent)
+	tp, ok := TraceparentFromContext(ctx)
+	assert.True(ok)
+	assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", tp.TraceID)
+	assert.Equal(log.Fields{"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "span_id": "00f067aa0ba902b7"}, ContextFields(ctx))
+
+	bg := context.Background()
+	assert.Equal(bg, ContextWithTraceparent(bg, "garbage"))
+}
+
+func TestTraceparentHookMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger := &log.Logger{
+		Out:       &buf,
+		Formatter: New(),
+		Hooks:     make(log.LevelHooks),
+		Level:     log.InfoLevel,
+	}
+	logger.AddHook(NewTraceparentHook())
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context(), logger).Info("handling")
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", traceparent)
+	HTTPMiddleware(logger)(http.HandlerFunc(handler)).ServeHTTP(httptest.NewRecorder(), req)
+
+	dec := NewDecoder(&buf)
+	for i := 0; i < 2; i++ {
+		require.True(t, dec.Next())
+		fields := dec.Entry().Fields
+		assert.Equal(traceparent, fields["traceparent"])
+		assert.Equal("4bf92f3577b34da6a3ce929d0e0e4736", fields["trace_id"])
+		assert.Equal("00f067aa0ba902b7", fields["span_id"])
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+//go:build !windows && !plan9
+
+package kvlog
+
+import (
+	"errors"
+	"net"
+	"syscall"
+)
+
+// NewUnixWriter creates a NetWriter that sends entries to the Unix domain
+// socket at path, such as one opened by a local logging agent or sidecar.
+//
+// Both stream and datagram sockets are supported; the socket type is
+// detected each time a connection is made.  With a datagram socket each
+// entry is sent as a separate datagram.  As with NewNetWriter, the
+// connection is re-established automatically if the agent restarts.
+func NewUnixWriter(path string, cfgs ...NetConfig) *NetWriter {
+	w := newNetWriter("unix", path, cfgs)
+	w.dialer = func(d *net.Dialer) (net.Conn, error) {
+		conn, err := d.Dial("unix", path)
+		if errors.Is(err, syscall.EPROTOTYPE) {
+			return d.Dial("unixgram", path)
+		}
+		return conn, err
+	}
+	w.start()
+	return w
+}
@@ -0,0 +1,64 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+//go:build !windows && !plan9
+
+package kvlog_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestUnixWriterStream(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agent.sock")
+
+	l, err := net.Listen("unix", path)
+	require.Nil(t, err)
+	defer l.Close()
+	lines, _ := readLines(l)
+
+	w := NewUnixWriter(path)
+	w.Write([]byte("line one\n"))
+	w.Write([]byte("line two\n"))
+	assert.Equal(t, "line one", recvLine(t, lines))
+	assert.Equal(t, "line two", recvLine(t, lines))
+	assert.Nil(t, w.Close())
+}
+
+func TestUnixWriterDatagram(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvlog")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "agent.sock")
+
+	pc, err := net.ListenPacket("unixgram", path)
+	require.Nil(t, err)
+	defer pc.Close()
+
+	w := NewUnixWriter(path)
+	defer w.Close()
+	w.Write([]byte("line one\n"))
+	w.Write([]byte("line two\n"))
+
+	buf := make([]byte, 1024)
+	pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, expected := range []string{"line one\n", "line two\n"} {
+		n, _, err := pc.ReadFrom(buf)
+		require.Nil(t, err)
+		assert.Equal(t, expected, string(buf[:n]))
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type receiverStringer struct{ s string }
+
+func (r *receiverStringer) String() string { return r.s }
+
+func TestValueString(t *testing.T) {
+	var nilStringer *receiverStringer
+	str := "ptr"
+	var nilStr *string
+	tests := []struct {
+		value    interface{}
+		expected string
+	}{
+		{"plain", "plain"},
+		{&str, "ptr"},
+		{nilStr, "<nil>"},
+		{&receiverStringer{"set"}, "set"},
+		{nilStringer, "<nil>"},
+		{errors.New("failed"), "failed"},
+		{[]byte("bytes"), "bytes"},
+		{time.Second, "1s"},
+		{RawLogString("raw"), "raw"},
+		{Lazy(func() interface{} { return nilStringer }), "<nil>"},
+		{42, "42"},
+		{nil, "<nil>"},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.expected, valueString(test.value), "%#v", test.value)
+	}
+}
+
+func TestHashedNilStringer(t *testing.T) {
+	var nilStringer *receiverStringer
+	cf := New(WithHashedKeys([]byte("key"), "user"))
+	assert.NotPanics(t, func() {
+		cf.format(new(bytes.Buffer), &Record{Data: map[string]interface{}{"user": nilStringer}})
+	})
+}
@@ -0,0 +1,143 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// VerbosityConfig represents a configuration function to be passed to
+// NewVerbosityToggle.
+type VerbosityConfig func(v *VerbosityToggle)
+
+// VerbosityRevertAfter sets how long a changed level lasts before the
+// original level is restored.  Each change restarts the period.  The
+// default is 15 minutes; 0 keeps the changed level until it's changed back.
+func VerbosityRevertAfter(d time.Duration) VerbosityConfig {
+	return func(v *VerbosityToggle) {
+		v.revertAfter = d
+	}
+}
+
+// VerbosityToggle temporarily changes the level of a logger when the
+// process receives a signal, for debugging a live problem without a
+// redeploy.  SIGUSR1 makes the logger one level more verbose, eg. from info
+// to debug, and SIGUSR2 one level less verbose.  The original level is
+// restored after the period set by VerbosityRevertAfter.
+//
+// eg.
+//
+//	v := kvlog.NewVerbosityToggle(logrus.StandardLogger())
+//	defer v.Close()
+//
+// then
+//
+//	kill -USR1 <pid>
+//
+// Signals aren't supported on Windows or Plan 9, where the level can only
+// be changed by calling Increase and Decrease.
+type VerbosityToggle struct {
+	logger      LevelSetter
+	revertAfter time.Duration
+
+	mu      sync.Mutex
+	base    log.Level
+	timer   *time.Timer
+	gen     int // incremented by each change, so a stale timer does nothing
+	closing chan struct{}
+	done    sync.WaitGroup
+	once    sync.Once
+}
+
+// NewVerbosityToggle creates a VerbosityToggle that changes the level of l,
+// treating its current level as the one to revert to, and starts listening
+// for signals.
+func NewVerbosityToggle(l LevelSetter, cfgs ...VerbosityConfig) *VerbosityToggle {
+	v := &VerbosityToggle{
+		logger:      l,
+		revertAfter: 15 * time.Minute,
+		base:        l.GetLevel(),
+		closing:     make(chan struct{}),
+	}
+	for _, cfg := range cfgs {
+		cfg(v)
+	}
+	v.handleSignals()
+	return v
+}
+
+// Increase makes the logger one level more verbose, if it isn't already
+// logging every level, returning the new level.
+func (v *VerbosityToggle) Increase() log.Level {
+	return v.step(1)
+}
+
+// Decrease makes the logger one level less verbose, if it isn't already
+// logging only panics, returning the new level.
+func (v *VerbosityToggle) Decrease() log.Level {
+	return v.step(-1)
+}
+
+func (v *VerbosityToggle) step(delta int) log.Level {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	level := int(v.logger.GetLevel()) + delta
+	if max := int(log.AllLevels[len(log.AllLevels)-1]); level > max {
+		level = max
+	}
+	if level < int(log.PanicLevel) {
+		level = int(log.PanicLevel)
+	}
+	v.logger.SetLevel(log.Level(level))
+
+	v.stopTimer()
+	if log.Level(level) != v.base && v.revertAfter > 0 {
+		gen := v.gen
+		v.timer = time.AfterFunc(v.revertAfter, func() { v.expire(gen) })
+	}
+	return log.Level(level)
+}
+
+// expire restores the original level if it hasn't been changed since the
+// timer for change gen was started.
+func (v *VerbosityToggle) expire(gen int) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if gen == v.gen {
+		v.stopTimer()
+		v.logger.SetLevel(v.base)
+	}
+}
+
+func (v *VerbosityToggle) stopTimer() {
+	v.gen++
+	if v.timer != nil {
+		v.timer.Stop()
+		v.timer = nil
+	}
+}
+
+// Revert restores the level the logger had when the VerbosityToggle was
+// created.
+func (v *VerbosityToggle) Revert() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.stopTimer()
+	v.logger.SetLevel(v.base)
+}
+
+// Close stops listening for signals and restores the logger's original
+// level.
+func (v *VerbosityToggle) Close() error {
+	v.once.Do(func() {
+		close(v.closing)
+	})
+	v.done.Wait()
+	v.Revert()
+	return nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+//go:build !windows && !plan9
+
+package kvlog
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// handleSignals increases the verbosity each time SIGUSR1 is received and
+// decreases it each time SIGUSR2 is received, until the toggle is closed.
+func (v *VerbosityToggle) handleSignals() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1, syscall.SIGUSR2)
+	v.done.Add(1)
+	go func() {
+		defer v.done.Done()
+		defer signal.Stop(ch)
+		for {
+			select {
+			case sig := <-ch:
+				if sig == syscall.SIGUSR1 {
+					v.Increase()
+				} else {
+					v.Decrease()
+				}
+			case <-v.closing:
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,11 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+//go:build windows || plan9
+
+package kvlog
+
+// handleSignals does nothing as SIGUSR1 and SIGUSR2 aren't supported on
+// this platform.
+func (v *VerbosityToggle) handleSignals() {}
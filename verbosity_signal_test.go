@@ -0,0 +1,41 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+//go:build !windows && !plan9
+
+package kvlog_test
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestVerbosityToggleSignals(t *testing.T) {
+	logger := log.New()
+	v := NewVerbosityToggle(logger)
+	defer v.Close()
+
+	waitLevel := func(level log.Level) {
+		deadline := time.Now().Add(5 * time.Second)
+		for logger.GetLevel() != level && time.Now().Before(deadline) {
+			time.Sleep(5 * time.Millisecond)
+		}
+		assert.Equal(t, level, logger.GetLevel())
+	}
+
+	require.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGUSR1))
+	waitLevel(log.DebugLevel)
+	require.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGUSR2))
+	waitLevel(log.InfoLevel)
+	require.Nil(t, syscall.Kill(os.Getpid(), syscall.SIGUSR2))
+	waitLevel(log.WarnLevel)
+}
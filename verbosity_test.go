@@ -0,0 +1,55 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+func TestVerbosityToggle(t *testing.T) {
+	logger := NewLogger(ioutil.Discard, nil)
+	v := NewVerbosityToggle(logger, VerbosityRevertAfter(0))
+	defer v.Close()
+
+	assert.Equal(t, log.DebugLevel, v.Increase())
+	assert.Equal(t, log.TraceLevel, v.Increase())
+	assert.Equal(t, log.TraceLevel, v.Increase())
+	assert.Equal(t, log.TraceLevel, logger.GetLevel())
+
+	v.Revert()
+	assert.Equal(t, log.InfoLevel, logger.GetLevel())
+	for i := 0; i < 6; i++ {
+		v.Decrease()
+	}
+	assert.Equal(t, log.PanicLevel, logger.GetLevel())
+
+	v.Close()
+	assert.Equal(t, log.InfoLevel, logger.GetLevel())
+}
+
+func TestVerbosityToggleRevert(t *testing.T) {
+	logger := log.New()
+	v := NewVerbosityToggle(logger, VerbosityRevertAfter(50*time.Millisecond))
+	defer v.Close()
+
+	v.Increase()
+	time.Sleep(30 * time.Millisecond)
+	v.Increase() // restarts the period
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, log.TraceLevel, logger.GetLevel())
+
+	deadline := time.Now().Add(5 * time.Second)
+	for logger.GetLevel() != log.InfoLevel && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	assert.Equal(t, log.InfoLevel, logger.GetLevel())
+}
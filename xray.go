@@ -0,0 +1,96 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	xrayContextKey contextKey = 1
+
+	// context key used by aws-lambda-go to hold the invocation's trace header
+	lambdaTraceKey = "x-amzn-trace-id"
+
+	// environment variable set by the Lambda runtime for each invocation
+	lambdaTraceEnv = "_X_AMZN_TRACE_ID"
+)
+
+// ContextWithXRayTraceID returns a copy of ctx holding an X-Ray trace
+// header, as received in an X-Amzn-Trace-Id HTTP header.  HTTPMiddleware
+// does this automatically for requests that include the header.
+func ContextWithXRayTraceID(ctx context.Context, header string) context.Context {
+	return context.WithValue(ctx, xrayContextKey, header)
+}
+
+// XRayTraceID returns the X-Ray trace ID for ctx, eg.
+// "1-5759e988-bd862e3fe1be46a994272793", or an empty string if none is
+// available.
+//
+// The trace header is taken from a value added by ContextWithXRayTraceID,
+// then from the value added to a Lambda handler's context by aws-lambda-go
+// and finally from the _X_AMZN_TRACE_ID environment variable set by the
+// Lambda runtime.  ctx may be nil.
+func XRayTraceID(ctx context.Context) string {
+	var header string
+	if ctx != nil {
+		header, _ = ctx.Value(xrayContextKey).(string)
+		if header == "" {
+			header, _ = ctx.Value(lambdaTraceKey).(string)
+		}
+	}
+	if header == "" {
+		header = os.Getenv(lambdaTraceEnv)
+	}
+	return xrayRoot(header)
+}
+
+// xrayRoot extracts the root trace ID from an X-Ray trace header of the form
+// "Root=1-...;Parent=...;Sampled=1".
+func xrayRoot(header string) string {
+	for _, part := range strings.Split(header, ";") {
+		part = strings.TrimSpace(part)
+		if strings.HasPrefix(part, "Root=") {
+			return part[len("Root="):]
+		}
+	}
+	if strings.HasPrefix(header, "1-") && !strings.Contains(header, ";") {
+		return header
+	}
+	return ""
+}
+
+// XRayHook is a logrus hook that adds the X-Ray trace ID to each entry as
+// an xray_trace_id field, allowing CloudWatch Logs Insights queries to be
+// correlated with X-Ray traces.
+//
+// The trace ID is found by calling XRayTraceID with the entry's context, so
+// entries should be logged using WithContext or FromContext where a request
+// context is available.  Entries for which no trace ID can be found are left
+// unchanged.
+type XRayHook struct{}
+
+// NewXRayHook creates an XRayHook, which should be registered with logrus
+// using AddHook.
+func NewXRayHook() *XRayHook {
+	return &XRayHook{}
+}
+
+// Levels implements the logrus.Hook interface.
+func (h *XRayHook) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements the logrus.Hook interface.
+func (h *XRayHook) Fire(entry *log.Entry) error {
+	if id := XRayTraceID(entry.Context); id != "" {
+		entry.Data["xray_trace_id"] = id
+	}
+	return nil
+}
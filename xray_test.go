@@ -0,0 +1,101 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	. "github.com/gwatts/kvlog"
+)
+
+const xrayHeader = "Root=1-5759e988-bd862e3fe1be46a994272793;Parent=53995c3f42cd8ad8;Sampled=1"
+
+func TestXRayTraceID(t *testing.T) {
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		env      string
+		expected string
+	}{
+		{
+			name:     "context",
+			ctx:      ContextWithXRayTraceID(context.Background(), xrayHeader),
+			expected: "1-5759e988-bd862e3fe1be46a994272793",
+		}, {
+			name:     "context-root-only",
+			ctx:      ContextWithXRayTraceID(context.Background(), "1-5759e988-bd862e3fe1be46a994272793"),
+			expected: "1-5759e988-bd862e3fe1be46a994272793",
+		}, {
+			name:     "lambda-context",
+			ctx:      context.WithValue(context.Background(), "x-amzn-trace-id", xrayHeader),
+			expected: "1-5759e988-bd862e3fe1be46a994272793",
+		}, {
+			name:     "env",
+			ctx:      context.Background(),
+			env:      "Root=1-58406520-a006649127e371903a2de979;Parent=4c721bf33e3caf8f;Sampled=0",
+			expected: "1-58406520-a006649127e371903a2de979",
+		}, {
+			name:     "context-overrides-env",
+			ctx:      ContextWithXRayTraceID(context.Background(), xrayHeader),
+			env:      "Root=1-58406520-a006649127e371903a2de979",
+			expected: "1-5759e988-bd862e3fe1be46a994272793",
+		}, {
+			name:     "nil-context",
+			env:      "Root=1-58406520-a006649127e371903a2de979",
+			expected: "1-58406520-a006649127e371903a2de979",
+		}, {
+			name:     "none",
+			ctx:      context.Background(),
+			expected: "",
+		}, {
+			name:     "malformed",
+			ctx:      ContextWithXRayTraceID(context.Background(), "Parent=53995c3f42cd8ad8"),
+			expected: "",
+		},
+	}
+
+	defer os.Unsetenv("_X_AMZN_TRACE_ID")
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			os.Setenv("_X_AMZN_TRACE_ID", test.env)
+			assert.Equal(t, test.expected, XRayTraceID(test.ctx))
+		})
+	}
+}
+
+func TestXRayHookMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	var buf bytes.Buffer
+	logger := &log.Logger{
+		Out:       &buf,
+		Formatter: New(),
+		Hooks:     make(log.LevelHooks),
+		Level:     log.InfoLevel,
+	}
+	logger.AddHook(NewXRayHook())
+
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		logger.WithContext(r.Context()).Info("handling")
+	}
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Amzn-Trace-Id", xrayHeader)
+	HTTPMiddleware(logger)(http.HandlerFunc(handler)).ServeHTTP(httptest.NewRecorder(), req)
+
+	dec := NewDecoder(&buf)
+	for i := 0; i < 2; i++ {
+		require.True(t, dec.Next())
+		assert.Equal("1-5759e988-bd862e3fe1be46a994272793", dec.Entry().Fields["xray_trace_id"])
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// ZerologWriter is an io.Writer that converts the JSON events written by a
+// zerolog Logger into k=v lines, so that programs using zerolog produce the
+// same output as those using logrus.
+//
+// eg.
+//
+//	logger := zerolog.New(kvlog.NewZerologWriter(kvlog.New(), os.Stderr))
+//
+// The event's time, level and message fields become the line's timestamp,
+// level and message; all other fields are rendered by the Formatter with the
+// usual constant field, primary field and sorting rules.  Nested objects are
+// flattened into dotted keys and arrays are rendered as quoted JSON.  Input
+// that isn't a JSON object is written through unchanged.
+type ZerologWriter struct {
+	cf  *Formatter
+	out io.Writer
+	mu  sync.Mutex
+}
+
+// NewZerologWriter creates a ZerologWriter that formats events using cf and
+// writes them to out.
+func NewZerologWriter(cf *Formatter, out io.Writer) *ZerologWriter {
+	return &ZerologWriter{cf: cf, out: out}
+}
+
+// Write implements io.Writer.  p should hold one or more complete
+// newline-terminated events, as written by zerolog.
+func (w *ZerologWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, line := range bytes.SplitAfter(p, []byte{'\n'}) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		entry, ok := zerologEntry(line)
+		if !ok {
+			if _, err := w.out.Write(line); err != nil {
+				return 0, err
+			}
+			continue
+		}
+		b, err := w.cf.Format(entry)
+		if err != nil {
+			return 0, err
+		}
+		if len(b) == 0 {
+			continue
+		}
+		if _, err := w.out.Write(b); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// zerologEntry converts a single zerolog JSON event into a log entry.
+func zerologEntry(line []byte) (*log.Entry, bool) {
+	dec := json.NewDecoder(bytes.NewReader(line))
+	dec.UseNumber()
+	var event map[string]interface{}
+	if err := dec.Decode(&event); err != nil {
+		return nil, false
+	}
+
+	entry := &log.Entry{
+		Time:  time.Now(),
+		Level: log.InfoLevel,
+		Data:  make(log.Fields, len(event)),
+	}
+	for k, v := range event {
+		switch k {
+		case "time":
+			if t, ok := zerologTime(v); ok {
+				entry.Time = t
+				continue
+			}
+		case "level":
+			if s, ok := v.(string); ok {
+				entry.Level = zerologLevel(s)
+				continue
+			}
+		case "message":
+			if s, ok := v.(string); ok {
+				entry.Message = s
+				continue
+			}
+		}
+		flattenJSON(entry.Data, k, v)
+	}
+	return entry, true
+}
+
+// flattenJSON adds a decoded JSON value to data, expanding objects into
+// dotted keys.
+func flattenJSON(data log.Fields, k string, v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for sk, sv := range v {
+			flattenJSON(data, k+"."+sk, sv)
+		}
+	case []interface{}:
+		b, _ := json.Marshal(v)
+		data[k] = string(b)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			data[k] = n
+		} else if f, err := v.Float64(); err == nil {
+			data[k] = f
+		} else {
+			data[k] = v.String()
+		}
+	default:
+		data[k] = v
+	}
+}
+
+func zerologLevel(s string) log.Level {
+	switch strings.ToLower(s) {
+	case "panic":
+		return log.PanicLevel
+	case "fatal":
+		return log.FatalLevel
+	case "error":
+		return log.ErrorLevel
+	case "warn", "warning":
+		return log.WarnLevel
+	case "debug", "trace":
+		return log.DebugLevel
+	}
+	return log.InfoLevel
+}
+
+// zerologTime parses an event timestamp, which zerolog may write either as
+// an RFC3339 string or as a Unix time in seconds, milliseconds or
+// microseconds depending on its TimeFieldFormat.
+func zerologTime(v interface{}) (time.Time, bool) {
+	switch v := v.(type) {
+	case string:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		return t, err == nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			switch {
+			case n > 1e15:
+				return time.Unix(0, n*int64(time.Microsecond)), true
+			case n > 1e12:
+				return time.Unix(0, n*int64(time.Millisecond)), true
+			}
+			return time.Unix(n, 0), true
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return time.Time{}, false
+		}
+		sec, frac := math.Modf(f)
+		return time.Unix(int64(sec), int64(math.Floor(frac*1e9+0.5))), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,44 @@
+// Copyright 2017 Gareth Watts
+// Licensed under an MIT license
+// See the LICENSE file for details
+
+package kvlog_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	. "github.com/gwatts/kvlog"
+)
+
+var zerologTests = []struct {
+	name     string
+	input    string
+	expected string
+}{
+	{"simple",
+		`{"level":"warn","time":"2017-02-13T12:13:45Z","status":"ok","count":3,"ratio":0.5,"message":"test message"}` + "\n",
+		`2017-02-13T12:13:45.000Z ll="warning" commit="abcd" status="ok" count=3 ratio=0.5 _msg="test message"` + "\n"},
+	{"nested",
+		`{"level":"trace","time":1486988025123,"req":{"id":"x1","size":10},"tags":["a","b"]}` + "\n",
+		`2017-02-13T12:13:45.123Z ll="debug" commit="abcd" req.id="x1" req.size=10 tags="[\"a\",\"b\"]"` + "\n"},
+	{"multiple",
+		`{"level":"info","time":"2017-02-13T12:13:45Z"}` + "\n" + `{"level":"error","time":"2017-02-13T12:13:45Z"}` + "\n",
+		`2017-02-13T12:13:45.000Z ll="info" commit="abcd"` + "\n" + `2017-02-13T12:13:45.000Z ll="error" commit="abcd"` + "\n"},
+	{"not-json", "plain text\n", "plain text\n"},
+}
+
+func TestZerologWriter(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, test := range zerologTests {
+		var buf bytes.Buffer
+		w := NewZerologWriter(New(WithConstantField("commit", "abcd"), WithPrimaryFields("status")), &buf)
+		n, err := w.Write([]byte(test.input))
+		assert.Nil(err, test.name+" should not error")
+		assert.Equal(len(test.input), n)
+		assert.Equal(test.expected, buf.String(), test.name+" should match")
+	}
+}